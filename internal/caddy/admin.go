@@ -0,0 +1,269 @@
+package caddy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/yoanbernabeu/frankendeploy/internal/config"
+)
+
+// adminBaseURL is the base URL of admin API requests. The host is ignored:
+// requests always go through the dialer, and Caddy does not enforce the
+// Host header on unix sockets.
+const adminBaseURL = "http://caddy-admin"
+
+// serverPath is the config path of the HTTP server holding the app routes
+const serverPath = "/config/apps/http/servers/" + apiServerName
+
+// DialFunc opens a connection to the Caddy admin API
+type DialFunc func(ctx context.Context) (net.Conn, error)
+
+// AdminClient talks to the Caddy admin API of a server in API mode. Each
+// app is updated through its own route, so other apps are never
+// reprovisioned.
+type AdminClient struct {
+	http *http.Client
+}
+
+// NewAdminClient creates an admin API client using dial for every
+// connection (typically a unix socket tunnelled through SSH)
+func NewAdminClient(dial DialFunc) *AdminClient {
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return dial(ctx)
+		},
+	}
+	return &AdminClient{http: &http.Client{Transport: transport, Timeout: 30 * time.Second}}
+}
+
+// APIError is an error response of the admin API
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("caddy admin API: %s (HTTP %d)", e.Message, e.StatusCode)
+}
+
+// isNotFound reports whether err is a 404 of the admin API
+func isNotFound(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound
+}
+
+// Config returns the live JSON config at path ("" for the whole config)
+func (a *AdminClient) Config(ctx context.Context, path string) (json.RawMessage, error) {
+	return a.do(ctx, http.MethodGet, "/config/"+strings.TrimPrefix(path, "/"), nil)
+}
+
+// Route returns the live route of an app, or nil when Caddy has none
+func (a *AdminClient) Route(ctx context.Context, appName string) (json.RawMessage, error) {
+	route, err := a.do(ctx, http.MethodGet, "/id/"+RouteID(appName), nil)
+	if isNotFound(err) {
+		return nil, nil
+	}
+	return route, err
+}
+
+// ApplyRoute creates or replaces the route of an app, along with its
+// access logger. Caddy provisions the new route before swapping it in: an
+// invalid route is rejected and the live one keeps serving.
+func (a *AdminClient) ApplyRoute(ctx context.Context, appName string, route []byte) error {
+	hosts, err := routeHosts(route)
+	if err != nil {
+		return err
+	}
+
+	logger, err := json.Marshal(appLogConfig(appName))
+	if err != nil {
+		return err
+	}
+	if _, err := a.do(ctx, http.MethodPost, "/config/logging/logs/"+RouteID(appName), logger); err != nil {
+		return fmt.Errorf("failed to configure access log: %w", err)
+	}
+	for _, host := range hosts {
+		names, _ := json.Marshal([]string{RouteID(appName)})
+		if _, err := a.do(ctx, http.MethodPost, serverPath+"/logs/logger_names/"+url.PathEscape(host), names); err != nil {
+			return fmt.Errorf("failed to configure access log: %w", err)
+		}
+	}
+
+	existing, err := a.Route(ctx, appName)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		_, err = a.do(ctx, http.MethodPatch, "/id/"+RouteID(appName), route)
+	} else {
+		_, err = a.do(ctx, http.MethodPost, serverPath+"/routes", route)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to apply route: %w", err)
+	}
+	return nil
+}
+
+// tlsPolicyID and tlsCertID are the @id of the TLS settings of an app:
+// an automation policy (internal CA) or a loaded certificate (custom).
+func tlsPolicyID(appName string) string { return RouteID(appName) + "-tls-policy" }
+func tlsCertID(appName string) string   { return RouteID(appName) + "-tls-cert" }
+
+// ApplyTLS configures how the certificate of an app is obtained (one of the
+// config.TLSMode* values, "" meaning ACME) and removes the settings of the
+// other modes. In custom mode the certificate files must be uploaded first
+// (see CertUploadCommands): they are reloaded even when their paths are
+// unchanged, so a renewed certificate is picked up.
+func (a *AdminClient) ApplyTLS(ctx context.Context, appName, domain, mode string) error {
+	var stale []string
+	switch mode {
+	case "", config.TLSModeACME:
+		stale = []string{tlsPolicyID(appName), tlsCertID(appName)}
+	case config.TLSModeInternal:
+		// Policies with subjects must come before the catch-all ACME policy
+		policy, _ := json.Marshal(object{
+			"@id":      tlsPolicyID(appName),
+			"subjects": []string{domain},
+			"issuers":  []any{object{"module": "internal"}},
+		})
+		if err := a.upsert(ctx, tlsPolicyID(appName), "/config/apps/tls/automation/policies/0", http.MethodPut, policy); err != nil {
+			return fmt.Errorf("failed to configure internal TLS: %w", err)
+		}
+		stale = []string{tlsCertID(appName)}
+	case config.TLSModeCustom:
+		cert, key := CertPaths(appName)
+		entry := object{"@id": tlsCertID(appName), "certificate": cert, "key": key}
+		body, _ := json.Marshal(entry)
+		if err := a.upsertCert(ctx, appName, body); err != nil {
+			return fmt.Errorf("failed to load custom certificate: %w", err)
+		}
+		stale = []string{tlsPolicyID(appName)}
+	case config.TLSModeOnDemand:
+		return errOnDemandAPI
+	default:
+		return fmt.Errorf("invalid TLS mode %q", mode)
+	}
+
+	for _, id := range stale {
+		if _, err := a.do(ctx, http.MethodDelete, "/id/"+id, nil); err != nil && !isNotFound(err) {
+			return fmt.Errorf("failed to remove TLS settings: %w", err)
+		}
+	}
+	return nil
+}
+
+// upsert patches the object with the given @id, or creates it at path
+func (a *AdminClient) upsert(ctx context.Context, id, path, method string, body []byte) error {
+	_, err := a.do(ctx, http.MethodPatch, "/id/"+id, body)
+	if isNotFound(err) {
+		_, err = a.do(ctx, method, path, body)
+	}
+	return err
+}
+
+// upsertCert loads the custom certificate of an app, forcing a reload so
+// files replaced in place are read again
+func (a *AdminClient) upsertCert(ctx context.Context, appName string, entry []byte) error {
+	_, err := a.request(ctx, http.MethodPatch, "/id/"+tlsCertID(appName), entry, true)
+	if !isNotFound(err) {
+		return err
+	}
+	// PUT creates the missing parents but refuses an existing list, which
+	// then gets the entry appended
+	_, err = a.do(ctx, http.MethodPut, "/config/apps/tls/certificates/load_files", append(append([]byte("["), entry...), ']'))
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusConflict {
+		_, err = a.do(ctx, http.MethodPost, "/config/apps/tls/certificates/load_files", entry)
+	}
+	return err
+}
+
+// RemoveRoute deletes the route of an app, its access logger and its TLS
+// settings. A missing route is not an error.
+func (a *AdminClient) RemoveRoute(ctx context.Context, appName string) error {
+	route, err := a.Route(ctx, appName)
+	if err != nil {
+		return err
+	}
+	if route != nil {
+		hosts, _ := routeHosts(route)
+		if _, err := a.do(ctx, http.MethodDelete, "/id/"+RouteID(appName), nil); err != nil && !isNotFound(err) {
+			return fmt.Errorf("failed to remove route: %w", err)
+		}
+		for _, host := range hosts {
+			if _, err := a.do(ctx, http.MethodDelete, serverPath+"/logs/logger_names/"+url.PathEscape(host), nil); err != nil && !isNotFound(err) {
+				return fmt.Errorf("failed to remove access log: %w", err)
+			}
+		}
+	}
+	if _, err := a.do(ctx, http.MethodDelete, "/config/logging/logs/"+RouteID(appName), nil); err != nil && !isNotFound(err) {
+		return fmt.Errorf("failed to remove access log: %w", err)
+	}
+	return a.ApplyTLS(ctx, appName, "", config.TLSModeACME)
+}
+
+// do sends a request to the admin API and returns the response body
+func (a *AdminClient) do(ctx context.Context, method, path string, body []byte) (json.RawMessage, error) {
+	return a.request(ctx, method, path, body, false)
+}
+
+// request sends a request to the admin API. With force, Caddy reloads even
+// if the config is unchanged.
+func (a *AdminClient) request(ctx context.Context, method, path string, body []byte, force bool) (json.RawMessage, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, adminBaseURL+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if force {
+		req.Header.Set("Cache-Control", "must-revalidate")
+	}
+
+	resp, err := a.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("caddy admin API unreachable: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read admin API response: %w", err)
+	}
+	if resp.StatusCode >= 300 {
+		var apiErr struct {
+			Error string `json:"error"`
+		}
+		msg := strings.TrimSpace(string(data))
+		if json.Unmarshal(data, &apiErr) == nil && apiErr.Error != "" {
+			msg = apiErr.Error
+		}
+		return nil, &APIError{StatusCode: resp.StatusCode, Message: msg}
+	}
+	return data, nil
+}
+
+// RoutesEqual reports whether two JSON routes are semantically equal
+// (formatting and key order are ignored)
+func RoutesEqual(a, b []byte) bool {
+	var va, vb any
+	if json.Unmarshal(a, &va) != nil || json.Unmarshal(b, &vb) != nil {
+		return false
+	}
+	return reflect.DeepEqual(va, vb)
+}
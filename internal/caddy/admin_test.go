@@ -0,0 +1,242 @@
+package caddy
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/yoanbernabeu/frankendeploy/internal/config"
+)
+
+// fakeAdmin is a minimal Caddy admin API keeping routes by @id
+type fakeAdmin struct {
+	mu       sync.Mutex
+	routes   map[string]string
+	requests []string
+	// reject makes route writes fail like a provisioning error
+	reject bool
+	// loadFiles reports whether apps.tls.certificates.load_files exists
+	loadFiles bool
+	// forced lists the requests sent with Cache-Control: must-revalidate
+	forced []string
+}
+
+func (f *fakeAdmin) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests = append(f.requests, r.Method+" "+r.URL.Path)
+	body, _ := io.ReadAll(r.Body)
+	if r.Header.Get("Cache-Control") == "must-revalidate" {
+		f.forced = append(f.forced, r.Method+" "+r.URL.Path)
+	}
+	store := func(body []byte) {
+		var meta struct {
+			ID string `json:"@id"`
+		}
+		_ = json.Unmarshal(body, &meta)
+		f.routes[meta.ID] = string(body)
+	}
+
+	fail := func(status int, msg string) {
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(map[string]string{"error": msg})
+	}
+
+	switch {
+	case strings.HasPrefix(r.URL.Path, "/id/"):
+		id := strings.TrimPrefix(r.URL.Path, "/id/")
+		route, ok := f.routes[id]
+		if !ok {
+			fail(http.StatusNotFound, "unknown object ID '"+id+"'")
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			_, _ = io.WriteString(w, route)
+		case http.MethodPatch:
+			if f.reject {
+				fail(http.StatusBadRequest, "loading new config: provision error")
+				return
+			}
+			f.routes[id] = string(body)
+		case http.MethodDelete:
+			delete(f.routes, id)
+		}
+	case r.URL.Path == serverPath+"/routes" && r.Method == http.MethodPost:
+		if f.reject {
+			fail(http.StatusBadRequest, "loading new config: provision error")
+			return
+		}
+		store(body)
+	case r.URL.Path == "/config/apps/tls/automation/policies/0" && r.Method == http.MethodPut:
+		store(body)
+	case r.URL.Path == "/config/apps/tls/certificates/load_files":
+		switch {
+		case r.Method == http.MethodPut && f.loadFiles:
+			fail(http.StatusConflict, "key already exists: load_files")
+		case r.Method == http.MethodPut:
+			var entries []json.RawMessage
+			_ = json.Unmarshal(body, &entries)
+			store(entries[0])
+			f.loadFiles = true
+		case r.Method == http.MethodPost:
+			store(body)
+		}
+	}
+}
+
+func newTestAdmin(t *testing.T, fake *fakeAdmin) *AdminClient {
+	t.Helper()
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+	return NewAdminClient(func(ctx context.Context) (net.Conn, error) {
+		var d net.Dialer
+		return d.DialContext(ctx, "tcp", srv.Listener.Addr().String())
+	})
+}
+
+func TestAdminClient_ApplyRouteCreatesThenPatches(t *testing.T) {
+	fake := &fakeAdmin{routes: map[string]string{}}
+	admin := newTestAdmin(t, fake)
+	ctx := context.Background()
+
+	v1 := []byte(`{"@id":"frankendeploy-myapp","match":[{"host":["example.com"]}],"terminal":true}`)
+	if err := admin.ApplyRoute(ctx, "myapp", v1); err != nil {
+		t.Fatalf("first apply: %v", err)
+	}
+	v2 := []byte(`{"@id":"frankendeploy-myapp","match":[{"host":["example.com"]}]}`)
+	if err := admin.ApplyRoute(ctx, "myapp", v2); err != nil {
+		t.Fatalf("second apply: %v", err)
+	}
+
+	joined := strings.Join(fake.requests, "\n")
+	for _, want := range []string{
+		"POST /config/logging/logs/frankendeploy-myapp",
+		"POST " + serverPath + "/logs/logger_names/example.com",
+		"POST " + serverPath + "/routes",
+		"PATCH /id/frankendeploy-myapp",
+	} {
+		if !strings.Contains(joined, want) {
+			t.Errorf("missing request %q in:\n%s", want, joined)
+		}
+	}
+	if strings.Count(joined, "POST "+serverPath+"/routes") != 1 {
+		t.Errorf("route should be appended once, then patched:\n%s", joined)
+	}
+
+	live, err := admin.Route(ctx, "myapp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !RoutesEqual(live, v2) {
+		t.Errorf("live route = %s, want %s", live, v2)
+	}
+}
+
+func TestAdminClient_ApplyRouteSurfacesCaddyError(t *testing.T) {
+	fake := &fakeAdmin{routes: map[string]string{}, reject: true}
+	admin := newTestAdmin(t, fake)
+
+	err := admin.ApplyRoute(context.Background(), "myapp", []byte(`{"@id":"frankendeploy-myapp"}`))
+	if err == nil || !strings.Contains(err.Error(), "provision error") {
+		t.Fatalf("expected Caddy's error message, got: %v", err)
+	}
+}
+
+func TestAdminClient_RouteMissing(t *testing.T) {
+	admin := newTestAdmin(t, &fakeAdmin{routes: map[string]string{}})
+
+	route, err := admin.Route(context.Background(), "ghost")
+	if err != nil || route != nil {
+		t.Errorf("Route() = %s, %v; want nil, nil", route, err)
+	}
+}
+
+func TestAdminClient_RemoveRoute(t *testing.T) {
+	fake := &fakeAdmin{routes: map[string]string{
+		"frankendeploy-myapp": `{"@id":"frankendeploy-myapp","match":[{"host":["example.com"]}]}`,
+	}}
+	admin := newTestAdmin(t, fake)
+
+	if err := admin.RemoveRoute(context.Background(), "myapp"); err != nil {
+		t.Fatalf("RemoveRoute: %v", err)
+	}
+	if _, ok := fake.routes["frankendeploy-myapp"]; ok {
+		t.Error("route should be deleted")
+	}
+	joined := strings.Join(fake.requests, "\n")
+	if !strings.Contains(joined, "DELETE "+serverPath+"/logs/logger_names/example.com") {
+		t.Errorf("logger name of the domain should be deleted:\n%s", joined)
+	}
+
+	// Removing again is a no-op
+	if err := admin.RemoveRoute(context.Background(), "myapp"); err != nil {
+		t.Errorf("second RemoveRoute: %v", err)
+	}
+}
+
+func TestRoutesEqual(t *testing.T) {
+	a := []byte(`{"a":1,"b":[1,2]}`)
+	b := []byte("{\n  \"b\": [1, 2],\n  \"a\": 1\n}\n")
+	if !RoutesEqual(a, b) {
+		t.Error("formatting and key order should be ignored")
+	}
+	if RoutesEqual(a, []byte(`{"a":2,"b":[1,2]}`)) {
+		t.Error("different values should not be equal")
+	}
+}
+
+func TestAdminClient_ApplyTLS(t *testing.T) {
+	fake := &fakeAdmin{routes: map[string]string{}}
+	admin := newTestAdmin(t, fake)
+	ctx := context.Background()
+
+	if err := admin.ApplyTLS(ctx, "myapp", "staging.internal", config.TLSModeInternal); err != nil {
+		t.Fatalf("ApplyTLS internal: %v", err)
+	}
+	policy := fake.routes["frankendeploy-myapp-tls-policy"]
+	if !strings.Contains(policy, `"subjects":["staging.internal"]`) || !strings.Contains(policy, `"module":"internal"`) {
+		t.Errorf("expected an internal issuer policy for the domain, got %s", policy)
+	}
+
+	// Switching to custom loads the certificate and drops the policy
+	if err := admin.ApplyTLS(ctx, "myapp", "staging.internal", config.TLSModeCustom); err != nil {
+		t.Fatalf("ApplyTLS custom: %v", err)
+	}
+	if _, ok := fake.routes["frankendeploy-myapp-tls-policy"]; ok {
+		t.Error("internal policy should be removed in custom mode")
+	}
+	if cert := fake.routes["frankendeploy-myapp-tls-cert"]; !strings.Contains(cert, "/config/caddy/certs/myapp/key.pem") {
+		t.Errorf("expected the certificate files to be loaded, got %q", cert)
+	}
+
+	// A second app appends to the existing load_files list
+	if err := admin.ApplyTLS(ctx, "other", "other.internal", config.TLSModeCustom); err != nil {
+		t.Fatalf("ApplyTLS custom (second app): %v", err)
+	}
+	if _, ok := fake.routes["frankendeploy-other-tls-cert"]; !ok {
+		t.Error("second certificate should be appended to load_files")
+	}
+
+	// Redeploying forces a reload so a renewed certificate is read again
+	if err := admin.ApplyTLS(ctx, "myapp", "staging.internal", config.TLSModeCustom); err != nil {
+		t.Fatalf("ApplyTLS custom (redeploy): %v", err)
+	}
+	if !strings.Contains(strings.Join(fake.forced, "\n"), "PATCH /id/frankendeploy-myapp-tls-cert") {
+		t.Errorf("certificate update should force a reload, got %v", fake.forced)
+	}
+
+	// Back to ACME removes everything
+	if err := admin.ApplyTLS(ctx, "myapp", "staging.internal", ""); err != nil {
+		t.Fatalf("ApplyTLS acme: %v", err)
+	}
+	if _, ok := fake.routes["frankendeploy-myapp-tls-cert"]; ok {
+		t.Error("custom certificate should be unloaded in ACME mode")
+	}
+}
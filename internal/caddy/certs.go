@@ -0,0 +1,209 @@
+package caddy
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/yoanbernabeu/frankendeploy/internal/security"
+)
+
+// Certificate locations inside the caddy container. Custom certificates
+// live in the config volume (mounted in both Caddy modes), away from the
+// certificates Caddy manages itself in the data volume.
+const (
+	containerCertsDir = "/config/caddy/certs"
+	managedCertsDir   = "/data/caddy/certificates"
+	// internalIssuerDir is the storage dir of Caddy's internal CA
+	internalIssuerDir = "local"
+	certDumpSeparator = "==> "
+)
+
+// Certificate sources reported by ParseCertDump
+const (
+	CertSourceACME     = "acme"
+	CertSourceInternal = "internal"
+	CertSourceCustom   = "custom"
+)
+
+// CertPaths returns the container paths of the custom certificate and key
+// of an app
+func CertPaths(appName string) (cert, key string) {
+	dir := containerCertsDir + "/" + appName
+	return dir + "/cert.pem", dir + "/key.pem"
+}
+
+// CertUploadCommands returns the SSH commands writing the custom
+// certificate and key of an app, in that order. Each one reads the file
+// from stdin, so the key never appears in a command line or a heredoc, and
+// writes it owner-only before renaming it in place.
+func CertUploadCommands(appName string) ([]string, error) {
+	if err := security.ValidateAppName(appName); err != nil {
+		return nil, err
+	}
+	cert, key := CertPaths(appName)
+	commands := make([]string, 0, 2)
+	for _, path := range []string{cert, key} {
+		commands = append(commands, fmt.Sprintf(
+			"docker exec -i caddy sh -c 'umask 077 && mkdir -p %[1]s/%[2]s && cat > %[3]s.tmp && mv -f %[3]s.tmp %[3]s'",
+			containerCertsDir, appName, path))
+	}
+	return commands, nil
+}
+
+// RemoveCertsCommand returns the SSH command deleting the custom
+// certificate of an app
+func RemoveCertsCommand(appName string) string {
+	return fmt.Sprintf("docker exec caddy rm -rf %s/%s", containerCertsDir, appName)
+}
+
+// ValidateCertificate checks a PEM certificate chain and key before upload:
+// the key must match the certificate, which must cover domain and not be
+// expired. It returns the leaf certificate.
+func ValidateCertificate(certPEM, keyPEM []byte, domain string) (*x509.Certificate, error) {
+	pair, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("invalid certificate or key: %w", err)
+	}
+	leaf, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid certificate: %w", err)
+	}
+	if err := leaf.VerifyHostname(domain); err != nil {
+		return nil, fmt.Errorf("certificate does not cover %s (SANs: %s)", domain, strings.Join(leaf.DNSNames, ", "))
+	}
+	if time.Now().After(leaf.NotAfter) {
+		return nil, fmt.Errorf("certificate expired on %s", leaf.NotAfter.Format("2006-01-02"))
+	}
+	return leaf, nil
+}
+
+// CertInfo describes a certificate found in the caddy container
+type CertInfo struct {
+	Path      string    `json:"path"`
+	Source    string    `json:"source"`
+	Issuer    string    `json:"issuer"`
+	NotBefore time.Time `json:"not_before"`
+	NotAfter  time.Time `json:"not_after"`
+	DNSNames  []string  `json:"dns_names"`
+
+	leaf *x509.Certificate
+}
+
+// CertDumpCommand returns the SSH command printing every certificate of
+// the caddy container, each preceded by a "==> <path>" line: the ones
+// Caddy manages (ACME and internal CA) and the custom ones.
+func CertDumpCommand() string {
+	return fmt.Sprintf(`docker exec caddy sh -c 'find %s %s -type f \( -name "*.crt" -o -name cert.pem \) 2>/dev/null | sort | while read -r f; do echo "%s$f"; cat "$f"; done'`,
+		managedCertsDir, containerCertsDir, certDumpSeparator)
+}
+
+// ParseCertDump parses the output of CertDumpCommand. Files that do not
+// hold a certificate are skipped.
+func ParseCertDump(out string) []CertInfo {
+	var certs []CertInfo
+	for _, section := range strings.Split(out, "\n"+certDumpSeparator) {
+		section = strings.TrimPrefix(section, certDumpSeparator)
+		path, content, ok := strings.Cut(section, "\n")
+		if !ok {
+			continue
+		}
+		// The leaf comes first in a chain
+		block, _ := pem.Decode([]byte(content))
+		if block == nil || block.Type != "CERTIFICATE" {
+			continue
+		}
+		leaf, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			continue
+		}
+		issuer := leaf.Issuer.CommonName
+		if issuer == "" && len(leaf.Issuer.Organization) > 0 {
+			issuer = leaf.Issuer.Organization[0]
+		}
+		certs = append(certs, CertInfo{
+			Path:      strings.TrimSpace(path),
+			Source:    certSource(strings.TrimSpace(path)),
+			Issuer:    issuer,
+			NotBefore: leaf.NotBefore,
+			NotAfter:  leaf.NotAfter,
+			DNSNames:  leaf.DNSNames,
+			leaf:      leaf,
+		})
+	}
+	return certs
+}
+
+// certSource derives the source of a certificate from its storage path:
+// certificates/<issuer>/<domain>/<domain>.crt or certs/<app>/cert.pem
+func certSource(path string) string {
+	if strings.HasPrefix(path, containerCertsDir+"/") {
+		return CertSourceCustom
+	}
+	issuer, _, _ := strings.Cut(strings.TrimPrefix(path, managedCertsDir+"/"), "/")
+	if issuer == internalIssuerDir {
+		return CertSourceInternal
+	}
+	return CertSourceACME
+}
+
+// MatchCertificate returns the certificate served for host by an app: its
+// custom certificate when it has one, else the managed certificate
+// covering host that expires last. Returns nil when none matches.
+func MatchCertificate(certs []CertInfo, appName, host string) *CertInfo {
+	customCert, _ := CertPaths(appName)
+	var candidates []*CertInfo
+	for i := range certs {
+		c := &certs[i]
+		if c.leaf == nil || c.leaf.VerifyHostname(host) != nil {
+			continue
+		}
+		if c.Path == customCert {
+			return c
+		}
+		if c.Source != CertSourceCustom {
+			candidates = append(candidates, c)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].NotAfter.After(candidates[j].NotAfter)
+	})
+	return candidates[0]
+}
+
+// DomainCert is the certificate Caddy obtained for a domain
+type DomainCert struct {
+	Domain string `json:"domain"`
+	CertInfo
+}
+
+// IssuedCertificates returns the certificates Caddy obtained itself (ACME
+// or internal CA) by domain, sorted by domain. When a domain has several
+// (e.g. after an issuer change), the one expiring last is kept.
+func IssuedCertificates(certs []CertInfo) []DomainCert {
+	byDomain := make(map[string]CertInfo)
+	for _, c := range certs {
+		if c.Source == CertSourceCustom {
+			continue
+		}
+		for _, name := range c.DNSNames {
+			if existing, ok := byDomain[name]; !ok || c.NotAfter.After(existing.NotAfter) {
+				byDomain[name] = c
+			}
+		}
+	}
+
+	issued := make([]DomainCert, 0, len(byDomain))
+	for domain, c := range byDomain {
+		issued = append(issued, DomainCert{Domain: domain, CertInfo: c})
+	}
+	sort.Slice(issued, func(i, j int) bool { return issued[i].Domain < issued[j].Domain })
+	return issued
+}
@@ -0,0 +1,218 @@
+package caddy
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testCert returns a self-signed PEM certificate and key for names
+func testCert(t *testing.T, issuer string, notAfter time.Time, names ...string) (certPEM, keyPEM []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: issuer},
+		DNSNames:     names,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func TestValidateCertificate(t *testing.T) {
+	valid := time.Now().Add(90 * 24 * time.Hour)
+	certPEM, keyPEM := testCert(t, "Corp CA", valid, "app.corp.example", "*.corp.example")
+	_, otherKey := testCert(t, "Corp CA", valid, "app.corp.example")
+	expiredCert, expiredKey := testCert(t, "Corp CA", time.Now().Add(-time.Minute), "app.corp.example")
+
+	if _, err := ValidateCertificate(certPEM, keyPEM, "app.corp.example"); err != nil {
+		t.Errorf("valid certificate rejected: %v", err)
+	}
+	if _, err := ValidateCertificate(certPEM, keyPEM, "api.corp.example"); err != nil {
+		t.Errorf("wildcard SAN should cover api.corp.example: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		cert, key []byte
+		domain    string
+		wantErr   string
+	}{
+		{"key mismatch", certPEM, otherKey, "app.corp.example", "invalid certificate or key"},
+		{"wrong domain", certPEM, keyPEM, "example.com", "does not cover example.com"},
+		{"expired", expiredCert, expiredKey, "app.corp.example", "expired"},
+		{"not PEM", []byte("nope"), keyPEM, "app.corp.example", "invalid certificate or key"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ValidateCertificate(tt.cert, tt.key, tt.domain)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestParseCertDumpAndMatch(t *testing.T) {
+	soon := time.Now().Add(30 * 24 * time.Hour)
+	later := time.Now().Add(60 * 24 * time.Hour)
+	oldACME, _ := testCert(t, "R10", soon, "shop.example.com")
+	newACME, _ := testCert(t, "R11", later, "shop.example.com")
+	internal, _ := testCert(t, "Caddy Local Authority", later, "staging.internal")
+	custom, _ := testCert(t, "Corp CA", soon, "shop.example.com")
+
+	dump := strings.Join([]string{
+		"==> " + managedCertsDir + "/acme-v02.api.letsencrypt.org-directory/shop.example.com/shop.example.com.crt",
+		string(oldACME),
+		"==> " + managedCertsDir + "/acme.zerossl.com-v2-dv90/shop.example.com/shop.example.com.crt",
+		string(newACME),
+		"==> " + managedCertsDir + "/local/staging.internal/staging.internal.crt",
+		string(internal),
+		"==> " + containerCertsDir + "/corp/cert.pem",
+		string(custom),
+		"==> " + containerCertsDir + "/broken/cert.pem",
+		"garbage",
+	}, "\n")
+
+	certs := ParseCertDump(dump)
+	if len(certs) != 4 {
+		t.Fatalf("expected 4 certificates (garbage skipped), got %d", len(certs))
+	}
+
+	got := MatchCertificate(certs, "shop", "shop.example.com")
+	if got == nil || got.Issuer != "R11" || got.Source != CertSourceACME {
+		t.Errorf("expected the latest ACME certificate, got %+v", got)
+	}
+	// Another app's custom certificate is never reported for this app
+	if got != nil && got.Path == containerCertsDir+"/corp/cert.pem" {
+		t.Error("custom certificate of another app matched")
+	}
+
+	got = MatchCertificate(certs, "corp", "shop.example.com")
+	if got == nil || got.Source != CertSourceCustom || got.Issuer != "Corp CA" {
+		t.Errorf("expected the app's custom certificate, got %+v", got)
+	}
+
+	got = MatchCertificate(certs, "staging", "staging.internal")
+	if got == nil || got.Source != CertSourceInternal {
+		t.Errorf("expected the internal CA certificate, got %+v", got)
+	}
+
+	if got := MatchCertificate(certs, "shop", "unknown.example.com"); got != nil {
+		t.Errorf("expected no match, got %+v", got)
+	}
+}
+
+func TestCertUploadAndDumpCommands(t *testing.T) {
+	certsDir := t.TempDir()
+	managedDir := t.TempDir()
+	certPEM, keyPEM := testCert(t, "Corp CA", time.Now().Add(24*time.Hour), "app.corp.example")
+
+	// Fake docker: run the command locally instead of inside the container
+	bin := t.TempDir()
+	fake := "#!/bin/sh\nshift\n[ \"$1\" = -i ] && shift\nshift\nexec \"$@\"\n"
+	if err := os.WriteFile(filepath.Join(bin, "docker"), []byte(fake), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	run := func(command string, stdin []byte) string {
+		t.Helper()
+		command = strings.ReplaceAll(command, containerCertsDir, certsDir)
+		command = strings.ReplaceAll(command, managedCertsDir, managedDir)
+		cmd := exec.Command("sh", "-c", command)
+		cmd.Env = append(os.Environ(), "PATH="+bin+":"+os.Getenv("PATH"))
+		cmd.Stdin = strings.NewReader(string(stdin))
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("command failed: %v\n%s", err, out)
+		}
+		// Report container paths, as the real command does
+		return strings.ReplaceAll(string(out), certsDir, containerCertsDir)
+	}
+
+	commands, err := CertUploadCommands("corp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(commands) != 2 {
+		t.Fatalf("expected cert and key commands, got %v", commands)
+	}
+	run(commands[0], certPEM)
+	run(commands[1], keyPEM)
+
+	info, err := os.Stat(filepath.Join(certsDir, "corp", "key.pem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("key should be owner-only, got %v", info.Mode().Perm())
+	}
+	if leftovers, _ := filepath.Glob(filepath.Join(certsDir, "corp", "*.tmp")); len(leftovers) > 0 {
+		t.Errorf("temp files left behind: %v", leftovers)
+	}
+
+	certs := ParseCertDump(run(CertDumpCommand(), nil))
+	if len(certs) != 1 || certs[0].Source != CertSourceCustom {
+		t.Fatalf("expected the uploaded certificate in the dump, got %+v", certs)
+	}
+	if got := MatchCertificate(certs, "corp", "app.corp.example"); got == nil {
+		t.Error("uploaded certificate should match its domain")
+	}
+
+	if _, err := CertUploadCommands("../etc"); err == nil {
+		t.Error("expected an error for an invalid app name")
+	}
+}
+
+func TestIssuedCertificates(t *testing.T) {
+	soon := time.Now().Add(10 * 24 * time.Hour)
+	later := time.Now().Add(80 * 24 * time.Hour)
+	renewed, _ := testCert(t, "R11", later, "shop.customer.com")
+	stale, _ := testCert(t, "R10", soon, "shop.customer.com")
+	app, _ := testCert(t, "R11", later, "saas.example.com")
+	custom, _ := testCert(t, "Corp CA", later, "corp.example.com")
+
+	dump := strings.Join([]string{
+		"==> " + managedCertsDir + "/acme-v02.api.letsencrypt.org-directory/shop.customer.com/shop.customer.com.crt",
+		string(stale),
+		"==> " + managedCertsDir + "/acme.zerossl.com-v2-dv90/shop.customer.com/shop.customer.com.crt",
+		string(renewed),
+		"==> " + managedCertsDir + "/acme-v02.api.letsencrypt.org-directory/saas.example.com/saas.example.com.crt",
+		string(app),
+		"==> " + containerCertsDir + "/corp/cert.pem",
+		string(custom),
+	}, "\n")
+
+	issued := IssuedCertificates(ParseCertDump(dump))
+	if len(issued) != 2 {
+		t.Fatalf("expected 2 issued domains (custom excluded), got %+v", issued)
+	}
+	if issued[0].Domain != "saas.example.com" || issued[1].Domain != "shop.customer.com" {
+		t.Errorf("domains should be sorted, got %s, %s", issued[0].Domain, issued[1].Domain)
+	}
+	if issued[1].Issuer != "R11" {
+		t.Errorf("the certificate expiring last should be kept, got issuer %s", issued[1].Issuer)
+	}
+}
@@ -3,7 +3,10 @@ package caddy
 import (
 	"bytes"
 	"fmt"
+	"regexp"
+	"sort"
 	"strconv"
+	"strings"
 	"text/template"
 
 	"github.com/yoanbernabeu/frankendeploy/internal/config"
@@ -29,19 +32,122 @@ type AppConfig struct {
 	// returns 404 on "/", which would mark the upstream unhealthy and
 	// turn every request into a 503.
 	HealthPath string
+	// Directives are the user-defined directives from deploy.caddy
+	Directives config.CaddyConfig
+	// Protect puts the whole site behind basic auth when non-nil
+	Protect *ProtectRule
+	// TLSMode is one of the config.TLSMode* values ("" means ACME). In
+	// custom mode the certificate must be uploaded first (see CertPaths).
+	TLSMode string
+	// OnDemandAsk is the app path approving on-demand certificates
+	// (on_demand mode only)
+	OnDemandAsk string
 }
 
-// GenerateAppConfig generates Caddy config for an application
-func (g *ConfigGenerator) GenerateAppConfig(app AppConfig) (string, error) {
-	if err := security.ValidateHealthPath(app.HealthPath); err != nil {
-		return "", fmt.Errorf("invalid health path: %w", err)
-	}
-	if app.HealthPath == "" {
-		app.HealthPath = "/"
-	}
+// ProtectRule is a site-wide basic auth rule. Users map a username to a
+// bcrypt hash: hashing is done by the caller, never by the generator.
+type ProtectRule struct {
+	Users map[string]string
+	// Exempt are path matchers reachable without credentials
+	Exempt []string
+}
+
+// header is a single response header rendered in the header block
+type header struct {
+	Name  string
+	Value string
+}
+
+// cacheRule sets Cache-Control on responses matching a path
+type cacheRule struct {
+	Path  string
+	Value string
+}
+
+// basicAuthRule is a path protected by basic auth, with sorted users
+type basicAuthRule struct {
+	Path  string
+	Users []header
+}
 
-	tmpl := `# {{ .Name }}
-{{ .Domain }} {
+// appTemplateData is the view of an AppConfig consumed by the template
+type appTemplateData struct {
+	AppConfig
+	Headers      []header
+	CacheRules   []cacheRule
+	MaxBodySize  string
+	IPAllow      string
+	IPDeny       string
+	BasicAuth    []basicAuthRule
+	Protect      *basicAuthRule
+	HasAccessCtl bool
+	Raw          string
+	TLS          string
+}
+
+// defaultHeaders are the security headers every app gets unless overridden
+// through deploy.caddy.headers
+var defaultHeaders = []header{
+	{"X-Content-Type-Options", "nosniff"},
+	{"X-Frame-Options", "DENY"},
+	{"Referrer-Policy", "strict-origin-when-cross-origin"},
+}
+
+// onDemandAskAddr is where Caddy asks whether an on-demand certificate may
+// be issued. It is served by Caddy itself, from the site block of the
+// on-demand app, and only listens inside the container.
+const onDemandAskAddr = "127.0.0.1:5555"
+
+// OnDemandMarker tags the app config serving the on-demand ask endpoint.
+// A server has at most one: the app answering every other domain.
+const OnDemandMarker = "on-demand TLS ask endpoint"
+
+const appTemplate = `# {{ .Name }}
+{{ .Domain }}{{ if .OnDemandAsk }}, https://{{ end }} {
+{{- with .TLS }}
+    tls {{ . }}
+{{ end }}
+{{- if .OnDemandAsk }}
+    tls {
+        on_demand
+    }
+{{ end }}
+{{- if .MaxBodySize }}
+    request_body {
+        max_size {{ .MaxBodySize }}
+    }
+{{ end }}
+{{- if .HasAccessCtl }}
+    route {
+{{- if .IPDeny }}
+        @ip_denied remote_ip {{ .IPDeny }}
+        error @ip_denied 403
+{{- end }}
+{{- if .IPAllow }}
+        @ip_not_allowed not remote_ip {{ .IPAllow }}
+        error @ip_not_allowed 403
+{{- end }}
+{{- range .BasicAuth }}
+        basic_auth {{ .Path }} {
+{{- range .Users }}
+            {{ .Name }} {{ .Value }}
+{{- end }}
+        }
+{{- end }}
+{{- with .Protect }}
+{{- if .Path }}
+        @protected not path {{ .Path }}
+        basic_auth @protected {
+{{- else }}
+        basic_auth {
+{{- end }}
+{{- range .Users }}
+            {{ .Name }} {{ .Value }}
+{{- end }}
+        }
+{{- end }}
+    }
+{{ end }}
     reverse_proxy {{ .Name }}:{{ .Port }} {
         health_uri {{ .HealthPath }}
         health_interval 30s
@@ -51,36 +157,248 @@ func (g *ConfigGenerator) GenerateAppConfig(app AppConfig) (string, error) {
     encode zstd gzip
 
     header {
-        X-Content-Type-Options nosniff
-        X-Frame-Options DENY
-        Referrer-Policy strict-origin-when-cross-origin
+{{- range .Headers }}
+        {{ .Name }} {{ quote .Value }}
+{{- end }}
         -Server
     }
+{{- range $i, $rule := .CacheRules }}
+
+    @cache_{{ $i }} path {{ $rule.Path }}
+    header @cache_{{ $i }} >Cache-Control {{ quote $rule.Value }}
+{{- end }}
 
     log {
         output file /config/logs/{{ .Name }}.log
         format json
     }
+{{- if .Raw }}
+
+    # Custom directives (deploy.caddy.raw)
+{{ .Raw }}
+{{- end }}
 }
+{{- with .OnDemandAsk }}
+
+# {{ $.Name }}: ` + OnDemandMarker + `
+# The primary domain is always allowed; other domains are approved by the app
+http://` + onDemandAskAddr + ` {
+    bind 127.0.0.1
+    @primary query domain={{ $.Domain }}
+    respond @primary 200
+    rewrite * {{ . }}?{query}
+    reverse_proxy {{ $.Name }}:{{ $.Port }} {
+        header_up Host {{ $.Domain }}
+    }
+}
+{{- end }}
 `
 
-	t, err := template.New("app").Parse(tmpl)
+// bareTokenRegex matches values that can be written without quotes
+var bareTokenRegex = regexp.MustCompile(`^[A-Za-z0-9._:/=,+-]+$`)
+
+// quoteValue quotes a Caddyfile token when it contains spaces or special
+// characters. Values are validated beforehand, so they never contain
+// quotes or backslashes.
+func quoteValue(v string) string {
+	if bareTokenRegex.MatchString(v) {
+		return v
+	}
+	return `"` + v + `"`
+}
+
+// GenerateAppConfig generates Caddy config for an application
+func (g *ConfigGenerator) GenerateAppConfig(app AppConfig) (string, error) {
+	app, err := prepareAppConfig(app)
 	if err != nil {
-		return "", fmt.Errorf("failed to parse template: %w", err)
+		return "", err
 	}
 
-	if app.Port == 0 {
-		app.Port, _ = strconv.Atoi(constants.AppPort)
+	t, err := template.New("app").Funcs(template.FuncMap{"quote": quoteValue}).Parse(appTemplate)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse template: %w", err)
 	}
 
 	var buf bytes.Buffer
-	if err := t.Execute(&buf, app); err != nil {
+	if err := t.Execute(&buf, newAppTemplateData(app)); err != nil {
 		return "", fmt.Errorf("failed to execute template: %w", err)
 	}
 
 	return buf.String(), nil
 }
 
+// prepareAppConfig validates an app config and fills in the defaults
+// shared by the Caddyfile and JSON generators.
+func prepareAppConfig(app AppConfig) (AppConfig, error) {
+	if err := security.ValidateHealthPath(app.HealthPath); err != nil {
+		return app, fmt.Errorf("invalid health path: %w", err)
+	}
+	if errs := config.ValidateCaddyConfig(&app.Directives); errs.HasErrors() {
+		return app, fmt.Errorf("invalid caddy directives: %w", errs)
+	}
+	if err := validateProtectRule(app.Protect); err != nil {
+		return app, err
+	}
+	switch app.TLSMode {
+	case "", config.TLSModeACME, config.TLSModeCustom, config.TLSModeInternal:
+		app.OnDemandAsk = ""
+	case config.TLSModeOnDemand:
+		if app.OnDemandAsk == "" {
+			return app, fmt.Errorf("on-demand TLS requires an ask endpoint")
+		}
+		if err := security.ValidateHealthPath(app.OnDemandAsk); err != nil {
+			return app, fmt.Errorf("invalid ask endpoint: %w", err)
+		}
+	default:
+		return app, fmt.Errorf("invalid TLS mode %q", app.TLSMode)
+	}
+	if app.TLSMode == config.TLSModeCustom {
+		// The app name is part of the certificate paths
+		if err := security.ValidateAppName(app.Name); err != nil {
+			return app, fmt.Errorf("invalid app name: %w", err)
+		}
+	}
+	if app.HealthPath == "" {
+		app.HealthPath = "/"
+	}
+	if app.Port == 0 {
+		app.Port, _ = strconv.Atoi(constants.AppPort)
+	}
+	return app, nil
+}
+
+// newAppTemplateData flattens the directives into deterministic, sorted
+// slices so the generated file only changes when the config does.
+func newAppTemplateData(app AppConfig) appTemplateData {
+	d := app.Directives
+	data := appTemplateData{
+		AppConfig:   app,
+		MaxBodySize: d.MaxBodySize,
+		IPAllow:     strings.Join(d.IPAllow, " "),
+		IPDeny:      strings.Join(d.IPDeny, " "),
+	}
+
+	switch app.TLSMode {
+	case config.TLSModeInternal:
+		data.TLS = "internal"
+	case config.TLSModeCustom:
+		cert, key := CertPaths(app.Name)
+		data.TLS = cert + " " + key
+	}
+
+	// Computed headers first, so an explicit deploy.caddy.headers entry wins
+	overrides := map[string]string{}
+	if d.HSTS != nil {
+		value := fmt.Sprintf("max-age=%d", d.HSTS.MaxAge)
+		if d.HSTS.IncludeSubdomains {
+			value += "; includeSubDomains"
+		}
+		if d.HSTS.Preload {
+			value += "; preload"
+		}
+		overrides["strict-transport-security"] = value
+	}
+	if d.CSP != "" {
+		overrides["content-security-policy"] = d.CSP
+	}
+	names := map[string]string{
+		"strict-transport-security": "Strict-Transport-Security",
+		"content-security-policy":   "Content-Security-Policy",
+	}
+	for name, value := range d.Headers {
+		overrides[strings.ToLower(name)] = value
+		names[strings.ToLower(name)] = name
+	}
+
+	for _, h := range defaultHeaders {
+		key := strings.ToLower(h.Name)
+		if v, ok := overrides[key]; ok {
+			h.Value = v
+			delete(overrides, key)
+		}
+		data.Headers = append(data.Headers, h)
+	}
+	extra := make([]string, 0, len(overrides))
+	for key := range overrides {
+		extra = append(extra, key)
+	}
+	sort.Strings(extra)
+	for _, key := range extra {
+		data.Headers = append(data.Headers, header{Name: names[key], Value: overrides[key]})
+	}
+
+	paths := make([]string, 0, len(d.CacheControl))
+	for path := range d.CacheControl {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		data.CacheRules = append(data.CacheRules, cacheRule{Path: path, Value: d.CacheControl[path]})
+	}
+
+	for _, rule := range d.BasicAuth {
+		users := make([]string, 0, len(rule.Users))
+		for user := range rule.Users {
+			users = append(users, user)
+		}
+		sort.Strings(users)
+		r := basicAuthRule{Path: rule.Path}
+		for _, user := range users {
+			r.Users = append(r.Users, header{Name: user, Value: rule.Users[user]})
+		}
+		data.BasicAuth = append(data.BasicAuth, r)
+	}
+
+	if p := app.Protect; p != nil {
+		rule := &basicAuthRule{Path: strings.Join(p.Exempt, " ")}
+		users := make([]string, 0, len(p.Users))
+		for user := range p.Users {
+			users = append(users, user)
+		}
+		sort.Strings(users)
+		for _, user := range users {
+			rule.Users = append(rule.Users, header{Name: user, Value: p.Users[user]})
+		}
+		data.Protect = rule
+	}
+
+	data.HasAccessCtl = data.IPAllow != "" || data.IPDeny != "" || len(data.BasicAuth) > 0 || data.Protect != nil
+
+	if raw := strings.TrimSpace(d.Raw); raw != "" {
+		lines := strings.Split(raw, "\n")
+		for i, line := range lines {
+			if strings.TrimSpace(line) != "" {
+				lines[i] = "    " + line
+			}
+		}
+		data.Raw = strings.Join(lines, "\n")
+	}
+
+	return data
+}
+
+// validateProtectRule checks a site-wide basic auth rule: a protected site
+// without users would lock everyone out, so it is refused.
+func validateProtectRule(p *ProtectRule) error {
+	if p == nil {
+		return nil
+	}
+	if len(p.Users) == 0 {
+		return fmt.Errorf("protection is enabled but no users are configured (add one with 'frankendeploy access add')")
+	}
+	for user, hash := range p.Users {
+		if err := security.ValidateBasicAuthUser(user, hash); err != nil {
+			return fmt.Errorf("invalid protected user: %w", err)
+		}
+	}
+	for _, path := range p.Exempt {
+		if err := security.ValidateCaddyPath(path); err != nil {
+			return fmt.Errorf("invalid exempt path: %w", err)
+		}
+	}
+	return nil
+}
+
 // GenerateMainConfig generates the main Caddyfile for Docker container
 func (g *ConfigGenerator) GenerateMainConfig(email string) (string, error) {
 	tmpl := `# FrankenDeploy Caddy Configuration
@@ -92,6 +410,13 @@ func (g *ConfigGenerator) GenerateMainConfig(email string) (string, error) {
 
     # Let's Encrypt email
     email %s
+
+    # Certificates of on-demand apps (deploy.tls.mode: on_demand) are only
+    # issued for domains the app approves, through the endpoint of its site
+    # config. Unused on servers without such an app.
+    on_demand_tls {
+        ask http://%s/
+    }
 }
 
 # Import app configurations (mounted at /config/apps in container)
@@ -102,17 +427,20 @@ import /config/apps/*.caddy
 		email = constants.DefaultCertEmail
 	}
 
-	return fmt.Sprintf(tmpl, email), nil
+	return fmt.Sprintf(tmpl, email, onDemandAskAddr), nil
 }
 
 // AppConfigFromProject creates AppConfig from project config
 func AppConfigFromProject(cfg *config.ProjectConfig, domain string) AppConfig {
 	port, _ := strconv.Atoi(constants.AppPort)
 	return AppConfig{
-		Name:       cfg.Name,
-		Domain:     domain,
-		Port:       port,
-		HealthPath: cfg.Deploy.HealthcheckPath,
+		Name:        cfg.Name,
+		Domain:      domain,
+		Port:        port,
+		HealthPath:  cfg.Deploy.HealthcheckPath,
+		Directives:  cfg.Deploy.Caddy,
+		TLSMode:     cfg.Deploy.TLS.Mode,
+		OnDemandAsk: cfg.Deploy.TLS.Ask,
 	}
 }
 
@@ -121,31 +449,118 @@ func AppConfigFromProject(cfg *config.ProjectConfig, domain string) AppConfig {
 func ReloadCommands() []string {
 	return []string{
 		// Reload Caddy config inside container via Admin API (zero downtime)
-		`docker exec caddy caddy reload --config /etc/caddy/Caddyfile --adapter caddyfile && echo "Caddy config reloaded"`,
+		reloadCommand + ` && echo "Caddy config reloaded"`,
 	}
 }
 
+// containerAppsDir is where the host's Caddy apps dir is mounted inside
+// the caddy container
+const containerAppsDir = "/config/apps"
+
+// reloadCommand reloads the main Caddyfile inside the caddy container
+const reloadCommand = `docker exec caddy caddy reload --config /etc/caddy/Caddyfile --adapter caddyfile`
+
+// ForceReloadCommand reloads Caddy even when the Caddyfile is unchanged,
+// so certificate files replaced in place are read again
+func ForceReloadCommand() string {
+	return reloadCommand + " --force"
+}
+
+// Sibling files of <app>.caddy. None of them matches the *.caddy import
+// glob, so Caddy never loads them.
+const (
+	tmpSuffix     = ".tmp"     // candidate config, validated before the swap
+	prevSuffix    = ".prev"    // previous config, kept for `caddy rollback`
+	restoreSuffix = ".restore" // copy of the live config during a reload
+)
+
 // WriteAppConfigCommands returns SSH commands to write app config and reload.
+// The config is written to a temp file, validated by the Caddy binary of the
+// running container, then swapped in atomically. If the reload fails, the
+// previous file is restored so a broken config never stays on disk (it
+// would break the next reload of every other app on the server).
 // Returns an error if the heredoc delimiter cannot be generated.
 func WriteAppConfigCommands(appName, configContent string) ([]string, error) {
 	delim, err := security.GenerateHeredocDelimiter("CADDYEOF")
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate delimiter: %w", err)
 	}
-	return []string{
+	return append([]string{
 		// Ensure directory exists
 		fmt.Sprintf("mkdir -p %s", constants.CaddyAppsDir),
-		// Write config file (escaped for shell with random heredoc delimiter)
-		fmt.Sprintf("cat > %s << '%s'\n%s\n%s", constants.CaddyAppConfig(appName), delim, configContent, delim),
-		// Reload Caddy inside container
-		`docker exec caddy caddy reload --config /etc/caddy/Caddyfile --adapter caddyfile`,
-	}, nil
+		// Write candidate config (escaped for shell with random heredoc delimiter)
+		fmt.Sprintf("cat > %s << '%s'\n%s\n%s", constants.CaddyAppConfig(appName)+tmpSuffix, delim, configContent, delim),
+	}, applyCandidateCommands(appName)...), nil
+}
+
+// OnDemandStatusCommand returns the SSH command reporting whether the main
+// Caddyfile enables on-demand TLS, and which app configs serve the ask
+// endpoint. Its output is read by ParseOnDemandStatus.
+func OnDemandStatusCommand() string {
+	return fmt.Sprintf("grep -q on_demand_tls %s/Caddyfile && echo global; grep -l '%s' %s/*.caddy 2>/dev/null; true",
+		constants.CaddyDir, OnDemandMarker, constants.CaddyAppsDir)
+}
+
+// ParseOnDemandStatus parses the output of OnDemandStatusCommand
+func ParseOnDemandStatus(out string) (global bool, apps []string) {
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "global":
+			global = true
+		case strings.HasSuffix(line, ".caddy"):
+			name := strings.TrimSuffix(line[strings.LastIndex(line, "/")+1:], ".caddy")
+			if security.ValidateAppName(name) == nil {
+				apps = append(apps, name)
+			}
+		}
+	}
+	return global, apps
+}
+
+// RestorePreviousCommands returns SSH commands that bring back the previous
+// config of an app through the same validate/swap/reload pipeline. The
+// config replaced becomes the new previous one, so running it twice
+// toggles between the two.
+func RestorePreviousCommands(appName string) []string {
+	current := constants.CaddyAppConfig(appName)
+	return append([]string{
+		fmt.Sprintf("test -f %[1]s || { echo 'no previous Caddy config for %[2]s' >&2; exit 1; }", current+prevSuffix, appName),
+		fmt.Sprintf("cp -p %s %s", current+prevSuffix, current+tmpSuffix),
+	}, applyCandidateCommands(appName)...)
+}
+
+// applyCandidateCommands validates <app>.caddy.tmp, swaps it in, and
+// reloads Caddy, restoring the live file if the reload fails.
+func applyCandidateCommands(appName string) []string {
+	current := constants.CaddyAppConfig(appName)
+	tmp := current + tmpSuffix
+	prev := current + prevSuffix
+	restore := current + restoreSuffix
+	containerTmp := containerAppsDir + "/" + appName + ".caddy" + tmpSuffix
+
+	return []string{
+		// Validate the candidate with the running Caddy binary
+		fmt.Sprintf("docker exec caddy caddy validate --adapter caddyfile --config %s || { rm -f %s; exit 1; }", containerTmp, tmp),
+		// Swap atomically (mv on the same filesystem), reload, and on failure
+		// put the live file back. On success the replaced file becomes the
+		// previous config, unless nothing changed.
+		fmt.Sprintf("if [ -f %[1]s ]; then cp -p %[1]s %[3]s; fi && mv -f %[2]s %[1]s && "+
+			"if %[5]s; then "+
+			"if [ -f %[3]s ]; then if cmp -s %[3]s %[1]s; then rm -f %[3]s; else mv -f %[3]s %[4]s; fi; fi; "+
+			"else "+
+			"if [ -f %[3]s ]; then mv -f %[3]s %[1]s; else rm -f %[1]s; fi; "+
+			"echo 'Caddy reload failed: previous config restored' >&2; exit 1; "+
+			"fi",
+			current, tmp, restore, prev, reloadCommand),
+	}
 }
 
 // RemoveAppConfigCommands returns SSH commands to remove app config and reload
 func RemoveAppConfigCommands(appName string) []string {
+	current := constants.CaddyAppConfig(appName)
 	return []string{
-		fmt.Sprintf("rm -f %s", constants.CaddyAppConfig(appName)),
-		`docker exec caddy caddy reload --config /etc/caddy/Caddyfile --adapter caddyfile`,
+		fmt.Sprintf("rm -f %s %s %s %s", current, current+tmpSuffix, current+prevSuffix, current+restoreSuffix),
+		reloadCommand,
 	}
 }
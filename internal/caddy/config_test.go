@@ -1,16 +1,20 @@
 package caddy
 
 import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
 	"strings"
 	"testing"
 
 	"github.com/yoanbernabeu/frankendeploy/internal/config"
+	"github.com/yoanbernabeu/frankendeploy/internal/constants"
 )
 
 func TestGenerateAppConfig_DoesNotEmitTLSInternal(t *testing.T) {
-	// The `tls internal` branch was unreachable since AppConfigFromProject
-	// always left TLS as the default. The field and branch were removed —
-	// this test guards against accidental reintroduction.
+	// Apps default to ACME: `tls internal` is only emitted when
+	// deploy.tls.mode asks for it (see TestGenerateAppConfig_TLSModes).
 	gen := NewConfigGenerator()
 	out, err := gen.GenerateAppConfig(AppConfig{
 		Name:   "myapp",
@@ -35,6 +39,91 @@ func TestGenerateAppConfig_DoesNotEmitTLSInternal(t *testing.T) {
 	}
 }
 
+func TestGenerateAppConfig_TLSModes(t *testing.T) {
+	tests := []struct {
+		mode string
+		want string
+	}{
+		{config.TLSModeInternal, "example.com {\n    tls internal\n"},
+		{config.TLSModeCustom, "    tls /config/caddy/certs/myapp/cert.pem /config/caddy/certs/myapp/key.pem\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			out, err := NewConfigGenerator().GenerateAppConfig(AppConfig{Name: "myapp", Domain: "example.com", TLSMode: tt.mode})
+			if err != nil {
+				t.Fatalf("GenerateAppConfig: %v", err)
+			}
+			if !strings.Contains(out, tt.want) {
+				t.Errorf("expected %q in:\n%s", tt.want, out)
+			}
+		})
+	}
+
+	if _, err := NewConfigGenerator().GenerateAppConfig(AppConfig{Name: "myapp", Domain: "example.com", TLSMode: "selfsigned"}); err == nil {
+		t.Error("expected an error for an unknown TLS mode")
+	}
+}
+
+func TestGenerateAppConfig_OnDemandTLS(t *testing.T) {
+	out, err := NewConfigGenerator().GenerateAppConfig(AppConfig{
+		Name:        "saas",
+		Domain:      "saas.example.com",
+		TLSMode:     config.TLSModeOnDemand,
+		OnDemandAsk: "/tls/allowed",
+	})
+	if err != nil {
+		t.Fatalf("GenerateAppConfig: %v", err)
+	}
+	for _, want := range []string{
+		"saas.example.com, https:// {\n    tls {\n        on_demand\n    }\n",
+		"# saas: " + OnDemandMarker,
+		"http://127.0.0.1:5555 {\n    bind 127.0.0.1\n",
+		"@primary query domain=saas.example.com\n    respond @primary 200\n",
+		"rewrite * /tls/allowed?{query}\n    reverse_proxy saas:8080 {\n        header_up Host saas.example.com\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("generated config missing %q\n%s", want, out)
+		}
+	}
+
+	for _, ask := range []string{"", "/allowed?domain={host}", "/../admin"} {
+		_, err := NewConfigGenerator().GenerateAppConfig(AppConfig{Name: "saas", Domain: "saas.example.com", TLSMode: config.TLSModeOnDemand, OnDemandAsk: ask})
+		if err == nil {
+			t.Errorf("expected an error for ask endpoint %q", ask)
+		}
+	}
+
+	// The ask endpoint is ignored outside on_demand mode
+	out, err = NewConfigGenerator().GenerateAppConfig(AppConfig{Name: "saas", Domain: "saas.example.com", OnDemandAsk: "/tls/allowed"})
+	if err != nil {
+		t.Fatalf("GenerateAppConfig: %v", err)
+	}
+	if strings.Contains(out, "on_demand") || strings.Contains(out, "https://") {
+		t.Errorf("ACME app should not be on demand:\n%s", out)
+	}
+}
+
+func TestGenerateMainConfig_OnDemandAskEndpoint(t *testing.T) {
+	out, err := NewConfigGenerator().GenerateMainConfig("ops@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "on_demand_tls {\n        ask http://127.0.0.1:5555/\n    }") {
+		t.Errorf("main config should point on-demand TLS to the ask relay:\n%s", out)
+	}
+}
+
+func TestParseOnDemandStatus(t *testing.T) {
+	global, apps := ParseOnDemandStatus("global\n/opt/frankendeploy/caddy/apps/saas.caddy\n")
+	if !global || len(apps) != 1 || apps[0] != "saas" {
+		t.Errorf("got global=%v apps=%v", global, apps)
+	}
+	global, apps = ParseOnDemandStatus("")
+	if global || len(apps) != 0 {
+		t.Errorf("empty output: got global=%v apps=%v", global, apps)
+	}
+}
+
 // TestGenerateAppConfig_UsesConfiguredHealthPath guards against the live 503
 // found in production: Caddy's active health check probed a hardcoded "/",
 // got 404 from an API-only app, marked the upstream unhealthy, and every
@@ -114,17 +203,20 @@ func TestWriteAppConfigCommands(t *testing.T) {
 	if err != nil {
 		t.Fatalf("WriteAppConfigCommands: %v", err)
 	}
-	if len(cmds) != 3 {
-		t.Fatalf("expected 3 commands (mkdir, write, reload), got %d", len(cmds))
+	if len(cmds) != 4 {
+		t.Fatalf("expected 4 commands (mkdir, write, validate, swap+reload), got %d", len(cmds))
 	}
 	if !strings.HasPrefix(cmds[0], "mkdir -p ") {
 		t.Errorf("first command should create the apps dir, got: %s", cmds[0])
 	}
-	if !strings.Contains(cmds[1], "myapp.caddy") || !strings.Contains(cmds[1], content) {
-		t.Errorf("second command should write the app config content, got: %s", cmds[1])
+	if !strings.Contains(cmds[1], "myapp.caddy.tmp") || !strings.Contains(cmds[1], content) {
+		t.Errorf("second command should write the candidate config to a temp file, got: %s", cmds[1])
+	}
+	if !strings.Contains(cmds[2], "caddy validate") || !strings.Contains(cmds[2], "/config/apps/myapp.caddy.tmp") {
+		t.Errorf("third command should validate the candidate inside the container, got: %s", cmds[2])
 	}
-	if !strings.Contains(cmds[2], "caddy reload") {
-		t.Errorf("third command should reload Caddy, got: %s", cmds[2])
+	if !strings.Contains(cmds[3], "caddy reload") {
+		t.Errorf("fourth command should reload Caddy, got: %s", cmds[3])
 	}
 
 	// Heredoc delimiter must be random: two calls must differ
@@ -149,3 +241,238 @@ func TestRemoveAppConfigCommands(t *testing.T) {
 		t.Errorf("second command should reload Caddy, got: %s", cmds[1])
 	}
 }
+
+func TestGenerateAppConfig_Directives(t *testing.T) {
+	hash := "$2a$14$" + "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0"
+	gen := NewConfigGenerator()
+	out, err := gen.GenerateAppConfig(AppConfig{
+		Name:   "myapp",
+		Domain: "example.com",
+		Port:   8080,
+		Directives: config.CaddyConfig{
+			HSTS:         &config.HSTSConfig{MaxAge: 31536000, IncludeSubdomains: true, Preload: true},
+			CSP:          "default-src 'self'",
+			Headers:      map[string]string{"x-frame-options": "SAMEORIGIN", "Permissions-Policy": "camera=()"},
+			CacheControl: map[string]string{"/build/*": "public, max-age=31536000, immutable", "/assets/*": "public, max-age=3600"},
+			MaxBodySize:  "20MB",
+			IPAllow:      []string{"10.0.0.0/8"},
+			IPDeny:       []string{"203.0.113.7"},
+			BasicAuth:    []config.BasicAuthRule{{Path: "/admin/*", Users: map[string]string{"admin": hash}}},
+			Raw:          "handle /ping {\n    respond 204\n}",
+		},
+	})
+	if err != nil {
+		t.Fatalf("GenerateAppConfig: %v", err)
+	}
+
+	wantFragments := []string{
+		"max_size 20MB",
+		"@ip_denied remote_ip 203.0.113.7",
+		"@ip_not_allowed not remote_ip 10.0.0.0/8",
+		"error @ip_not_allowed 403",
+		"basic_auth /admin/* {\n            admin " + hash,
+		`Strict-Transport-Security "max-age=31536000; includeSubDomains; preload"`,
+		`Content-Security-Policy "default-src 'self'"`,
+		`Permissions-Policy "camera=()"`,
+		"X-Frame-Options SAMEORIGIN",
+		"@cache_0 path /assets/*",
+		`header @cache_1 >Cache-Control "public, max-age=31536000, immutable"`,
+		"    handle /ping {\n        respond 204\n    }\n}",
+	}
+	for _, want := range wantFragments {
+		if !strings.Contains(out, want) {
+			t.Errorf("generated config missing %q\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "X-Frame-Options DENY") {
+		t.Errorf("custom header should override the default:\n%s", out)
+	}
+}
+
+func TestGenerateAppConfig_NoDirectivesKeepsDefaults(t *testing.T) {
+	gen := NewConfigGenerator()
+	out, err := gen.GenerateAppConfig(AppConfig{Name: "myapp", Domain: "example.com"})
+	if err != nil {
+		t.Fatalf("GenerateAppConfig: %v", err)
+	}
+	for _, unwanted := range []string{"route {", "request_body", "Strict-Transport-Security", "@cache_"} {
+		if strings.Contains(out, unwanted) {
+			t.Errorf("config without directives should not contain %q:\n%s", unwanted, out)
+		}
+	}
+	if !strings.Contains(out, "X-Frame-Options DENY") {
+		t.Errorf("default security headers missing:\n%s", out)
+	}
+}
+
+func TestGenerateAppConfig_RejectsInvalidDirectives(t *testing.T) {
+	gen := NewConfigGenerator()
+	_, err := gen.GenerateAppConfig(AppConfig{
+		Name:       "myapp",
+		Domain:     "example.com",
+		Directives: config.CaddyConfig{Raw: "}\nevil.com {\n    respond 200"},
+	})
+	if err == nil {
+		t.Error("expected error for a raw snippet closing the site block")
+	}
+}
+
+func TestGenerateAppConfig_Protect(t *testing.T) {
+	hash := "$2a$10$" + strings.Repeat("a", 53)
+	gen := NewConfigGenerator()
+	out, err := gen.GenerateAppConfig(AppConfig{
+		Name:   "myapp",
+		Domain: "staging.example.com",
+		Protect: &ProtectRule{
+			Users:  map[string]string{"bob": hash, "alice": hash},
+			Exempt: []string{"/health", "/webhooks/*"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("GenerateAppConfig: %v", err)
+	}
+	want := "        @protected not path /health /webhooks/*\n" +
+		"        basic_auth @protected {\n" +
+		"            alice " + hash + "\n" +
+		"            bob " + hash + "\n" +
+		"        }"
+	if !strings.Contains(out, want) {
+		t.Errorf("expected protected block:\n%s\ngot:\n%s", want, out)
+	}
+}
+
+func TestGenerateAppConfig_ProtectWithoutExemptions(t *testing.T) {
+	hash := "$2a$10$" + strings.Repeat("a", 53)
+	gen := NewConfigGenerator()
+	out, err := gen.GenerateAppConfig(AppConfig{
+		Name:    "myapp",
+		Domain:  "staging.example.com",
+		Protect: &ProtectRule{Users: map[string]string{"bob": hash}},
+	})
+	if err != nil {
+		t.Fatalf("GenerateAppConfig: %v", err)
+	}
+	if !strings.Contains(out, "        basic_auth {\n            bob ") {
+		t.Errorf("expected site-wide basic_auth:\n%s", out)
+	}
+	if strings.Contains(out, "@protected") {
+		t.Errorf("no matcher expected without exemptions:\n%s", out)
+	}
+}
+
+func TestGenerateAppConfig_ProtectRejectsUnsafeRules(t *testing.T) {
+	gen := NewConfigGenerator()
+	rules := map[string]*ProtectRule{
+		"no users":        {},
+		"plaintext":       {Users: map[string]string{"bob": "secret"}},
+		"bad exempt path": {Users: map[string]string{"bob": "$2a$10$" + strings.Repeat("a", 53)}, Exempt: []string{"/x {"}},
+	}
+	for name, rule := range rules {
+		if _, err := gen.GenerateAppConfig(AppConfig{Name: "myapp", Domain: "example.com", Protect: rule}); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+// runCaddyCommands runs the generated commands with sh against a temp apps
+// dir and a fake docker binary whose reload exits with reloadExit.
+func runCaddyCommands(t *testing.T, dir string, cmds []string, reloadExit int) error {
+	t.Helper()
+	bin := filepath.Join(dir, "bin")
+	if err := os.MkdirAll(bin, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	fake := fmt.Sprintf("#!/bin/sh\ncase \"$*\" in *reload*) exit %d;; esac\nexit 0\n", reloadExit)
+	if err := os.WriteFile(filepath.Join(bin, "docker"), []byte(fake), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range cmds {
+		c = strings.ReplaceAll(c, constants.CaddyAppsDir, filepath.Join(dir, "apps"))
+		cmd := exec.Command("sh", "-c", c)
+		cmd.Env = append(os.Environ(), "PATH="+bin+":"+os.Getenv("PATH"))
+		if out, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("%v: %s", err, out)
+		}
+	}
+	return nil
+}
+
+func readAppFile(t *testing.T, dir, name string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(dir, "apps", name))
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+func TestWriteAppConfigCommands_SwapKeepsPrevious(t *testing.T) {
+	dir := t.TempDir()
+	for _, content := range []string{"v1", "v2"} {
+		cmds, err := WriteAppConfigCommands("myapp", content)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := runCaddyCommands(t, dir, cmds, 0); err != nil {
+			t.Fatalf("write %s: %v", content, err)
+		}
+	}
+	if got := readAppFile(t, dir, "myapp.caddy"); got != "v2\n" {
+		t.Errorf("live config = %q, want v2", got)
+	}
+	if got := readAppFile(t, dir, "myapp.caddy.prev"); got != "v1\n" {
+		t.Errorf("previous config = %q, want v1", got)
+	}
+	if readAppFile(t, dir, "myapp.caddy.tmp") != "" || readAppFile(t, dir, "myapp.caddy.restore") != "" {
+		t.Error("temp files must not be left behind")
+	}
+
+	// Rolling back toggles live and previous
+	if err := runCaddyCommands(t, dir, RestorePreviousCommands("myapp"), 0); err != nil {
+		t.Fatalf("rollback: %v", err)
+	}
+	if got := readAppFile(t, dir, "myapp.caddy"); got != "v1\n" {
+		t.Errorf("after rollback live config = %q, want v1", got)
+	}
+	if got := readAppFile(t, dir, "myapp.caddy.prev"); got != "v2\n" {
+		t.Errorf("after rollback previous config = %q, want v2", got)
+	}
+}
+
+func TestWriteAppConfigCommands_RestoresOnReloadFailure(t *testing.T) {
+	dir := t.TempDir()
+	cmds, _ := WriteAppConfigCommands("myapp", "good")
+	if err := runCaddyCommands(t, dir, cmds, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	cmds, _ = WriteAppConfigCommands("myapp", "broken")
+	if err := runCaddyCommands(t, dir, cmds, 1); err == nil {
+		t.Fatal("expected failure when the reload fails")
+	}
+	if got := readAppFile(t, dir, "myapp.caddy"); got != "good\n" {
+		t.Errorf("live config = %q, the previous file must be restored", got)
+	}
+}
+
+func TestWriteAppConfigCommands_FirstWriteFailureLeavesNothing(t *testing.T) {
+	dir := t.TempDir()
+	cmds, _ := WriteAppConfigCommands("myapp", "broken")
+	if err := runCaddyCommands(t, dir, cmds, 1); err == nil {
+		t.Fatal("expected failure when the reload fails")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "apps", "myapp.caddy")); !os.IsNotExist(err) {
+		t.Error("a config that failed to load must not stay on disk")
+	}
+}
+
+func TestRestorePreviousCommands_NoPrevious(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "apps"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	err := runCaddyCommands(t, dir, RestorePreviousCommands("myapp"), 0)
+	if err == nil || !strings.Contains(err.Error(), "no previous Caddy config") {
+		t.Errorf("expected a clear error without previous config, got: %v", err)
+	}
+}
@@ -0,0 +1,58 @@
+package caddy
+
+import (
+	"fmt"
+
+	"github.com/yoanbernabeu/frankendeploy/internal/constants"
+)
+
+// Image is the Caddy image run by FrankenDeploy
+const Image = "caddy:alpine"
+
+// PreviousImage tags the image replaced by the last 'server update', kept
+// for rollback
+const PreviousImage = "caddy:frankendeploy-previous"
+
+// VersionCommand prints the version of the running Caddy binary
+const VersionCommand = "docker exec caddy caddy version"
+
+// ContainerRunCommand returns the command (re)creating the caddy container.
+//
+// In Caddyfile mode the admin API listens on localhost inside the container
+// only, and configs are reloaded with docker exec. In API mode it listens
+// on a unix socket shared through constants.CaddyAdminDir, and Caddy starts
+// from its last autosaved config (--resume) so routes added through the API
+// survive restarts. Each mode keeps its autosave in its own volume: a
+// Caddyfile-mode autosave must never be resumed in API mode.
+func ContainerRunCommand(apiMode bool) string {
+	mounts := fmt.Sprintf("-v %s/Caddyfile:/etc/caddy/Caddyfile:ro -v %s:%s:ro -v caddy_config:/config/caddy",
+		constants.CaddyDir, constants.CaddyAppsDir, containerAppsDir)
+	command := ""
+	if apiMode {
+		mounts = fmt.Sprintf("-v %s/caddy.json:/etc/caddy/caddy.json:ro -v %s:%s -v caddy_api_config:/config/caddy",
+			constants.CaddyDir, constants.CaddyAdminDir, containerAdminDir)
+		command = " caddy run --config /etc/caddy/caddy.json --resume"
+	}
+
+	return fmt.Sprintf("docker rm -f caddy 2>/dev/null || true && docker run -d "+
+		"--name caddy --network %s --restart unless-stopped %s "+
+		"-p 80:80 -p 443:443 -p 443:443/udp "+
+		"%s -v %s:%s -v caddy_data:/data %s%s",
+		constants.NetworkName, constants.DockerLogOptions,
+		mounts, constants.CaddyLogsDir, containerLogsDir, Image, command)
+}
+
+// ValidateImageCommand returns the command validating the live config of
+// the caddy container with the Caddy binary of another image. The
+// throwaway container shares the mounts of the caddy container and no
+// network: in Caddyfile mode the main Caddyfile is validated with every app
+// config it imports, in API mode the config autosaved by the admin API
+// (the setup config before any app was added).
+func ValidateImageCommand(image string, apiMode bool) string {
+	validate := "caddy validate --config /etc/caddy/Caddyfile --adapter caddyfile"
+	if apiMode {
+		validate = "sh -c 'if [ -f /config/caddy/autosave.json ]; then caddy validate --config /config/caddy/autosave.json; " +
+			"else caddy validate --config /etc/caddy/caddy.json; fi'"
+	}
+	return fmt.Sprintf("docker run --rm --network none --volumes-from caddy %s %s", image, validate)
+}
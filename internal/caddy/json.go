@@ -0,0 +1,465 @@
+package caddy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/yoanbernabeu/frankendeploy/internal/config"
+	"github.com/yoanbernabeu/frankendeploy/internal/constants"
+	"github.com/yoanbernabeu/frankendeploy/internal/security"
+)
+
+// JSON config layout used in API mode. Every app is one route of the
+// "frankendeploy" HTTP server, addressed by its @id so it can be read,
+// patched or deleted without touching the other apps.
+const (
+	apiServerName = "frankendeploy"
+	routeIDPrefix = "frankendeploy-"
+	// containerAdminDir is where constants.CaddyAdminDir is mounted
+	containerAdminDir = "/run/caddy"
+	// containerLogsDir is where constants.CaddyLogsDir is mounted
+	containerLogsDir = "/config/logs"
+)
+
+// RouteID returns the @id of an app's route in the JSON config. It also
+// names the app's access logger.
+func RouteID(appName string) string {
+	return routeIDPrefix + appName
+}
+
+// object is a JSON object of the Caddy config
+type object = map[string]any
+
+// privateRanges is the expansion of the Caddyfile "private_ranges"
+// shorthand, which the JSON config does not understand
+var privateRanges = []string{
+	"192.168.0.0/16",
+	"172.16.0.0/12",
+	"10.0.0.0/8",
+	"127.0.0.1/8",
+	"fd00::/8",
+	"::1",
+}
+
+// GenerateAPIMainConfig generates the initial JSON config of a Caddy
+// container running in API mode: an admin API on a unix socket, an empty
+// HTTP server for the app routes, and the ACME account email. Routes are
+// added later through the admin API and persisted by Caddy (--resume).
+func (g *ConfigGenerator) GenerateAPIMainConfig(email string) ([]byte, error) {
+	if email == "" {
+		email = constants.DefaultCertEmail
+	}
+
+	cfg := object{
+		"admin": object{
+			// The socket is only reachable through the admin dir (0700 on
+			// the host): no TCP port is published, and Caddy skips the
+			// Host/Origin checks on unix sockets
+			"listen": "unix/" + containerAdminDir + "/admin.sock|0666",
+			"config": object{"persist": true},
+		},
+		"logging": object{
+			"logs": object{
+				// Access logs go to per-app files, not to the container output
+				"default": object{"exclude": []string{"http.log.access"}},
+			},
+		},
+		"apps": object{
+			"http": object{
+				"servers": object{
+					apiServerName: object{
+						"listen": []string{":443"},
+						"routes": []any{},
+						"logs":   object{"logger_names": object{}},
+					},
+				},
+			},
+			"tls": object{
+				"automation": object{
+					"policies": []any{
+						object{"issuers": []any{object{"module": "acme", "email": email}}},
+					},
+				},
+			},
+		},
+	}
+
+	return json.MarshalIndent(cfg, "", "  ")
+}
+
+// errOnDemandAPI refuses on-demand TLS in API mode: the catch-all route
+// would have to stay last in the route list, which per-app routes
+// appended through the admin API cannot guarantee.
+var errOnDemandAPI = errors.New("deploy.tls.mode on_demand is not supported when the server manages Caddy through the admin API (caddy_mode: api)")
+
+// GenerateAppRoute generates the JSON route of an application, equivalent
+// to the site block of GenerateAppConfig. Raw Caddyfile snippets cannot be
+// translated and are refused.
+func (g *ConfigGenerator) GenerateAppRoute(app AppConfig) ([]byte, error) {
+	app, err := prepareAppConfig(app)
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(app.Directives.Raw) != "" {
+		return nil, fmt.Errorf("deploy.caddy.raw is a Caddyfile snippet and is not supported when the server manages Caddy through the admin API (caddy_mode: api)")
+	}
+	if app.TLSMode == config.TLSModeOnDemand {
+		return nil, errOnDemandAPI
+	}
+
+	data := newAppTemplateData(app)
+	var routes []any
+
+	if data.MaxBodySize != "" {
+		size, err := parseByteSize(data.MaxBodySize)
+		if err != nil {
+			return nil, err
+		}
+		routes = append(routes, handle(object{"handler": "request_body", "max_size": size}))
+	}
+
+	set := object{}
+	for _, h := range data.Headers {
+		set[h.Name] = []string{h.Value}
+	}
+	routes = append(routes, handle(object{
+		"handler": "headers",
+		"response": object{
+			"set":      set,
+			"delete":   []string{"Server"},
+			"deferred": true,
+		},
+	}))
+	for _, rule := range data.CacheRules {
+		route := handle(object{
+			"handler": "headers",
+			"response": object{
+				"set":      object{"Cache-Control": []string{rule.Value}},
+				"deferred": true,
+			},
+		})
+		route["match"] = []any{object{"path": []string{rule.Path}}}
+		routes = append(routes, route)
+	}
+
+	if d := app.Directives; len(d.IPDeny) > 0 {
+		route := handle(object{"handler": "error", "status_code": 403})
+		route["match"] = []any{object{"remote_ip": object{"ranges": expandIPRanges(d.IPDeny)}}}
+		routes = append(routes, route)
+	}
+	if d := app.Directives; len(d.IPAllow) > 0 {
+		route := handle(object{"handler": "error", "status_code": 403})
+		route["match"] = []any{object{"not": []any{object{"remote_ip": object{"ranges": expandIPRanges(d.IPAllow)}}}}}
+		routes = append(routes, route)
+	}
+	for _, rule := range data.BasicAuth {
+		route := handle(basicAuthHandler(rule.Users))
+		route["match"] = []any{object{"path": []string{rule.Path}}}
+		routes = append(routes, route)
+	}
+	if p := app.Protect; p != nil {
+		route := handle(basicAuthHandler(data.Protect.Users))
+		if len(p.Exempt) > 0 {
+			route["match"] = []any{object{"not": []any{object{"path": p.Exempt}}}}
+		}
+		routes = append(routes, route)
+	}
+
+	routes = append(routes,
+		handle(object{
+			"handler":   "encode",
+			"encodings": object{"zstd": object{}, "gzip": object{}},
+			"prefer":    []string{"zstd", "gzip"},
+		}),
+		handle(object{
+			"handler":   "reverse_proxy",
+			"upstreams": []any{object{"dial": fmt.Sprintf("%s:%d", app.Name, app.Port)}},
+			"health_checks": object{
+				"active": object{
+					"uri":      app.HealthPath,
+					"interval": "30s",
+					"timeout":  "5s",
+				},
+			},
+		}),
+	)
+
+	route := object{
+		"@id":      RouteID(app.Name),
+		"match":    []any{object{"host": []string{app.Domain}}},
+		"handle":   []any{object{"handler": "subroute", "routes": routes}},
+		"terminal": true,
+	}
+	return json.MarshalIndent(route, "", "  ")
+}
+
+// appLogConfig returns the access logger of an app, writing JSON lines to
+// the same file as the Caddyfile mode
+func appLogConfig(appName string) object {
+	return object{
+		"writer": object{
+			"output":   "file",
+			"filename": containerLogsDir + "/" + appName + ".log",
+		},
+		"encoder": object{"format": "json"},
+		"include": []string{"http.log.access." + RouteID(appName)},
+	}
+}
+
+// routeHosts extracts the host matchers of a JSON route
+func routeHosts(route []byte) ([]string, error) {
+	var parsed struct {
+		Match []struct {
+			Host []string `json:"host"`
+		} `json:"match"`
+	}
+	if err := json.Unmarshal(route, &parsed); err != nil {
+		return nil, fmt.Errorf("invalid route JSON: %w", err)
+	}
+	var hosts []string
+	for _, m := range parsed.Match {
+		hosts = append(hosts, m.Host...)
+	}
+	return hosts, nil
+}
+
+// handle wraps handlers into a subroute entry
+func handle(handlers ...object) object {
+	list := make([]any, len(handlers))
+	for i, h := range handlers {
+		list[i] = h
+	}
+	return object{"handle": list}
+}
+
+// basicAuthHandler builds an http_basic authentication handler from sorted
+// username/bcrypt pairs
+func basicAuthHandler(users []header) object {
+	accounts := make([]any, 0, len(users))
+	for _, u := range users {
+		accounts = append(accounts, object{"username": u.Name, "password": u.Value})
+	}
+	return object{
+		"handler": "authentication",
+		"providers": object{
+			"http_basic": object{
+				"accounts":   accounts,
+				"hash":       object{"algorithm": "bcrypt"},
+				"hash_cache": object{},
+			},
+		},
+	}
+}
+
+// expandIPRanges replaces the "private_ranges" shorthand by its CIDRs
+func expandIPRanges(values []string) []string {
+	var ranges []string
+	for _, v := range values {
+		if v == "private_ranges" {
+			ranges = append(ranges, privateRanges...)
+			continue
+		}
+		ranges = append(ranges, v)
+	}
+	return ranges
+}
+
+// byteUnits are the size suffixes accepted by the Caddyfile, as multipliers
+var byteUnits = map[string]int64{
+	"":    1,
+	"kb":  1000,
+	"mb":  1000 * 1000,
+	"gb":  1000 * 1000 * 1000,
+	"tb":  1000 * 1000 * 1000 * 1000,
+	"kib": 1 << 10,
+	"mib": 1 << 20,
+	"gib": 1 << 30,
+	"tib": 1 << 40,
+}
+
+// parseByteSize converts a size such as 10MB or 512KiB to bytes, with the
+// same units as the Caddyfile (MB = 1000², MiB = 1024²)
+func parseByteSize(size string) (int64, error) {
+	i := strings.IndexFunc(size, func(r rune) bool { return r < '0' || r > '9' })
+	if i == -1 {
+		i = len(size)
+	}
+	n, err := strconv.ParseInt(size[:i], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q: %w", size, err)
+	}
+	unit, ok := byteUnits[strings.ToLower(size[i:])]
+	if !ok {
+		return 0, fmt.Errorf("invalid size %q: unknown unit", size)
+	}
+	return n * unit, nil
+}
+
+// Site is an app route found in a live Caddy config
+type Site struct {
+	// App is the app name, from the route @id in API mode or from the
+	// upstream container name otherwise
+	App       string
+	Hosts     []string
+	Upstreams []string
+	// Route is the raw JSON of the route
+	Route json.RawMessage
+}
+
+// ParseSites lists the host-matched routes of a live Caddy config, sorted
+// by server then route order. It reads configs produced by both modes.
+func ParseSites(cfg []byte) ([]Site, error) {
+	var parsed struct {
+		Apps struct {
+			HTTP struct {
+				Servers map[string]struct {
+					Routes []json.RawMessage `json:"routes"`
+				} `json:"servers"`
+			} `json:"http"`
+		} `json:"apps"`
+	}
+	if err := json.Unmarshal(cfg, &parsed); err != nil {
+		return nil, fmt.Errorf("invalid Caddy config: %w", err)
+	}
+
+	names := make([]string, 0, len(parsed.Apps.HTTP.Servers))
+	for name := range parsed.Apps.HTTP.Servers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var sites []Site
+	for _, name := range names {
+		for _, raw := range parsed.Apps.HTTP.Servers[name].Routes {
+			hosts, err := routeHosts(raw)
+			if err != nil || len(hosts) == 0 {
+				continue
+			}
+			var tree any
+			_ = json.Unmarshal(raw, &tree)
+			site := Site{Hosts: hosts, Upstreams: collectDials(tree, nil), Route: raw}
+
+			var meta struct {
+				ID string `json:"@id"`
+			}
+			_ = json.Unmarshal(raw, &meta)
+			switch {
+			case strings.HasPrefix(meta.ID, routeIDPrefix):
+				site.App = strings.TrimPrefix(meta.ID, routeIDPrefix)
+			case len(site.Upstreams) > 0:
+				if host, _, err := net.SplitHostPort(site.Upstreams[0]); err == nil {
+					site.App = host
+				}
+			}
+			sites = append(sites, site)
+		}
+	}
+	return sites, nil
+}
+
+// collectDials gathers the reverse_proxy upstream addresses of a route tree
+func collectDials(node any, dials []string) []string {
+	switch v := node.(type) {
+	case map[string]any:
+		if dial, ok := v["dial"].(string); ok {
+			dials = append(dials, dial)
+		}
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			dials = collectDials(v[k], dials)
+		}
+	case []any:
+		for _, item := range v {
+			dials = collectDials(item, dials)
+		}
+	}
+	return dials
+}
+
+// RouteTLS is the TLS setting applied with an app's route, recorded next
+// to it so `caddy rollback` restores both
+type RouteTLS struct {
+	// Mode is one of the config.TLSMode* values ("" means ACME)
+	Mode   string `json:"mode"`
+	Domain string `json:"domain"`
+}
+
+// SaveRouteCommands returns SSH commands recording the route and TLS
+// setting applied for an app in API mode. The replaced records become the
+// previous ones (kept for `caddy rollback`) unless nothing changed.
+// Returns an error if the heredoc delimiter cannot be generated.
+func SaveRouteCommands(appName string, route []byte, tls RouteTLS) ([]string, error) {
+	delim, err := security.GenerateHeredocDelimiter("ROUTEEOF")
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate delimiter: %w", err)
+	}
+	tlsRecord, err := json.Marshal(tls)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode TLS setting: %w", err)
+	}
+	current := constants.CaddyAppRoute(appName)
+	currentTLS := constants.CaddyAppTLS(appName)
+	return []string{
+		fmt.Sprintf("mkdir -p %s", constants.CaddyAppsDir),
+		fmt.Sprintf("cat > %s << '%s'\n%s\n%s", current+tmpSuffix, delim, route, delim),
+		fmt.Sprintf("cat > %s << '%s'\n%s\n%s", currentTLS+tmpSuffix, delim, tlsRecord, delim),
+		// A route recorded before TLS settings were has no previous TLS
+		fmt.Sprintf("if [ -f %[1]s ] && { ! cmp -s %[1]s %[2]s || ! cmp -s %[4]s %[5]s; }; then "+
+			"mv -f %[1]s %[3]s && if [ -f %[4]s ]; then mv -f %[4]s %[6]s; else rm -f %[6]s; fi; fi && "+
+			"mv -f %[2]s %[1]s && mv -f %[5]s %[4]s",
+			current, current+tmpSuffix, current+prevSuffix,
+			currentTLS, currentTLS+tmpSuffix, currentTLS+prevSuffix),
+	}, nil
+}
+
+// PreviousRoutePath returns the previous recorded route of an app
+func PreviousRoutePath(appName string) string {
+	return constants.CaddyAppRoute(appName) + prevSuffix
+}
+
+// PreviousTLSPath returns the previous recorded TLS setting of an app
+func PreviousTLSPath(appName string) string {
+	return constants.CaddyAppTLS(appName) + prevSuffix
+}
+
+// ParseRouteTLS decodes a recorded TLS setting
+func ParseRouteTLS(record []byte) (RouteTLS, error) {
+	var tls RouteTLS
+	if err := json.Unmarshal(record, &tls); err != nil {
+		return RouteTLS{}, fmt.Errorf("invalid recorded TLS setting: %w", err)
+	}
+	return tls, nil
+}
+
+// RestorePreviousRouteCommands returns SSH commands swapping the recorded
+// route and TLS setting of an app with the previous ones, once they have
+// been applied through the admin API
+func RestorePreviousRouteCommands(appName string) []string {
+	current := constants.CaddyAppRoute(appName)
+	currentTLS := constants.CaddyAppTLS(appName)
+	return []string{
+		fmt.Sprintf("mv -f %[2]s %[3]s && if [ -f %[1]s ]; then mv -f %[1]s %[2]s; fi && mv -f %[3]s %[1]s",
+			current, current+prevSuffix, current+tmpSuffix),
+		fmt.Sprintf("rm -f %[3]s && if [ -f %[2]s ]; then mv -f %[2]s %[3]s; fi && "+
+			"if [ -f %[1]s ]; then mv -f %[1]s %[2]s; fi && if [ -f %[3]s ]; then mv -f %[3]s %[1]s; fi",
+			currentTLS, currentTLS+prevSuffix, currentTLS+tmpSuffix),
+	}
+}
+
+// RemoveRouteFilesCommand returns the SSH command deleting the recorded
+// routes and TLS settings of an app
+func RemoveRouteFilesCommand(appName string) string {
+	current := constants.CaddyAppRoute(appName)
+	currentTLS := constants.CaddyAppTLS(appName)
+	return fmt.Sprintf("rm -f %s %s %s %s %s %s", current, current+tmpSuffix, current+prevSuffix,
+		currentTLS, currentTLS+tmpSuffix, currentTLS+prevSuffix)
+}
@@ -0,0 +1,255 @@
+package caddy
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/yoanbernabeu/frankendeploy/internal/config"
+)
+
+func TestGenerateAppRoute(t *testing.T) {
+	hash := "$2a$10$" + strings.Repeat("a", 53)
+	gen := NewConfigGenerator()
+	out, err := gen.GenerateAppRoute(AppConfig{
+		Name:       "myapp",
+		Domain:     "example.com",
+		HealthPath: "/health",
+		Directives: config.CaddyConfig{
+			MaxBodySize:  "20MB",
+			IPAllow:      []string{"private_ranges"},
+			CacheControl: map[string]string{"/build/*": "public, max-age=31536000"},
+		},
+		Protect: &ProtectRule{Users: map[string]string{"alice": hash}, Exempt: []string{"/health"}},
+	})
+	if err != nil {
+		t.Fatalf("GenerateAppRoute: %v", err)
+	}
+
+	var route map[string]any
+	if err := json.Unmarshal(out, &route); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, out)
+	}
+	if route["@id"] != "frankendeploy-myapp" {
+		t.Errorf("@id = %v", route["@id"])
+	}
+	hosts, _ := routeHosts(out)
+	if len(hosts) != 1 || hosts[0] != "example.com" {
+		t.Errorf("hosts = %v", hosts)
+	}
+
+	for _, want := range []string{
+		`"max_size": 20000000`,
+		`"10.0.0.0/8"`,
+		`"Cache-Control": [`,
+		`"X-Frame-Options": [`,
+		`"algorithm": "bcrypt"`,
+		`"password": "` + hash + `"`,
+		`"dial": "myapp:8080"`,
+		`"uri": "/health"`,
+	} {
+		if !strings.Contains(string(out), want) {
+			t.Errorf("route missing %s\n%s", want, out)
+		}
+	}
+	if strings.Contains(string(out), "private_ranges") {
+		t.Error("private_ranges must be expanded: the JSON config does not know the shorthand")
+	}
+}
+
+func TestGenerateAppRoute_RejectsRawSnippet(t *testing.T) {
+	gen := NewConfigGenerator()
+	_, err := gen.GenerateAppRoute(AppConfig{
+		Name:       "myapp",
+		Domain:     "example.com",
+		Directives: config.CaddyConfig{Raw: "respond /ping 204"},
+	})
+	if err == nil || !strings.Contains(err.Error(), "deploy.caddy.raw") {
+		t.Errorf("expected raw snippet error, got: %v", err)
+	}
+}
+
+func TestGenerateAppRoute_RejectsOnDemandTLS(t *testing.T) {
+	_, err := NewConfigGenerator().GenerateAppRoute(AppConfig{
+		Name:        "saas",
+		Domain:      "saas.example.com",
+		TLSMode:     config.TLSModeOnDemand,
+		OnDemandAsk: "/tls/allowed",
+	})
+	if err == nil || !strings.Contains(err.Error(), "caddy_mode: api") {
+		t.Errorf("expected on-demand TLS to be refused in API mode, got: %v", err)
+	}
+}
+
+func TestGenerateAPIMainConfig(t *testing.T) {
+	out, err := NewConfigGenerator().GenerateAPIMainConfig("ops@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`"unix//run/caddy/admin.sock|0666"`, `"ops@example.com"`, `"frankendeploy": {`} {
+		if !strings.Contains(string(out), want) {
+			t.Errorf("main config missing %s\n%s", want, out)
+		}
+	}
+}
+
+func TestParseByteSize(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int64
+	}{
+		{"1024", 1024},
+		{"10MB", 10_000_000},
+		{"10mb", 10_000_000},
+		{"512KiB", 512 * 1024},
+		{"1GB", 1_000_000_000},
+	}
+	for _, tt := range tests {
+		got, err := parseByteSize(tt.in)
+		if err != nil || got != tt.want {
+			t.Errorf("parseByteSize(%q) = %d, %v; want %d", tt.in, got, err, tt.want)
+		}
+	}
+	if _, err := parseByteSize("10XB"); err == nil {
+		t.Error("expected error for unknown unit")
+	}
+}
+
+func TestParseSites(t *testing.T) {
+	live := `{"apps":{"http":{"servers":{
+		"srv0":{"routes":[{"match":[{"host":["legacy.example.com"]}],"handle":[{"handler":"subroute","routes":[{"handle":[{"handler":"reverse_proxy","upstreams":[{"dial":"legacy:8080"}]}]}]}]}]},
+		"frankendeploy":{"routes":[{"@id":"frankendeploy-myapp","match":[{"host":["example.com","www.example.com"]}],"handle":[{"handler":"subroute","routes":[{"handle":[{"handler":"reverse_proxy","upstreams":[{"dial":"myapp:8080"}]}]}]}]}]}
+	}}}}`
+	sites, err := ParseSites([]byte(live))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sites) != 2 {
+		t.Fatalf("expected 2 sites, got %+v", sites)
+	}
+	if sites[0].App != "myapp" || len(sites[0].Hosts) != 2 || sites[0].Upstreams[0] != "myapp:8080" {
+		t.Errorf("API mode site = %+v", sites[0])
+	}
+	if sites[1].App != "legacy" || sites[1].Hosts[0] != "legacy.example.com" {
+		t.Errorf("Caddyfile mode site = %+v", sites[1])
+	}
+}
+
+func TestSaveRouteCommands_KeepsPreviousAndRestores(t *testing.T) {
+	dir := t.TempDir()
+	saves := []struct {
+		route string
+		tls   RouteTLS
+	}{
+		{`{"v":1}`, RouteTLS{Mode: config.TLSModeCustom, Domain: "example.com"}},
+		{`{"v":2}`, RouteTLS{Domain: "example.com"}},
+		{`{"v":2}`, RouteTLS{Domain: "example.com"}},
+	}
+	for _, save := range saves {
+		cmds, err := SaveRouteCommands("myapp", []byte(save.route), save.tls)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := runCaddyCommands(t, dir, cmds, 0); err != nil {
+			t.Fatalf("save %s: %v", save.route, err)
+		}
+	}
+	if got := readAppFile(t, dir, "myapp.json"); got != "{\"v\":2}\n" {
+		t.Errorf("recorded route = %q", got)
+	}
+	// Saving the same route twice must not overwrite the previous one
+	if got := readAppFile(t, dir, "myapp.json.prev"); got != "{\"v\":1}\n" {
+		t.Errorf("previous route = %q", got)
+	}
+	if tls, err := ParseRouteTLS([]byte(readAppFile(t, dir, "myapp.tls.prev"))); err != nil || tls.Mode != config.TLSModeCustom {
+		t.Errorf("previous TLS setting = %+v, %v", tls, err)
+	}
+
+	if err := runCaddyCommands(t, dir, RestorePreviousRouteCommands("myapp"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if got := readAppFile(t, dir, "myapp.json"); got != "{\"v\":1}\n" {
+		t.Errorf("after restore, recorded route = %q", got)
+	}
+	if got := readAppFile(t, dir, "myapp.json.prev"); got != "{\"v\":2}\n" {
+		t.Errorf("after restore, previous route = %q", got)
+	}
+	if tls, err := ParseRouteTLS([]byte(readAppFile(t, dir, "myapp.tls"))); err != nil || tls.Mode != config.TLSModeCustom {
+		t.Errorf("after restore, recorded TLS setting = %+v, %v", tls, err)
+	}
+	if tls, err := ParseRouteTLS([]byte(readAppFile(t, dir, "myapp.tls.prev"))); err != nil || tls.Mode != "" {
+		t.Errorf("after restore, previous TLS setting = %+v, %v", tls, err)
+	}
+
+	if err := runCaddyCommands(t, dir, []string{RemoveRouteFilesCommand("myapp")}, 0); err != nil {
+		t.Fatal(err)
+	}
+	if entries, _ := os.ReadDir(filepath.Join(dir, "apps")); len(entries) != 0 {
+		t.Errorf("recorded routes should be removed, found %d files", len(entries))
+	}
+}
+
+func TestSaveRouteCommands_RouteRecordedWithoutTLS(t *testing.T) {
+	dir := t.TempDir()
+	// A route recorded before TLS settings were
+	if err := os.MkdirAll(filepath.Join(dir, "apps"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "apps", "myapp.json"), []byte("{\"v\":1}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cmds, err := SaveRouteCommands("myapp", []byte(`{"v":1}`), RouteTLS{Domain: "example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := runCaddyCommands(t, dir, cmds, 0); err != nil {
+		t.Fatal(err)
+	}
+	if readAppFile(t, dir, "myapp.tls") == "" || readAppFile(t, dir, "myapp.tls.prev") != "" {
+		t.Error("the TLS setting should be recorded, with no previous one")
+	}
+
+	if err := runCaddyCommands(t, dir, RestorePreviousRouteCommands("myapp"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if readAppFile(t, dir, "myapp.tls") != "" || readAppFile(t, dir, "myapp.tls.prev") == "" {
+		t.Error("restoring should swap a missing previous TLS setting too")
+	}
+}
+
+func TestContainerRunCommand(t *testing.T) {
+	caddyfile := ContainerRunCommand(false)
+	if !strings.Contains(caddyfile, "/etc/caddy/Caddyfile:ro") || strings.Contains(caddyfile, "--resume") {
+		t.Errorf("Caddyfile mode command = %s", caddyfile)
+	}
+	api := ContainerRunCommand(true)
+	for _, want := range []string{"/opt/frankendeploy/caddy/admin:/run/caddy", "caddy_api_config:/config/caddy", "--resume"} {
+		if !strings.Contains(api, want) {
+			t.Errorf("API mode command missing %q: %s", want, api)
+		}
+	}
+	if strings.Contains(api, ":2019") {
+		t.Error("the admin API must not be published on a TCP port")
+	}
+}
+
+func TestValidateImageCommand(t *testing.T) {
+	caddyfile := ValidateImageCommand("sha256:abc", false)
+	for _, want := range []string{"--network none", "--volumes-from caddy", "sha256:abc caddy validate", "/etc/caddy/Caddyfile --adapter caddyfile"} {
+		if !strings.Contains(caddyfile, want) {
+			t.Errorf("Caddyfile mode command missing %q: %s", want, caddyfile)
+		}
+	}
+	api := ValidateImageCommand(Image, true)
+	for _, want := range []string{"/config/caddy/autosave.json", "/etc/caddy/caddy.json"} {
+		if !strings.Contains(api, want) {
+			t.Errorf("API mode command missing %q: %s", want, api)
+		}
+	}
+	if strings.Contains(api, "--adapter") {
+		t.Errorf("API mode config is JSON, no adapter: %s", api)
+	}
+}
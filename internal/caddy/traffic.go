@@ -0,0 +1,230 @@
+package caddy
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yoanbernabeu/frankendeploy/internal/security"
+)
+
+// TrafficReport summarizes the access log of an app over a time window
+type TrafficReport struct {
+	App  string    `json:"app"`
+	From time.Time `json:"from,omitempty"`
+	To   time.Time `json:"to,omitempty"`
+	// Window is the requested duration, in seconds
+	Window            float64        `json:"window_seconds"`
+	Requests          int            `json:"requests"`
+	RequestsPerMinute float64        `json:"requests_per_minute"`
+	PeakPerMinute     MinuteCount    `json:"peak_minute"`
+	PerMinute         []MinuteCount  `json:"per_minute"`
+	StatusCodes       map[string]int `json:"status_codes"`
+	StatusClasses     map[string]int `json:"status_classes"`
+	Latency           LatencyStats   `json:"latency_ms"`
+	TopPaths          []Count        `json:"top_paths"`
+	TopClientIPs      []Count        `json:"top_client_ips"`
+	TopUserAgents     []Count        `json:"top_user_agents"`
+	// Skipped counts lines that are not access log entries
+	Skipped int `json:"skipped_lines,omitempty"`
+}
+
+// MinuteCount is the number of requests in one minute
+type MinuteCount struct {
+	Minute time.Time `json:"minute"`
+	Count  int       `json:"count"`
+}
+
+// LatencyStats are request duration percentiles, in milliseconds
+type LatencyStats struct {
+	P50 float64 `json:"p50"`
+	P95 float64 `json:"p95"`
+	P99 float64 `json:"p99"`
+	Max float64 `json:"max"`
+}
+
+// Count is a value of a top-N ranking
+type Count struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+// accessEntry is the subset of a Caddy access log line used for analytics
+type accessEntry struct {
+	TS      float64 `json:"ts"`
+	Request struct {
+		ClientIP string              `json:"client_ip"`
+		RemoteIP string              `json:"remote_ip"`
+		URI      string              `json:"uri"`
+		Headers  map[string][]string `json:"headers"`
+	} `json:"request"`
+	Duration float64 `json:"duration"`
+	Status   int     `json:"status"`
+}
+
+// AccessLogCommand returns the SSH command printing the access log lines of
+// an app written during the last window, gzip-compressed. Rotated files
+// are included. It runs inside the caddy container: log files belong to
+// root there, and busybox provides every tool needed.
+// Returns an error if the heredoc delimiter cannot be generated.
+func AccessLogCommand(appName string, window time.Duration) (string, error) {
+	if err := security.ValidateAppName(appName); err != nil {
+		return "", err
+	}
+	delim, err := security.GenerateHeredocDelimiter("LOGEOF")
+	if err != nil {
+		return "", fmt.Errorf("failed to generate delimiter: %w", err)
+	}
+	seconds := int64(window.Seconds())
+	minutes := int64(math.Ceil(window.Minutes())) + 1
+
+	// Rotated files are named <app>-<timestamp>.log[.gz]: the digit glob
+	// keeps "my" from matching the logs of "my-app". Lines are filtered on
+	// their "ts" field against the server clock.
+	script := fmt.Sprintf(`cd %[1]s || exit 0
+since=$(( $(date +%%s) - %[2]d ))
+find . -maxdepth 1 \( -name '%[3]s.log' -o -name '%[3]s-[0-9][0-9][0-9][0-9]-*.log' -o -name '%[3]s-[0-9][0-9][0-9][0-9]-*.log.gz' \) -mmin -%[4]d | sort | while read -r f; do
+  case "$f" in *.gz) gzip -dc "$f" ;; *) cat "$f" ;; esac
+done | awk -v since="$since" 'match($0, /"ts":[0-9.]+/) && substr($0, RSTART+5, RLENGTH-5) + 0 >= since' | gzip -c`,
+		containerLogsDir, seconds, appName, minutes)
+
+	return fmt.Sprintf("docker exec -i caddy sh -s << '%s'\n%s\n%s", delim, script, delim), nil
+}
+
+// AnalyzeAccessLog builds a traffic report from Caddy JSON access log
+// lines. window is the period the lines cover, used for the average rate;
+// top is the size of the rankings.
+func AnalyzeAccessLog(r io.Reader, appName string, window time.Duration, top int) (*TrafficReport, error) {
+	report := &TrafficReport{
+		App:           appName,
+		Window:        window.Seconds(),
+		StatusCodes:   map[string]int{},
+		StatusClasses: map[string]int{},
+	}
+	perMinute := map[int64]int{}
+	paths := map[string]int{}
+	ips := map[string]int{}
+	agents := map[string]int{}
+	var durations []float64
+	var first, last float64
+
+	reader := bufio.NewReader(r)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(strings.TrimSpace(string(line))) > 0 {
+			var e accessEntry
+			if json.Unmarshal(line, &e) != nil || e.TS == 0 || e.Status == 0 {
+				report.Skipped++
+			} else {
+				report.Requests++
+				if first == 0 || e.TS < first {
+					first = e.TS
+				}
+				if e.TS > last {
+					last = e.TS
+				}
+				perMinute[int64(e.TS)/60]++
+				report.StatusCodes[strconv.Itoa(e.Status)]++
+				report.StatusClasses[fmt.Sprintf("%dxx", e.Status/100)]++
+				durations = append(durations, e.Duration*1000)
+
+				path := e.Request.URI
+				if i := strings.IndexByte(path, '?'); i >= 0 {
+					path = path[:i]
+				}
+				paths[path]++
+
+				ip := e.Request.ClientIP
+				if ip == "" {
+					ip = e.Request.RemoteIP
+				}
+				ips[ip]++
+
+				agent := "-"
+				if ua := e.Request.Headers["User-Agent"]; len(ua) > 0 && ua[0] != "" {
+					agent = ua[0]
+				}
+				agents[agent]++
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read access log: %w", err)
+		}
+	}
+
+	if report.Requests == 0 {
+		return report, nil
+	}
+
+	report.From = unixTime(first)
+	report.To = unixTime(last)
+	if window > 0 {
+		report.RequestsPerMinute = float64(report.Requests) / window.Minutes()
+	}
+
+	// Dense series between the first and last minute, for dashboards
+	for m := int64(first) / 60; m <= int64(last)/60; m++ {
+		mc := MinuteCount{Minute: time.Unix(m*60, 0).UTC(), Count: perMinute[m]}
+		report.PerMinute = append(report.PerMinute, mc)
+		if mc.Count > report.PeakPerMinute.Count {
+			report.PeakPerMinute = mc
+		}
+	}
+
+	sort.Float64s(durations)
+	report.Latency = LatencyStats{
+		P50: percentile(durations, 50),
+		P95: percentile(durations, 95),
+		P99: percentile(durations, 99),
+		Max: durations[len(durations)-1],
+	}
+
+	report.TopPaths = topCounts(paths, top)
+	report.TopClientIPs = topCounts(ips, top)
+	report.TopUserAgents = topCounts(agents, top)
+	return report, nil
+}
+
+// unixTime converts a Caddy "ts" (fractional Unix seconds) to UTC time
+func unixTime(ts float64) time.Time {
+	sec, frac := math.Modf(ts)
+	return time.Unix(int64(sec), int64(frac*1e9)).UTC()
+}
+
+// percentile returns the nearest-rank percentile of sorted values, rounded
+// to 0.1
+func percentile(sorted []float64, p float64) float64 {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return math.Round(sorted[rank-1]*10) / 10
+}
+
+// topCounts returns the n most frequent values, ties broken alphabetically
+func topCounts(counts map[string]int, n int) []Count {
+	list := make([]Count, 0, len(counts))
+	for value, count := range counts {
+		list = append(list, Count{Value: value, Count: count})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Count != list[j].Count {
+			return list[i].Count > list[j].Count
+		}
+		return list[i].Value < list[j].Value
+	})
+	if n > 0 && len(list) > n {
+		list = list[:n]
+	}
+	return list
+}
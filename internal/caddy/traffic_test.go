@@ -0,0 +1,134 @@
+package caddy
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func accessLine(ts float64, ip, uri, ua string, status int, duration float64) string {
+	return fmt.Sprintf(`{"level":"info","ts":%.3f,"logger":"http.log.access.log0","msg":"handled request","request":{"remote_ip":"%s","client_ip":"%s","proto":"HTTP/2.0","method":"GET","host":"example.com","uri":"%s","headers":{"User-Agent":["%s"]}},"duration":%f,"size":12,"status":%d}`,
+		ts, ip, ip, uri, ua, duration, status)
+}
+
+func TestAnalyzeAccessLog(t *testing.T) {
+	base := float64(time.Date(2026, 1, 15, 12, 0, 0, 0, time.UTC).Unix())
+	lines := []string{
+		accessLine(base+1, "1.1.1.1", "/", "curl/8", 200, 0.010),
+		accessLine(base+2, "1.1.1.1", "/api?page=2", "curl/8", 200, 0.020),
+		accessLine(base+3, "2.2.2.2", "/api", "Mozilla/5.0", 404, 0.030),
+		accessLine(base+130, "1.1.1.1", "/api", "Mozilla/5.0", 500, 1.5),
+		`{"level":"info","msg":"not an access entry"}`,
+		"garbage",
+	}
+	report, err := AnalyzeAccessLog(strings.NewReader(strings.Join(lines, "\n")), "myapp", 10*time.Minute, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.Requests != 4 || report.Skipped != 2 {
+		t.Errorf("requests = %d, skipped = %d; want 4, 2", report.Requests, report.Skipped)
+	}
+	if report.RequestsPerMinute != 0.4 {
+		t.Errorf("requests/min = %v, want 0.4", report.RequestsPerMinute)
+	}
+	if len(report.PerMinute) != 3 || report.PerMinute[1].Count != 0 {
+		t.Errorf("per-minute series should be dense, got %+v", report.PerMinute)
+	}
+	if report.PeakPerMinute.Count != 3 {
+		t.Errorf("peak = %+v, want 3", report.PeakPerMinute)
+	}
+	if report.StatusCodes["200"] != 2 || report.StatusClasses["4xx"] != 1 || report.StatusClasses["5xx"] != 1 {
+		t.Errorf("status = %v / %v", report.StatusCodes, report.StatusClasses)
+	}
+	if report.Latency.P50 != 20 || report.Latency.P99 != 1500 || report.Latency.Max != 1500 {
+		t.Errorf("latency = %+v", report.Latency)
+	}
+	if len(report.TopPaths) != 2 || report.TopPaths[0] != (Count{"/api", 3}) {
+		t.Errorf("top paths = %+v (query strings must be stripped)", report.TopPaths)
+	}
+	if report.TopClientIPs[0] != (Count{"1.1.1.1", 3}) {
+		t.Errorf("top IPs = %+v", report.TopClientIPs)
+	}
+	if report.TopUserAgents[0] != (Count{"Mozilla/5.0", 2}) {
+		t.Errorf("top user agents = %+v", report.TopUserAgents)
+	}
+}
+
+func TestAnalyzeAccessLog_Empty(t *testing.T) {
+	report, err := AnalyzeAccessLog(strings.NewReader(""), "myapp", time.Hour, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Requests != 0 || report.PerMinute != nil {
+		t.Errorf("empty log should give an empty report, got %+v", report)
+	}
+}
+
+func TestAccessLogCommand_FiltersWindowAndRotatedFiles(t *testing.T) {
+	dir := t.TempDir()
+	now := float64(time.Now().Unix())
+	old := accessLine(now-7200, "9.9.9.9", "/old", "x", 200, 0.01)
+	recent := accessLine(now-60, "1.1.1.1", "/recent", "x", 200, 0.01)
+	rotated := accessLine(now-120, "1.1.1.1", "/rotated", "x", 200, 0.01)
+
+	write := func(name, content string) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content+"\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("my.log", old+"\n"+recent)
+	write("my-app.log", accessLine(now-10, "5.5.5.5", "/other-app", "x", 200, 0.01))
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	_, _ = io.WriteString(zw, rotated+"\n")
+	_ = zw.Close()
+	write("my-2026-01-15T12-00-00.000.log.gz", gz.String())
+
+	command, err := AccessLogCommand("my", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	command = strings.ReplaceAll(command, containerLogsDir, dir)
+
+	// Fake docker: run the script locally instead of inside the container
+	bin := t.TempDir()
+	if err := os.WriteFile(filepath.Join(bin, "docker"), []byte("#!/bin/sh\nshift 3\nexec \"$@\"\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Env = append(os.Environ(), "PATH="+bin+":"+os.Getenv("PATH"))
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("command failed: %v", err)
+	}
+
+	zr, err := gzip.NewReader(bytes.NewReader(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := io.ReadAll(zr)
+	for _, want := range []string{"/recent", "/rotated"} {
+		if !strings.Contains(string(got), want) {
+			t.Errorf("output missing %s:\n%s", want, got)
+		}
+	}
+	for _, unwanted := range []string{"/old", "/other-app"} {
+		if strings.Contains(string(got), unwanted) {
+			t.Errorf("output should not contain %s:\n%s", unwanted, got)
+		}
+	}
+}
+
+func TestAccessLogCommand_RejectsInvalidAppName(t *testing.T) {
+	if _, err := AccessLogCommand("../etc", time.Hour); err == nil {
+		t.Error("expected error for an invalid app name")
+	}
+}
@@ -0,0 +1,270 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/spf13/cobra"
+	"github.com/yoanbernabeu/frankendeploy/internal/caddy"
+	"github.com/yoanbernabeu/frankendeploy/internal/config"
+	"github.com/yoanbernabeu/frankendeploy/internal/deploy"
+	"github.com/yoanbernabeu/frankendeploy/internal/security"
+	"github.com/yoanbernabeu/frankendeploy/internal/ssh"
+	"golang.org/x/term"
+)
+
+var accessCmd = &cobra.Command{
+	Use:   "access",
+	Short: "Manage basic auth users of a protected app",
+	Long: `Commands to manage the users allowed through the basic auth protection
+of your application (deploy.protect in frankendeploy.yaml).
+
+Users added here are stored on the server as bcrypt hashes and merged with
+the users of frankendeploy.yaml. Changes are applied immediately by
+reloading Caddy: no redeploy is needed.`,
+}
+
+var accessAddCmd = &cobra.Command{
+	Use:   "add <server> <user>",
+	Short: "Add or update a user",
+	Long: `Adds a basic auth user, or changes the password of an existing one.
+
+The password is asked with a hidden prompt (or read from stdin in scripts)
+and hashed locally: plaintext never reaches the server.
+
+Example:
+  frankendeploy access add staging alice
+  echo "s3cret" | frankendeploy access add staging ci-bot`,
+	Args: cobra.ExactArgs(2),
+	RunE: runAccessAdd,
+}
+
+var accessRemoveCmd = &cobra.Command{
+	Use:   "remove <server> <user>",
+	Short: "Remove a user",
+	Long: `Removes a basic auth user added with 'access add'.
+
+Users declared in frankendeploy.yaml must be removed from the file.
+
+Example:
+  frankendeploy access remove staging alice`,
+	Args: cobra.ExactArgs(2),
+	RunE: runAccessRemove,
+}
+
+var accessListCmd = &cobra.Command{
+	Use:   "list <server>",
+	Short: "List users",
+	Long: `Lists the basic auth users of the application.
+
+Example:
+  frankendeploy access list staging`,
+	Args: cobra.ExactArgs(1),
+	RunE: runAccessList,
+}
+
+func init() {
+	rootCmd.AddCommand(accessCmd)
+	accessCmd.AddCommand(accessAddCmd)
+	accessCmd.AddCommand(accessRemoveCmd)
+	accessCmd.AddCommand(accessListCmd)
+}
+
+func runAccessAdd(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	serverName, user := args[0], args[1]
+
+	if err := security.ValidateBasicAuthUsername(user); err != nil {
+		return err
+	}
+
+	password, err := readAccessPassword(user, os.Stdin)
+	if err != nil {
+		return err
+	}
+	hash, err := deploy.HashAccessPassword(password)
+	if err != nil {
+		return err
+	}
+
+	conn, err := ConnectToServer(serverName)
+	if err != nil {
+		return err
+	}
+	defer conn.Client.Close()
+
+	users, err := deploy.ReadAccessUsers(ctx, conn.Client, conn.Project.Name)
+	if err != nil {
+		return err
+	}
+	_, existed := users[user]
+	users[user] = hash
+	if err := deploy.WriteAccessUsers(ctx, conn.Client, conn.Project.Name, users); err != nil {
+		return err
+	}
+
+	if existed {
+		PrintSuccess("Updated password of %s on %s", user, serverName)
+	} else {
+		PrintSuccess("Added %s on %s", user, serverName)
+	}
+
+	return applyAccessChange(ctx, conn)
+}
+
+func runAccessRemove(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	serverName, user := args[0], args[1]
+
+	conn, err := ConnectToServer(serverName)
+	if err != nil {
+		return err
+	}
+	defer conn.Client.Close()
+
+	users, err := deploy.ReadAccessUsers(ctx, conn.Client, conn.Project.Name)
+	if err != nil {
+		return err
+	}
+	if _, ok := users[user]; !ok {
+		if p := conn.Project.Deploy.Protect; p != nil {
+			if _, inConfig := p.Users[user]; inConfig {
+				return fmt.Errorf("user %s is declared in frankendeploy.yaml (deploy.protect.users): remove it there and redeploy", user)
+			}
+		}
+		return fmt.Errorf("user %s not found", user)
+	}
+
+	delete(users, user)
+	if err := deploy.WriteAccessUsers(ctx, conn.Client, conn.Project.Name, users); err != nil {
+		return err
+	}
+	PrintSuccess("Removed %s from %s", user, serverName)
+
+	return applyAccessChange(ctx, conn)
+}
+
+func runAccessList(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	serverName := args[0]
+
+	conn, err := ConnectToServer(serverName)
+	if err != nil {
+		return err
+	}
+	defer conn.Client.Close()
+
+	serverUsers, err := deploy.ReadAccessUsers(ctx, conn.Client, conn.Project.Name)
+	if err != nil {
+		return err
+	}
+
+	sources := make(map[string]string)
+	if p := conn.Project.Deploy.Protect; p != nil {
+		for user := range p.Users {
+			sources[user] = "frankendeploy.yaml"
+		}
+	}
+	for user := range serverUsers {
+		sources[user] = "server"
+	}
+
+	if len(sources) == 0 {
+		PrintInfo("%s is not protected on %s", conn.Project.Name, serverName)
+		return nil
+	}
+
+	names := make([]string, 0, len(sources))
+	for name := range sources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Printf("Users of %s on %s:\n\n", conn.Project.Name, serverName)
+	for _, name := range names {
+		fmt.Printf("  %-24s (%s)\n", name, sources[name])
+	}
+
+	return nil
+}
+
+// applyAccessChange re-renders the app's Caddy config so a users change is
+// live without a redeploy.
+func applyAccessChange(ctx context.Context, conn *ServerConnection) error {
+	if conn.Project.Deploy.Domain == "" {
+		PrintInfo("No domain configured: the change will apply once the app is exposed")
+		return nil
+	}
+	if err := updateCaddyConfig(ctx, conn.Client, caddyAdminFor(conn.Client, conn.Server), conn.Project); err != nil {
+		return fmt.Errorf("users saved but Caddy was not updated: %w", err)
+	}
+	return nil
+}
+
+// resolveProtectRule builds the site-wide basic auth rule of an app from
+// deploy.protect (plaintext hashed locally) and the users stored on the
+// server. Server-side users win on a name clash: they are the most recent
+// change. Returns nil when the app is not protected.
+func resolveProtectRule(ctx context.Context, client ssh.Executor, cfg *config.ProjectConfig) (*caddy.ProtectRule, error) {
+	serverUsers, err := deploy.ReadAccessUsers(ctx, client, cfg.Name)
+	if err != nil {
+		return nil, err
+	}
+	protect := cfg.Deploy.Protect
+	if protect == nil && len(serverUsers) == 0 {
+		return nil, nil
+	}
+
+	rule := &caddy.ProtectRule{Users: map[string]string{}}
+	if protect != nil {
+		hashed, err := deploy.HashAccessUsers(protect.Users)
+		if err != nil {
+			return nil, fmt.Errorf("deploy.protect: %w", err)
+		}
+		rule.Users = hashed
+	}
+	for user, hash := range serverUsers {
+		rule.Users[user] = hash
+	}
+
+	// The healthcheck path stays reachable for external monitors. "/" is
+	// never exempted: that would expose the home page.
+	if health := cfg.Deploy.HealthcheckPath; health != "" && health != "/" {
+		rule.Exempt = append(rule.Exempt, health)
+	}
+	if protect != nil {
+		rule.Exempt = append(rule.Exempt, protect.Exempt...)
+	}
+
+	return rule, nil
+}
+
+// readAccessPassword reads a password with a confirmed hidden prompt on a
+// terminal, or from stdin in scripts.
+func readAccessPassword(user string, stdin *os.File) (string, error) {
+	if !term.IsTerminal(int(stdin.Fd())) {
+		return readStdinValue(stdin)
+	}
+
+	fmt.Printf("Password for %s (input hidden): ", user)
+	first, err := term.ReadPassword(int(stdin.Fd()))
+	fmt.Println()
+	if err != nil {
+		return "", fmt.Errorf("failed to read password: %w", err)
+	}
+	fmt.Print("Confirm password: ")
+	second, err := term.ReadPassword(int(stdin.Fd()))
+	fmt.Println()
+	if err != nil {
+		return "", fmt.Errorf("failed to read password: %w", err)
+	}
+	if string(first) != string(second) {
+		return "", fmt.Errorf("passwords do not match")
+	}
+	if len(first) == 0 {
+		return "", fmt.Errorf("password cannot be empty")
+	}
+	return string(first), nil
+}
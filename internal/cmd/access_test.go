@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/yoanbernabeu/frankendeploy/internal/config"
+	"github.com/yoanbernabeu/frankendeploy/internal/security"
+	"github.com/yoanbernabeu/frankendeploy/internal/ssh"
+)
+
+func TestResolveProtectRule_NotProtected(t *testing.T) {
+	mock := &ssh.MockExecutor{}
+	cfg := &config.ProjectConfig{Name: "my-app"}
+
+	rule, err := resolveProtectRule(context.Background(), mock, cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if rule != nil {
+		t.Errorf("expected no protection, got %+v", rule)
+	}
+}
+
+func TestResolveProtectRule_MergesConfigAndServerUsers(t *testing.T) {
+	serverHash := "$2a$10$" + strings.Repeat("s", 53)
+	mock := &ssh.MockExecutor{
+		ExecFunc: func(ctx context.Context, command string) (*ssh.ExecResult, error) {
+			if strings.Contains(command, "/opt/frankendeploy/apps/my-app/access") {
+				return &ssh.ExecResult{Stdout: "carol:" + serverHash + "\n"}, nil
+			}
+			return &ssh.ExecResult{}, nil
+		},
+	}
+	cfg := &config.ProjectConfig{
+		Name: "my-app",
+		Deploy: config.DeployConfig{
+			HealthcheckPath: "/health",
+			Protect: &config.ProtectConfig{
+				Users:  map[string]string{"alice": "plaintext"},
+				Exempt: []string{"/webhooks/*"},
+			},
+		},
+	}
+
+	rule, err := resolveProtectRule(context.Background(), mock, cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !security.IsBcryptHash(rule.Users["alice"]) {
+		t.Errorf("plaintext password must be hashed locally, got %q", rule.Users["alice"])
+	}
+	if rule.Users["carol"] != serverHash {
+		t.Errorf("server-side user missing: %v", rule.Users)
+	}
+	if strings.Join(rule.Exempt, " ") != "/health /webhooks/*" {
+		t.Errorf("unexpected exemptions: %v", rule.Exempt)
+	}
+}
+
+func TestResolveProtectRule_RootHealthPathNotExempt(t *testing.T) {
+	mock := &ssh.MockExecutor{}
+	cfg := &config.ProjectConfig{
+		Name: "my-app",
+		Deploy: config.DeployConfig{
+			HealthcheckPath: "/",
+			Protect:         &config.ProtectConfig{Users: map[string]string{"alice": "pw"}},
+		},
+	}
+
+	rule, err := resolveProtectRule(context.Background(), mock, cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(rule.Exempt) != 0 {
+		t.Errorf("exempting / would expose the home page, got: %v", rule.Exempt)
+	}
+}
+
+func TestUpdateCaddyConfig_NeverSendsPlaintextPassword(t *testing.T) {
+	var commands []string
+	mock := &ssh.MockExecutor{
+		ExecFunc: func(ctx context.Context, command string) (*ssh.ExecResult, error) {
+			commands = append(commands, command)
+			if strings.Contains(command, "docker inspect caddy") {
+				return &ssh.ExecResult{Stdout: "running\n"}, nil
+			}
+			return &ssh.ExecResult{}, nil
+		},
+	}
+	cfg := &config.ProjectConfig{
+		Name: "my-app",
+		Deploy: config.DeployConfig{
+			Domain:  "staging.example.com",
+			Protect: &config.ProtectConfig{Users: map[string]string{"alice": "hunter2-plaintext"}},
+		},
+	}
+
+	if err := updateCaddyConfig(context.Background(), mock, nil, cfg); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	joined := strings.Join(commands, "\n")
+	if strings.Contains(joined, "hunter2-plaintext") {
+		t.Error("plaintext password must never be sent to the server")
+	}
+	if !strings.Contains(joined, "basic_auth") {
+		t.Error("protected app config should contain basic_auth")
+	}
+}
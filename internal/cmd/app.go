@@ -5,9 +5,11 @@ import (
 	"strings"
 
 	"github.com/spf13/cobra"
+	"github.com/yoanbernabeu/frankendeploy/internal/caddy"
 	"github.com/yoanbernabeu/frankendeploy/internal/config"
 	"github.com/yoanbernabeu/frankendeploy/internal/constants"
 	"github.com/yoanbernabeu/frankendeploy/internal/security"
+	"github.com/yoanbernabeu/frankendeploy/internal/ssh"
 )
 
 var appCmd = &cobra.Command{
@@ -90,27 +92,32 @@ func runAppList(cmd *cobra.Command, args []string) error {
 		return nil
 	}
 
-	fmt.Printf("Applications on %s:\n\n", serverName)
-
+	var names []string
+	var probes []string
 	for _, app := range strings.Split(apps, "\n") {
 		if app == "" {
 			continue
 		}
+		names = append(names, app)
+		probes = append(probes,
+			fmt.Sprintf("docker ps --filter name=%s --format '{{.Status}}' 2>/dev/null", app),
+			fmt.Sprintf("readlink %s/current 2>/dev/null | xargs basename", constants.AppBasePath(app)))
+	}
 
-		// Get container status
-		status := ""
-		if statusResult, err := conn.Client.Exec(ctx, fmt.Sprintf("docker ps --filter name=%s --format '{{.Status}}' 2>/dev/null", app)); err == nil && statusResult != nil {
-			status = strings.TrimSpace(statusResult.Stdout)
-		}
+	// Status and release of every app in one round trip
+	results, err := ssh.ExecBatch(ctx, conn.Client, probes)
+	if err != nil {
+		return fmt.Errorf("failed to read apps status: %w", err)
+	}
+
+	fmt.Printf("Applications on %s:\n\n", serverName)
+
+	for i, app := range names {
+		status := strings.TrimSpace(results[2*i].Stdout)
 		if status == "" {
 			status = "stopped"
 		}
-
-		// Get current release
-		release := ""
-		if releaseResult, err := conn.Client.Exec(ctx, fmt.Sprintf("readlink %s/current 2>/dev/null | xargs basename", constants.AppBasePath(app))); err == nil && releaseResult != nil {
-			release = strings.TrimSpace(releaseResult.Stdout)
-		}
+		release := strings.TrimSpace(results[2*i+1].Stdout)
 		if release == "" {
 			release = "-"
 		}
@@ -187,14 +194,25 @@ func runAppRemove(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("failed to remove app directory: %w", err)
 	}
 
-	// Remove Caddy config
-	if _, err := conn.Client.Exec(ctx, fmt.Sprintf("rm -f %s", constants.CaddyAppConfig(appName))); err != nil {
-		PrintVerbose("Could not remove Caddy config: %v", err)
+	// Remove Caddy config (with its previous/temp siblings) and reload, or
+	// delete the app's route through the admin API
+	if admin := caddyAdminFor(conn.Client, conn.Server); admin != nil {
+		if err := admin.RemoveRoute(ctx, appName); err != nil {
+			PrintWarning("Could not remove Caddy route: %v", err)
+		}
+		if _, err := conn.Client.Exec(ctx, caddy.RemoveRouteFilesCommand(appName)); err != nil {
+			PrintVerbose("Could not remove recorded Caddy route: %v", err)
+		}
+	} else {
+		for _, command := range caddy.RemoveAppConfigCommands(appName) {
+			if _, err := conn.Client.Exec(ctx, command+" 2>/dev/null || true"); err != nil {
+				PrintVerbose("Could not remove Caddy config: %v", err)
+			}
+		}
 	}
 
-	// Reload Caddy
-	if _, err := conn.Client.Exec(ctx, "docker exec caddy caddy reload --config /etc/caddy/Caddyfile 2>/dev/null || true"); err != nil {
-		PrintVerbose("Could not reload Caddy: %v", err)
+	if _, err := conn.Client.Exec(ctx, caddy.RemoveCertsCommand(appName)+" 2>/dev/null || true"); err != nil {
+		PrintVerbose("Could not remove custom certificate: %v", err)
 	}
 
 	// Remove Docker images
@@ -12,7 +12,8 @@ import (
 // docker-entrypoint.sh, .dockerignore) if they are missing, so that
 // `deploy` works right after `init` without requiring a manual `build`.
 // Existing files are never overwritten: users may have customized them.
-func ensureDockerArtifacts(cfg *config.ProjectConfig) error {
+// forwardAgent mounts the forwarded ssh-agent in the composer steps.
+func ensureDockerArtifacts(cfg *config.ProjectConfig, forwardAgent bool) error {
 	type artifact struct {
 		path  string
 		write func(*generator.DockerfileGenerator) error
@@ -36,6 +37,7 @@ func ensureDockerArtifacts(cfg *config.ProjectConfig) error {
 
 	PrintInfo("Docker artifacts missing — generating them (equivalent to 'frankendeploy build')")
 	gen := generator.NewDockerfileGenerator(cfg)
+	gen.ForwardAgent = forwardAgent
 	for _, a := range missing {
 		if err := a.write(gen); err != nil {
 			return fmt.Errorf("failed to generate %s: %w", a.path, err)
@@ -20,7 +20,7 @@ func artifactsTestConfig() *config.ProjectConfig {
 func TestEnsureDockerArtifacts_GeneratesAllWhenMissing(t *testing.T) {
 	t.Chdir(t.TempDir())
 
-	if err := ensureDockerArtifacts(artifactsTestConfig()); err != nil {
+	if err := ensureDockerArtifacts(artifactsTestConfig(), false); err != nil {
 		t.Fatalf("ensureDockerArtifacts failed: %v", err)
 	}
 
@@ -53,7 +53,7 @@ func TestEnsureDockerArtifacts_NeverOverwritesExisting(t *testing.T) {
 		}
 	}
 
-	if err := ensureDockerArtifacts(artifactsTestConfig()); err != nil {
+	if err := ensureDockerArtifacts(artifactsTestConfig(), false); err != nil {
 		t.Fatalf("ensureDockerArtifacts failed: %v", err)
 	}
 
@@ -76,7 +76,7 @@ func TestEnsureDockerArtifacts_GeneratesOnlyMissing(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	if err := ensureDockerArtifacts(artifactsTestConfig()); err != nil {
+	if err := ensureDockerArtifacts(artifactsTestConfig(), false); err != nil {
 		t.Fatalf("ensureDockerArtifacts failed: %v", err)
 	}
 
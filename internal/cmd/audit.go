@@ -0,0 +1,509 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/yoanbernabeu/frankendeploy/internal/caddy"
+	"github.com/yoanbernabeu/frankendeploy/internal/config"
+	"github.com/yoanbernabeu/frankendeploy/internal/constants"
+	"github.com/yoanbernabeu/frankendeploy/internal/provision"
+	"github.com/yoanbernabeu/frankendeploy/internal/security"
+	"github.com/yoanbernabeu/frankendeploy/internal/ssh"
+)
+
+// Audit check results
+const (
+	auditPass = "pass"
+	auditWarn = "warn"
+	auditFail = "fail"
+)
+
+// minDockerMajor is the oldest Docker Engine major version still receiving
+// security fixes
+const minDockerMajor = 25
+
+// auditProbeSeparator precedes each section of the audit probe output
+const auditProbeSeparator = "==> "
+
+var serverAuditCmd = &cobra.Command{
+	Use:   "audit <name>",
+	Short: "Check a server against the setup baseline",
+	Long: `Verifies that a server still matches what 'server setup' configured:
+- The firewall enabled, with the SSH ports, 80 and 443 allowed
+- Fail2ban running its sshd jail
+- Docker daemon version and log rotation
+- The frankendeploy Docker network
+- The caddy container image, restart policy and log rotation
+- Ownership of the directories under /opt/frankendeploy
+- Pending security updates
+
+Each check passes, warns or fails. With --fix, the fixes of the failed and
+warned checks are applied, then the audit runs again. The command exits
+with an error when a check fails.
+
+Example:
+  frankendeploy server audit production
+  frankendeploy server audit production --fix
+  frankendeploy server audit production --json`,
+	Args: cobra.ExactArgs(1),
+	RunE: runServerAudit,
+}
+
+var (
+	auditFix  bool
+	auditJSON bool
+)
+
+func init() {
+	serverCmd.AddCommand(serverAuditCmd)
+
+	serverAuditCmd.Flags().BoolVar(&auditFix, "fix", false, "Apply the fixes of the failed and warned checks")
+	serverAuditCmd.Flags().BoolVar(&auditJSON, "json", false, "Output the report as JSON")
+}
+
+// auditResult is the outcome of one audit check
+type auditResult struct {
+	Check   string   `json:"check"`
+	Status  string   `json:"status"`
+	Message string   `json:"message"`
+	Fix     []string `json:"fix,omitempty"`
+}
+
+// auditReport is the JSON output of server audit
+type auditReport struct {
+	Server  string         `json:"server"`
+	Results []auditResult  `json:"results"`
+	Summary map[string]int `json:"summary"`
+	Fixed   []string       `json:"fixed,omitempty"`
+}
+
+func runServerAudit(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	name := args[0]
+
+	conn, err := ConnectToServerNoProject(name)
+	if err != nil {
+		return err
+	}
+	defer conn.Client.Close()
+
+	results, err := auditServer(ctx, conn.Client, conn.Server)
+	if err != nil {
+		return err
+	}
+
+	var fixed []string
+	if auditFix {
+		fixes := auditFixes(results)
+		if len(fixes) > 0 {
+			if !auditJSON {
+				PrintInfo("Applying %d fix(es)...", len(fixes))
+			}
+			if err := runCommandsWithProgress(ctx, conn.Client, fixes); err != nil {
+				return fmt.Errorf("failed to apply fixes: %w", err)
+			}
+			fixed = fixes
+			if results, err = auditServer(ctx, conn.Client, conn.Server); err != nil {
+				return err
+			}
+		}
+	}
+
+	summary := auditSummary(results)
+	if auditJSON {
+		out, err := json.MarshalIndent(auditReport{Server: name, Results: results, Summary: summary, Fixed: fixed}, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(out))
+	} else {
+		printAuditResults(name, results, summary, len(fixed))
+	}
+
+	if summary[auditFail] > 0 {
+		return fmt.Errorf("%d check(s) failed on %s", summary[auditFail], name)
+	}
+	return nil
+}
+
+func printAuditResults(name string, results []auditResult, summary map[string]int, fixed int) {
+	fmt.Printf("Audit of %s:\n\n", name)
+	for _, r := range results {
+		icon := "✅"
+		switch r.Status {
+		case auditWarn:
+			icon = "⚠️ "
+		case auditFail:
+			icon = "❌"
+		}
+		fmt.Printf("  %s %-18s %s\n", icon, r.Check, r.Message)
+	}
+	fmt.Println()
+	fmt.Printf("%d passed, %d warning(s), %d failed\n", summary[auditPass], summary[auditWarn], summary[auditFail])
+	if fixed == 0 && len(auditFixes(results)) > 0 {
+		PrintInfo("Run 'frankendeploy server audit %s --fix' to apply the available fixes", name)
+	}
+}
+
+// auditSummary counts the results by status
+func auditSummary(results []auditResult) map[string]int {
+	summary := map[string]int{auditPass: 0, auditWarn: 0, auditFail: 0}
+	for _, r := range results {
+		summary[r.Status]++
+	}
+	return summary
+}
+
+// auditFixes returns the fix commands of the checks that did not pass, in
+// check order and without duplicates
+func auditFixes(results []auditResult) []string {
+	var fixes []string
+	seen := make(map[string]bool)
+	for _, r := range results {
+		if r.Status == auditPass {
+			continue
+		}
+		for _, fix := range r.Fix {
+			if !seen[fix] {
+				seen[fix] = true
+				fixes = append(fixes, fix)
+			}
+		}
+	}
+	return fixes
+}
+
+// auditServer runs the audit probe on the server and evaluates every check
+func auditServer(ctx context.Context, client ssh.Executor, server *config.ServerConfig) ([]auditResult, error) {
+	provisioner, _, err := detectProvisioner(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+	sshPorts := serverSSHPorts(ctx, client, server)
+
+	probe, err := auditProbeCommand(provisioner)
+	if err != nil {
+		return nil, err
+	}
+	PrintVerbose("  > running audit probe")
+	result, err := client.Exec(ctx, probe)
+	if err != nil {
+		return nil, fmt.Errorf("failed to run audit probe: %w", err)
+	}
+	sections := parseAuditProbe(result.Stdout)
+
+	return []auditResult{
+		auditFirewall(provisioner, sections["firewall"], sshPorts),
+		auditFail2ban(provisioner, sections["fail2ban"]),
+		auditDockerVersion(sections["docker"]),
+		auditDockerLogs(sections["log-driver"], sections["daemon-json"]),
+		auditNetwork(sections["network"]),
+		auditCaddy(sections["caddy"], server.UsesCaddyAPI()),
+		auditOwnership(sections["ownership"]),
+		auditAdminDir(sections["admin-dir"]),
+		auditSecurityUpdates(provisioner, sections["security"]),
+	}, nil
+}
+
+// auditProbeCommand returns the single SSH command gathering everything the
+// audit needs. Each section is printed as "==> <name>", its output, then
+// "exit=<code>". sudo never prompts: a check needing a password reports it.
+func auditProbeCommand(provisioner provision.Provisioner) (string, error) {
+	delimiter, err := security.GenerateHeredocDelimiter("AUDIT")
+	if err != nil {
+		return "", err
+	}
+	sections := []struct{ name, script string }{
+		{"firewall", provisioner.FirewallStatusCommand()},
+		{"fail2ban", "command -v fail2ban-client >/dev/null || { echo 'fail2ban: not installed'; exit 127; }; sudo -n fail2ban-client status sshd"},
+		{"docker", "docker version --format '{{.Server.Version}}'"},
+		{"log-driver", "docker info --format '{{.LoggingDriver}}'"},
+		{"daemon-json", "cat /etc/docker/daemon.json"},
+		{"network", fmt.Sprintf("docker network inspect %s --format '{{.Driver}}'", constants.NetworkName)},
+		{"caddy", `docker inspect caddy --format '{{.Config.Image}}|{{.HostConfig.RestartPolicy.Name}}|{{.State.Status}}|{{index .HostConfig.LogConfig.Config "max-size"}}'`},
+		{"ownership", fmt.Sprintf(`[ -d %[1]s ] || { echo missing; exit 1; }; find %[1]s -maxdepth 2 -type d ! -user "$(id -un)"`, constants.BasePath)},
+		{"admin-dir", fmt.Sprintf("[ ! -d %[1]s ] || stat -c %%a %[1]s", constants.CaddyAdminDir)},
+		{"security", provisioner.SecurityUpdatesCommand()},
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "sh -s << '%s'\n", delimiter)
+	for _, s := range sections {
+		fmt.Fprintf(&b, "echo '%s%s'\n(%s) 2>&1\necho \"exit=$?\"\n", auditProbeSeparator, s.name, s.script)
+	}
+	b.WriteString(delimiter)
+	return b.String(), nil
+}
+
+// auditSection is the output and exit code of one probe section
+type auditSection struct {
+	Output   string
+	ExitCode int
+	// present is false when the section is missing from the probe output
+	present bool
+}
+
+// needsPassword reports whether sudo refused to run without a password
+func (s auditSection) needsPassword() bool {
+	return strings.Contains(s.Output, "a password is required")
+}
+
+// parseAuditProbe splits the output of the audit probe by section
+func parseAuditProbe(out string) map[string]auditSection {
+	sections := make(map[string]auditSection)
+	for _, chunk := range strings.Split(out, "\n"+auditProbeSeparator) {
+		chunk = strings.TrimPrefix(chunk, auditProbeSeparator)
+		name, body, _ := strings.Cut(chunk, "\n")
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		section := auditSection{ExitCode: -1, present: true}
+		body = strings.TrimRight(body, "\n")
+		if i := strings.LastIndex(body, "exit="); i >= 0 && (i == 0 || body[i-1] == '\n') {
+			if code, err := strconv.Atoi(strings.TrimSpace(body[i+len("exit="):])); err == nil {
+				section.ExitCode = code
+				body = body[:i]
+			}
+		}
+		section.Output = strings.TrimSpace(body)
+		sections[name] = section
+	}
+	return sections
+}
+
+// unreachable returns the result of a check whose probe section is missing
+// or could not run
+func unreachable(check string, s auditSection) (auditResult, bool) {
+	switch {
+	case !s.present:
+		return auditResult{Check: check, Status: auditWarn, Message: "cannot check: no probe output"}, true
+	case s.needsPassword():
+		return auditResult{Check: check, Status: auditWarn, Message: "cannot check: sudo requires a password"}, true
+	}
+	return auditResult{}, false
+}
+
+func auditFirewall(provisioner provision.Provisioner, s auditSection, sshPorts []int) auditResult {
+	const check = "firewall"
+	if r, ok := unreachable(check, s); ok {
+		return r
+	}
+	fix := provisioner.FirewallCommands(sshPorts)
+	if s.ExitCode == 127 {
+		return auditResult{Check: check, Status: auditFail, Message: "no firewall installed", Fix: fix}
+	}
+	active, allowed := provisioner.ParseFirewallStatus(s.Output)
+	if s.ExitCode != 0 || !active {
+		return auditResult{Check: check, Status: auditFail, Message: "the firewall is not active", Fix: fix}
+	}
+
+	var missing []string
+	seen := make(map[int]bool)
+	for _, port := range append(append([]int{}, sshPorts...), 80, 443) {
+		if port <= 0 || seen[port] {
+			continue
+		}
+		seen[port] = true
+		if !allowed[port] {
+			missing = append(missing, strconv.Itoa(port))
+		}
+	}
+	if len(missing) > 0 {
+		return auditResult{Check: check, Status: auditFail,
+			Message: fmt.Sprintf("the firewall is active but does not allow port(s) %s", strings.Join(missing, ", ")), Fix: fix}
+	}
+	return auditResult{Check: check, Status: auditPass, Message: "active, SSH, 80 and 443 allowed"}
+}
+
+func auditFail2ban(provisioner provision.Provisioner, s auditSection) auditResult {
+	const check = "fail2ban"
+	if r, ok := unreachable(check, s); ok {
+		return r
+	}
+	fix := append(provisioner.Fail2banCommands(), provisioner.Fail2banJailCommand(), provisioner.RestartCommand("fail2ban"))
+	switch {
+	case s.ExitCode == 127:
+		return auditResult{Check: check, Status: auditFail, Message: "fail2ban is not installed", Fix: fix}
+	case s.ExitCode != 0:
+		return auditResult{Check: check, Status: auditFail, Message: "the sshd jail is not running", Fix: fix}
+	}
+	return auditResult{Check: check, Status: auditPass, Message: "sshd jail running"}
+}
+
+func auditDockerVersion(s auditSection) auditResult {
+	const check = "docker"
+	if r, ok := unreachable(check, s); ok {
+		return r
+	}
+	if s.ExitCode != 0 || s.Output == "" {
+		return auditResult{Check: check, Status: auditFail, Message: "the Docker daemon is not reachable"}
+	}
+	version := strings.TrimSpace(s.Output)
+	major, err := strconv.Atoi(strings.SplitN(version, ".", 2)[0])
+	if err != nil {
+		return auditResult{Check: check, Status: auditWarn, Message: fmt.Sprintf("unrecognized Docker version %q", version)}
+	}
+	if major < minDockerMajor {
+		return auditResult{Check: check, Status: auditWarn,
+			Message: fmt.Sprintf("Docker %s is out of support (%d+ recommended)", version, minDockerMajor)}
+	}
+	return auditResult{Check: check, Status: auditPass, Message: "Docker " + version}
+}
+
+func auditDockerLogs(driver, daemonJSON auditSection) auditResult {
+	const check = "docker logs"
+	if r, ok := unreachable(check, driver); ok {
+		return r
+	}
+	if driver.ExitCode != 0 {
+		return auditResult{Check: check, Status: auditWarn, Message: "cannot check: the Docker daemon is not reachable"}
+	}
+	name := strings.TrimSpace(driver.Output)
+	switch name {
+	case "local", "journald":
+		return auditResult{Check: check, Status: auditPass, Message: fmt.Sprintf("default log driver %s rotates logs", name)}
+	case "json-file":
+		if daemonJSON.ExitCode == 0 && daemonLogMaxSize(daemonJSON.Output) != "" {
+			return auditResult{Check: check, Status: auditPass,
+				Message: "json-file logs limited to " + daemonLogMaxSize(daemonJSON.Output) + " by daemon.json"}
+		}
+	}
+	return auditResult{Check: check, Status: auditWarn,
+		Message: fmt.Sprintf("default log driver %s is unbounded for containers not started by FrankenDeploy (set log-opts max-size in /etc/docker/daemon.json)", name)}
+}
+
+// daemonLogMaxSize returns the default max-size log option of a Docker
+// daemon.json, if any
+func daemonLogMaxSize(content string) string {
+	var daemon struct {
+		LogOpts map[string]string `json:"log-opts"`
+	}
+	if err := json.Unmarshal([]byte(content), &daemon); err != nil {
+		return ""
+	}
+	return daemon.LogOpts["max-size"]
+}
+
+func auditNetwork(s auditSection) auditResult {
+	const check = "network"
+	if r, ok := unreachable(check, s); ok {
+		return r
+	}
+	if s.ExitCode != 0 {
+		return auditResult{Check: check, Status: auditFail,
+			Message: fmt.Sprintf("Docker network %s is missing", constants.NetworkName),
+			Fix:     []string{fmt.Sprintf("docker network create %s 2>/dev/null || true", constants.NetworkName)}}
+	}
+	return auditResult{Check: check, Status: auditPass, Message: fmt.Sprintf("Docker network %s exists", constants.NetworkName)}
+}
+
+func auditCaddy(s auditSection, apiMode bool) auditResult {
+	const check = "caddy"
+	if r, ok := unreachable(check, s); ok {
+		return r
+	}
+	fix := []string{caddy.ContainerRunCommand(apiMode)}
+	if s.ExitCode != 0 {
+		return auditResult{Check: check, Status: auditFail, Message: "the caddy container does not exist", Fix: fix}
+	}
+	parts := strings.Split(strings.TrimSpace(s.Output), "|")
+	for len(parts) < 4 {
+		parts = append(parts, "")
+	}
+	image, restart, state, maxSize := parts[0], parts[1], parts[2], parts[3]
+
+	if state != "running" {
+		return auditResult{Check: check, Status: auditFail, Message: fmt.Sprintf("the caddy container is %s", state), Fix: fix}
+	}
+	var problems []string
+	if image != caddy.Image {
+		problems = append(problems, fmt.Sprintf("image %s instead of %s", image, caddy.Image))
+	}
+	if restart != "unless-stopped" {
+		problems = append(problems, fmt.Sprintf("restart policy %q instead of unless-stopped", restart))
+	}
+	if maxSize == "" || maxSize == "<no value>" {
+		problems = append(problems, "no log rotation")
+	}
+	if len(problems) > 0 {
+		return auditResult{Check: check, Status: auditWarn, Message: strings.Join(problems, ", "), Fix: fix}
+	}
+	return auditResult{Check: check, Status: auditPass, Message: fmt.Sprintf("running %s, restart unless-stopped", image)}
+}
+
+func auditOwnership(s auditSection) auditResult {
+	const check = "ownership"
+	if r, ok := unreachable(check, s); ok {
+		return r
+	}
+	if s.ExitCode != 0 {
+		return auditResult{Check: check, Status: auditFail,
+			Message: fmt.Sprintf("%s does not exist: run 'frankendeploy server setup'", constants.BasePath)}
+	}
+	var dirs []string
+	for _, line := range strings.Split(s.Output, "\n") {
+		dir := strings.TrimSpace(line)
+		if dir == constants.BasePath || strings.HasPrefix(dir, constants.BasePath+"/") {
+			dirs = append(dirs, dir)
+		}
+	}
+	if len(dirs) == 0 {
+		return auditResult{Check: check, Status: auditPass, Message: fmt.Sprintf("%s owned by the SSH user", constants.BasePath)}
+	}
+	sort.Strings(dirs)
+	quoted := make([]string, len(dirs))
+	for i, dir := range dirs {
+		quoted[i] = security.ShellEscape(dir)
+	}
+	return auditResult{Check: check, Status: auditFail,
+		Message: fmt.Sprintf("not owned by the SSH user: %s", strings.Join(dirs, ", ")),
+		Fix:     []string{"sudo chown $USER:$USER " + strings.Join(quoted, " ")}}
+}
+
+func auditAdminDir(s auditSection) auditResult {
+	const check = "admin socket dir"
+	if r, ok := unreachable(check, s); ok {
+		return r
+	}
+	mode := strings.TrimSpace(s.Output)
+	if s.ExitCode == 0 && mode == "" {
+		return auditResult{Check: check, Status: auditPass, Message: "not created (Caddyfile mode)"}
+	}
+	if s.ExitCode != 0 || mode != "700" {
+		return auditResult{Check: check, Status: auditFail,
+			Message: fmt.Sprintf("%s has mode %s, other users could reach the Caddy admin API", constants.CaddyAdminDir, mode),
+			Fix:     []string{fmt.Sprintf("chmod 700 %s", constants.CaddyAdminDir)}}
+	}
+	return auditResult{Check: check, Status: auditPass, Message: constants.CaddyAdminDir + " is owner-only"}
+}
+
+func auditSecurityUpdates(provisioner provision.Provisioner, s auditSection) auditResult {
+	const check = "security updates"
+	if r, ok := unreachable(check, s); ok {
+		return r
+	}
+	if s.Output == provision.SecurityUnsupported {
+		return auditResult{Check: check, Status: auditWarn,
+			Message: fmt.Sprintf("cannot check: no security advisories on %s", provisioner.Name())}
+	}
+	var packages []string
+	for _, line := range strings.Split(s.Output, "\n") {
+		if pkg := strings.TrimSpace(line); provision.ValidPackageName(pkg) {
+			packages = append(packages, pkg)
+		}
+	}
+	if len(packages) == 0 {
+		return auditResult{Check: check, Status: auditPass, Message: "no pending security update"}
+	}
+	sort.Strings(packages)
+	return auditResult{Check: check, Status: auditWarn,
+		Message: fmt.Sprintf("%d pending: %s", len(packages), strings.Join(packages, ", ")),
+		Fix:     provisioner.SecurityUpgradeCommands(packages)}
+}
@@ -0,0 +1,249 @@
+package cmd
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/yoanbernabeu/frankendeploy/internal/config"
+	"github.com/yoanbernabeu/frankendeploy/internal/provision"
+	"github.com/yoanbernabeu/frankendeploy/internal/ssh"
+)
+
+// auditProbeOutput builds a probe output from section name/body pairs
+func auditProbeOutput(sections ...string) string {
+	var b strings.Builder
+	for i := 0; i+1 < len(sections); i += 2 {
+		b.WriteString("==> " + sections[i] + "\n" + sections[i+1] + "\n")
+	}
+	return b.String()
+}
+
+const healthyUFWStatus = `Status: active
+
+To                         Action      From
+--                         ------      ----
+OpenSSH                    ALLOW       Anywhere
+80,443/tcp                 ALLOW       Anywhere
+2222/tcp                   ALLOW       Anywhere
+OpenSSH (v6)               ALLOW       Anywhere (v6)
+exit=0`
+
+func healthyAuditProbe() []string {
+	return []string{
+		"firewall", healthyUFWStatus,
+		"fail2ban", "Status for the jail: sshd\n|- Filter\nexit=0",
+		"docker", "27.3.1\nexit=0",
+		"log-driver", "json-file\nexit=0",
+		"daemon-json", `{"log-driver": "json-file", "log-opts": {"max-size": "10m", "max-file": "3"}}` + "\nexit=0",
+		"network", "bridge\nexit=0",
+		"caddy", "caddy:alpine|unless-stopped|running|10m\nexit=0",
+		"ownership", "exit=0",
+		"admin-dir", "exit=0",
+		"security", "exit=0",
+	}
+}
+
+const ubuntuOSRelease = `PRETTY_NAME="Ubuntu 24.04.1 LTS"
+ID=ubuntu
+ID_LIKE=debian
+VERSION_ID="24.04"`
+
+func runTestAudit(t *testing.T, probe []string) []auditResult {
+	t.Helper()
+	return runTestAuditOn(t, ubuntuOSRelease, probe)
+}
+
+func runTestAuditOn(t *testing.T, osRelease string, probe []string) []auditResult {
+	t.Helper()
+	mock := &ssh.MockExecutor{
+		ExecFunc: func(ctx context.Context, command string) (*ssh.ExecResult, error) {
+			if command == provision.OSReleaseCommand {
+				return &ssh.ExecResult{Stdout: osRelease}, nil
+			}
+			if strings.Contains(command, "SSH_CONNECTION") {
+				return &ssh.ExecResult{Stdout: "2222\n"}, nil
+			}
+			return &ssh.ExecResult{Stdout: auditProbeOutput(probe...)}, nil
+		},
+	}
+	results, err := auditServer(context.Background(), mock, &config.ServerConfig{Port: 22})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return results
+}
+
+func auditResultFor(t *testing.T, results []auditResult, check string) auditResult {
+	t.Helper()
+	for _, r := range results {
+		if r.Check == check {
+			return r
+		}
+	}
+	t.Fatalf("no %q check in results", check)
+	return auditResult{}
+}
+
+func TestAuditServer_Healthy(t *testing.T) {
+	results := runTestAudit(t, healthyAuditProbe())
+	for _, r := range results {
+		if r.Status != auditPass {
+			t.Errorf("%s: expected pass, got %s (%s)", r.Check, r.Status, r.Message)
+		}
+	}
+	if fixes := auditFixes(results); len(fixes) != 0 {
+		t.Errorf("a healthy server needs no fix, got %v", fixes)
+	}
+}
+
+func TestAuditServer_Drift(t *testing.T) {
+	probe := healthyAuditProbe()
+	set := func(section, body string) {
+		for i := 0; i < len(probe); i += 2 {
+			if probe[i] == section {
+				probe[i+1] = body
+			}
+		}
+	}
+	set("firewall", "Status: active\n\nTo Action From\n22/tcp ALLOW Anywhere\n80/tcp ALLOW Anywhere\nexit=0")
+	set("fail2ban", "sudo: a password is required\nexit=1")
+	set("docker", "20.10.24\nexit=0")
+	set("log-driver", "json-file\nexit=0")
+	set("daemon-json", "cat: /etc/docker/daemon.json: No such file or directory\nexit=1")
+	set("network", "Error: No such network: frankendeploy\nexit=1")
+	set("caddy", "caddy:2.7|no|running|\nexit=0")
+	set("ownership", "/opt/frankendeploy/apps/shop\nexit=0")
+	set("admin-dir", "755\nexit=0")
+	set("security", "openssl\nlibssl3\nexit=0")
+	results := runTestAudit(t, probe)
+
+	tests := []struct {
+		check, status, message string
+	}{
+		{"firewall", auditFail, "does not allow port(s) 2222, 443"},
+		{"fail2ban", auditWarn, "sudo requires a password"},
+		{"docker", auditWarn, "out of support"},
+		{"docker logs", auditWarn, "unbounded"},
+		{"network", auditFail, "missing"},
+		{"caddy", auditWarn, "restart policy \"no\""},
+		{"ownership", auditFail, "/opt/frankendeploy/apps/shop"},
+		{"admin socket dir", auditFail, "mode 755"},
+		{"security updates", auditWarn, "2 pending: libssl3, openssl"},
+	}
+	for _, tt := range tests {
+		r := auditResultFor(t, results, tt.check)
+		if r.Status != tt.status || !strings.Contains(r.Message, tt.message) {
+			t.Errorf("%s: expected %s containing %q, got %s: %s", tt.check, tt.status, tt.message, r.Status, r.Message)
+		}
+	}
+
+	fixes := strings.Join(auditFixes(results), "\n")
+	for _, want := range []string{
+		"sudo ufw allow 2222/tcp",
+		"docker network create frankendeploy",
+		"--restart unless-stopped",
+		"sudo chown $USER:$USER '/opt/frankendeploy/apps/shop'",
+		"chmod 700 /opt/frankendeploy/caddy/admin",
+		"--only-upgrade libssl3 openssl",
+	} {
+		if !strings.Contains(fixes, want) {
+			t.Errorf("expected fix %q, got:\n%s", want, fixes)
+		}
+	}
+	// No fix is offered for a check that could not run
+	if strings.Contains(fixes, "fail2ban") {
+		t.Errorf("fail2ban could not be checked, no fix expected:\n%s", fixes)
+	}
+}
+
+func TestAuditServer_MissingComponents(t *testing.T) {
+	results := runTestAudit(t, []string{
+		"firewall", "ufw: not installed\nexit=127",
+		"fail2ban", "fail2ban: not installed\nexit=127",
+		"docker", "Cannot connect to the Docker daemon\nexit=1",
+		"log-driver", "exit=1",
+		"caddy", "Error: No such object: caddy\nexit=1",
+		"ownership", "missing\nexit=1",
+		"security", "unsupported\nexit=0",
+	})
+
+	for check, status := range map[string]string{
+		"firewall":         auditFail,
+		"fail2ban":         auditFail,
+		"docker":           auditFail,
+		"docker logs":      auditWarn,
+		"network":          auditWarn,
+		"caddy":            auditFail,
+		"ownership":        auditFail,
+		"security updates": auditWarn,
+	} {
+		if r := auditResultFor(t, results, check); r.Status != status {
+			t.Errorf("%s: expected %s, got %s (%s)", check, status, r.Status, r.Message)
+		}
+	}
+
+	fixes := auditFixes(results)
+	if len(fixes) == 0 || !strings.Contains(fixes[0], "apt-get install -y -qq ufw") {
+		t.Errorf("ufw should be installed before its rules are added, got %v", fixes)
+	}
+}
+
+func TestAuditServer_RHELBackend(t *testing.T) {
+	probe := healthyAuditProbe()
+	probe[1] = "running\n2222/tcp\ncockpit dhcpv6-client http https ssh\nexit=0"
+	for i := 0; i < len(probe); i += 2 {
+		if probe[i] == "security" {
+			probe[i+1] = "openssl-1:3.0.7-25.el9_3.x86_64\nexit=0"
+		}
+	}
+	results := runTestAuditOn(t, "ID=\"rocky\"\nID_LIKE=\"rhel centos fedora\"\nVERSION_ID=\"9.3\"", probe)
+
+	if r := auditResultFor(t, results, "firewall"); r.Status != auditPass {
+		t.Errorf("firewalld allowing every port should pass, got %s: %s", r.Status, r.Message)
+	}
+	r := auditResultFor(t, results, "security updates")
+	if r.Status != auditWarn || len(r.Fix) != 1 || r.Fix[0] != "sudo dnf upgrade -y -q --security" {
+		t.Errorf("expected a dnf security upgrade fix, got %+v", r)
+	}
+}
+
+func TestAuditServer_UnsupportedDistro(t *testing.T) {
+	mock := &ssh.MockExecutor{
+		ExecFunc: func(ctx context.Context, command string) (*ssh.ExecResult, error) {
+			return &ssh.ExecResult{Stdout: "ID=arch\nPRETTY_NAME=\"Arch Linux\""}, nil
+		},
+	}
+	_, err := auditServer(context.Background(), mock, &config.ServerConfig{Port: 22})
+	if err == nil || !strings.Contains(err.Error(), "unsupported distribution Arch Linux") {
+		t.Fatalf("expected an unsupported distribution error, got %v", err)
+	}
+}
+
+func TestParseAuditProbe(t *testing.T) {
+	sections := parseAuditProbe("==> docker\n27.0.1\nexit=0\n==> network\nexit=1\n")
+	if s := sections["docker"]; s.Output != "27.0.1" || s.ExitCode != 0 {
+		t.Errorf("unexpected docker section: %+v", s)
+	}
+	if s := sections["network"]; s.Output != "" || s.ExitCode != 1 {
+		t.Errorf("unexpected network section: %+v", s)
+	}
+	if _, ok := sections["caddy"]; ok {
+		t.Error("absent sections must not be reported")
+	}
+}
+
+func TestAuditProbeCommand_AllSections(t *testing.T) {
+	probe, err := auditProbeCommand(provision.Debian{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, section := range []string{"firewall", "fail2ban", "docker", "log-driver", "daemon-json", "network", "caddy", "ownership", "admin-dir", "security"} {
+		if !strings.Contains(probe, "echo '==> "+section+"'") {
+			t.Errorf("probe is missing the %s section", section)
+		}
+	}
+	if strings.Contains(probe, "sudo ") && !strings.Contains(probe, "sudo -n") {
+		t.Error("the probe must never wait for a sudo password")
+	}
+}
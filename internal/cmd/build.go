@@ -24,6 +24,7 @@ var (
 	buildDockerfile bool
 	buildCompose    bool
 	buildAll        bool
+	buildNoCache    bool
 )
 
 func init() {
@@ -31,6 +32,7 @@ func init() {
 	buildCmd.Flags().BoolVar(&buildDockerfile, "dockerfile", false, "Generate only Dockerfile")
 	buildCmd.Flags().BoolVar(&buildCompose, "compose", false, "Generate only docker-compose files")
 	buildCmd.Flags().BoolVar(&buildAll, "all", false, "Generate all files")
+	buildCmd.Flags().BoolVar(&buildNoCache, "no-cache", false, "Generate the Dockerfile without BuildKit cache mounts")
 }
 
 func runBuild(cmd *cobra.Command, args []string) error {
@@ -50,6 +52,8 @@ func runBuild(cmd *cobra.Command, args []string) error {
 	// Generate Dockerfile and entrypoint
 	if generateAll || buildDockerfile {
 		dockerGen := generator.NewDockerfileGenerator(cfg)
+		dockerGen.ForwardAgent = anyServerForwardsAgent()
+		dockerGen.NoCache = buildNoCache
 
 		if err := dockerGen.WriteDockerfile(""); err != nil {
 			return err
@@ -88,3 +92,19 @@ func runBuild(cmd *cobra.Command, args []string) error {
 
 	return nil
 }
+
+// anyServerForwardsAgent reports whether a server of the global config
+// forwards the ssh-agent to its builds: the Dockerfile then mounts it. The
+// mount is optional in BuildKit, so builds without the agent still work.
+func anyServerForwardsAgent() bool {
+	globalCfg, err := config.LoadGlobalConfig()
+	if err != nil {
+		return false
+	}
+	for _, server := range globalCfg.Servers {
+		if server.ForwardAgent {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,163 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/yoanbernabeu/frankendeploy/internal/config"
+	"github.com/yoanbernabeu/frankendeploy/internal/security"
+	"github.com/yoanbernabeu/frankendeploy/internal/ssh"
+)
+
+// buildArgFlags returns the docker build --build-arg flags, sorted by name
+func buildArgFlags(args map[string]string) []string {
+	names := make([]string, 0, len(args))
+	for name := range args {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	flags := make([]string, 0, 2*len(names))
+	for _, name := range names {
+		flags = append(flags, "--build-arg", name+"="+args[name])
+	}
+	return flags
+}
+
+// localCacheFlags returns the buildx flags importing the build cache from
+// dir and exporting it back, mode=max to keep the layers of every stage.
+// The import is skipped until a first build has exported the cache.
+func localCacheFlags(dir string) []string {
+	if dir == "" {
+		return nil
+	}
+	dir = secretFilePath(dir)
+	var flags []string
+	if _, err := os.Stat(filepath.Join(dir, "index.json")); err == nil {
+		flags = append(flags, "--cache-from", "type=local,src="+dir)
+	}
+	return append(flags, "--cache-to", "type=local,dest="+dir+",mode=max")
+}
+
+// buildxDriver returns the driver of the current buildx builder, "" when
+// it cannot be inspected
+func buildxDriver() string {
+	output, err := exec.Command("docker", "buildx", "inspect").Output()
+	if err != nil {
+		return ""
+	}
+	return parseBuildxDriver(string(output))
+}
+
+// parseBuildxDriver returns the driver reported by docker buildx inspect
+func parseBuildxDriver(output string) string {
+	for _, line := range strings.Split(output, "\n") {
+		if value, ok := strings.CutPrefix(strings.TrimSpace(line), "Driver:"); ok {
+			return strings.TrimSpace(value)
+		}
+	}
+	return ""
+}
+
+// secretFilePath returns the local path of a file secret: ~ is expanded,
+// relative paths are relative to the project
+func secretFilePath(file string) string {
+	if strings.HasPrefix(file, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, file[2:])
+		}
+	}
+	return file
+}
+
+// localSecretFlags returns the docker build --secret flags of a local
+// build: buildx reads the files and environment variables itself. A
+// missing source fails the build before it starts.
+func localSecretFlags(secrets []config.BuildSecret) ([]string, error) {
+	flags := make([]string, 0, 2*len(secrets))
+	for _, secret := range secrets {
+		if secret.Env != "" {
+			if _, ok := os.LookupEnv(secret.Env); !ok {
+				return nil, fmt.Errorf("build secret %q: environment variable %s is not set", secret.ID, secret.Env)
+			}
+			flags = append(flags, "--secret", fmt.Sprintf("id=%s,env=%s", secret.ID, secret.Env))
+			continue
+		}
+		path := secretFilePath(secret.File)
+		if _, err := os.Stat(path); err != nil {
+			return nil, fmt.Errorf("build secret %q: %w", secret.ID, err)
+		}
+		flags = append(flags, "--secret", fmt.Sprintf("id=%s,src=%s", secret.ID, path))
+	}
+	return flags, nil
+}
+
+// readBuildSecret returns the content of a secret, from its file or its
+// environment variable
+func readBuildSecret(secret config.BuildSecret) ([]byte, error) {
+	if secret.Env != "" {
+		value, ok := os.LookupEnv(secret.Env)
+		if !ok {
+			return nil, fmt.Errorf("build secret %q: environment variable %s is not set", secret.ID, secret.Env)
+		}
+		return []byte(value), nil
+	}
+	data, err := os.ReadFile(secretFilePath(secret.File))
+	if err != nil {
+		return nil, fmt.Errorf("build secret %q: %w", secret.ID, err)
+	}
+	return data, nil
+}
+
+// stageRemoteSecrets writes the secrets of a remote build to dir on the
+// server, readable by the SSH user only, and returns their --secret flags.
+// Contents go through stdin, never through a command line. cleanup removes
+// dir: call it once the build is over, failed or not.
+func stageRemoteSecrets(ctx context.Context, client ssh.Executor, secrets []config.BuildSecret, dir string) (flags []string, cleanup func(), err error) {
+	cleanup = func() {
+		if _, err := client.Exec(context.WithoutCancel(ctx), "rm -rf "+security.ShellEscape(dir)); err != nil {
+			PrintVerbose("Could not remove build secrets: %v", err)
+		}
+	}
+	if len(secrets) == 0 {
+		return nil, func() {}, nil
+	}
+
+	for _, secret := range secrets {
+		data, err := readBuildSecret(secret)
+		if err != nil {
+			return nil, nil, err
+		}
+		path := dir + "/" + secret.ID
+		command := fmt.Sprintf("umask 077 && mkdir -p %s && cat > %s", security.ShellEscape(dir), security.ShellEscape(path))
+		result, err := client.ExecInput(ctx, command, bytes.NewReader(data))
+		if err == nil {
+			err = result.Err()
+		}
+		if err != nil {
+			cleanup()
+			return nil, nil, fmt.Errorf("failed to upload build secret %q: %w", secret.ID, err)
+		}
+		flags = append(flags, "--secret", fmt.Sprintf("id=%s,src=%s", secret.ID, path))
+	}
+	return flags, cleanup, nil
+}
+
+// shellFlags quotes docker build flags, name and value pairs, for a remote
+// command line: values are quoted
+func shellFlags(flags []string) string {
+	quoted := make([]string, len(flags))
+	for i, flag := range flags {
+		if i%2 == 1 {
+			flag = security.ShellEscape(flag)
+		}
+		quoted[i] = flag
+	}
+	return strings.Join(quoted, " ")
+}
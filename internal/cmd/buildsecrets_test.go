@@ -0,0 +1,150 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/yoanbernabeu/frankendeploy/internal/config"
+	"github.com/yoanbernabeu/frankendeploy/internal/ssh"
+)
+
+func TestBuildArgFlags(t *testing.T) {
+	got := buildArgFlags(map[string]string{"SENTRY_RELEASE": "abc", "APP_VERSION": "1.2 beta"})
+	want := []string{"--build-arg", "APP_VERSION=1.2 beta", "--build-arg", "SENTRY_RELEASE=abc"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("buildArgFlags() = %v, want %v", got, want)
+	}
+	if got := shellFlags(want); got != "--build-arg 'APP_VERSION=1.2 beta' --build-arg 'SENTRY_RELEASE=abc'" {
+		t.Errorf("shellFlags() = %s", got)
+	}
+}
+
+func TestLocalSecretFlags(t *testing.T) {
+	authFile := filepath.Join(t.TempDir(), "auth.json")
+	if err := os.WriteFile(authFile, []byte(`{"github-oauth":{}}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("NPMRC", "//registry.npmjs.org/:_authToken=secret")
+
+	flags, err := localSecretFlags([]config.BuildSecret{
+		{ID: config.SecretComposerAuth, File: authFile},
+		{ID: config.SecretNpmrc, Env: "NPMRC"},
+	})
+	if err != nil {
+		t.Fatalf("localSecretFlags() error = %v", err)
+	}
+	want := []string{"--secret", "id=composer_auth,src=" + authFile, "--secret", "id=npmrc,env=NPMRC"}
+	if !reflect.DeepEqual(flags, want) {
+		t.Errorf("localSecretFlags() = %v, want %v", flags, want)
+	}
+
+	// A missing source fails before the build
+	if _, err := localSecretFlags([]config.BuildSecret{{ID: "token", Env: "FRANKENDEPLOY_TEST_UNSET"}}); err == nil || !strings.Contains(err.Error(), "FRANKENDEPLOY_TEST_UNSET") {
+		t.Errorf("an unset variable should be reported, got %v", err)
+	}
+	if _, err := localSecretFlags([]config.BuildSecret{{ID: "token", File: authFile + ".missing"}}); err == nil {
+		t.Error("a missing file should be reported")
+	}
+}
+
+func TestBuildDockerImageRemote_Secrets(t *testing.T) {
+	t.Setenv("COMPOSER_AUTH_JSON", `{"http-basic":{}}`)
+	mock := &ssh.MockExecutor{}
+	opts := buildOptions{Dockerfile: config.DockerfileConfig{
+		BuildArgs: map[string]string{"APP_VERSION": "1.2"},
+		Secrets:   []config.BuildSecret{{ID: config.SecretComposerAuth, Env: "COMPOSER_AUTH_JSON"}},
+	}}
+	if err := buildDockerImageRemote(context.Background(), mock, "myapp:v1", "/opt/frankendeploy/apps/myapp", opts); err != nil {
+		t.Fatalf("buildDockerImageRemote() error = %v", err)
+	}
+
+	// The content goes through stdin only
+	if len(mock.Inputs) != 1 || mock.Inputs[0] != `{"http-basic":{}}` {
+		t.Errorf("secret inputs = %v", mock.Inputs)
+	}
+	for _, command := range mock.Commands {
+		if strings.Contains(command, "http-basic") {
+			t.Errorf("the secret leaked into a command line: %s", command)
+		}
+	}
+	if !hasCommand(mock.Commands, "--build-arg 'APP_VERSION=1.2' --secret 'id=composer_auth,src=/opt/frankendeploy/apps/myapp/.build-secrets/composer_auth'") {
+		t.Errorf("docker build should get the build arg and the secret: %v", mock.Commands)
+	}
+	if last := mock.Commands[len(mock.Commands)-1]; last != "rm -rf '/opt/frankendeploy/apps/myapp/.build-secrets'" {
+		t.Errorf("the secrets should be removed after the build, last command: %s", last)
+	}
+}
+
+func TestLocalCacheFlags(t *testing.T) {
+	if flags := localCacheFlags(""); flags != nil {
+		t.Errorf("no cache dir should give no flags, got %v", flags)
+	}
+
+	dir := t.TempDir()
+	want := []string{"--cache-to", "type=local,dest=" + dir + ",mode=max"}
+	if flags := localCacheFlags(dir); !reflect.DeepEqual(flags, want) {
+		t.Errorf("first build: localCacheFlags() = %v, want %v", flags, want)
+	}
+
+	// Imported once a build has exported it
+	if err := os.WriteFile(filepath.Join(dir, "index.json"), []byte("{}"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	want = append([]string{"--cache-from", "type=local,src=" + dir}, want...)
+	if flags := localCacheFlags(dir); !reflect.DeepEqual(flags, want) {
+		t.Errorf("localCacheFlags() = %v, want %v", flags, want)
+	}
+}
+
+func TestParseBuildxDriver(t *testing.T) {
+	output := "Name:          default\nDriver:        docker\n\nNodes:\nName:      default\n"
+	if got := parseBuildxDriver(output); got != "docker" {
+		t.Errorf("parseBuildxDriver() = %q, want docker", got)
+	}
+	if got := parseBuildxDriver("error"); got != "" {
+		t.Errorf("parseBuildxDriver() = %q for an unexpected output", got)
+	}
+}
+
+func TestBuildDockerImage_CacheDir(t *testing.T) {
+	tests := []struct {
+		name      string
+		driver    string
+		wantCache bool
+	}{
+		{"docker driver", "docker", false},
+		{"docker-container driver", "docker-container", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// A fake docker reporting the builder driver and recording the build
+			bin := t.TempDir()
+			out := filepath.Join(bin, "out")
+			script := "#!/bin/sh\nif [ \"$2\" = inspect ]; then echo 'Driver: " + tt.driver + "'; exit 0; fi\necho \"$*\" > " + out + "\n"
+			if err := os.WriteFile(filepath.Join(bin, "docker"), []byte(script), 0755); err != nil {
+				t.Fatal(err)
+			}
+			t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+			opts := buildOptions{Dockerfile: config.DockerfileConfig{CacheDir: t.TempDir()}, NoCache: true}
+			if err := buildDockerImage("myapp:v1", "linux/amd64", opts); err != nil {
+				t.Fatalf("buildDockerImage() error = %v", err)
+			}
+			data, err := os.ReadFile(out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			args := string(data)
+			if got := strings.Contains(args, "--cache-to"); got != tt.wantCache {
+				t.Errorf("cache export = %v, want %v: %s", got, tt.wantCache, args)
+			}
+			if !strings.Contains(args, "--no-cache") {
+				t.Errorf("--no-cache should be passed to the build: %s", args)
+			}
+		})
+	}
+}
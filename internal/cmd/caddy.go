@@ -0,0 +1,286 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/yoanbernabeu/frankendeploy/internal/caddy"
+	"github.com/yoanbernabeu/frankendeploy/internal/config"
+	"github.com/yoanbernabeu/frankendeploy/internal/constants"
+	"github.com/yoanbernabeu/frankendeploy/internal/security"
+	"github.com/yoanbernabeu/frankendeploy/internal/ssh"
+)
+
+var caddyCmd = &cobra.Command{
+	Use:   "caddy",
+	Short: "Manage the Caddy reverse proxy of a server",
+	Long:  `Commands to inspect and repair the Caddy reverse proxy configuration of a server.`,
+}
+
+var caddyRollbackCmd = &cobra.Command{
+	Use:   "rollback <server> <app>",
+	Short: "Restore the previous Caddy config of an app",
+	Long: `Restores the previous Caddy configuration of an application.
+
+Every config update keeps the replaced file. This command validates it,
+swaps it back in and reloads Caddy. The replaced config becomes the new
+previous one, so running the command twice toggles between the two.
+
+On servers in API mode the previous route is patched back through the
+admin API instead.
+
+Example:
+  frankendeploy caddy rollback production my-app`,
+	Args: cobra.ExactArgs(2),
+	RunE: runCaddyRollback,
+}
+
+var caddyShowCmd = &cobra.Command{
+	Use:   "show <server>",
+	Short: "Show the live Caddy config of a server",
+	Long: `Lists the sites served by Caddy, read back from its running config:
+domains and upstream container of each app.
+
+On servers in API mode, each route is also compared with the one recorded
+at the last deploy, so manual changes made through the admin API (drift)
+are reported.
+
+Example:
+  frankendeploy caddy show production
+  frankendeploy caddy show production --raw`,
+	Args: cobra.ExactArgs(1),
+	RunE: runCaddyShow,
+}
+
+var caddyShowRaw bool
+
+func init() {
+	rootCmd.AddCommand(caddyCmd)
+	caddyCmd.AddCommand(caddyRollbackCmd)
+	caddyCmd.AddCommand(caddyShowCmd)
+
+	caddyShowCmd.Flags().BoolVar(&caddyShowRaw, "raw", false, "Print the full live JSON config")
+}
+
+func runCaddyRollback(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	serverName, appName := args[0], args[1]
+
+	if err := security.ValidateAppName(appName); err != nil {
+		return fmt.Errorf("invalid app name: %w", err)
+	}
+
+	conn, err := ConnectToServerNoProject(serverName)
+	if err != nil {
+		return err
+	}
+	defer conn.Client.Close()
+
+	PrintInfo("Restoring previous Caddy config of %s...", appName)
+	if admin := caddyAdminFor(conn.Client, conn.Server); admin != nil {
+		if err := restorePreviousRoute(ctx, conn.Client, admin, appName); err != nil {
+			return err
+		}
+	} else if err := runCommandsStrict(ctx, conn.Client, caddy.RestorePreviousCommands(appName)); err != nil {
+		return err
+	}
+
+	PrintSuccess("Previous Caddy config of %s restored", appName)
+	return nil
+}
+
+// restorePreviousRoute patches the previous recorded TLS setting and route
+// of an app back through the admin API, then swaps the recorded ones.
+func restorePreviousRoute(ctx context.Context, client ssh.Executor, admin *caddy.AdminClient, appName string) error {
+	results, err := ssh.ExecBatch(ctx, client, []string{
+		fmt.Sprintf("cat %s 2>/dev/null", caddy.PreviousRoutePath(appName)),
+		fmt.Sprintf("cat %s 2>/dev/null", caddy.PreviousTLSPath(appName)),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to read previous route: %w", err)
+	}
+	route, tlsRecord := results[0], results[1]
+	if route.ExitCode != 0 || strings.TrimSpace(route.Stdout) == "" {
+		return fmt.Errorf("no previous Caddy config for %s", appName)
+	}
+
+	// Routes recorded before TLS settings were have none to restore
+	if tlsRecord.ExitCode == 0 && strings.TrimSpace(tlsRecord.Stdout) != "" {
+		tls, err := caddy.ParseRouteTLS([]byte(tlsRecord.Stdout))
+		if err != nil {
+			return err
+		}
+		if err := admin.ApplyTLS(ctx, appName, tls.Domain, tls.Mode); err != nil {
+			return err
+		}
+	}
+	if err := admin.ApplyRoute(ctx, appName, []byte(route.Stdout)); err != nil {
+		return err
+	}
+	return runCommandsStrict(ctx, client, caddy.RestorePreviousRouteCommands(appName))
+}
+
+func runCaddyShow(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	serverName := args[0]
+
+	conn, err := ConnectToServerNoProject(serverName)
+	if err != nil {
+		return err
+	}
+	defer conn.Client.Close()
+
+	admin := caddyAdminFor(conn.Client, conn.Server)
+	live, err := readLiveCaddyConfig(ctx, conn.Client, admin)
+	if err != nil {
+		return err
+	}
+
+	if caddyShowRaw {
+		var out bytes.Buffer
+		if err := json.Indent(&out, live, "", "  "); err != nil {
+			return fmt.Errorf("invalid Caddy config: %w", err)
+		}
+		fmt.Println(out.String())
+		return nil
+	}
+
+	sites, err := caddy.ParseSites(live)
+	if err != nil {
+		return err
+	}
+
+	var recorded map[string][]byte
+	if admin != nil {
+		recorded, err = readRecordedRoutes(ctx, conn.Client)
+		if err != nil {
+			return err
+		}
+	}
+
+	mode := config.CaddyModeCaddyfile
+	if admin != nil {
+		mode = config.CaddyModeAPI
+	}
+	if len(sites) == 0 && len(recorded) == 0 {
+		PrintInfo("No sites configured in Caddy on %s (mode: %s)", serverName, mode)
+		return nil
+	}
+
+	fmt.Printf("Caddy sites on %s (mode: %s):\n\n", serverName, mode)
+	for _, site := range sites {
+		name := site.App
+		if name == "" {
+			name = "(unknown)"
+		}
+		fmt.Printf("  %s\n", name)
+		fmt.Printf("    Domains:  %s\n", strings.Join(site.Hosts, ", "))
+		if len(site.Upstreams) > 0 {
+			fmt.Printf("    Upstream: %s\n", strings.Join(site.Upstreams, ", "))
+		}
+		if admin != nil {
+			fmt.Printf("    Status:   %s\n", routeDriftStatus(site, recorded))
+			delete(recorded, site.App)
+		}
+		fmt.Println()
+	}
+
+	// Recorded routes that Caddy no longer serves
+	for _, name := range sortedRouteNames(recorded) {
+		fmt.Printf("  %s\n", name)
+		fmt.Println("    Status:   missing from the live config (redeploy to restore it)")
+		fmt.Println()
+	}
+
+	return nil
+}
+
+// routeDriftStatus compares a live route with the route recorded at the
+// last deploy
+func routeDriftStatus(site caddy.Site, recorded map[string][]byte) string {
+	want, ok := recorded[site.App]
+	switch {
+	case !ok:
+		return "not managed by FrankenDeploy"
+	case caddy.RoutesEqual(want, site.Route):
+		return "in sync"
+	default:
+		return "drift: the live route differs from the last deploy (redeploy to reset it)"
+	}
+}
+
+// readLiveCaddyConfig returns the running Caddy config, through the admin
+// API in API mode or from inside the container otherwise
+func readLiveCaddyConfig(ctx context.Context, client ssh.Executor, admin *caddy.AdminClient) ([]byte, error) {
+	if admin != nil {
+		return admin.Config(ctx, "")
+	}
+	result, err := client.Exec(ctx, "docker exec caddy wget -qO- http://localhost:2019/config/")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Caddy config: %w", err)
+	}
+	if err := result.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read Caddy config (is the caddy container running?): %w", err)
+	}
+	return []byte(result.Stdout), nil
+}
+
+// readRecordedRoutes returns the routes recorded on the server in API mode,
+// by app name
+func readRecordedRoutes(ctx context.Context, client ssh.Executor) (map[string][]byte, error) {
+	result, err := client.Exec(ctx, fmt.Sprintf("ls -1 %s/*.json 2>/dev/null", constants.CaddyAppsDir))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list recorded routes: %w", err)
+	}
+
+	var names, commands []string
+	for _, path := range strings.Split(strings.TrimSpace(result.Stdout), "\n") {
+		name := strings.TrimSuffix(strings.TrimPrefix(path, constants.CaddyAppsDir+"/"), ".json")
+		if name == "" || security.ValidateAppName(name) != nil {
+			continue
+		}
+		names = append(names, name)
+		commands = append(commands, fmt.Sprintf("cat %s", constants.CaddyAppRoute(name)))
+	}
+	if len(commands) == 0 {
+		return map[string][]byte{}, nil
+	}
+
+	results, err := ssh.ExecBatch(ctx, client, commands)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read recorded routes: %w", err)
+	}
+	routes := make(map[string][]byte, len(names))
+	for i, name := range names {
+		routes[name] = []byte(results[i].Stdout)
+	}
+	return routes, nil
+}
+
+// sortedRouteNames returns the app names of recorded routes in order
+func sortedRouteNames(routes map[string][]byte) []string {
+	names := make([]string, 0, len(routes))
+	for name := range routes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// caddyAdminFor returns an admin API client for servers in API mode, nil
+// for servers in Caddyfile mode. The admin socket is reached through the
+// SSH connection: nothing listens on a TCP port.
+func caddyAdminFor(client *ssh.Client, server *config.ServerConfig) *caddy.AdminClient {
+	if server == nil || !server.UsesCaddyAPI() {
+		return nil
+	}
+	return caddy.NewAdminClient(func(ctx context.Context) (net.Conn, error) {
+		return client.DialContext(ctx, "unix", constants.CaddyAdminSocket)
+	})
+}
@@ -2,9 +2,13 @@ package cmd
 
 import (
 	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"strings"
 	"testing"
 
+	"github.com/yoanbernabeu/frankendeploy/internal/caddy"
 	"github.com/yoanbernabeu/frankendeploy/internal/config"
 	"github.com/yoanbernabeu/frankendeploy/internal/ssh"
 )
@@ -22,8 +26,8 @@ func TestCaddyAppConfigExists(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			mock := &ssh.MockExecutor{
 				ExecFunc: func(ctx context.Context, command string) (*ssh.ExecResult, error) {
-					if !strings.Contains(command, "my-app.caddy") {
-						t.Errorf("expected check on my-app.caddy, got: %s", command)
+					if !strings.Contains(command, "my-app.caddy") || !strings.Contains(command, "my-app.json") {
+						t.Errorf("expected check on my-app.caddy and my-app.json, got: %s", command)
 					}
 					return &ssh.ExecResult{Stdout: tt.stdout, ExitCode: 0}, nil
 				},
@@ -49,7 +53,7 @@ func TestUpdateCaddyConfig_FailsWhenCaddyNotRunning(t *testing.T) {
 		Name:   "my-app",
 		Deploy: config.DeployConfig{Domain: "example.com"},
 	}
-	err := updateCaddyConfig(context.Background(), mock, cfg)
+	err := updateCaddyConfig(context.Background(), mock, nil, cfg)
 	if err == nil {
 		t.Fatal("expected error when caddy container is not running")
 	}
@@ -73,7 +77,7 @@ func TestUpdateCaddyConfig_SucceedsWhenCaddyRunning(t *testing.T) {
 		Name:   "my-app",
 		Deploy: config.DeployConfig{Domain: "example.com", HealthcheckPath: "/api"},
 	}
-	if err := updateCaddyConfig(context.Background(), mock, cfg); err != nil {
+	if err := updateCaddyConfig(context.Background(), mock, nil, cfg); err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
 	joined := strings.Join(commands, "\n")
@@ -81,3 +85,151 @@ func TestUpdateCaddyConfig_SucceedsWhenCaddyRunning(t *testing.T) {
 		t.Errorf("expected write and reload commands, got:\n%s", joined)
 	}
 }
+
+func TestRunCommandsStrict_StopsAtFirstFailure(t *testing.T) {
+	mock := &ssh.MockExecutor{
+		ExecFunc: func(ctx context.Context, command string) (*ssh.ExecResult, error) {
+			if strings.Contains(command, "caddy validate") {
+				return &ssh.ExecResult{Stderr: "Error: adapting config", ExitCode: 1}, nil
+			}
+			return &ssh.ExecResult{}, nil
+		},
+	}
+	err := runCommandsStrict(context.Background(), mock, []string{"write", "docker exec caddy caddy validate", "swap"})
+	if err == nil || !strings.Contains(err.Error(), "adapting config") {
+		t.Fatalf("expected validation error with Caddy output, got: %v", err)
+	}
+	if len(mock.Commands) != 2 {
+		t.Errorf("no command should run after a failure, got: %v", mock.Commands)
+	}
+}
+
+func TestUpdateCaddyConfig_APIModePatchesRouteOnly(t *testing.T) {
+	var requests []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		if r.Method == http.MethodGet {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"error":"unknown object ID"}`))
+		}
+	}))
+	defer srv.Close()
+	admin := caddy.NewAdminClient(func(ctx context.Context) (net.Conn, error) {
+		var d net.Dialer
+		return d.DialContext(ctx, "tcp", srv.Listener.Addr().String())
+	})
+
+	var commands []string
+	mock := &ssh.MockExecutor{
+		ExecFunc: func(ctx context.Context, command string) (*ssh.ExecResult, error) {
+			commands = append(commands, command)
+			if strings.Contains(command, "docker inspect caddy") {
+				return &ssh.ExecResult{Stdout: "running\n"}, nil
+			}
+			return &ssh.ExecResult{}, nil
+		},
+	}
+	cfg := &config.ProjectConfig{
+		Name:   "my-app",
+		Deploy: config.DeployConfig{Domain: "example.com"},
+	}
+
+	if err := updateCaddyConfig(context.Background(), mock, admin, cfg); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(strings.Join(requests, "\n"), "POST /config/apps/http/servers/frankendeploy/routes") {
+		t.Errorf("expected the route to be added through the admin API, got:\n%s", strings.Join(requests, "\n"))
+	}
+	joined := strings.Join(commands, "\n")
+	if strings.Contains(joined, "caddy reload") || strings.Contains(joined, "my-app.caddy") {
+		t.Errorf("API mode must not touch the Caddyfile, got:\n%s", joined)
+	}
+	if !strings.Contains(joined, "my-app.json") {
+		t.Errorf("applied route should be recorded for drift detection, got:\n%s", joined)
+	}
+}
+
+func TestRestorePreviousRoute_RestoresTLSThenRoute(t *testing.T) {
+	var requests []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		if r.Method == http.MethodPatch || r.Method == http.MethodGet || r.Method == http.MethodDelete {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"error":"unknown object ID"}`))
+		}
+	}))
+	defer srv.Close()
+	admin := caddy.NewAdminClient(func(ctx context.Context) (net.Conn, error) {
+		var d net.Dialer
+		return d.DialContext(ctx, "tcp", srv.Listener.Addr().String())
+	})
+
+	mock := &ssh.MockExecutor{
+		ExecFunc: func(ctx context.Context, command string) (*ssh.ExecResult, error) {
+			switch {
+			case strings.HasPrefix(command, "cat ") && strings.Contains(command, "my-app.json.prev"):
+				return &ssh.ExecResult{Stdout: `{"@id":"frankendeploy-my-app","match":[{"host":["example.com"]}]}`}, nil
+			case strings.HasPrefix(command, "cat ") && strings.Contains(command, "my-app.tls.prev"):
+				return &ssh.ExecResult{Stdout: `{"mode":"internal","domain":"example.com"}`}, nil
+			}
+			return &ssh.ExecResult{}, nil
+		},
+	}
+
+	if err := restorePreviousRoute(context.Background(), mock, admin, "my-app"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(mock.Batches) != 1 {
+		t.Errorf("the previous records should be read in one batch, got %v", mock.Batches)
+	}
+	joined := strings.Join(requests, "\n")
+	policy := strings.Index(joined, "PUT /config/apps/tls/automation/policies/0")
+	route := strings.Index(joined, "POST /config/apps/http/servers/frankendeploy/routes")
+	if policy < 0 || route < 0 || policy > route {
+		t.Errorf("the TLS setting should be restored before the route, got:\n%s", joined)
+	}
+	if !hasCommand(mock.Commands, "my-app.tls.prev") {
+		t.Errorf("the recorded TLS settings should be swapped, got %v", mock.Commands)
+	}
+}
+
+func TestReadRecordedRoutes_BatchesReads(t *testing.T) {
+	mock := &ssh.MockExecutor{
+		ExecFunc: func(ctx context.Context, command string) (*ssh.ExecResult, error) {
+			if strings.HasPrefix(command, "ls ") {
+				return &ssh.ExecResult{Stdout: "/opt/frankendeploy/caddy/apps/a.json\n/opt/frankendeploy/caddy/apps/b.json\n"}, nil
+			}
+			return &ssh.ExecResult{Stdout: command}, nil
+		},
+	}
+	routes, err := readRecordedRoutes(context.Background(), mock)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(routes) != 2 || !strings.Contains(string(routes["b"]), "b.json") {
+		t.Errorf("routes = %v", routes)
+	}
+	if len(mock.Batches) != 1 || len(mock.Batches[0]) != 2 {
+		t.Errorf("the routes should be read in one batch, got %v", mock.Batches)
+	}
+}
+
+func TestRouteDriftStatus(t *testing.T) {
+	recorded := map[string][]byte{"my-app": []byte(`{"@id":"frankendeploy-my-app","terminal":true}`)}
+	tests := []struct {
+		name string
+		site caddy.Site
+		want string
+	}{
+		{"in sync", caddy.Site{App: "my-app", Route: []byte(`{"terminal": true, "@id": "frankendeploy-my-app"}`)}, "in sync"},
+		{"drift", caddy.Site{App: "my-app", Route: []byte(`{"@id":"frankendeploy-my-app"}`)}, "drift"},
+		{"unmanaged", caddy.Site{App: "other"}, "not managed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := routeDriftStatus(tt.site, recorded); !strings.HasPrefix(got, tt.want) {
+				t.Errorf("routeDriftStatus() = %q, want prefix %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,158 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/yoanbernabeu/frankendeploy/internal/caddy"
+	"github.com/yoanbernabeu/frankendeploy/internal/config"
+	"github.com/yoanbernabeu/frankendeploy/internal/ssh"
+)
+
+// certExpiryWarning is how close to expiry a certificate gets flagged
+const certExpiryWarning = 14 * 24 * time.Hour
+
+var certCmd = &cobra.Command{
+	Use:   "cert",
+	Short: "Inspect the TLS certificates of a server",
+	Long:  `Commands to inspect the TLS certificates served by Caddy.`,
+}
+
+var certStatusCmd = &cobra.Command{
+	Use:   "status <server>",
+	Short: "Show issuer, expiry and SANs of each app domain",
+	Long: `Lists the certificate served for each domain of the server, read from
+the caddy container: issuer, expiry date and subject alternative names.
+
+The source tells how it was obtained: acme (automatic), internal (Caddy's
+internal CA) or custom (deploy.tls.cert_file). Certificates expiring within
+14 days are flagged.
+
+Example:
+  frankendeploy cert status production`,
+	Args: cobra.ExactArgs(1),
+	RunE: runCertStatus,
+}
+
+func init() {
+	rootCmd.AddCommand(certCmd)
+	certCmd.AddCommand(certStatusCmd)
+}
+
+func runCertStatus(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	serverName := args[0]
+
+	conn, err := ConnectToServerNoProject(serverName)
+	if err != nil {
+		return err
+	}
+	defer conn.Client.Close()
+
+	live, err := readLiveCaddyConfig(ctx, conn.Client, caddyAdminFor(conn.Client, conn.Server))
+	if err != nil {
+		return err
+	}
+	sites, err := caddy.ParseSites(live)
+	if err != nil {
+		return err
+	}
+	if len(sites) == 0 {
+		PrintInfo("No sites configured in Caddy on %s", serverName)
+		return nil
+	}
+
+	dumpCmd := caddy.CertDumpCommand()
+	PrintVerboseCommand(dumpCmd)
+	result, err := conn.Client.Exec(ctx, dumpCmd)
+	if err != nil {
+		return fmt.Errorf("failed to read certificates: %w", err)
+	}
+	if err := result.Err(); err != nil {
+		return fmt.Errorf("failed to read certificates (is the caddy container running?): %w", err)
+	}
+	certs := caddy.ParseCertDump(result.Stdout)
+
+	fmt.Printf("Certificates on %s:\n\n", serverName)
+	now := time.Now()
+	for _, site := range sites {
+		for _, host := range site.Hosts {
+			printCertStatus(host, site.App, caddy.MatchCertificate(certs, site.App, host), now)
+		}
+	}
+	return nil
+}
+
+func printCertStatus(host, appName string, cert *caddy.CertInfo, now time.Time) {
+	if appName != "" {
+		fmt.Printf("  %s (%s)\n", host, appName)
+	} else {
+		fmt.Printf("  %s\n", host)
+	}
+	if cert == nil {
+		fmt.Println("    No certificate found (issuance may still be pending: check 'docker logs caddy' on the server)")
+		fmt.Println()
+		return
+	}
+	fmt.Printf("    Issuer:   %s (%s)\n", cert.Issuer, cert.Source)
+	fmt.Printf("    Expires:  %s\n", certExpiry(cert.NotAfter, now))
+	fmt.Printf("    SANs:     %s\n", strings.Join(cert.DNSNames, ", "))
+	fmt.Println()
+}
+
+// certExpiry formats an expiry date with the days left, flagging soon
+// expiring and expired certificates
+func certExpiry(notAfter, now time.Time) string {
+	date := notAfter.UTC().Format("2006-01-02 15:04 UTC")
+	left := notAfter.Sub(now)
+	switch {
+	case left <= 0:
+		return date + " (EXPIRED)"
+	case left < certExpiryWarning:
+		return fmt.Sprintf("%s (%d days left, renew soon)", date, int(left.Hours()/24))
+	default:
+		return fmt.Sprintf("%s (%d days left)", date, int(left.Hours()/24))
+	}
+}
+
+// uploadCustomCert checks the local certificate and key of an app against
+// its domain, then streams them into the caddy container over stdin.
+func uploadCustomCert(ctx context.Context, client ssh.Executor, cfg *config.ProjectConfig, domain string) error {
+	tlsCfg := cfg.Deploy.TLS
+	certPEM, err := os.ReadFile(tlsCfg.CertFile)
+	if err != nil {
+		return fmt.Errorf("failed to read deploy.tls.cert_file: %w", err)
+	}
+	keyPEM, err := os.ReadFile(tlsCfg.KeyFile)
+	if err != nil {
+		return fmt.Errorf("failed to read deploy.tls.key_file: %w", err)
+	}
+	leaf, err := caddy.ValidateCertificate(certPEM, keyPEM, domain)
+	if err != nil {
+		return fmt.Errorf("invalid custom certificate: %w", err)
+	}
+	if time.Until(leaf.NotAfter) < certExpiryWarning {
+		PrintWarning("Custom certificate expires on %s", leaf.NotAfter.Format("2006-01-02"))
+	}
+
+	commands, err := caddy.CertUploadCommands(cfg.Name)
+	if err != nil {
+		return err
+	}
+	for i, content := range [][]byte{certPEM, keyPEM} {
+		PrintVerboseCommand(commands[i])
+		result, err := client.ExecInput(ctx, commands[i], bytes.NewReader(content))
+		if err != nil {
+			return fmt.Errorf("failed to upload custom certificate: %w", err)
+		}
+		if err := result.Err(); err != nil {
+			return fmt.Errorf("failed to upload custom certificate: %w", err)
+		}
+	}
+	return nil
+}
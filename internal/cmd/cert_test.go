@@ -0,0 +1,127 @@
+package cmd
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yoanbernabeu/frankendeploy/internal/config"
+	"github.com/yoanbernabeu/frankendeploy/internal/ssh"
+)
+
+// writeTestCert writes a self-signed certificate and key for domain
+func writeTestCert(t *testing.T, domain string) (certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		DNSNames:     []string{domain},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(90 * 24 * time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	certFile = filepath.Join(dir, "cert.pem")
+	keyFile = filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+func TestUpdateCaddyConfig_CustomTLSUploadsOverStdin(t *testing.T) {
+	certFile, keyFile := writeTestCert(t, "app.corp.example")
+	mock := &ssh.MockExecutor{
+		ExecFunc: func(ctx context.Context, command string) (*ssh.ExecResult, error) {
+			if strings.Contains(command, "docker inspect caddy") {
+				return &ssh.ExecResult{Stdout: "running\n"}, nil
+			}
+			return &ssh.ExecResult{}, nil
+		},
+	}
+	cfg := &config.ProjectConfig{
+		Name: "my-app",
+		Deploy: config.DeployConfig{
+			Domain: "app.corp.example",
+			TLS:    config.TLSConfig{Mode: config.TLSModeCustom, CertFile: certFile, KeyFile: keyFile},
+		},
+	}
+	if err := updateCaddyConfig(context.Background(), mock, nil, cfg); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(mock.Inputs) != 2 || !strings.Contains(mock.Inputs[1], "PRIVATE KEY") {
+		t.Fatalf("certificate and key should be sent over stdin, got %d inputs", len(mock.Inputs))
+	}
+	joined := strings.Join(mock.Commands, "\n")
+	if strings.Contains(joined, "PRIVATE KEY") {
+		t.Error("the private key must never appear in a command")
+	}
+	for _, want := range []string{"tls /config/caddy/certs/my-app/cert.pem", "caddy reload --config /etc/caddy/Caddyfile --adapter caddyfile --force"} {
+		if !strings.Contains(joined, want) {
+			t.Errorf("expected %q in commands:\n%s", want, joined)
+		}
+	}
+}
+
+func TestUpdateCaddyConfig_CustomTLSRejectsWrongDomain(t *testing.T) {
+	certFile, keyFile := writeTestCert(t, "other.example")
+	mock := &ssh.MockExecutor{
+		ExecFunc: func(ctx context.Context, command string) (*ssh.ExecResult, error) {
+			return &ssh.ExecResult{Stdout: "running\n"}, nil
+		},
+	}
+	cfg := &config.ProjectConfig{
+		Name: "my-app",
+		Deploy: config.DeployConfig{
+			Domain: "app.corp.example",
+			TLS:    config.TLSConfig{Mode: config.TLSModeCustom, CertFile: certFile, KeyFile: keyFile},
+		},
+	}
+	err := updateCaddyConfig(context.Background(), mock, nil, cfg)
+	if err == nil || !strings.Contains(err.Error(), "does not cover app.corp.example") {
+		t.Fatalf("expected a domain mismatch error, got: %v", err)
+	}
+	if len(mock.Inputs) != 0 {
+		t.Error("nothing should be uploaded when the certificate is invalid")
+	}
+}
+
+func TestCertExpiry(t *testing.T) {
+	now := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		notAfter time.Time
+		want     string
+	}{
+		{now.Add(60 * 24 * time.Hour), "(60 days left)"},
+		{now.Add(5 * 24 * time.Hour), "(5 days left, renew soon)"},
+		{now.Add(-time.Hour), "(EXPIRED)"},
+	}
+	for _, tt := range tests {
+		if got := certExpiry(tt.notAfter, now); !strings.HasSuffix(got, tt.want) {
+			t.Errorf("certExpiry(%v) = %q, want suffix %q", tt.notAfter, got, tt.want)
+		}
+	}
+}
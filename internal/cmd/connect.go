@@ -55,7 +55,7 @@ func connectToServerInternal(serverName string, loadProject bool, opts ...ssh.Cl
 		return nil, err
 	}
 
-	allOpts := sshOptsFromGlobal(globalCfg, opts)
+	allOpts := sshOptsForServer(serverCfg, globalCfg, opts)
 
 	client := ssh.NewClient(serverCfg.Host, serverCfg.User, serverCfg.Port, serverCfg.KeyPath, allOpts...)
 	if err := client.Connect(); err != nil {
@@ -78,3 +78,20 @@ func sshOptsFromGlobal(globalCfg *config.GlobalConfig, opts []ssh.ClientOption)
 	}
 	return opts
 }
+
+// sshOptsForServer returns the client options of a server: the global
+// timeout, then its jump hosts and pinned host keys, then opts.
+func sshOptsForServer(serverCfg *config.ServerConfig, globalCfg *config.GlobalConfig, opts []ssh.ClientOption) []ssh.ClientOption {
+	var serverOpts []ssh.ClientOption
+	if len(serverCfg.ProxyJump) > 0 {
+		hops := make([]ssh.JumpHost, len(serverCfg.ProxyJump))
+		for i, hop := range serverCfg.ProxyJump {
+			hops[i] = ssh.JumpHost{Host: hop.Host, User: hop.User, Port: hop.Port, KeyPath: hop.KeyPath}
+		}
+		serverOpts = append(serverOpts, ssh.WithProxyJump(hops...))
+	}
+	if len(serverCfg.HostKeys) > 0 {
+		serverOpts = append(serverOpts, ssh.WithHostKeyPins(serverCfg.HostKeys...))
+	}
+	return sshOptsFromGlobal(globalCfg, append(serverOpts, opts...))
+}
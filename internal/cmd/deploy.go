@@ -7,8 +7,10 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
 	"runtime"
+	"slices"
 	"strings"
 	"time"
 
@@ -20,6 +22,7 @@ import (
 	"github.com/yoanbernabeu/frankendeploy/internal/generator"
 	"github.com/yoanbernabeu/frankendeploy/internal/security"
 	"github.com/yoanbernabeu/frankendeploy/internal/ssh"
+	"golang.org/x/term"
 )
 
 var deployCmd = &cobra.Command{
@@ -35,7 +38,9 @@ The deployment process:
 5. Switches traffic to new version
 6. Cleans up old releases
 
-CI/CD: If no server is specified, FRANKENDEPLOY_SERVER environment variable is used.`,
+CI/CD: If no server is specified, FRANKENDEPLOY_SERVER environment variable is used.
+With --image, an image built by CI is deployed instead: it is pulled on the
+server, its digest verified and recorded in the release.`,
 	Args: cobra.MaximumNArgs(1),
 	RunE: runDeploy,
 }
@@ -44,8 +49,12 @@ var (
 	deployTag             string
 	deployForce           bool
 	deployNoBuild         bool
+	deployNoCache         bool
 	deployRemoteBuild     bool
 	deployNoRemoteBuild   bool
+	deployRemoteBuilder   bool
+	deployImage           string
+	deployImageFromLocal  bool
 	deploySkipEnvCheck    bool
 	deploySkipHealthcheck bool
 )
@@ -57,8 +66,20 @@ func init() {
 	deployCmd.Flags().BoolVar(&deploySkipEnvCheck, "skip-env-check", false, "Skip the pre-flight environment variables check")
 	deployCmd.Flags().BoolVar(&deploySkipHealthcheck, "skip-healthcheck", false, "Skip the health check on the new container (traffic switches unverified)")
 	deployCmd.Flags().BoolVar(&deployNoBuild, "no-build", false, "Skip image build (use existing image)")
+	deployCmd.Flags().BoolVar(&deployNoCache, "no-cache", false, "Build the image without reusing cached layers")
 	deployCmd.Flags().BoolVar(&deployRemoteBuild, "remote-build", false, "Build image on the server (recommended for cross-architecture)")
 	deployCmd.Flags().BoolVar(&deployNoRemoteBuild, "no-remote-build", false, "Force local build (ignore saved preference)")
+	deployCmd.Flags().BoolVar(&deployRemoteBuilder, "remote-builder", false, "Build with the server's Docker daemon over SSH (no source sync, no image transfer)")
+	deployCmd.MarkFlagsMutuallyExclusive("remote-builder", "remote-build")
+	deployCmd.MarkFlagsMutuallyExclusive("remote-builder", "no-remote-build")
+	deployCmd.MarkFlagsMutuallyExclusive("remote-builder", "no-build")
+	deployCmd.Flags().StringVar(&deployImage, "image", "", "Deploy a prebuilt image reference (e.g. ghcr.io/acme/app@sha256:...) instead of building")
+	deployCmd.Flags().BoolVar(&deployImageFromLocal, "image-from-local", false, "Transfer the --image from the local Docker daemon instead of pulling it on the server")
+	deployCmd.MarkFlagsMutuallyExclusive("image", "remote-build")
+	deployCmd.MarkFlagsMutuallyExclusive("image", "remote-builder")
+	deployCmd.MarkFlagsMutuallyExclusive("image", "no-build")
+	deployCmd.MarkFlagsMutuallyExclusive("no-cache", "no-build")
+	deployCmd.MarkFlagsMutuallyExclusive("no-cache", "image")
 }
 
 func runDeploy(cmd *cobra.Command, args []string) error {
@@ -103,13 +124,23 @@ func runDeploy(cmd *cobra.Command, args []string) error {
 	imageName := fmt.Sprintf("%s:%s", projectCfg.Name, deployTag)
 	remoteAppPath := constants.AppBasePath(projectCfg.Name)
 
-	// Step 1a: Check architecture compatibility
-	useRemoteBuild, err := checkArchitectureMismatch(ctx, client, serverCfg, globalCfg, serverName)
-	if err != nil {
-		return err
+	if deployImageFromLocal && deployImage == "" {
+		return fmt.Errorf("--image-from-local requires --image")
 	}
-	if useRemoteBuild && !deployRemoteBuild {
-		deployRemoteBuild = true
+
+	// Step 1a: Check architecture compatibility (nothing is built for a
+	// prebuilt image)
+	probes := probeDeployTarget(ctx, client, projectCfg.Name)
+	useRemoteBuilder := false
+	if deployImage == "" {
+		useRemoteBuild, err := checkArchitectureMismatch(probes.Arch, serverCfg, globalCfg, serverName)
+		if err != nil {
+			return err
+		}
+		if useRemoteBuild && !deployRemoteBuild {
+			deployRemoteBuild = true
+		}
+		useRemoteBuilder = usesRemoteBuilder(serverCfg)
 	}
 
 	// Step 1b: Pre-flight environment check
@@ -124,38 +155,64 @@ func runDeploy(cmd *cobra.Command, args []string) error {
 	}
 
 	// Step 2: Ensure Docker artifacts exist (novice flow: init → deploy without build)
-	if deployRemoteBuild || !deployNoBuild {
-		if err := ensureDockerArtifacts(projectCfg); err != nil {
+	if deployImage == "" && (deployRemoteBuild || useRemoteBuilder || !deployNoBuild) {
+		if err := ensureDockerArtifacts(projectCfg, (deployRemoteBuild || useRemoteBuilder) && serverCfg.ForwardAgent); err != nil {
 			return err
 		}
 	}
 
-	if deployRemoteBuild {
+	var imageDigest string
+	if deployImage != "" {
+		// Prebuilt image: no build, the image is tagged as a release
+		PrintInfo("Fetching prebuilt image %s...", deployImage)
+		imageDigest, err = deployPrebuiltImage(ctx, client, deployImage, imageName, probes.Arch, deployImageFromLocal)
+		if err != nil {
+			return fmt.Errorf("prebuilt image failed: %w", err)
+		}
+		PrintSuccess("Image ready: %s (%s)", imageName, imageDigest)
+	} else if deployRemoteBuild {
 		// Remote build: transfer source code and build on server
 		PrintInfo("Transferring source code to server...")
-		if err := transferSourceCode(ctx, client, serverCfg, projectCfg.Name, remoteAppPath); err != nil {
+		if err := transferSourceCode(ctx, client, projectCfg.Name, remoteAppPath); err != nil {
 			return fmt.Errorf("transfer failed: %w", err)
 		}
 		PrintSuccess("Source code transferred")
 
 		PrintInfo("Building Docker image on server...")
-		if err := buildDockerImageRemote(ctx, client, imageName, remoteAppPath); err != nil {
+		if serverCfg.ForwardAgent && !dockerfileMountsAgent("Dockerfile") {
+			PrintWarning("forward_agent is set but the Dockerfile has no RUN --mount=type=ssh: private dependencies cannot use the agent (regenerate it with 'frankendeploy build --dockerfile')")
+		}
+		opts := buildOptions{Dockerfile: projectCfg.Dockerfile, ForwardAgent: serverCfg.ForwardAgent, NoCache: deployNoCache}
+		if err := buildDockerImageRemote(ctx, client, imageName, remoteAppPath, opts); err != nil {
 			return fmt.Errorf("remote build failed: %w", err)
 		}
 		PrintSuccess("Image built: %s", imageName)
+	} else if useRemoteBuilder {
+		// Remote builder: the server's daemon builds from the local context,
+		// the image never leaves the server
+		platform := platformForArch(probes.Arch)
+		PrintInfo("Building Docker image with the server as builder (%s)...", platform)
+		if serverCfg.ForwardAgent && !dockerfileMountsAgent("Dockerfile") {
+			PrintWarning("forward_agent is set but the Dockerfile has no RUN --mount=type=ssh: private dependencies cannot use the agent (regenerate it with 'frankendeploy build --dockerfile')")
+		}
+		opts := buildOptions{Dockerfile: projectCfg.Dockerfile, ForwardAgent: serverCfg.ForwardAgent, NoCache: deployNoCache}
+		if err := buildDockerImageWithBuilder(ctx, client, imageName, platform, opts); err != nil {
+			return fmt.Errorf("remote builder failed: %w", err)
+		}
+		PrintSuccess("Image built on server: %s", imageName)
 	} else {
 		// Local build: build locally and transfer image
 		if !deployNoBuild {
-			platform := buildPlatformForServer(ctx, client)
+			platform := platformForArch(probes.Arch)
 			PrintInfo("Building Docker image locally (%s)...", platform)
-			if err := buildDockerImage(imageName, platform); err != nil {
+			if err := buildDockerImage(imageName, platform, buildOptions{Dockerfile: projectCfg.Dockerfile, NoCache: deployNoCache}); err != nil {
 				return fmt.Errorf("build failed: %w", err)
 			}
 			PrintSuccess("Image built: %s", imageName)
 		}
 
 		PrintInfo("Transferring image to server...")
-		if err := transferImage(ctx, client, serverCfg, imageName); err != nil {
+		if err := transferImage(ctx, client, imageName); err != nil {
 			return fmt.Errorf("transfer failed: %w", err)
 		}
 		PrintSuccess("Image transferred")
@@ -182,12 +239,15 @@ func runDeploy(cmd *cobra.Command, args []string) error {
 	if err := prepareRelease(ctx, client, projectCfg, remoteAppPath, deployTag); err != nil {
 		return fmt.Errorf("deployment failed: %w", err)
 	}
-
-	// Check if old container exists (for swap phase)
-	if oldResult, err := client.Exec(ctx, fmt.Sprintf("docker ps -q -f name=^%s$", projectCfg.Name)); err == nil && oldResult != nil {
-		state.OldContainerExists = strings.TrimSpace(oldResult.Stdout) != ""
+	if imageDigest != "" {
+		if err := writeImageDigest(ctx, client, constants.AppReleasePath(projectCfg.Name, deployTag), imageDigest); err != nil {
+			return fmt.Errorf("deployment failed: %w", err)
+		}
 	}
 
+	// Old container (for swap phase), probed before the deploy started
+	state.OldContainerExists = probes.OldContainerExists
+
 	// Step 5: Start new container with temporary name (old container still running)
 	PrintInfo("Starting new version (blue-green)...")
 	state.Phase = deploy.PhaseStartNewContainer
@@ -298,9 +358,9 @@ func runDeploy(cmd *cobra.Command, args []string) error {
 	// printing a success message with an unreachable https URL. On later
 	// deploys the existing Caddy config still routes to the swapped container,
 	// so a reload failure only warrants a warning.
-	firstExposure := projectCfg.Deploy.Domain != "" && !caddyAppConfigExists(ctx, client, projectCfg.Name)
+	firstExposure := projectCfg.Deploy.Domain != "" && !probes.CaddyConfigExists
 	PrintInfo("Updating reverse proxy...")
-	if err := updateCaddyConfig(ctx, client, projectCfg); err != nil {
+	if err := updateCaddyConfig(ctx, client, caddyAdminFor(client, serverCfg), projectCfg); err != nil {
 		if firstExposure {
 			return fmt.Errorf("reverse proxy configuration failed — the application is running on the server but NOT publicly reachable: %w", err)
 		}
@@ -334,18 +394,49 @@ func runDeploy(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
-// buildPlatformForServer returns the docker --platform value matching the
-// server's CPU architecture, so a local build always produces an image the
-// server can run (e.g. arm64 Mac → arm64 VPS must NOT build amd64).
-// Falls back to linux/amd64 when detection fails.
-func buildPlatformForServer(ctx context.Context, client ssh.Executor) string {
-	result, err := client.Exec(ctx, "uname -m")
-	if err != nil || result == nil || result.Err() != nil {
+// deployProbes is what runDeploy reads from the server before changing
+// anything, collected in one round trip
+type deployProbes struct {
+	// Arch is the output of uname -m, "" when unknown
+	Arch string
+	// OldContainerExists is set when a container of the app is running
+	OldContainerExists bool
+	// CaddyConfigExists is set when the app has already been exposed
+	CaddyConfigExists bool
+}
+
+// probeDeployTarget runs the probes of a deploy in one batch. Probes that
+// fail are left unset.
+func probeDeployTarget(ctx context.Context, client ssh.Executor, appName string) deployProbes {
+	var probes deployProbes
+	results, err := ssh.ExecBatch(ctx, client, []string{
+		"uname -m",
+		fmt.Sprintf("docker ps -q -f name=^%s$", appName),
+		caddyAppConfigCommand(appName),
+	})
+	if err != nil {
+		PrintVerbose("Could not probe the server: %v", err)
+		return probes
+	}
+	if results[0].ExitCode == 0 {
+		probes.Arch = strings.TrimSpace(results[0].Stdout)
+	}
+	probes.OldContainerExists = strings.TrimSpace(results[1].Stdout) != ""
+	probes.CaddyConfigExists = strings.TrimSpace(results[2].Stdout) == "yes"
+	return probes
+}
+
+// platformForArch returns the docker --platform value matching the
+// server's CPU architecture (uname -m), so a local build always produces an
+// image the server can run (e.g. arm64 Mac → arm64 VPS must NOT build
+// amd64). Falls back to linux/amd64 when the architecture is unknown.
+func platformForArch(serverArch string) string {
+	if serverArch == "" {
 		PrintWarning("Could not detect server architecture, building for linux/amd64")
 		return "linux/amd64"
 	}
 
-	arch := normalizeArch(result.Stdout)
+	arch := normalizeArch(serverArch)
 	switch arch {
 	case "amd64", "arm64":
 		return "linux/" + arch
@@ -355,20 +446,114 @@ func buildPlatformForServer(ctx context.Context, client ssh.Executor) string {
 	}
 }
 
-func buildDockerImage(imageName, platform string) error {
+// buildOptions are the docker build settings shared by the build modes
+type buildOptions struct {
+	// Dockerfile holds the build args and secrets
+	Dockerfile config.DockerfileConfig
+	// ForwardAgent forwards the local ssh-agent to a remote build
+	ForwardAgent bool
+	// NoCache rebuilds every layer (docker build --no-cache)
+	NoCache bool
+}
+
+func buildDockerImage(imageName, platform string, opts buildOptions) error {
+	secretFlags, err := localSecretFlags(opts.Dockerfile.Secrets)
+	if err != nil {
+		return err
+	}
+
 	// Use buildx to cross-compile for the server's architecture
-	dockerCmd := exec.Command("docker", "buildx", "build",
+	args := []string{"buildx", "build",
 		"--platform", platform,
 		"--target", "frankenphp_prod",
 		"--load",
 		"-t", imageName,
-		".")
+	}
+	if opts.NoCache {
+		args = append(args, "--no-cache")
+	}
+	args = append(args, buildArgFlags(opts.Dockerfile.BuildArgs)...)
+	args = append(args, secretFlags...)
+	if opts.Dockerfile.CacheDir != "" {
+		// The default "docker" driver fails on a cache export
+		if driver := buildxDriver(); driver == "docker" {
+			PrintWarning("dockerfile.cache_dir ignored: the current buildx builder uses the %q driver, which cannot export a cache (create a docker-container builder with 'docker buildx create --use')", driver)
+		} else {
+			args = append(args, localCacheFlags(opts.Dockerfile.CacheDir)...)
+		}
+	}
+	dockerCmd := exec.Command("docker", append(args, ".")...)
+	dockerCmd.Stdout = os.Stdout
+	dockerCmd.Stderr = os.Stderr
+	return dockerCmd.Run()
+}
+
+// buildDockerImageWithBuilder builds the image with the Docker daemon of
+// the server as builder: its API socket is tunnelled through the SSH
+// connection (jump hosts and host key checks included) and used as
+// DOCKER_HOST. The default builder of that endpoint is the daemon's own
+// BuildKit, so --load stores the image on the server directly, where a
+// docker-container builder would stream it back through the local machine.
+// The local ssh-agent and secrets are handed to the build by buildx
+// itself.
+func buildDockerImageWithBuilder(ctx context.Context, client ssh.Tunneler, imageName, platform string, opts buildOptions) error {
+	secretFlags, err := localSecretFlags(opts.Dockerfile.Secrets)
+	if err != nil {
+		return err
+	}
+
+	tunnel, err := client.Forward(ctx, "unix", constants.DockerSocket)
+	if err != nil {
+		return fmt.Errorf("failed to reach the server's Docker daemon: %w", err)
+	}
+	defer tunnel.Close()
+
+	dockerCmd := exec.CommandContext(ctx, "docker", remoteBuilderArgs(imageName, platform, opts, secretFlags)...)
+	dockerCmd.Env = dockerHostEnv(os.Environ(), tunnel.URL())
 	dockerCmd.Stdout = os.Stdout
 	dockerCmd.Stderr = os.Stderr
 	return dockerCmd.Run()
 }
 
-func transferImage(ctx context.Context, client ssh.Executor, serverCfg *config.ServerConfig, imageName string) error {
+// remoteBuilderArgs returns the docker arguments of a remote builder
+// build. cache_dir is left out: the daemon's builder cannot export a cache,
+// and keeps its own between builds.
+func remoteBuilderArgs(imageName, platform string, opts buildOptions, secretFlags []string) []string {
+	args := []string{"buildx", "build",
+		"--builder", "default",
+		"--platform", platform,
+		"--target", "frankenphp_prod",
+		"--load",
+		"-t", imageName,
+	}
+	if opts.ForwardAgent {
+		args = append(args, "--ssh", "default")
+	}
+	if opts.NoCache {
+		args = append(args, "--no-cache")
+	}
+	args = append(args, buildArgFlags(opts.Dockerfile.BuildArgs)...)
+	args = append(args, secretFlags...)
+	return append(args, ".")
+}
+
+// dockerHostEnv returns env with DOCKER_HOST set to host. DOCKER_CONTEXT
+// is dropped: a context would take precedence over the tunnel.
+func dockerHostEnv(env []string, host string) []string {
+	out := make([]string, 0, len(env)+1)
+	for _, kv := range env {
+		if strings.HasPrefix(kv, "DOCKER_HOST=") || strings.HasPrefix(kv, "DOCKER_CONTEXT=") {
+			continue
+		}
+		out = append(out, kv)
+	}
+	return append(out, "DOCKER_HOST="+host)
+}
+
+// transferImage saves the image locally and uploads it over SFTP through
+// the SSH connection of client, so the upload takes the same route (jump
+// hosts included) and credentials as every command.
+func transferImage(ctx context.Context, client ssh.Transferer, imageName string) error {
 	// Save image to tar
 	tarPath := fmt.Sprintf("/tmp/%s.tar", strings.ReplaceAll(imageName, ":", "-"))
 
@@ -379,22 +564,14 @@ func transferImage(ctx context.Context, client ssh.Executor, serverCfg *config.S
 	defer os.Remove(tarPath)
 
 	// Get image size for progress
-	info, _ := os.Stat(tarPath)
-	PrintVerbose("Image size: %.2f MB", float64(info.Size())/1024/1024)
-
-	// Upload using scp
-	remoteTarPath := fmt.Sprintf("/tmp/%s.tar", strings.ReplaceAll(imageName, ":", "-"))
-
-	scpArgs := []string{
-		"-P", fmt.Sprintf("%d", serverCfg.Port),
-	}
-	if serverCfg.KeyPath != "" {
-		scpArgs = append(scpArgs, "-i", serverCfg.KeyPath)
+	if info, err := os.Stat(tarPath); err == nil {
+		PrintVerbose("Image size: %.2f MB", float64(info.Size())/1024/1024)
 	}
-	scpArgs = append(scpArgs, tarPath, fmt.Sprintf("%s@%s:%s", serverCfg.User, serverCfg.Host, remoteTarPath))
 
-	scpCmd := exec.Command("scp", scpArgs...)
-	if err := scpCmd.Run(); err != nil {
+	// The tar is uploaded under a temporary name then renamed: an
+	// interrupted upload never leaves a partial tar to load
+	remoteTarPath := fmt.Sprintf("/tmp/%s.tar", strings.ReplaceAll(imageName, ":", "-"))
+	if err := client.Upload(ctx, tarPath, remoteTarPath, transferProgress("Uploading image")); err != nil {
 		return fmt.Errorf("failed to upload image: %w", err)
 	}
 
@@ -411,47 +588,104 @@ func transferImage(ctx context.Context, client ssh.Executor, serverCfg *config.S
 	return nil
 }
 
-func transferSourceCode(ctx context.Context, client ssh.Executor, serverCfg *config.ServerConfig, appName, appPath string) error {
-	// Create build directory on server
-	buildPath := fmt.Sprintf("%s/build", appPath)
-	if _, err := client.Exec(ctx, fmt.Sprintf("rm -rf %s && mkdir -p %s", buildPath, buildPath)); err != nil {
-		return fmt.Errorf("failed to create build directory: %w", err)
-	}
+// sourceExcludes are the names never transferred for a remote build, at
+// any depth: dependencies and local state are rebuilt on the server
+var sourceExcludes = []string{".git", "node_modules", "vendor", "var", ".env.local"}
 
-	// Use rsync to transfer source code (respects .dockerignore patterns)
-	sshArgs := fmt.Sprintf("ssh -p %d", serverCfg.Port)
-	if serverCfg.KeyPath != "" {
-		sshArgs += fmt.Sprintf(" -i %s", serverCfg.KeyPath)
-	}
-	rsyncArgs := []string{
-		"-avz", "--delete",
-		"--exclude", ".git",
-		"--exclude", "node_modules",
-		"--exclude", "vendor",
-		"--exclude", "var",
-		"--exclude", ".env.local",
-		"-e", sshArgs,
-		"./",
-		fmt.Sprintf("%s@%s:%s/", serverCfg.User, serverCfg.Host, buildPath),
+// sourceExcluded reports whether a project path stays out of a remote
+// build: named like one of sourceExcludes, or left out of the build
+// context by .dockerignore
+func sourceExcluded(rel string, isDir bool, ignore *ssh.Dockerignore) bool {
+	return slices.Contains(sourceExcludes, path.Base(rel)) || ignore.Excluded(rel, isDir)
+}
+
+// transferSourceCode syncs the project sources to the build directory of
+// the app over SFTP. The directory is kept between builds: only the files
+// changed since the last build are uploaded.
+func transferSourceCode(ctx context.Context, client ssh.Transferer, appName, appPath string) error {
+	ignore, err := ssh.LoadDockerignore(".")
+	if err != nil {
+		return err
 	}
 
-	rsyncCmd := exec.Command("rsync", rsyncArgs...)
-	rsyncCmd.Stdout = os.Stdout
-	rsyncCmd.Stderr = os.Stderr
-	if err := rsyncCmd.Run(); err != nil {
-		return fmt.Errorf("rsync failed: %w", err)
+	buildPath := fmt.Sprintf("%s/build", appPath)
+	stats, err := client.SyncDir(ctx, ".", buildPath, ssh.SyncOptions{
+		Exclude: func(rel string, isDir bool) bool {
+			return sourceExcluded(rel, isDir, ignore)
+		},
+		Progress: transferProgress("Uploading sources"),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to upload %s sources: %w", appName, err)
 	}
+	PrintVerbose("%d files uploaded (%.2f MB), %d unchanged, %d deleted",
+		stats.Uploaded, float64(stats.Bytes)/1024/1024, stats.Unchanged, stats.Deleted)
 
 	return nil
 }
 
-func buildDockerImageRemote(ctx context.Context, client ssh.Executor, imageName, appPath string) error {
+// transferProgress returns a progress callback redrawing one line on a
+// terminal; nothing is printed otherwise, so CI logs stay readable
+func transferProgress(label string) ssh.ProgressFunc {
+	if !term.IsTerminal(int(os.Stdout.Fd())) {
+		return nil
+	}
+	lastPercent := -1
+	return func(p ssh.TransferProgress) {
+		if p.Total <= 0 {
+			return
+		}
+		percent := int(p.Done * 100 / p.Total)
+		if percent == lastPercent {
+			return
+		}
+		lastPercent = percent
+		fmt.Printf("\r   %s: %3d%% (%.1f/%.1f MB)", label, percent, float64(p.Done)/1024/1024, float64(p.Total)/1024/1024)
+		if p.Done >= p.Total {
+			fmt.Println()
+		}
+	}
+}
+
+// buildDockerImageRemote builds the image on the server from the synced
+// source. With opts.ForwardAgent, the local ssh-agent is forwarded to the
+// build session only and handed to BuildKit (--ssh default) for RUN
+// --mount=type=ssh steps. Secrets are staged next to the build directory
+// for the build only. The build directory and the daemon's BuildKit cache
+// (layers and cache mounts) are kept between builds.
+func buildDockerImageRemote(ctx context.Context, client ssh.Executor, imageName, appPath string, opts buildOptions) error {
 	buildPath := fmt.Sprintf("%s/build", appPath)
 
-	// Build Docker image on the server
-	buildCmd := fmt.Sprintf("cd %s && docker build --target frankenphp_prod -t %s .", buildPath, imageName)
+	secretFlags, cleanup, err := stageRemoteSecrets(ctx, client, opts.Dockerfile.Secrets, appPath+"/.build-secrets")
+	if err != nil {
+		return err
+	}
+	defer cleanup()
 
-	result, err := client.Exec(ctx, buildCmd)
+	flags := append(buildArgFlags(opts.Dockerfile.BuildArgs), secretFlags...)
+	run := client.Exec
+	if opts.ForwardAgent {
+		forwarder, ok := client.(ssh.AgentForwarder)
+		if !ok {
+			return fmt.Errorf("forward_agent is not supported by this connection")
+		}
+		flags = append([]string{"--ssh", "default"}, flags...)
+		run = forwarder.ExecForwardAgent
+	}
+
+	// Build Docker image on the server. Cache mounts, --ssh and --secret
+	// require BuildKit, the default builder since Docker 23 only.
+	// --no-cache stays out of flags: shellFlags quotes name and value pairs
+	buildCmd := fmt.Sprintf("cd %s && DOCKER_BUILDKIT=1 docker build", buildPath)
+	if opts.NoCache {
+		buildCmd += " --no-cache"
+	}
+	if len(flags) > 0 {
+		buildCmd += " " + shellFlags(flags)
+	}
+	buildCmd += fmt.Sprintf(" --target frankenphp_prod -t %s .", imageName)
+
+	result, err := run(ctx, buildCmd)
 	if err != nil {
 		return fmt.Errorf("docker build failed: %w", err)
 	}
@@ -459,13 +693,9 @@ func buildDockerImageRemote(ctx context.Context, client ssh.Executor, imageName,
 		return fmt.Errorf("docker build failed: %w", err)
 	}
 
-	// Cleanup build directory
-	if _, err := client.Exec(ctx, fmt.Sprintf("rm -rf %s", buildPath)); err != nil {
-		PrintVerbose("Could not cleanup build directory: %v", err)
-	}
-
-	// Remote builds leave dangling layers behind (each rebuild orphans the
-	// previous intermediate layers); prune them so they don't pile up
+	// Remote builds leave dangling images behind (each rebuild orphans the
+	// previous tag's layers); prune them so they don't pile up. The build
+	// cache is left alone: 'server gc' prunes the entries unused for a day.
 	if _, err := client.Exec(ctx, "docker image prune -f"); err != nil {
 		PrintVerbose("Could not prune dangling images: %v", err)
 	}
@@ -473,6 +703,13 @@ func buildDockerImageRemote(ctx context.Context, client ssh.Executor, imageName,
 	return nil
 }
 
+// dockerfileMountsAgent reports whether the Dockerfile at path mounts the
+// forwarded ssh-agent in a RUN step
+func dockerfileMountsAgent(path string) bool {
+	data, err := os.ReadFile(path)
+	return err == nil && strings.Contains(string(data), "--mount=type=ssh")
+}
+
 // prepareRelease creates the release directory, shared directories and files, and fixes permissions.
 func prepareRelease(ctx context.Context, client ssh.Executor, cfg *config.ProjectConfig, appPath, tag string) error {
 	releasePath := filepath.Join(appPath, "releases", tag)
@@ -823,14 +1060,24 @@ func fixSharedPermissions(ctx context.Context, client ssh.Executor, sharedPath s
 	}
 }
 
-// caddyAppConfigExists reports whether the app already has a Caddy config on
-// the server — i.e. whether it has ever been publicly exposed.
+// caddyAppConfigExists reports whether the app already has a Caddy config
+// (or recorded route in API mode) on the server — i.e. whether it has ever
+// been publicly exposed.
 func caddyAppConfigExists(ctx context.Context, client ssh.Executor, appName string) bool {
-	result, err := client.Exec(ctx, fmt.Sprintf("test -f %s && echo yes", constants.CaddyAppConfig(appName)))
+	result, err := client.Exec(ctx, caddyAppConfigCommand(appName))
 	return err == nil && result != nil && strings.TrimSpace(result.Stdout) == "yes"
 }
 
-func updateCaddyConfig(ctx context.Context, client ssh.Executor, cfg *config.ProjectConfig) error {
+// caddyAppConfigCommand prints "yes" when the app has a Caddy config
+func caddyAppConfigCommand(appName string) string {
+	return fmt.Sprintf("(test -f %s || test -f %s) && echo yes",
+		constants.CaddyAppConfig(appName), constants.CaddyAppRoute(appName))
+}
+
+// updateCaddyConfig exposes the app on its domain. With an admin client
+// (API mode) only the app's route is patched; otherwise its Caddyfile is
+// rewritten and Caddy reloaded.
+func updateCaddyConfig(ctx context.Context, client ssh.Executor, admin *caddy.AdminClient, cfg *config.ProjectConfig) error {
 	domain := cfg.Deploy.Domain
 	if domain == "" {
 		fmt.Println()
@@ -861,28 +1108,87 @@ func updateCaddyConfig(ctx context.Context, client ssh.Executor, cfg *config.Pro
 	// Generate Caddy config using our generator
 	caddyGen := caddy.NewConfigGenerator()
 	appConfig := caddy.AppConfigFromProject(cfg, domain)
+	appConfig.Protect, err = resolveProtectRule(ctx, client, cfg)
+	if err != nil {
+		return err
+	}
+	customTLS := cfg.Deploy.TLS.EffectiveMode() == config.TLSModeCustom
+	if customTLS {
+		if err := uploadCustomCert(ctx, client, cfg, domain); err != nil {
+			return err
+		}
+	}
+	if admin != nil {
+		if err := admin.ApplyTLS(ctx, cfg.Name, domain, appConfig.TLSMode); err != nil {
+			return err
+		}
+		if err := applyCaddyRoute(ctx, client, admin, appConfig); err != nil {
+			return err
+		}
+		removeStaleCerts(ctx, client, cfg)
+		PrintSuccess("Caddy configured for %s", domain)
+		return nil
+	}
+	if appConfig.TLSMode == config.TLSModeOnDemand {
+		if err := checkOnDemandTLS(ctx, client, cfg.Name); err != nil {
+			return err
+		}
+	}
 	configContent, err := caddyGen.GenerateAppConfig(appConfig)
 	if err != nil {
 		return fmt.Errorf("failed to generate Caddy config: %w", err)
 	}
 
-	// Write config and reload Caddy
+	// Write, validate, swap and reload (restoring the previous file on failure)
 	commands, err := caddy.WriteAppConfigCommands(cfg.Name, configContent)
 	if err != nil {
 		return fmt.Errorf("failed to prepare Caddy commands: %w", err)
 	}
-	for _, command := range commands {
-		PrintVerboseCommand(command)
-		result, err := client.Exec(ctx, command)
-		if err != nil {
-			return fmt.Errorf("command failed: %w", err)
-		}
-		if err := result.Err(); err != nil {
-			return fmt.Errorf("command failed: %w", err)
-		}
+	if customTLS {
+		// The Caddyfile may be unchanged while the certificate was renewed
+		commands = append(commands, caddy.ForceReloadCommand())
 	}
+	if err := runCommandsStrict(ctx, client, commands); err != nil {
+		return err
+	}
+	removeStaleCerts(ctx, client, cfg)
 
 	PrintSuccess("Caddy configured for %s", domain)
+	if appConfig.TLSMode == config.TLSModeOnDemand {
+		PrintInfo("Other domains get a certificate at their first HTTPS request, once %s?domain=<name> answers 200", appConfig.OnDemandAsk)
+	}
+	return nil
+}
+
+// removeStaleCerts deletes the custom certificate left on the server by an
+// app that no longer uses one
+func removeStaleCerts(ctx context.Context, client ssh.Executor, cfg *config.ProjectConfig) {
+	if cfg.Deploy.TLS.EffectiveMode() == config.TLSModeCustom {
+		return
+	}
+	if _, err := client.Exec(ctx, caddy.RemoveCertsCommand(cfg.Name)); err != nil {
+		PrintVerbose("Could not remove custom certificate: %v", err)
+	}
+}
+
+// applyCaddyRoute patches the app's route through the admin API, then
+// records it with the app's TLS setting (applied before) on the server for
+// drift detection and rollback.
+func applyCaddyRoute(ctx context.Context, client ssh.Executor, admin *caddy.AdminClient, app caddy.AppConfig) error {
+	route, err := caddy.NewConfigGenerator().GenerateAppRoute(app)
+	if err != nil {
+		return fmt.Errorf("failed to generate Caddy route: %w", err)
+	}
+	if err := admin.ApplyRoute(ctx, app.Name, route); err != nil {
+		return err
+	}
+	commands, err := caddy.SaveRouteCommands(app.Name, route, caddy.RouteTLS{Mode: app.TLSMode, Domain: app.Domain})
+	if err != nil {
+		return fmt.Errorf("failed to prepare Caddy commands: %w", err)
+	}
+	if err := runCommandsStrict(ctx, client, commands); err != nil {
+		return fmt.Errorf("route applied but not recorded on the server: %w", err)
+	}
 	return nil
 }
 
@@ -1229,7 +1535,12 @@ func checkAndWarnMigrationState(ctx context.Context, client ssh.Executor, appNam
 
 // checkArchitectureMismatch detects if local and server architectures are incompatible
 // Returns: (shouldUseRemoteBuild bool, err error)
-func checkArchitectureMismatch(ctx context.Context, client *ssh.Client, serverCfg *config.ServerConfig, globalCfg *config.GlobalConfig, serverName string) (bool, error) {
+func checkArchitectureMismatch(serverArch string, serverCfg *config.ServerConfig, globalCfg *config.GlobalConfig, serverName string) (bool, error) {
+	// 0. The remote builder builds natively on the server: no mismatch
+	if usesRemoteBuilder(serverCfg) {
+		return false, nil
+	}
+
 	// 1. Check explicit flags first
 	if deployNoRemoteBuild {
 		return false, nil // User explicitly wants local build
@@ -1248,9 +1559,8 @@ func checkArchitectureMismatch(ctx context.Context, client *ssh.Client, serverCf
 
 	// 3. Detect architectures
 	localArch := runtime.GOARCH // "arm64" on Mac Silicon, "amd64" on Intel
-	serverArch, err := client.GetServerArchitecture(ctx)
-	if err != nil {
-		PrintWarning("Could not detect server architecture: %v", err)
+	if serverArch == "" {
+		PrintWarning("Could not detect server architecture")
 		return false, nil // Default to local build
 	}
 
@@ -1267,6 +1577,19 @@ func checkArchitectureMismatch(ctx context.Context, client *ssh.Client, serverCf
 	return handleArchitectureMismatch(serverCfg, globalCfg, serverName, localArch, serverArch)
 }
 
+// usesRemoteBuilder reports whether the server's Docker daemon builds the
+// image: --remote-builder, or the server preference unless a build flag
+// asks for another mode or --no-build for no build at all
+func usesRemoteBuilder(serverCfg *config.ServerConfig) bool {
+	if deployRemoteBuilder {
+		return true
+	}
+	if deployRemoteBuild || deployNoRemoteBuild || deployNoBuild {
+		return false
+	}
+	return serverCfg.RemoteBuilder
+}
+
 // normalizeArch converts architecture names to a common format
 func normalizeArch(arch string) string {
 	arch = strings.TrimSpace(strings.ToLower(arch))
@@ -1298,7 +1621,7 @@ func handleArchitectureMismatch(serverCfg *config.ServerConfig, globalCfg *confi
 	if !IsInteractive() {
 		PrintError("Architecture mismatch: local %s → server %s", localArch, serverArch)
 		fmt.Println()
-		fmt.Println("   Add --remote-build flag or configure server:")
+		fmt.Println("   Add --remote-build (or --remote-builder) flag or configure server:")
 		fmt.Printf("   frankendeploy server set %s remote_build true\n", serverName)
 		return false, fmt.Errorf("architecture mismatch requires --remote-build flag in CI/CD mode")
 	}
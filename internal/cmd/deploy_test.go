@@ -3,6 +3,8 @@ package cmd
 import (
 	"context"
 	"fmt"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
@@ -361,25 +363,188 @@ func TestTransferSourceCode_PropagatesContext(t *testing.T) {
 	seen := ""
 
 	mock := &ssh.MockExecutor{
-		ExecFunc: func(ctx context.Context, command string) (*ssh.ExecResult, error) {
+		SyncDirFunc: func(ctx context.Context, localDir, remoteDir string, opts ssh.SyncOptions) (*ssh.SyncStats, error) {
 			if v, ok := ctx.Value(key).(string); ok {
 				seen = v
 			}
-			// Return an error so transferSourceCode returns before rsync runs externally.
-			return nil, fmt.Errorf("mocked failure to short-circuit rsync")
+			return nil, fmt.Errorf("mocked failure to short-circuit the upload")
 		},
 	}
 
 	ctx := context.WithValue(context.Background(), key, "propagated")
-	_ = transferSourceCode(
+	err := transferSourceCode(
 		ctx, mock,
-		&config.ServerConfig{Host: "example", User: "deploy", Port: 22},
 		"myapp",
 		"/opt/frankendeploy/apps/myapp",
 	)
 
 	if seen != "propagated" {
-		t.Errorf("transferSourceCode() did not propagate ctx to client.Exec; seen=%q", seen)
+		t.Errorf("transferSourceCode() did not propagate ctx to client.SyncDir; seen=%q", seen)
+	}
+	if err == nil {
+		t.Error("transferSourceCode() should return the sync error")
+	}
+	if len(mock.Uploads) != 1 || mock.Uploads[0] != "/opt/frankendeploy/apps/myapp/build" {
+		t.Errorf("sources should sync to the build directory, got %v", mock.Uploads)
+	}
+}
+
+func TestBuildDockerImageRemote_ForwardAgent(t *testing.T) {
+	mock := &ssh.MockExecutor{}
+	if err := buildDockerImageRemote(context.Background(), mock, "myapp:v1", "/opt/frankendeploy/apps/myapp", buildOptions{}); err != nil {
+		t.Fatalf("buildDockerImageRemote() error = %v", err)
+	}
+	if len(mock.AgentCommands) != 0 || hasCommand(mock.Commands, "--ssh") {
+		t.Errorf("the agent should not be forwarded by default: %v", mock.AgentCommands)
+	}
+	if hasCommand(mock.Commands, "--no-cache") {
+		t.Errorf("the build cache should be used by default: %v", mock.Commands)
+	}
+
+	mock = &ssh.MockExecutor{}
+	if err := buildDockerImageRemote(context.Background(), mock, "myapp:v1", "/opt/frankendeploy/apps/myapp", buildOptions{NoCache: true}); err != nil {
+		t.Fatalf("buildDockerImageRemote() error = %v", err)
+	}
+	if !hasCommand(mock.Commands, "docker build --no-cache --target") {
+		t.Errorf("--no-cache should be passed to docker build: %v", mock.Commands)
+	}
+
+	// Build arg values stay quoted next to --no-cache
+	mock = &ssh.MockExecutor{}
+	opts := buildOptions{
+		Dockerfile: config.DockerfileConfig{BuildArgs: map[string]string{"APP_NAME": "My App $(reboot)"}},
+		NoCache:    true,
+	}
+	if err := buildDockerImageRemote(context.Background(), mock, "myapp:v1", "/opt/frankendeploy/apps/myapp", opts); err != nil {
+		t.Fatalf("buildDockerImageRemote() error = %v", err)
+	}
+	if !hasCommand(mock.Commands, "docker build --no-cache --build-arg 'APP_NAME=My App $(reboot)' --target") {
+		t.Errorf("build arg values should be quoted: %v", mock.Commands)
+	}
+
+	mock = &ssh.MockExecutor{}
+	if err := buildDockerImageRemote(context.Background(), mock, "myapp:v1", "/opt/frankendeploy/apps/myapp", buildOptions{ForwardAgent: true}); err != nil {
+		t.Fatalf("buildDockerImageRemote() error = %v", err)
+	}
+	if len(mock.AgentCommands) != 1 || !strings.Contains(mock.AgentCommands[0], "docker build --ssh 'default'") {
+		t.Errorf("docker build should run with the agent forwarded, got %v", mock.AgentCommands)
+	}
+	// Only the build session gets the agent
+	if hasCommand(mock.AgentCommands, "prune") {
+		t.Errorf("the agent was forwarded to another command: %v", mock.AgentCommands)
+	}
+}
+
+func TestBuildDockerImageWithBuilder(t *testing.T) {
+	// A fake docker recording its arguments and endpoint
+	bin := t.TempDir()
+	out := filepath.Join(bin, "out")
+	script := "#!/bin/sh\necho \"$DOCKER_HOST|$DOCKER_CONTEXT|$*\" > " + out + "\n"
+	if err := os.WriteFile(filepath.Join(bin, "docker"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("DOCKER_CONTEXT", "laptop")
+
+	mock := &ssh.MockExecutor{}
+	opts := buildOptions{
+		Dockerfile:   config.DockerfileConfig{BuildArgs: map[string]string{"APP_VERSION": "1.2"}, CacheDir: t.TempDir()},
+		ForwardAgent: true,
+		NoCache:      true,
+	}
+	if err := buildDockerImageWithBuilder(context.Background(), mock, "myapp:v1", "linux/arm64", opts); err != nil {
+		t.Fatalf("buildDockerImageWithBuilder() error = %v", err)
+	}
+	if len(mock.Forwards) != 1 || mock.Forwards[0] != "/var/run/docker.sock" {
+		t.Errorf("the Docker socket should be tunnelled, got %v", mock.Forwards)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	host, rest, _ := strings.Cut(strings.TrimSpace(string(data)), "|")
+	dockerContext, args, _ := strings.Cut(rest, "|")
+	if !strings.HasPrefix(host, "unix://") || dockerContext != "" {
+		t.Errorf("docker should target the tunnel only, got DOCKER_HOST=%q DOCKER_CONTEXT=%q", host, dockerContext)
+	}
+	want := "buildx build --builder default --platform linux/arm64 --target frankenphp_prod --load -t myapp:v1 --ssh default --no-cache --build-arg APP_VERSION=1.2 ."
+	if args != want {
+		t.Errorf("docker args = %q, want %q", args, want)
+	}
+	// No source sync and no image transfer
+	if len(mock.Commands) != 0 || len(mock.Uploads) != 0 {
+		t.Errorf("nothing else should reach the server: %v %v", mock.Commands, mock.Uploads)
+	}
+}
+
+func TestCheckArchitectureMismatch_RemoteBuilder(t *testing.T) {
+	defer func() { deployRemoteBuilder, deployRemoteBuild, deployNoBuild = false, false, false }()
+
+	// The server builds natively: no prompt, no remote build
+	serverCfg := &config.ServerConfig{RemoteBuilder: true}
+	useRemoteBuild, err := checkArchitectureMismatch("riscv64", serverCfg, &config.GlobalConfig{}, "prod")
+	if err != nil || useRemoteBuild {
+		t.Errorf("checkArchitectureMismatch() = %v, %v, want false, nil", useRemoteBuild, err)
+	}
+	if !usesRemoteBuilder(serverCfg) {
+		t.Error("the server preference should select the remote builder")
+	}
+
+	// A build flag overrides the preference
+	deployRemoteBuild = true
+	if usesRemoteBuilder(serverCfg) {
+		t.Error("--remote-build should override the remote_builder preference")
+	}
+	deployRemoteBuild = false
+	deployNoBuild = true
+	if usesRemoteBuilder(serverCfg) {
+		t.Error("--no-build should override the remote_builder preference")
+	}
+	deployNoBuild = false
+	deployRemoteBuilder = true
+	if !usesRemoteBuilder(&config.ServerConfig{}) {
+		t.Error("--remote-builder should select the remote builder")
+	}
+}
+
+func TestDockerfileMountsAgent(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "Dockerfile")
+	if dockerfileMountsAgent(path) {
+		t.Error("a missing Dockerfile does not mount the agent")
+	}
+	os.WriteFile(path, []byte("RUN --mount=type=ssh composer install\n"), 0644)
+	if !dockerfileMountsAgent(path) {
+		t.Error("RUN --mount=type=ssh should be detected")
+	}
+}
+
+func TestSourceExcluded(t *testing.T) {
+	ignore, err := ssh.ParseDockerignore(strings.NewReader("*.md\ntests\nDockerfile*\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		rel      string
+		isDir    bool
+		excluded bool
+	}{
+		{"composer.json", false, false},
+		{"src/Kernel.php", false, false},
+		{"src/vendor", true, true}, // excluded at any depth
+		{"vendor", true, true},
+		{".git", true, true},
+		{".env.local", false, true},
+		{"public/assets/.env.local", false, true},
+		{"README.md", false, true},
+		{"tests", true, true},
+		{"Dockerfile", false, false}, // the build needs it
+		{"docker-entrypoint.sh", false, false},
+	}
+	for _, tt := range tests {
+		if got := sourceExcluded(tt.rel, tt.isDir, ignore); got != tt.excluded {
+			t.Errorf("sourceExcluded(%q) = %v, want %v", tt.rel, got, tt.excluded)
+		}
 	}
 }
 
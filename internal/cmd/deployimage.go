@@ -0,0 +1,189 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/yoanbernabeu/frankendeploy/internal/security"
+	"github.com/yoanbernabeu/frankendeploy/internal/ssh"
+)
+
+// imageDigestFile is the file of a release directory recording the digest
+// of a prebuilt image (deploy --image)
+const imageDigestFile = "image-digest"
+
+// imageInspectFormat prints the id, architecture and repo digests of an
+// image on one line
+const imageInspectFormat = "{{.Id}} {{.Architecture}}{{range .RepoDigests}} {{.}}{{end}}"
+
+// imageInfo is what docker image inspect reports about an image
+type imageInfo struct {
+	ID           string
+	Architecture string
+	// RepoDigests are the registry references of the image
+	// (repository@sha256:...)
+	RepoDigests []string
+}
+
+// parseImageInfo parses the imageInspectFormat output
+func parseImageInfo(output string) (*imageInfo, error) {
+	fields := strings.Fields(output)
+	if len(fields) < 2 || !strings.HasPrefix(fields[0], "sha256:") {
+		return nil, fmt.Errorf("unexpected docker image inspect output: %q", strings.TrimSpace(output))
+	}
+	return &imageInfo{ID: fields[0], Architecture: fields[1], RepoDigests: fields[2:]}, nil
+}
+
+// refDigest returns the digest pinned by an image reference, "" for a tag
+func refDigest(ref string) string {
+	if _, digest, ok := strings.Cut(ref, "@"); ok {
+		return digest
+	}
+	return ""
+}
+
+// refRepository returns the repository of an image reference, without tag
+// or digest, in its canonical form: Docker Hub references ("nginx",
+// "acme/app") get their implicit registry and namespace, as in RepoDigests
+// they may be reported either way.
+func refRepository(ref string) string {
+	repository, _, _ := strings.Cut(ref, "@")
+	if colon := strings.LastIndex(repository, ":"); colon > strings.LastIndex(repository, "/") {
+		repository = repository[:colon]
+	}
+
+	domain, path, found := strings.Cut(repository, "/")
+	if !found || (!strings.ContainsAny(domain, ".:") && domain != "localhost") {
+		domain, path = "docker.io", repository
+	}
+	if domain == "index.docker.io" {
+		domain = "docker.io"
+	}
+	if domain == "docker.io" && !strings.Contains(path, "/") {
+		path = "library/" + path
+	}
+	return domain + "/" + path
+}
+
+// verifiedDigest returns the registry digest of an image in the repository
+// of ref, checked against the digest pinned by ref if any. The digests of
+// other repositories the image was pulled from are not ref's: an image
+// without registry digest for its repository (never pulled, or tagged
+// locally) is identified by its id.
+func verifiedDigest(ref string, info *imageInfo) (string, error) {
+	want := refDigest(ref)
+	repository := refRepository(ref)
+	for _, repoDigest := range info.RepoDigests {
+		name, digest, _ := strings.Cut(repoDigest, "@")
+		if refRepository(name) != repository {
+			continue
+		}
+		if want == "" || digest == want {
+			return digest, nil
+		}
+	}
+	if want != "" {
+		return "", fmt.Errorf("image %s does not match its digest: got %s", ref, strings.Join(info.RepoDigests, ", "))
+	}
+	return info.ID, nil
+}
+
+// deployPrebuiltImage makes the prebuilt image ref available on the server
+// as imageName, so rollback and image pruning treat it like a built one,
+// and returns its verified digest. The image is pulled by the server, or
+// with fromLocal transferred from the local Docker daemon.
+func deployPrebuiltImage(ctx context.Context, client ssh.Transferer, ref, imageName, serverArch string, fromLocal bool) (string, error) {
+	if err := security.ValidateImageRef(ref); err != nil {
+		return "", fmt.Errorf("invalid image: %w", err)
+	}
+	if fromLocal {
+		return transferPrebuiltImage(ctx, client, ref, imageName, serverArch)
+	}
+	return pullPrebuiltImage(ctx, client, ref, imageName)
+}
+
+// pullPrebuiltImage pulls ref on the server, verifies its digest and tags
+// it imageName. The pulled reference is removed afterwards: imageName is
+// then the only tag of the image, which pruning the release frees.
+func pullPrebuiltImage(ctx context.Context, client ssh.Executor, ref, imageName string) (string, error) {
+	quoted := security.ShellEscape(ref)
+	if err := runCommandsStrict(ctx, client, []string{"docker pull " + quoted}); err != nil {
+		return "", fmt.Errorf("failed to pull %s on the server: %w", ref, err)
+	}
+
+	result, err := client.Exec(ctx, fmt.Sprintf("docker image inspect --format '%s' %s", imageInspectFormat, quoted))
+	if err == nil {
+		err = result.Err()
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to inspect %s: %w", ref, err)
+	}
+	info, err := parseImageInfo(result.Stdout)
+	if err != nil {
+		return "", err
+	}
+	digest, err := verifiedDigest(ref, info)
+	if err != nil {
+		return "", err
+	}
+
+	if err := runCommandsStrict(ctx, client, []string{fmt.Sprintf("docker tag %s %s", quoted, imageName)}); err != nil {
+		return "", fmt.Errorf("failed to tag %s: %w", ref, err)
+	}
+	if _, err := client.Exec(ctx, "docker rmi "+quoted); err != nil {
+		PrintVerbose("Could not untag %s: %v", ref, err)
+	}
+	return digest, nil
+}
+
+// transferPrebuiltImage verifies ref in the local Docker daemon, then
+// transfers it to the server as imageName. The loaded image must have the
+// local id: the tar is checked end to end.
+func transferPrebuiltImage(ctx context.Context, client ssh.Transferer, ref, imageName, serverArch string) (string, error) {
+	output, err := exec.CommandContext(ctx, "docker", "image", "inspect", "--format", imageInspectFormat, ref).Output()
+	if err != nil {
+		return "", fmt.Errorf("image %s is not in the local Docker daemon (docker pull it first): %w", ref, err)
+	}
+	info, err := parseImageInfo(string(output))
+	if err != nil {
+		return "", err
+	}
+	digest, err := verifiedDigest(ref, info)
+	if err != nil {
+		return "", err
+	}
+	if serverArch != "" && normalizeArch(info.Architecture) != normalizeArch(serverArch) {
+		return "", fmt.Errorf("image %s is built for %s, the server runs %s", ref, info.Architecture, serverArch)
+	}
+
+	if err := exec.CommandContext(ctx, "docker", "tag", ref, imageName).Run(); err != nil {
+		return "", fmt.Errorf("failed to tag %s: %w", ref, err)
+	}
+	if err := transferImage(ctx, client, imageName); err != nil {
+		return "", err
+	}
+
+	result, err := client.Exec(ctx, fmt.Sprintf("docker image inspect --format '{{.Id}}' %s", imageName))
+	if err == nil {
+		err = result.Err()
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to inspect %s on the server: %w", imageName, err)
+	}
+	if id := strings.TrimSpace(result.Stdout); id != info.ID {
+		return "", fmt.Errorf("image %s loaded on the server as %s, want %s", imageName, id, info.ID)
+	}
+	return digest, nil
+}
+
+// writeImageDigest records the digest of a prebuilt image in the release
+// directory
+func writeImageDigest(ctx context.Context, client ssh.Executor, releasePath, digest string) error {
+	command := fmt.Sprintf("echo %s > %s/%s", security.ShellEscape(digest), releasePath, imageDigestFile)
+	if err := runCommandsStrict(ctx, client, []string{command}); err != nil {
+		return fmt.Errorf("failed to record image digest: %w", err)
+	}
+	return nil
+}
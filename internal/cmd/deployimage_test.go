@@ -0,0 +1,157 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/yoanbernabeu/frankendeploy/internal/ssh"
+)
+
+var (
+	testImageID     = "sha256:" + strings.Repeat("1", 64)
+	testImageDigest = "sha256:" + strings.Repeat("a", 64)
+)
+
+func TestVerifiedDigest(t *testing.T) {
+	info, err := parseImageInfo(testImageID + " arm64 ghcr.io/acme/app@" + testImageDigest + "\n")
+	if err != nil {
+		t.Fatalf("parseImageInfo() error = %v", err)
+	}
+	if info.ID != testImageID || info.Architecture != "arm64" || len(info.RepoDigests) != 1 {
+		t.Errorf("parseImageInfo() = %+v", info)
+	}
+
+	tests := []struct {
+		name    string
+		ref     string
+		info    *imageInfo
+		want    string
+		wantErr bool
+	}{
+		{"pinned", "ghcr.io/acme/app@" + testImageDigest, info, testImageDigest, false},
+		{"tag", "ghcr.io/acme/app:1.2", info, testImageDigest, false},
+		{"mismatch", "ghcr.io/acme/app@sha256:" + strings.Repeat("b", 64), info, "", true},
+		{"never pulled", "app:ci", &imageInfo{ID: testImageID}, testImageID, false},
+		{"other repository", "ghcr.io/acme/other:1.2", info, testImageID, false},
+		{"pinned in other repository", "ghcr.io/acme/other@" + testImageDigest, info, "", true},
+		{"docker hub", "nginx:1.27", &imageInfo{ID: testImageID, RepoDigests: []string{"nginx@" + testImageDigest}}, testImageDigest, false},
+		{"docker hub canonical", "docker.io/library/nginx", &imageInfo{ID: testImageID, RepoDigests: []string{"nginx@" + testImageDigest}}, testImageDigest, false},
+		{"registry with port", "localhost:5000/app:1", &imageInfo{ID: testImageID, RepoDigests: []string{"localhost:5000/app@" + testImageDigest}}, testImageDigest, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := verifiedDigest(tt.ref, tt.info)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("verifiedDigest() = %q, %v, want %q (error %v)", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+
+	if _, err := parseImageInfo("Error: No such image"); err == nil {
+		t.Error("parseImageInfo() should reject an unexpected output")
+	}
+}
+
+func TestPullPrebuiltImage(t *testing.T) {
+	ref := "ghcr.io/acme/app@" + testImageDigest
+	inspect := testImageID + " amd64 ghcr.io/acme/app@" + testImageDigest
+	mock := &ssh.MockExecutor{
+		ExecFunc: func(ctx context.Context, command string) (*ssh.ExecResult, error) {
+			if strings.HasPrefix(command, "docker image inspect") {
+				return &ssh.ExecResult{Stdout: inspect}, nil
+			}
+			return &ssh.ExecResult{}, nil
+		},
+	}
+
+	digest, err := deployPrebuiltImage(context.Background(), mock, ref, "myapp:v1", "x86_64", false)
+	if err != nil {
+		t.Fatalf("deployPrebuiltImage() error = %v", err)
+	}
+	if digest != testImageDigest {
+		t.Errorf("digest = %s, want %s", digest, testImageDigest)
+	}
+	want := []string{
+		"docker pull '" + ref + "'",
+		"docker tag '" + ref + "' myapp:v1",
+		"docker rmi '" + ref + "'",
+	}
+	for _, command := range want {
+		if !hasCommand(mock.Commands, command) {
+			t.Errorf("missing command %q in %v", command, mock.Commands)
+		}
+	}
+
+	// A digest mismatch never gets tagged
+	inspect = testImageID + " amd64 ghcr.io/acme/app@sha256:" + strings.Repeat("b", 64)
+	mock.Commands = nil
+	if _, err := deployPrebuiltImage(context.Background(), mock, ref, "myapp:v1", "x86_64", false); err == nil {
+		t.Fatal("a digest mismatch should fail the deploy")
+	}
+	if hasCommand(mock.Commands, "docker tag") {
+		t.Errorf("a mismatching image was tagged: %v", mock.Commands)
+	}
+
+	if _, err := deployPrebuiltImage(context.Background(), mock, "app;reboot", "myapp:v1", "", false); err == nil {
+		t.Error("an invalid reference should be rejected")
+	}
+}
+
+func TestTransferPrebuiltImage(t *testing.T) {
+	// A fake local docker: inspect, tag, and save writing the tar
+	bin := t.TempDir()
+	script := `#!/bin/sh
+case "$1 $2" in
+"image inspect") echo "` + testImageID + ` arm64 ghcr.io/acme/app@` + testImageDigest + `" ;;
+"save -o") touch "$3" ;;
+esac
+`
+	if err := os.WriteFile(filepath.Join(bin, "docker"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	loadedID := testImageID
+	mock := &ssh.MockExecutor{
+		ExecFunc: func(ctx context.Context, command string) (*ssh.ExecResult, error) {
+			if strings.HasPrefix(command, "docker image inspect") {
+				return &ssh.ExecResult{Stdout: loadedID + "\n"}, nil
+			}
+			return &ssh.ExecResult{}, nil
+		},
+	}
+	ref := "ghcr.io/acme/app@" + testImageDigest
+
+	digest, err := deployPrebuiltImage(context.Background(), mock, ref, "myapp:v1", "aarch64", true)
+	if err != nil || digest != testImageDigest {
+		t.Fatalf("deployPrebuiltImage() = %q, %v", digest, err)
+	}
+	if len(mock.Uploads) != 1 || hasCommand(mock.Commands, "docker pull") {
+		t.Errorf("the image should be uploaded, not pulled: %v %v", mock.Uploads, mock.Commands)
+	}
+
+	// The loaded image must be the local one
+	loadedID = "sha256:" + strings.Repeat("2", 64)
+	if _, err := deployPrebuiltImage(context.Background(), mock, ref, "myapp:v1", "aarch64", true); err == nil {
+		t.Error("an id mismatch after the load should fail the deploy")
+	}
+
+	// The image must run on the server
+	if _, err := deployPrebuiltImage(context.Background(), mock, ref, "myapp:v1", "x86_64", true); err == nil || !strings.Contains(err.Error(), "arm64") {
+		t.Errorf("an architecture mismatch should be reported, got %v", err)
+	}
+}
+
+func TestWriteImageDigest(t *testing.T) {
+	mock := &ssh.MockExecutor{}
+	if err := writeImageDigest(context.Background(), mock, "/opt/frankendeploy/apps/myapp/releases/v1", testImageDigest); err != nil {
+		t.Fatalf("writeImageDigest() error = %v", err)
+	}
+	want := "echo '" + testImageDigest + "' > /opt/frankendeploy/apps/myapp/releases/v1/image-digest"
+	if len(mock.Commands) != 1 || mock.Commands[0] != want {
+		t.Errorf("commands = %v, want [%s]", mock.Commands, want)
+	}
+}
@@ -0,0 +1,227 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/yoanbernabeu/frankendeploy/internal/deploy"
+)
+
+var serverDiskCmd = &cobra.Command{
+	Use:   "disk <name>",
+	Short: "Show where the disk space of a server goes",
+	Long: `Breaks the disk usage of a server down:
+- Docker usage: images, containers, volumes and build cache, with the
+  space 'docker system prune' could reclaim
+- Per application: image size per tag, release directories, database
+  backups (shared/backups), database volume and Caddy access logs
+
+Image sizes include the layers shared with the app's other images. Backups
+and volumes are measured through passwordless sudo: '?' when unavailable.
+
+Everything is measured with a single SSH command. Run 'server gc' to free
+what deploys leave behind.
+
+Example:
+  frankendeploy server disk production
+  frankendeploy server disk production --json`,
+	Args: cobra.ExactArgs(1),
+	RunE: runServerDisk,
+}
+
+var serverGCCmd = &cobra.Command{
+	Use:   "gc <name>",
+	Short: "Free the disk space deploys leave behind",
+	Long: `Removes what deploys leave behind on a server:
+- Images of releases no longer kept (keep_releases)
+- Dangling images, and build cache unused for 24 hours
+- Stopped -new, -rollback and -old containers of interrupted deploys,
+  rollbacks and env reloads
+- Image tars left in /tmp by interrupted transfers, once older than an hour
+
+Nothing is ever forced: running containers and the images they use are
+kept, and an app's images are kept when its releases cannot be listed.
+Running temporary containers are reported only: a deploy may be in
+progress.
+
+Example:
+  frankendeploy server gc production --dry-run
+  frankendeploy server gc production`,
+	Args: cobra.ExactArgs(1),
+	RunE: runServerGC,
+}
+
+var (
+	diskJSON bool
+	gcDryRun bool
+	gcJSON   bool
+)
+
+func init() {
+	serverCmd.AddCommand(serverDiskCmd)
+	serverCmd.AddCommand(serverGCCmd)
+
+	serverDiskCmd.Flags().BoolVar(&diskJSON, "json", false, "Output the breakdown as JSON (sizes in bytes, -1 when unknown)")
+	serverGCCmd.Flags().BoolVar(&gcDryRun, "dry-run", false, "List what would be removed without removing anything")
+	serverGCCmd.Flags().BoolVar(&gcJSON, "json", false, "Output the report as JSON")
+}
+
+func runServerDisk(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+
+	conn, err := ConnectToServerNoProject(args[0])
+	if err != nil {
+		return err
+	}
+	defer conn.Client.Close()
+
+	probe, err := deploy.DiskUsageCommand()
+	if err != nil {
+		return err
+	}
+	result, err := conn.Client.Exec(ctx, probe)
+	if err != nil {
+		return fmt.Errorf("failed to measure disk usage: %w", err)
+	}
+	usage := deploy.ParseDiskUsage(result.Stdout)
+
+	if diskJSON {
+		out, err := json.MarshalIndent(usage, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(out))
+		return nil
+	}
+
+	printDiskUsage(usage)
+	return nil
+}
+
+// printDiskUsage prints the breakdown of server disk
+func printDiskUsage(usage *deploy.DiskUsage) {
+	if usage.DiskTotal > 0 {
+		fmt.Printf("Disk: %s/%s used (%d%%)\n", formatSize(usage.DiskUsed), formatSize(usage.DiskTotal), usage.DiskUsed*100/usage.DiskTotal)
+	}
+
+	if len(usage.Docker) > 0 {
+		fmt.Println()
+		fmt.Println("Docker:")
+		for _, docker := range usage.Docker {
+			line := fmt.Sprintf("  %-14s %s", docker.Type, formatSize(docker.Size))
+			if docker.Reclaimable > 0 {
+				line += fmt.Sprintf(" (%s reclaimable)", formatSize(docker.Reclaimable))
+			}
+			fmt.Println(line)
+		}
+	}
+
+	apps := append([]deploy.AppUsage(nil), usage.Apps...)
+	sort.SliceStable(apps, func(i, j int) bool { return apps[i].Total() > apps[j].Total() })
+	for _, app := range apps {
+		fmt.Println()
+		fmt.Printf("%s:\n", app.Name)
+		if len(app.Images) == 0 {
+			fmt.Println("  Images:     none")
+		} else {
+			fmt.Println("  Images:")
+			for _, image := range app.Images {
+				fmt.Printf("    %-24s %s\n", image.Tag, formatSize(image.Size))
+			}
+		}
+		var releases int64
+		for _, release := range app.Releases {
+			releases += max(release.Size, 0)
+		}
+		fmt.Printf("  Releases:   %d, %s\n", len(app.Releases), formatSize(releases))
+		fmt.Printf("  Backups:    %s\n", formatSize(app.Backups))
+		if app.DBVolume != 0 {
+			fmt.Printf("  DB volume:  %s\n", formatSize(app.DBVolume))
+		}
+		fmt.Printf("  Caddy logs: %s\n", formatSize(app.CaddyLogs))
+	}
+}
+
+func runServerGC(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+
+	conn, err := ConnectToServerNoProject(args[0])
+	if err != nil {
+		return err
+	}
+	defer conn.Client.Close()
+
+	if !gcJSON {
+		PrintInfo("Collecting garbage on %s...", args[0])
+	}
+	report, err := deploy.CollectGarbage(ctx, conn.Client, gcDryRun)
+	if err != nil {
+		return err
+	}
+
+	if gcJSON {
+		out, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(out))
+		return nil
+	}
+
+	printGCReport(report, gcDryRun)
+	return nil
+}
+
+// printGCReport prints what server gc removed
+func printGCReport(report *deploy.GCReport, dryRun bool) {
+	verb := "Removed"
+	if dryRun {
+		verb = "Would remove"
+	}
+
+	if len(report.Containers) > 0 {
+		PrintSuccess("%s containers: %s", verb, strings.Join(report.Containers, ", "))
+	}
+	for _, name := range report.RunningContainers {
+		PrintWarning("Kept running container %s: a deploy may be in progress (docker rm -f %s once it is over)", name, name)
+	}
+
+	apps := make([]string, 0, len(report.Images))
+	for app := range report.Images {
+		apps = append(apps, app)
+	}
+	sort.Strings(apps)
+	for _, app := range apps {
+		PrintSuccess("%s %s images: %s", verb, app, strings.Join(report.Images[app], ", "))
+	}
+
+	if report.DanglingImages != "" {
+		PrintSuccess("%s dangling images: %s", verb, report.DanglingImages)
+	}
+	if report.BuildCache != "" {
+		PrintSuccess("%s build cache: %s", verb, report.BuildCache)
+	}
+	if len(report.Tars) > 0 {
+		PrintSuccess("%s stale tars: %s", verb, strings.Join(report.Tars, ", "))
+	}
+	for _, warning := range report.Warnings {
+		PrintWarning("%s", warning)
+	}
+}
+
+// formatSize prints a size in bytes, "?" when unknown
+func formatSize(size int64) string {
+	switch {
+	case size < 0:
+		return "?"
+	case size >= 1<<30:
+		return fmt.Sprintf("%.1fG", float64(size)/(1<<30))
+	case size >= 1<<20:
+		return fmt.Sprintf("%dM", size>>20)
+	default:
+		return fmt.Sprintf("%dK", size>>10)
+	}
+}
@@ -0,0 +1,146 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/yoanbernabeu/frankendeploy/internal/caddy"
+	"github.com/yoanbernabeu/frankendeploy/internal/ssh"
+)
+
+var domainsCmd = &cobra.Command{
+	Use:   "domains",
+	Short: "Inspect the domains served by a server",
+	Long:  `Commands to inspect the domains Caddy holds certificates for.`,
+}
+
+var domainsListCmd = &cobra.Command{
+	Use:   "list <server>",
+	Short: "List the domains with an issued certificate",
+	Long: `Lists every domain Caddy obtained a certificate for, with the app
+serving it, the issuer and the expiry date.
+
+Domains of an app with on-demand TLS (deploy.tls.mode: on_demand) are
+the customer domains approved by its ask endpoint.
+
+Example:
+  frankendeploy domains list production
+  frankendeploy domains list production --on-demand`,
+	Args: cobra.ExactArgs(1),
+	RunE: runDomainsList,
+}
+
+var domainsOnDemandOnly bool
+
+func init() {
+	rootCmd.AddCommand(domainsCmd)
+	domainsCmd.AddCommand(domainsListCmd)
+
+	domainsListCmd.Flags().BoolVar(&domainsOnDemandOnly, "on-demand", false, "Only list domains issued on demand")
+}
+
+func runDomainsList(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	serverName := args[0]
+
+	conn, err := ConnectToServerNoProject(serverName)
+	if err != nil {
+		return err
+	}
+	defer conn.Client.Close()
+
+	live, err := readLiveCaddyConfig(ctx, conn.Client, caddyAdminFor(conn.Client, conn.Server))
+	if err != nil {
+		return err
+	}
+	sites, err := caddy.ParseSites(live)
+	if err != nil {
+		return err
+	}
+	hostApps := make(map[string]string)
+	for _, site := range sites {
+		for _, host := range site.Hosts {
+			hostApps[host] = site.App
+		}
+	}
+
+	statusResult, err := conn.Client.Exec(ctx, caddy.OnDemandStatusCommand())
+	if err != nil {
+		return fmt.Errorf("failed to read on-demand TLS status: %w", err)
+	}
+	_, onDemandApps := caddy.ParseOnDemandStatus(statusResult.Stdout)
+
+	dumpCmd := caddy.CertDumpCommand()
+	PrintVerboseCommand(dumpCmd)
+	result, err := conn.Client.Exec(ctx, dumpCmd)
+	if err != nil {
+		return fmt.Errorf("failed to read certificates: %w", err)
+	}
+	if err := result.Err(); err != nil {
+		return fmt.Errorf("failed to read certificates (is the caddy container running?): %w", err)
+	}
+
+	var listed int
+	now := time.Now()
+	for _, issued := range caddy.IssuedCertificates(caddy.ParseCertDump(result.Stdout)) {
+		app, onDemand := domainApp(issued.Domain, hostApps, onDemandApps)
+		if domainsOnDemandOnly && !onDemand {
+			continue
+		}
+		if listed == 0 {
+			fmt.Printf("Domains with a certificate on %s:\n\n", serverName)
+		}
+		listed++
+		fmt.Printf("  %s\n", issued.Domain)
+		fmt.Printf("    App:      %s\n", app)
+		fmt.Printf("    Issuer:   %s (%s)\n", issued.Issuer, issued.Source)
+		fmt.Printf("    Expires:  %s\n", certExpiry(issued.NotAfter, now))
+		fmt.Println()
+	}
+
+	if listed == 0 {
+		if domainsOnDemandOnly {
+			PrintInfo("No certificate issued on demand on %s", serverName)
+		} else {
+			PrintInfo("No certificate issued on %s", serverName)
+		}
+		return nil
+	}
+	fmt.Printf("%d domain(s)\n", listed)
+	return nil
+}
+
+// domainApp returns the app serving a domain and whether its certificate
+// was issued on demand: domains that are no site address belong to the
+// on-demand app, if the server has one.
+func domainApp(domain string, hostApps map[string]string, onDemandApps []string) (string, bool) {
+	if app, ok := hostApps[domain]; ok {
+		return app, false
+	}
+	if len(onDemandApps) > 0 {
+		return onDemandApps[0] + " (on demand)", true
+	}
+	return "(not served)", false
+}
+
+// checkOnDemandTLS verifies that the server can serve an on-demand app: the
+// main Caddyfile must define the ask endpoint, and no other app may already
+// answer for arbitrary domains.
+func checkOnDemandTLS(ctx context.Context, client ssh.Executor, appName string) error {
+	result, err := client.Exec(ctx, caddy.OnDemandStatusCommand())
+	if err != nil {
+		return fmt.Errorf("could not check on-demand TLS support: %w", err)
+	}
+	global, apps := caddy.ParseOnDemandStatus(result.Stdout)
+	if !global {
+		return fmt.Errorf("the Caddy config of the server predates on-demand TLS — run 'frankendeploy server setup' again to update it")
+	}
+	for _, app := range apps {
+		if app != appName {
+			return fmt.Errorf("on-demand TLS is already used by %s on this server: only one app can answer for arbitrary domains", app)
+		}
+	}
+	return nil
+}
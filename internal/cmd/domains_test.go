@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/yoanbernabeu/frankendeploy/internal/config"
+	"github.com/yoanbernabeu/frankendeploy/internal/ssh"
+)
+
+func TestCheckOnDemandTLS(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  string
+		wantErr string
+	}{
+		{"first on-demand app", "global\n", ""},
+		{"redeploy", "global\n/opt/frankendeploy/caddy/apps/saas.caddy\n", ""},
+		{"setup too old", "", "server setup"},
+		{"another app", "global\n/opt/frankendeploy/caddy/apps/other.caddy\n", "already used by other"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := &ssh.MockExecutor{
+				ExecFunc: func(ctx context.Context, command string) (*ssh.ExecResult, error) {
+					return &ssh.ExecResult{Stdout: tt.status}, nil
+				},
+			}
+			err := checkOnDemandTLS(context.Background(), mock, "saas")
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got: %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestUpdateCaddyConfig_OnDemandChecksServerFirst(t *testing.T) {
+	mock := &ssh.MockExecutor{
+		ExecFunc: func(ctx context.Context, command string) (*ssh.ExecResult, error) {
+			if strings.Contains(command, "docker inspect caddy") {
+				return &ssh.ExecResult{Stdout: "running\n"}, nil
+			}
+			if strings.Contains(command, "on_demand_tls") {
+				return &ssh.ExecResult{Stdout: "global\n/opt/frankendeploy/caddy/apps/other.caddy\n"}, nil
+			}
+			return &ssh.ExecResult{}, nil
+		},
+	}
+	cfg := &config.ProjectConfig{
+		Name: "saas",
+		Deploy: config.DeployConfig{
+			Domain: "saas.example.com",
+			TLS:    config.TLSConfig{Mode: config.TLSModeOnDemand, Ask: "/tls/allowed"},
+		},
+	}
+	if err := updateCaddyConfig(context.Background(), mock, nil, cfg); err == nil {
+		t.Fatal("expected an error when another app already uses on-demand TLS")
+	}
+	if strings.Contains(strings.Join(mock.Commands, "\n"), "saas.caddy") {
+		t.Error("no config should be written when the check fails")
+	}
+}
+
+func TestDomainApp(t *testing.T) {
+	hostApps := map[string]string{"saas.example.com": "saas"}
+	if app, onDemand := domainApp("saas.example.com", hostApps, []string{"saas"}); app != "saas" || onDemand {
+		t.Errorf("site domain: got %q, %v", app, onDemand)
+	}
+	if app, onDemand := domainApp("shop.customer.com", hostApps, []string{"saas"}); app != "saas (on demand)" || !onDemand {
+		t.Errorf("customer domain: got %q, %v", app, onDemand)
+	}
+	if app, onDemand := domainApp("old.example.com", hostApps, nil); app != "(not served)" || onDemand {
+		t.Errorf("leftover certificate: got %q, %v", app, onDemand)
+	}
+}
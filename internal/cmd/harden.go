@@ -0,0 +1,125 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/yoanbernabeu/frankendeploy/internal/config"
+	"github.com/yoanbernabeu/frankendeploy/internal/constants"
+	"github.com/yoanbernabeu/frankendeploy/internal/provision"
+	"github.com/yoanbernabeu/frankendeploy/internal/security"
+	"github.com/yoanbernabeu/frankendeploy/internal/ssh"
+)
+
+// loginCheck opens a new SSH connection as user and checks it can run
+// sudo and docker. The current connection stays open meanwhile.
+type loginCheck func(ctx context.Context, user string) error
+
+// resolveDeployUser returns the user the hardening step deploys as: the
+// --deploy-user flag, else the default user of the global config
+func resolveDeployUser(flag string, globalCfg *config.GlobalConfig) (string, error) {
+	user := flag
+	if user == "" && globalCfg != nil {
+		user = globalCfg.DefaultUser
+	}
+	if user == "" {
+		user = "deploy"
+	}
+	if err := security.ValidateUnixUser(user); err != nil {
+		return "", fmt.Errorf("invalid deploy user: %w", err)
+	}
+	if user == "root" {
+		return "", fmt.Errorf("the deploy user cannot be root: root login is disabled by --harden")
+	}
+	return user, nil
+}
+
+// hardenServer moves deployments to a dedicated user and locks sshd down to
+// key-only, non-root logins, without ever risking a lockout:
+//  1. the deploy user is created (docker group, the SSH user's keys,
+//     passwordless sudo) and takes over /opt/frankendeploy
+//  2. unattended security upgrades are enabled
+//  3. a second connection as the deploy user must work before sshd is
+//     touched
+//  4. the sshd drop-in is validated with sshd -t, then sshd reloads
+//  5. a new connection as the deploy user must still work, else the drop-in
+//     is removed and sshd reloaded again
+//
+// The current connection stays open throughout: a reload never closes
+// established sessions.
+func hardenServer(ctx context.Context, client ssh.Executor, p provision.Provisioner, loginUser, deployUser string, check loginCheck) error {
+	if deployUser != loginUser {
+		PrintInfo("Creating deploy user %s...", deployUser)
+		keysCmd, err := provision.AuthorizedKeysCommand(deployUser)
+		if err != nil {
+			return err
+		}
+		sudoersCmd, err := provision.SudoersCommand(deployUser)
+		if err != nil {
+			return err
+		}
+		commands := append(p.CreateUserCommands(deployUser), keysCmd, sudoersCmd, takeOverCommand(loginUser, deployUser))
+		if err := runCommandsStrict(ctx, client, commands); err != nil {
+			return fmt.Errorf("failed to create deploy user %s: %w", deployUser, err)
+		}
+	}
+
+	PrintInfo("Enabling unattended security upgrades...")
+	if err := runCommandsStrict(ctx, client, p.AutoUpdatesCommands()); err != nil {
+		return fmt.Errorf("failed to enable unattended upgrades: %w", err)
+	}
+
+	if err := check(ctx, deployUser); err != nil {
+		return fmt.Errorf("cannot log in as %s, sshd left unchanged: %w", deployUser, err)
+	}
+
+	PrintInfo("Disabling password and root login...")
+	if err := runCommandsStrict(ctx, client, provision.SSHDHardeningCommands()); err != nil {
+		return fmt.Errorf("sshd rejected the hardened config, sshd left unchanged: %w", err)
+	}
+	if err := runCommandsStrict(ctx, client, []string{p.ReloadSSHCommand()}); err != nil {
+		return revertSSHD(ctx, client, p, fmt.Errorf("failed to reload sshd: %w", err))
+	}
+	if err := check(ctx, deployUser); err != nil {
+		return revertSSHD(ctx, client, p, fmt.Errorf("cannot log in as %s after hardening: %w", deployUser, err))
+	}
+	return nil
+}
+
+// revertSSHD removes the hardening drop-in through the still open
+// connection and reloads sshd
+func revertSSHD(ctx context.Context, client ssh.Executor, p provision.Provisioner, cause error) error {
+	if err := runCommandsStrict(ctx, client, []string{provision.SSHDRevertCommand(), p.ReloadSSHCommand()}); err != nil {
+		return fmt.Errorf("%w; reverting sshd failed too, keep this session open and remove %s by hand: %v", cause, provision.SSHDDropIn, err)
+	}
+	return fmt.Errorf("%w (sshd hardening reverted)", cause)
+}
+
+// takeOverCommand hands what the SSH user owns under /opt/frankendeploy over
+// to the deploy user. Shared directories keep the container user: their
+// owner is fixed on each deploy.
+func takeOverCommand(loginUser, deployUser string) string {
+	return fmt.Sprintf("sudo find %[1]s -path '%[2]s/*/shared' -prune -o -user %[3]s -exec chown -h %[4]s:%[4]s {} +",
+		constants.BasePath, constants.AppsDir, loginUser, deployUser)
+}
+
+// sshLoginCheck returns the loginCheck of a configured server: a fresh
+// connection with the same host, port and key, as another user
+func sshLoginCheck(server *config.ServerConfig, globalCfg *config.GlobalConfig) loginCheck {
+	return func(ctx context.Context, user string) error {
+		client := ssh.NewClient(server.Host, user, server.Port, server.KeyPath, sshOptsForServer(server, globalCfg, nil)...)
+		if err := client.Connect(); err != nil {
+			return err
+		}
+		defer client.Close()
+
+		result, err := client.Exec(ctx, "sudo -n true && docker info --format '{{.ServerVersion}}'")
+		if err != nil {
+			return err
+		}
+		if err := result.Err(); err != nil {
+			return fmt.Errorf("sudo or docker unavailable: %w", err)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,167 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/yoanbernabeu/frankendeploy/internal/config"
+	"github.com/yoanbernabeu/frankendeploy/internal/provision"
+	"github.com/yoanbernabeu/frankendeploy/internal/ssh"
+)
+
+// hardenRun records the commands and login checks of a hardenServer run,
+// in order
+type hardenRun struct {
+	steps []string
+	// failOn makes the first command containing it exit 1
+	failOn string
+	// checks are the results of the successive login checks
+	checks []error
+}
+
+func (h *hardenRun) executor() *ssh.MockExecutor {
+	return &ssh.MockExecutor{
+		ExecFunc: func(ctx context.Context, command string) (*ssh.ExecResult, error) {
+			h.steps = append(h.steps, command)
+			if h.failOn != "" && strings.Contains(command, h.failOn) {
+				return &ssh.ExecResult{ExitCode: 1, Stderr: "rejected"}, nil
+			}
+			return &ssh.ExecResult{}, nil
+		},
+	}
+}
+
+func (h *hardenRun) check(ctx context.Context, user string) error {
+	h.steps = append(h.steps, "CHECK "+user)
+	if len(h.checks) == 0 {
+		return nil
+	}
+	err := h.checks[0]
+	h.checks = h.checks[1:]
+	return err
+}
+
+func (h *hardenRun) index(t *testing.T, substr string) int {
+	t.Helper()
+	for i, step := range h.steps {
+		if strings.Contains(step, substr) {
+			return i
+		}
+	}
+	return -1
+}
+
+func TestHardenServer_Success(t *testing.T) {
+	run := &hardenRun{}
+	err := hardenServer(context.Background(), run.executor(), provision.Debian{}, "root", "deploy", run.check)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	order := []string{
+		"useradd -m -s /bin/bash deploy",
+		"usermod -aG docker deploy",
+		".ssh/authorized_keys",
+		"NOPASSWD:ALL",
+		"-user root -exec chown -h deploy:deploy",
+		"unattended-upgrades",
+		"CHECK deploy",
+		provision.SSHDDropIn,
+		"sshd -t",
+		"systemctl reload ssh",
+	}
+	last := -1
+	for _, want := range order {
+		i := run.index(t, want)
+		if i < 0 {
+			t.Fatalf("missing %q in:\n%s", want, strings.Join(run.steps, "\n"))
+		}
+		if i < last {
+			t.Errorf("%q runs too early in:\n%s", want, strings.Join(run.steps, "\n"))
+		}
+		last = i
+	}
+	if got := run.steps[len(run.steps)-1]; got != "CHECK deploy" {
+		t.Errorf("a new login must be checked after the reload, last step was %q", got)
+	}
+}
+
+func TestHardenServer_LoginFailsBeforeSSHD(t *testing.T) {
+	run := &hardenRun{checks: []error{errors.New("permission denied (publickey)")}}
+	err := hardenServer(context.Background(), run.executor(), provision.Debian{}, "ubuntu", "deploy", run.check)
+	if err == nil || !strings.Contains(err.Error(), "sshd left unchanged") {
+		t.Fatalf("expected an sshd left unchanged error, got %v", err)
+	}
+	if run.index(t, "sshd") >= 0 {
+		t.Errorf("sshd must not be touched when the deploy user cannot log in:\n%s", strings.Join(run.steps, "\n"))
+	}
+}
+
+func TestHardenServer_InvalidSSHDConfig(t *testing.T) {
+	run := &hardenRun{failOn: "sshd -t"}
+	err := hardenServer(context.Background(), run.executor(), provision.Debian{}, "ubuntu", "deploy", run.check)
+	if err == nil || !strings.Contains(err.Error(), "rejected the hardened config") {
+		t.Fatalf("expected an sshd -t error, got %v", err)
+	}
+	if run.index(t, "reload") >= 0 {
+		t.Errorf("sshd must not reload an invalid config:\n%s", strings.Join(run.steps, "\n"))
+	}
+}
+
+func TestHardenServer_RevertsWhenLoginFailsAfterReload(t *testing.T) {
+	run := &hardenRun{checks: []error{nil, errors.New("connection refused")}}
+	err := hardenServer(context.Background(), run.executor(), provision.RHEL{}, "rocky", "deploy", run.check)
+	if err == nil || !strings.Contains(err.Error(), "hardening reverted") {
+		t.Fatalf("expected a reverted error, got %v", err)
+	}
+
+	tail := strings.Join(run.steps[len(run.steps)-2:], "\n")
+	if !strings.Contains(tail, "rm -f "+provision.SSHDDropIn) || !strings.HasSuffix(tail, "sudo systemctl reload sshd") {
+		t.Errorf("expected the drop-in to be removed and sshd reloaded, got:\n%s", tail)
+	}
+}
+
+func TestHardenServer_SameUserKeepsAccount(t *testing.T) {
+	run := &hardenRun{}
+	if err := hardenServer(context.Background(), run.executor(), provision.Alpine{}, "deploy", "deploy", run.check); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, unwanted := range []string{"adduser", "authorized_keys", "sudoers", "chown"} {
+		if i := run.index(t, unwanted); i >= 0 {
+			t.Errorf("the SSH user already deploys, %q not expected: %s", unwanted, run.steps[i])
+		}
+	}
+	if run.index(t, "sshd -t") < 0 {
+		t.Error("sshd should still be hardened")
+	}
+}
+
+func TestResolveDeployUser(t *testing.T) {
+	global := &config.GlobalConfig{DefaultUser: "frank"}
+	tests := []struct {
+		flag    string
+		global  *config.GlobalConfig
+		want    string
+		wantErr string
+	}{
+		{"ops", global, "ops", ""},
+		{"", global, "frank", ""},
+		{"", &config.GlobalConfig{}, "deploy", ""},
+		{"root", global, "", "cannot be root"},
+		{"bad user", global, "", "invalid deploy user"},
+	}
+	for _, tt := range tests {
+		got, err := resolveDeployUser(tt.flag, tt.global)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("resolveDeployUser(%q): expected error containing %q, got %v", tt.flag, tt.wantErr, err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("resolveDeployUser(%q) = %q, %v; want %q", tt.flag, got, err, tt.want)
+		}
+	}
+}
@@ -8,39 +8,80 @@ import (
 	"github.com/yoanbernabeu/frankendeploy/internal/ssh"
 )
 
-func TestBuildPlatformForServer(t *testing.T) {
+func TestPlatformForArch(t *testing.T) {
 	tests := []struct {
-		name     string
-		stdout   string
-		exitCode int
-		execErr  error
-		want     string
+		name string
+		arch string
+		want string
 	}{
-		{name: "x86_64 server", stdout: "x86_64\n", want: "linux/amd64"},
-		{name: "aarch64 server", stdout: "aarch64\n", want: "linux/arm64"},
-		{name: "arm64 server", stdout: "arm64\n", want: "linux/arm64"},
-		{name: "amd64 server", stdout: "amd64\n", want: "linux/amd64"},
-		{name: "exec error falls back to amd64", execErr: errors.New("connection lost"), want: "linux/amd64"},
-		{name: "non-zero exit falls back to amd64", stdout: "", exitCode: 127, want: "linux/amd64"},
-		{name: "unknown arch falls back to amd64", stdout: "riscv64\n", want: "linux/amd64"},
+		{name: "x86_64 server", arch: "x86_64", want: "linux/amd64"},
+		{name: "aarch64 server", arch: "aarch64", want: "linux/arm64"},
+		{name: "arm64 server", arch: "arm64", want: "linux/arm64"},
+		{name: "amd64 server", arch: "amd64", want: "linux/amd64"},
+		{name: "unknown arch falls back to amd64", arch: "", want: "linux/amd64"},
+		{name: "unsupported arch falls back to amd64", arch: "riscv64", want: "linux/amd64"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := platformForArch(tt.arch); got != tt.want {
+				t.Errorf("platformForArch(%q) = %q, want %q", tt.arch, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProbeDeployTarget(t *testing.T) {
+	tests := []struct {
+		name string
+		exec func(command string) (*ssh.ExecResult, error)
+		want deployProbes
+	}{
+		{
+			name: "existing app",
+			exec: func(command string) (*ssh.ExecResult, error) {
+				switch {
+				case command == "uname -m":
+					return &ssh.ExecResult{Stdout: "aarch64\n"}, nil
+				case command == "docker ps -q -f name=^my-app$":
+					return &ssh.ExecResult{Stdout: "3f2a1b\n"}, nil
+				default:
+					return &ssh.ExecResult{Stdout: "yes\n"}, nil
+				}
+			},
+			want: deployProbes{Arch: "aarch64", OldContainerExists: true, CaddyConfigExists: true},
+		},
+		{
+			name: "first deploy, uname failing",
+			exec: func(command string) (*ssh.ExecResult, error) {
+				if command == "uname -m" {
+					return &ssh.ExecResult{ExitCode: 127}, nil
+				}
+				return &ssh.ExecResult{ExitCode: 1}, nil
+			},
+			want: deployProbes{},
+		},
+		{
+			name: "connection lost",
+			exec: func(command string) (*ssh.ExecResult, error) {
+				return nil, errors.New("connection lost")
+			},
+			want: deployProbes{},
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			mock := &ssh.MockExecutor{
 				ExecFunc: func(ctx context.Context, command string) (*ssh.ExecResult, error) {
-					if tt.execErr != nil {
-						return nil, tt.execErr
-					}
-					return &ssh.ExecResult{Stdout: tt.stdout, ExitCode: tt.exitCode}, nil
+					return tt.exec(command)
 				},
 			}
-			got := buildPlatformForServer(context.Background(), mock)
-			if got != tt.want {
-				t.Errorf("buildPlatformForServer() = %q, want %q", got, tt.want)
+			if got := probeDeployTarget(context.Background(), mock, "my-app"); got != tt.want {
+				t.Errorf("probeDeployTarget() = %+v, want %+v", got, tt.want)
 			}
-			if len(mock.Commands) != 1 || mock.Commands[0] != "uname -m" {
-				t.Errorf("expected a single 'uname -m' command, got %v", mock.Commands)
+			if len(mock.Batches) != 1 || len(mock.Batches[0]) != 3 {
+				t.Errorf("expected the 3 probes in a single batch, got %v", mock.Batches)
 			}
 		})
 	}
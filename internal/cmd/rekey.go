@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/yoanbernabeu/frankendeploy/internal/config"
+	"github.com/yoanbernabeu/frankendeploy/internal/security"
+	"github.com/yoanbernabeu/frankendeploy/internal/ssh"
+)
+
+var serverRekeyCmd = &cobra.Command{
+	Use:   "rekey <name>",
+	Short: "Pin the current host key of a server after a key rotation",
+	Long: `Connects to the server, shows the host key it presents and pins it in
+the server config in place of the previous one.
+
+Run it after a planned host key rotation or a server reinstall: until
+then, connections fail because the key no longer matches the pin. Check
+the new fingerprint on the server first (ssh-keygen -lf
+/etc/ssh/ssh_host_ed25519_key.pub).
+
+Non-interactive sessions (CI/CD, --yes) must give the expected fingerprint
+with --fingerprint: any other key is refused.
+
+Example:
+  frankendeploy server rekey production
+  frankendeploy server rekey production --fingerprint SHA256:uNiVztksCsDhcc0u9e8BujQXVUpKZIDTMczCvj3tD2s`,
+	Args: cobra.ExactArgs(1),
+	RunE: runServerRekey,
+}
+
+var rekeyFingerprint string
+
+func init() {
+	serverCmd.AddCommand(serverRekeyCmd)
+
+	serverRekeyCmd.Flags().StringVar(&rekeyFingerprint, "fingerprint", "", "Expected SHA256 fingerprint of the new host key")
+}
+
+// rekeyHostKeyCheck accepts the host key matching fingerprint, or, without
+// one, the key confirmed interactively
+func rekeyHostKeyCheck(fingerprint string, pins []string, interactive bool, confirm ssh.HostKeyPrompt) ssh.HostKeyCheck {
+	return func(host, keyType, presented string) error {
+		if fingerprint != "" {
+			if presented != fingerprint {
+				return fmt.Errorf("host key of %s is %s, not the expected %s", host, presented, fingerprint)
+			}
+			return nil
+		}
+		if !interactive {
+			return fmt.Errorf("host key of %s is %s %s: run interactively to confirm it, or give it with --fingerprint", host, keyType, presented)
+		}
+		if len(pins) > 0 {
+			PrintInfo("Pinned host key(s): %s", strings.Join(pins, ", "))
+		}
+		if !confirm(host, keyType, presented) {
+			return fmt.Errorf("host key of %s not confirmed", host)
+		}
+		return nil
+	}
+}
+
+func runServerRekey(cmd *cobra.Command, args []string) error {
+	name := args[0]
+	if err := security.ValidateServerName(name); err != nil {
+		return fmt.Errorf("invalid server name: %w", err)
+	}
+	if rekeyFingerprint != "" {
+		if fields := strings.Fields(rekeyFingerprint); len(fields) == 2 {
+			// A pin ("ssh-ed25519 SHA256:...") is accepted too
+			rekeyFingerprint = fields[1]
+		}
+		if !strings.HasPrefix(rekeyFingerprint, "SHA256:") {
+			return fmt.Errorf("invalid --fingerprint %q: expected SHA256:<base64>", rekeyFingerprint)
+		}
+	}
+
+	globalCfg, err := config.LoadGlobalConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load global config: %w", err)
+	}
+	serverCfg, err := globalCfg.GetServer(name)
+	if err != nil {
+		return err
+	}
+
+	check := rekeyHostKeyCheck(rekeyFingerprint, serverCfg.HostKeys, IsInteractive(), ssh.DefaultHostKeyPrompt)
+	client := ssh.NewClient(serverCfg.Host, serverCfg.User, serverCfg.Port, serverCfg.KeyPath,
+		sshOptsForServer(serverCfg, globalCfg, []ssh.ClientOption{ssh.WithHostKeyCheck(check)})...)
+	if err := client.Connect(); err != nil {
+		return fmt.Errorf("failed to connect: %w", err)
+	}
+	client.Close()
+
+	pin := client.HostKeyPin()
+	if len(serverCfg.HostKeys) == 1 && serverCfg.HostKeys[0] == pin {
+		PrintInfo("Host key of '%s' unchanged: %s", name, pin)
+		return nil
+	}
+
+	serverCfg.HostKeys = []string{pin}
+	globalCfg.Servers[name] = *serverCfg
+	if err := config.SaveGlobalConfig(globalCfg); err != nil {
+		return fmt.Errorf("failed to save config: %w", err)
+	}
+	PrintSuccess("Pinned host key of '%s': %s", name, pin)
+	return nil
+}
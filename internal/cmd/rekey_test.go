@@ -0,0 +1,36 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRekeyHostKeyCheck(t *testing.T) {
+	const presented = "SHA256:uNiVztksCsDhcc0u9e8BujQXVUpKZIDTMczCvj3tD2s"
+	prompted := false
+	accept := func(host, keyType, fingerprint string) bool {
+		prompted = true
+		return true
+	}
+	refuse := func(host, keyType, fingerprint string) bool { return false }
+
+	// The expected fingerprint is enough, without prompting
+	if err := rekeyHostKeyCheck(presented, nil, true, accept)("prod:22", "ssh-ed25519", presented); err != nil || prompted {
+		t.Errorf("matching --fingerprint: err = %v, prompted = %v", err, prompted)
+	}
+	err := rekeyHostKeyCheck("SHA256:other", nil, true, accept)("prod:22", "ssh-ed25519", presented)
+	if err == nil || !strings.Contains(err.Error(), presented) {
+		t.Errorf("a key other than --fingerprint should be refused, got %v", err)
+	}
+
+	// Without --fingerprint, the key is confirmed interactively only
+	if err := rekeyHostKeyCheck("", nil, false, accept)("prod:22", "ssh-ed25519", presented); err == nil || !strings.Contains(err.Error(), "--fingerprint") {
+		t.Errorf("non-interactive rekey without --fingerprint should fail, got %v", err)
+	}
+	if err := rekeyHostKeyCheck("", nil, true, refuse)("prod:22", "ssh-ed25519", presented); err == nil {
+		t.Error("a refused key should fail")
+	}
+	if err := rekeyHostKeyCheck("", nil, true, accept)("prod:22", "ssh-ed25519", presented); err != nil || !prompted {
+		t.Errorf("a confirmed key should be accepted: err = %v, prompted = %v", err, prompted)
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"github.com/yoanbernabeu/frankendeploy/internal/caddy"
 	"github.com/yoanbernabeu/frankendeploy/internal/config"
 	"github.com/yoanbernabeu/frankendeploy/internal/constants"
+	"github.com/yoanbernabeu/frankendeploy/internal/provision"
 	"github.com/yoanbernabeu/frankendeploy/internal/security"
 	"github.com/yoanbernabeu/frankendeploy/internal/ssh"
 )
@@ -26,10 +27,21 @@ var serverAddCmd = &cobra.Command{
 	Short: "Add a new server",
 	Long: `Adds a new server to the global configuration.
 
+With --from-ssh-config, the host, user, port, key and jump hosts are taken
+from a Host alias of ~/.ssh/config instead of <user@host>. The flags given
+take precedence.
+
+Servers reachable only through a bastion take --jump, in the format of
+OpenSSH's ProxyJump: one or more comma-separated [user@]host[:port] hops.
+Each hop authenticates with the server's key unless --jump-key is given,
+and its host key is verified like the server's.
+
 Example:
   frankendeploy server add production deploy@my-vps.com
-  frankendeploy server add staging user@staging.example.com --port 2222`,
-	Args: cobra.ExactArgs(2),
+  frankendeploy server add staging user@staging.example.com --port 2222
+  frankendeploy server add internal deploy@10.0.0.5 --jump ops@bastion.example.com
+  frankendeploy server add production --from-ssh-config myvps`,
+	Args: cobra.RangeArgs(1, 2),
 	RunE: runServerAdd,
 }
 
@@ -39,12 +51,36 @@ var serverSetupCmd = &cobra.Command{
 	Long: `Configures a server for FrankenDeploy deployments.
 
 This command will:
+- Detect the distribution (Debian/Ubuntu, RHEL/Rocky/Alma/Fedora, Alpine)
 - Install Docker if not present
-- Configure UFW firewall (ports 22, 80, 443)
+- Configure the firewall (UFW, firewalld or iptables): SSH, 80 and 443
 - Install and configure Fail2ban (SSH brute-force protection)
 - Configure Docker for non-root usage
 - Set up the deployment directory structure
-- Configure Caddy as reverse proxy`,
+- Configure Caddy as reverse proxy
+
+Caddy modes (--caddy-mode):
+  caddyfile  One Caddyfile per app, Caddy reloaded on each change (default)
+  api        Per-app JSON routes patched through the Caddy admin API: an
+             update never reprovisions the other apps, and 'caddy show'
+             reports manual changes. deploy.caddy.raw is not supported.
+
+Apps deployed before a mode change must be redeployed.
+
+With --harden, setup also creates a non-root deploy user (docker group,
+passwordless sudo, your authorized keys), disables password and root SSH
+login and enables unattended security upgrades. sshd is only reloaded once
+its config passes 'sshd -t' and a second SSH connection as the deploy user
+works; if that connection fails after the reload, the change is reverted.
+The server is then saved with the deploy user.
+
+With --tune (or --swap), setup also runs the steps of 'server tune': a swap
+file, kernel limits and Docker daemon defaults.
+
+Example:
+  frankendeploy server setup production --email admin@example.com
+  frankendeploy server setup production --email admin@example.com --harden
+  frankendeploy server setup production --email admin@example.com --swap 1G`,
 	Args: cobra.ExactArgs(1),
 	RunE: runServerSetup,
 }
@@ -63,7 +99,10 @@ var serverStatusCmd = &cobra.Command{
 - System metrics: CPU, Memory, Disk usage, Load average
 - Per-application resource consumption (CPU/RAM per container)
 - Caddy reverse proxy status
-- Deployed applications`,
+- Swap, kernel limits and Docker daemon defaults set by 'server tune'
+- Deployed applications
+
+For a refreshing view, use 'server top'.`,
 	Args: cobra.ExactArgs(1),
 	RunE: runServerStatus,
 }
@@ -81,20 +120,31 @@ var serverSetCmd = &cobra.Command{
 	Long: `Sets a configuration value for a server.
 
 Available keys:
-  remote_build  Enable/disable remote build (true/false)
+  remote_build    Enable/disable remote build (true/false)
+  remote_builder  Build with the server's Docker daemon over SSH (true/false)
+  forward_agent   Forward the local ssh-agent to remote builds (true/false)
 
 Examples:
   frankendeploy server set prod remote_build true
-  frankendeploy server set staging remote_build false`,
+  frankendeploy server set staging remote_build false
+  frankendeploy server set prod forward_agent true
+  frankendeploy server set prod remote_builder true`,
 	Args: cobra.ExactArgs(3),
 	RunE: runServerSet,
 }
 
 var (
-	serverPort    int
-	serverKeyPath string
-	setupEmail    string
-	skipSSHTest   bool
+	serverPort      int
+	serverKeyPath   string
+	serverJump      string
+	serverJumpKey   string
+	setupEmail      string
+	setupCaddyMode  string
+	setupHarden     bool
+	setupDeployUser string
+	setupTune       bool
+	setupSwap       string
+	skipSSHTest     bool
 )
 
 func init() {
@@ -109,40 +159,80 @@ func init() {
 	serverAddCmd.Flags().IntVarP(&serverPort, "port", "p", 22, "SSH port")
 	serverAddCmd.Flags().StringVarP(&serverKeyPath, "key", "k", "", "SSH private key path")
 	serverAddCmd.Flags().BoolVar(&skipSSHTest, "skip-test", false, "Skip SSH connection test")
+	serverAddCmd.Flags().StringVarP(&serverJump, "jump", "J", "", "Jump hosts to tunnel through: [user@]host[:port][,...]")
+	serverAddCmd.Flags().StringVar(&serverJumpKey, "jump-key", "", "SSH private key path for the jump hosts (default: the server key)")
 
 	serverSetupCmd.Flags().StringVarP(&setupEmail, "email", "e", "", "Email for Let's Encrypt certificates (required)")
 	_ = serverSetupCmd.MarkFlagRequired("email")
+	serverSetupCmd.Flags().BoolVar(&setupHarden, "harden", false, "Create a deploy user, disable password and root SSH login, enable unattended security upgrades")
+	serverSetupCmd.Flags().StringVar(&setupDeployUser, "deploy-user", "", "User created by --harden (default: default_user of the global config)")
+	serverSetupCmd.Flags().BoolVar(&setupTune, "tune", false, "Add a swap file and tune the kernel and Docker daemon (see 'server tune')")
+	serverSetupCmd.Flags().StringVar(&setupSwap, "swap", provision.DefaultSwapSize, "Swap file size for --tune, like 512M or 2G (0 for none); implies --tune")
+	serverSetupCmd.Flags().StringVar(&setupCaddyMode, "caddy-mode", "", "How apps are configured in Caddy: caddyfile or api (default: current mode, caddyfile for new servers)")
 }
 
 func runServerAdd(cmd *cobra.Command, args []string) error {
 	name := args[0]
-	hostSpec := args[1]
 
 	// Validate server name
 	if err := security.ValidateServerName(name); err != nil {
 		return fmt.Errorf("invalid server name: %w", err)
 	}
 
-	// Parse user@host
-	parts := strings.SplitN(hostSpec, "@", 2)
-	if len(parts) != 2 {
-		return fmt.Errorf("invalid host format, use user@host")
-	}
-	user, host := parts[0], parts[1]
-
 	// Load global config
 	globalCfg, err := config.LoadGlobalConfig()
 	if err != nil {
 		return fmt.Errorf("failed to load global config: %w", err)
 	}
 
-	// Create server config
-	serverCfg := config.ServerConfig{
-		Host:    host,
-		User:    user,
-		Port:    serverPort,
-		KeyPath: serverKeyPath,
+	var serverCfg config.ServerConfig
+	if serverFromSSHConfig != "" {
+		if len(args) == 2 {
+			return fmt.Errorf("<user@host> and --from-ssh-config cannot be combined")
+		}
+		sshCfg, path, err := loadSSHConfig()
+		if err != nil {
+			return err
+		}
+		if serverCfg, err = serverConfigFromSSH(sshCfg, serverFromSSHConfig, globalCfg); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		if cmd.Flags().Changed("port") {
+			serverCfg.Port = serverPort
+		}
+		if serverKeyPath != "" {
+			serverCfg.KeyPath = serverKeyPath
+		}
+	} else {
+		if len(args) != 2 {
+			return fmt.Errorf("missing <user@host> (or --from-ssh-config <alias>)")
+		}
+		// Parse user@host
+		parts := strings.SplitN(args[1], "@", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("invalid host format, use user@host")
+		}
+		serverCfg = config.ServerConfig{
+			Host:    parts[1],
+			User:    parts[0],
+			Port:    serverPort,
+			KeyPath: serverKeyPath,
+		}
+	}
+
+	if serverJump != "" {
+		proxyJump, err := config.ParseProxyJump(serverJump)
+		if err != nil {
+			return fmt.Errorf("invalid --jump: %w", err)
+		}
+		serverCfg.ProxyJump = proxyJump
 	}
+	if serverJumpKey != "" {
+		for i := range serverCfg.ProxyJump {
+			serverCfg.ProxyJump[i].KeyPath = serverJumpKey
+		}
+	}
+	user, host := serverCfg.User, serverCfg.Host
 
 	// Validate
 	if errors := config.ValidateServerConfig(&serverCfg); errors.HasErrors() {
@@ -171,7 +261,15 @@ func runServerAdd(cmd *cobra.Command, args []string) error {
 	// Test SSH connection and configure key if needed
 	if err := testAndConfigureSSH(name, &serverCfg, globalCfg); err != nil {
 		PrintWarning("SSH connection could not be established: %v", err)
-		PrintInfo("You can test the connection manually with: ssh %s@%s -p %d", user, host, serverCfg.Port)
+		jump := ""
+		if len(serverCfg.ProxyJump) > 0 {
+			hops := make([]string, len(serverCfg.ProxyJump))
+			for i, hop := range serverCfg.ProxyJump {
+				hops[i] = hop.String()
+			}
+			jump = " -J " + strings.Join(hops, ",")
+		}
+		PrintInfo("You can test the connection manually with: ssh%s %s@%s -p %d", jump, user, host, serverCfg.Port)
 	}
 
 	printNextSteps(name)
@@ -189,8 +287,20 @@ func testAndConfigureSSH(name string, serverCfg *config.ServerConfig, globalCfg
 	PrintInfo("Testing SSH connection...")
 
 	// Try connection with current configuration
-	client := ssh.NewClient(serverCfg.Host, serverCfg.User, serverCfg.Port, serverCfg.KeyPath)
+	client := ssh.NewClient(serverCfg.Host, serverCfg.User, serverCfg.Port, serverCfg.KeyPath, sshOptsForServer(serverCfg, globalCfg, nil)...)
 	err := client.Connect()
+
+	// The host key is verified before authentication: it is pinned even
+	// when the key tried is refused, and the other keys are tried with it
+	if pin := client.HostKeyPin(); pin != "" && len(serverCfg.HostKeys) == 0 {
+		serverCfg.HostKeys = []string{pin}
+		globalCfg.Servers[name] = *serverCfg
+		if saveErr := config.SaveGlobalConfig(globalCfg); saveErr != nil {
+			return fmt.Errorf("failed to save config: %w", saveErr)
+		}
+		PrintVerbose("Pinned host key %s", pin)
+	}
+
 	if err == nil {
 		client.Close()
 		PrintSuccess("SSH connection successful")
@@ -236,9 +346,9 @@ func testAndConfigureSSH(name string, serverCfg *config.ServerConfig, globalCfg
 	// Try keys - either interactively or automatically
 	var workingKey *ssh.SSHKeyInfo
 	if interactive {
-		workingKey = interactiveKeySelection(serverCfg, availableKeys)
+		workingKey = interactiveKeySelection(serverCfg, globalCfg, availableKeys)
 	} else {
-		workingKey = autoTryKeys(serverCfg, availableKeys)
+		workingKey = autoTryKeys(serverCfg, globalCfg, availableKeys)
 	}
 
 	if workingKey == nil {
@@ -258,7 +368,7 @@ func testAndConfigureSSH(name string, serverCfg *config.ServerConfig, globalCfg
 }
 
 // interactiveKeySelection prompts the user to select an SSH key
-func interactiveKeySelection(serverCfg *config.ServerConfig, keys []ssh.SSHKeyInfo) *ssh.SSHKeyInfo {
+func interactiveKeySelection(serverCfg *config.ServerConfig, globalCfg *config.GlobalConfig, keys []ssh.SSHKeyInfo) *ssh.SSHKeyInfo {
 	options := make([]string, len(keys))
 	for i, key := range keys {
 		if key.IsEncrypted {
@@ -278,7 +388,7 @@ func interactiveKeySelection(serverCfg *config.ServerConfig, keys []ssh.SSHKeyIn
 	selectedKey := &keys[choice]
 	PrintInfo("Testing with %s...", selectedKey.Path)
 
-	err := ssh.TryConnect(serverCfg.Host, serverCfg.User, serverCfg.Port, selectedKey.Path)
+	err := ssh.TryConnect(serverCfg.Host, serverCfg.User, serverCfg.Port, selectedKey.Path, sshOptsForServer(serverCfg, globalCfg, nil)...)
 	if err != nil {
 		PrintError("Connection failed: %v", err)
 		return nil
@@ -289,12 +399,12 @@ func interactiveKeySelection(serverCfg *config.ServerConfig, keys []ssh.SSHKeyIn
 }
 
 // autoTryKeys automatically tries available keys in order
-func autoTryKeys(serverCfg *config.ServerConfig, keys []ssh.SSHKeyInfo) *ssh.SSHKeyInfo {
+func autoTryKeys(serverCfg *config.ServerConfig, globalCfg *config.GlobalConfig, keys []ssh.SSHKeyInfo) *ssh.SSHKeyInfo {
 	PrintInfo("Trying available SSH keys automatically...")
 
 	for _, key := range keys {
 		PrintVerbose("Trying %s...", key.Name)
-		err := ssh.TryConnect(serverCfg.Host, serverCfg.User, serverCfg.Port, key.Path)
+		err := ssh.TryConnect(serverCfg.Host, serverCfg.User, serverCfg.Port, key.Path, sshOptsForServer(serverCfg, globalCfg, nil)...)
 		if err == nil {
 			PrintSuccess("SSH connection successful with %s", key.Name)
 			return &key
@@ -304,31 +414,48 @@ func autoTryKeys(serverCfg *config.ServerConfig, keys []ssh.SSHKeyInfo) *ssh.SSH
 	return nil
 }
 
-// buildFirewallCommands returns the UFW commands for server setup. Every SSH
-// port is allowed before ufw is enabled: never enable the firewall without
-// having allowed the port(s) SSH is reachable on, or the user gets locked
-// out of their own server. Invalid ports (<= 0) are filtered out.
-func buildFirewallCommands(sshPorts []int) []string {
-	cmds := make([]string, 0, len(sshPorts)+3)
-	seen := make(map[int]bool)
-	for _, port := range sshPorts {
-		if port > 0 && !seen[port] {
-			seen[port] = true
-			cmds = append(cmds, fmt.Sprintf("sudo ufw allow %d/tcp || true", port))
+// detectProvisioner reads /etc/os-release on the server and returns the
+// provisioner of its distro family
+func detectProvisioner(ctx context.Context, client ssh.Executor) (provision.Provisioner, provision.Distro, error) {
+	result, err := client.Exec(ctx, provision.OSReleaseCommand)
+	if err != nil {
+		return nil, provision.Distro{}, fmt.Errorf("failed to detect the server distribution: %w", err)
+	}
+	if err := result.Err(); err != nil {
+		return nil, provision.Distro{}, fmt.Errorf("failed to detect the server distribution (no /etc/os-release): %w", err)
+	}
+	distro := provision.ParseOSRelease(result.Stdout)
+	p, err := provision.ForDistro(distro)
+	if err != nil {
+		return nil, distro, err
+	}
+	return p, distro, nil
+}
+
+// serverSSHPorts returns the ports SSH must stay reachable on: the
+// configured one, and the one of the current session. Behind a gateway/NAT,
+// sshd may receive connections on a different port than the client-side
+// one ($SSH_CONNECTION is "client_ip client_port server_ip server_port").
+func serverSSHPorts(ctx context.Context, client ssh.Executor, server *config.ServerConfig) []int {
+	sshPorts := []int{server.Port}
+	if result, err := client.Exec(ctx, `echo "${SSH_CONNECTION##* }"`); err == nil && result != nil {
+		if port, convErr := strconv.Atoi(strings.TrimSpace(result.Stdout)); convErr == nil && port != server.Port {
+			sshPorts = append(sshPorts, port)
 		}
 	}
-	cmds = append(cmds,
-		"sudo ufw allow 80/tcp || true",
-		"sudo ufw allow 443/tcp || true",
-		"sudo ufw --force enable || true",
-	)
-	return cmds
+	return sshPorts
 }
 
 func runServerSetup(cmd *cobra.Command, args []string) error {
 	ctx := cmd.Context()
 	name := args[0]
 
+	caddyMode, err := resolveCaddyMode(setupCaddyMode, name)
+	if err != nil {
+		return err
+	}
+	apiMode := caddyMode == config.CaddyModeAPI
+
 	conn, err := ConnectToServerNoProject(name)
 	if err != nil {
 		return err
@@ -337,75 +464,72 @@ func runServerSetup(cmd *cobra.Command, args []string) error {
 	client := conn.Client
 
 	PrintSuccess("Connected to %s", conn.Server.Host)
+	provisioner, distro, err := detectProvisioner(ctx, client)
+	if err != nil {
+		return err
+	}
+	PrintInfo("Detected %s (%s)", distro.PrettyName, provisioner.Name())
+
+	tune := setupTune || cmd.Flags().Changed("swap")
+	var swapSize int64
+	if tune {
+		if swapSize, err = provision.ParseSwapSize(setupSwap); err != nil {
+			return err
+		}
+	}
+
+	steps := 5
+	if tune {
+		steps++
+	}
+	var deployUser string
+	if setupHarden {
+		steps++
+		if deployUser, err = resolveDeployUser(setupDeployUser, conn.Global); err != nil {
+			return err
+		}
+	}
 	PrintInfo("Setting up server for FrankenDeploy...")
 
 	// Step 1: System update and prerequisites
-	PrintInfo("[1/5] Installing prerequisites...")
-	prereqCommands := []string{
-		"sudo apt-get update -qq",
-		"sudo apt-get install -y -qq curl ca-certificates",
-	}
-	if err := runCommandsWithProgress(ctx, client, prereqCommands); err != nil {
+	PrintInfo("[1/%d] Installing prerequisites...", steps)
+	if err := runCommandsWithProgress(ctx, client, provisioner.PrereqCommands()); err != nil {
 		return err
 	}
 
 	// Step 2: Install and configure Fail2ban
-	PrintInfo("[2/5] Installing Fail2ban...")
-	fail2banCommands := []string{
-		// Install Fail2ban
-		"sudo apt-get install -y -qq fail2ban",
-		// Enable and start Fail2ban
-		"sudo systemctl enable fail2ban",
-		"sudo systemctl start fail2ban",
-	}
-	if err := runCommandsWithProgress(ctx, client, fail2banCommands); err != nil {
+	PrintInfo("[2/%d] Installing Fail2ban...", steps)
+	if err := runCommandsWithProgress(ctx, client, provisioner.Fail2banCommands()); err != nil {
 		return err
 	}
 
 	// Create Fail2ban jail configuration for SSH
-	fail2banConfig := `[sshd]
-enabled = true
-port = ssh
-filter = sshd
-logpath = /var/log/auth.log
-maxretry = 5
-bantime = 3600
-findtime = 600
-`
-	fail2banConfigCmd := fmt.Sprintf(`sudo tee /etc/fail2ban/jail.local > /dev/null << 'FAIL2BANEOF'
-%sFAIL2BANEOF`, fail2banConfig)
-	if _, err := client.Exec(ctx, fail2banConfigCmd); err != nil {
+	if _, err := client.Exec(ctx, provisioner.Fail2banJailCommand()); err != nil {
 		PrintWarning("Failed to configure Fail2ban jail: %v", err)
 	} else {
 		// Restart Fail2ban to apply configuration
-		if _, err := client.Exec(ctx, "sudo systemctl restart fail2ban"); err != nil {
+		if _, err := client.Exec(ctx, provisioner.RestartCommand("fail2ban")); err != nil {
 			PrintWarning("Could not restart Fail2ban: %v", err)
 		}
 	}
 
 	// Step 3: Install Docker
-	PrintInfo("[3/5] Installing Docker...")
-	dockerCommands := []string{
-		// Install Docker if not present
-		"which docker || (curl -fsSL https://get.docker.com | sudo sh)",
-		// Add user to docker group
-		"sudo usermod -aG docker $USER || true",
-		// Enable and start Docker
-		"sudo systemctl enable docker",
-		"sudo systemctl start docker",
-	}
-	if err := runCommandsWithProgress(ctx, client, dockerCommands); err != nil {
+	PrintInfo("[3/%d] Installing Docker...", steps)
+	if err := runCommandsWithProgress(ctx, client, provisioner.DockerCommands()); err != nil {
 		return err
 	}
 
 	// Step 4: Create directory structure and Docker network
-	PrintInfo("[4/5] Configuring FrankenDeploy...")
+	PrintInfo("[4/%d] Configuring FrankenDeploy...", steps)
 	structureCommands := []string{
 		// Create directory structure
 		fmt.Sprintf("sudo mkdir -p %s", constants.AppsDir),
 		fmt.Sprintf("sudo mkdir -p %s/apps", constants.CaddyDir),
 		fmt.Sprintf("sudo mkdir -p %s/logs", constants.CaddyDir),
+		fmt.Sprintf("sudo mkdir -p %s", constants.CaddyAdminDir),
 		fmt.Sprintf("sudo chown -R $USER:$USER %s", constants.BasePath),
+		// Only the SSH user may reach the admin API socket
+		fmt.Sprintf("chmod 700 %s", constants.CaddyAdminDir),
 		// Create Docker network for apps
 		fmt.Sprintf("docker network create %s 2>/dev/null || true", constants.NetworkName),
 	}
@@ -415,17 +539,30 @@ findtime = 600
 
 	// Generate and upload Caddy main configuration
 	caddyGen := caddy.NewConfigGenerator()
-	mainConfig, err := caddyGen.GenerateMainConfig(setupEmail)
-	if err != nil {
-		return fmt.Errorf("failed to generate Caddy config: %w", err)
-	}
+	if apiMode {
+		apiConfig, err := caddyGen.GenerateAPIMainConfig(setupEmail)
+		if err != nil {
+			return fmt.Errorf("failed to generate Caddy config: %w", err)
+		}
+		uploadCaddyCmd := fmt.Sprintf(`cat > %s/caddy.json << 'CADDYEOF'
+%s
+CADDYEOF`, constants.CaddyDir, apiConfig)
+		if _, err := client.Exec(ctx, uploadCaddyCmd); err != nil {
+			return fmt.Errorf("failed to upload Caddy JSON config: %w", err)
+		}
+	} else {
+		mainConfig, err := caddyGen.GenerateMainConfig(setupEmail)
+		if err != nil {
+			return fmt.Errorf("failed to generate Caddy config: %w", err)
+		}
 
-	// Upload Caddyfile
-	uploadCaddyCmd := fmt.Sprintf(`cat > %s/Caddyfile << 'CADDYEOF'
+		// Upload Caddyfile
+		uploadCaddyCmd := fmt.Sprintf(`cat > %s/Caddyfile << 'CADDYEOF'
 %s
 CADDYEOF`, constants.CaddyDir, mainConfig)
-	if _, err := client.Exec(ctx, uploadCaddyCmd); err != nil {
-		return fmt.Errorf("failed to upload Caddyfile: %w", err)
+		if _, err := client.Exec(ctx, uploadCaddyCmd); err != nil {
+			return fmt.Errorf("failed to upload Caddyfile: %w", err)
+		}
 	}
 
 	// Create empty placeholder for apps import
@@ -434,37 +571,16 @@ CADDYEOF`, constants.CaddyDir, mainConfig)
 	}
 
 	// Step 5: Configure firewall and start Caddy container
-	PrintInfo("[5/5] Configuring firewall and starting Caddy...")
-	sshPorts := []int{conn.Server.Port}
-	// Behind a gateway/NAT, sshd may receive connections on a different port
-	// than the client-side one: also allow the port of the current session
-	// ($SSH_CONNECTION is "client_ip client_port server_ip server_port").
-	if result, err := client.Exec(ctx, `echo "${SSH_CONNECTION##* }"`); err == nil && result != nil {
-		if port, convErr := strconv.Atoi(strings.TrimSpace(result.Stdout)); convErr == nil {
-			sshPorts = append(sshPorts, port)
-		}
-	}
-	if err := runCommandsWithProgress(ctx, client, buildFirewallCommands(sshPorts)); err != nil {
+	PrintInfo("[5/%d] Configuring firewall and starting Caddy...", steps)
+	sshPorts := serverSSHPorts(ctx, client, conn.Server)
+	if err := runCommandsWithProgress(ctx, client, provisioner.FirewallCommands(sshPorts)); err != nil {
 		return err
 	}
 
-	// Start Caddy container with Admin API exposed on localhost only
-	// Note: Admin API on 2019 is NOT exposed to host - only accessible inside container
-	// We use docker exec to reload config
-	caddyContainerCmd := fmt.Sprintf(`docker rm -f caddy 2>/dev/null || true && docker run -d \
-		--name caddy \
-		--network %s \
-		--restart unless-stopped \
-		`+constants.DockerLogOptions+` \
-		-p 80:80 \
-		-p 443:443 \
-		-p 443:443/udp \
-		-v %s/Caddyfile:/etc/caddy/Caddyfile:ro \
-		-v %s/apps:/config/apps:ro \
-		-v %s/logs:/config/logs \
-		-v caddy_data:/data \
-		-v caddy_config:/config/caddy \
-		caddy:alpine`, constants.NetworkName, constants.CaddyDir, constants.CaddyDir, constants.CaddyDir)
+	// Start Caddy container. The admin API is never exposed on a TCP port:
+	// it listens on localhost inside the container (Caddyfile mode, reloaded
+	// with docker exec) or on a unix socket reached over SSH (API mode).
+	caddyContainerCmd := caddy.ContainerRunCommand(apiMode)
 
 	result, err := client.Exec(ctx, caddyContainerCmd)
 	if err != nil {
@@ -482,11 +598,52 @@ CADDYEOF`, constants.CaddyDir, mainConfig)
 		PrintWarning("Caddy container may not be running properly")
 	}
 
+	if previous := conn.Server.CaddyMode; previous != caddyMode && !(previous == "" && caddyMode == config.CaddyModeCaddyfile) {
+		conn.Server.CaddyMode = caddyMode
+		conn.Global.Servers[name] = *conn.Server
+		if err := config.SaveGlobalConfig(conn.Global); err != nil {
+			return fmt.Errorf("failed to save Caddy mode: %w", err)
+		}
+		PrintWarning("Caddy mode is now %q: apps already deployed on this server must be redeployed to be served", caddyMode)
+	}
+
+	step := 5
+
+	// Swap, kernel and Docker daemon tuning
+	if tune {
+		step++
+		PrintInfo("[%d/%d] Tuning swap, kernel and Docker...", step, steps)
+		if err := tuneServer(ctx, client, provisioner, swapSize, provision.DefaultSwappiness); err != nil {
+			return err
+		}
+	}
+
+	// Dedicated deploy user and sshd hardening
+	if setupHarden {
+		step++
+		PrintInfo("[%d/%d] Hardening SSH...", step, steps)
+		if err := hardenServer(ctx, client, provisioner, conn.Server.User, deployUser, sshLoginCheck(conn.Server, conn.Global)); err != nil {
+			return err
+		}
+		if conn.Server.User != deployUser {
+			conn.Server.User = deployUser
+			conn.Global.Servers[name] = *conn.Server
+			if err := config.SaveGlobalConfig(conn.Global); err != nil {
+				return fmt.Errorf("failed to save deploy user: %w", err)
+			}
+			PrintSuccess("Server '%s' now connects as %s", name, deployUser)
+		}
+	}
+
 	PrintSuccess("Server '%s' is ready for deployments!", name)
 	fmt.Println()
 	fmt.Println("Configuration:")
 	fmt.Printf("  Email:    %s (for Let's Encrypt)\n", setupEmail)
-	fmt.Println("  Caddy:    Docker container with Admin API")
+	if apiMode {
+		fmt.Println("  Caddy:    Docker container managed through its JSON admin API")
+	} else {
+		fmt.Println("  Caddy:    Docker container with Admin API")
+	}
 	fmt.Println("  Docker:   Installed with 'frankendeploy' network")
 	openPorts := make([]string, 0, len(sshPorts)+2)
 	seenPort := make(map[int]bool)
@@ -499,6 +656,17 @@ CADDYEOF`, constants.CaddyDir, mainConfig)
 	openPorts = append(openPorts, "80", "443")
 	fmt.Printf("  Firewall: Ports %s open\n", strings.Join(openPorts, ", "))
 	fmt.Println("  Fail2ban: SSH protection enabled (5 retries, 1h ban)")
+	if tune {
+		if swapSize > 0 {
+			fmt.Printf("  Tuning:   %s swap, kernel limits raised, Docker live-restore\n", formatSwapSize(swapSize))
+		} else {
+			fmt.Println("  Tuning:   Kernel limits raised, Docker live-restore")
+		}
+	}
+	if setupHarden {
+		fmt.Printf("  SSH:      Key-only logins as %s, root login disabled\n", deployUser)
+		fmt.Println("  Updates:  Unattended security upgrades enabled")
+	}
 	fmt.Println()
 	fmt.Println("Next step:")
 	fmt.Println("  Run 'frankendeploy deploy " + name + "' from your Symfony project")
@@ -506,6 +674,37 @@ CADDYEOF`, constants.CaddyDir, mainConfig)
 	return nil
 }
 
+// diskFull reports whether the disk line of server status ("12G/25G (91%)")
+// shows 85% or more used
+func diskFull(diskUsage string) bool {
+	_, percent, ok := strings.Cut(diskUsage, "(")
+	if !ok {
+		return false
+	}
+	used, err := strconv.Atoi(strings.TrimSuffix(strings.TrimSpace(percent), "%)"))
+	return err == nil && used >= 85
+}
+
+// resolveCaddyMode validates the --caddy-mode flag. Without the flag, the
+// current mode of the server is kept.
+func resolveCaddyMode(flag, serverName string) (string, error) {
+	switch flag {
+	case config.CaddyModeCaddyfile, config.CaddyModeAPI:
+		return flag, nil
+	case "":
+		globalCfg, err := config.LoadGlobalConfig()
+		if err != nil {
+			return "", err
+		}
+		if server, err := globalCfg.GetServer(serverName); err == nil && server.CaddyMode != "" {
+			return server.CaddyMode, nil
+		}
+		return config.CaddyModeCaddyfile, nil
+	default:
+		return "", fmt.Errorf("invalid --caddy-mode %q: use %s or %s", flag, config.CaddyModeCaddyfile, config.CaddyModeAPI)
+	}
+}
+
 // runCommandsWithProgress executes a list of commands with error handling
 func runCommandsWithProgress(ctx context.Context, client *ssh.Client, commands []string) error {
 	for _, command := range commands {
@@ -522,6 +721,22 @@ func runCommandsWithProgress(ctx context.Context, client *ssh.Client, commands [
 	return nil
 }
 
+// runCommandsStrict runs commands in order, stopping at the first failure:
+// unlike runCommandsWithProgress, no failure is tolerated.
+func runCommandsStrict(ctx context.Context, client ssh.Executor, commands []string) error {
+	for _, command := range commands {
+		PrintVerboseCommand(command)
+		result, err := client.Exec(ctx, command)
+		if err != nil {
+			return fmt.Errorf("command failed: %w", err)
+		}
+		if err := result.Err(); err != nil {
+			return fmt.Errorf("command failed: %w", err)
+		}
+	}
+	return nil
+}
+
 func runServerList(cmd *cobra.Command, args []string) error {
 	globalCfg, err := config.LoadGlobalConfig()
 	if err != nil {
@@ -546,9 +761,19 @@ func runServerList(cmd *cobra.Command, args []string) error {
 		if server.KeyPath != "" {
 			fmt.Printf("    Key:  %s\n", server.KeyPath)
 		}
+		if len(server.ProxyJump) > 0 {
+			hops := make([]string, len(server.ProxyJump))
+			for i, hop := range server.ProxyJump {
+				hops[i] = hop.String()
+			}
+			fmt.Printf("    Jump: %s\n", strings.Join(hops, " → "))
+		}
 		if server.RemoteBuild != nil {
 			fmt.Printf("    Remote Build: %v\n", *server.RemoteBuild)
 		}
+		if server.CaddyMode != "" {
+			fmt.Printf("    Caddy Mode: %s\n", server.CaddyMode)
+		}
 		fmt.Println()
 	}
 
@@ -569,38 +794,50 @@ func runServerStatus(cmd *cobra.Command, args []string) error {
 
 	PrintSuccess("Connection: OK")
 
+	// Every probe in one round trip
+	results, err := ssh.ExecBatch(ctx, client, []string{
+		"docker --version",
+		fmt.Sprintf("test -d %s && echo 'exists'", constants.BasePath),
+		"docker ps --filter name=caddy --format '{{.Status}}'",
+		fmt.Sprintf("docker network inspect %s --format '{{.Name}}' 2>/dev/null", constants.NetworkName),
+		"top -bn1 | grep 'Cpu(s)' | awk '{print 100 - $8}' 2>/dev/null || echo 'N/A'",
+		"free -m | awk 'NR==2{printf \"%.1f/%.1fGB (%.0f%%)\", $3/1024, $2/1024, $3*100/$2}'",
+		"df -h / | awk 'NR==2{printf \"%s/%s (%s)\", $3, $2, $5}'",
+		"uptime | awk -F'load average:' '{print $2}' | xargs",
+		provision.TuneStatusCommand(),
+		fmt.Sprintf("ls -1 %s 2>/dev/null", constants.AppsDir),
+	})
+	if err != nil {
+		PrintError("Could not read the server status: %v", err)
+		return nil
+	}
+	docker, baseDir, caddyPS, network, cpu, memory, disk, load, tune, appDirs :=
+		results[0], results[1], results[2], results[3], results[4], results[5], results[6], results[7], results[8], results[9]
+
 	// Check Docker
-	result, err := client.Exec(ctx, "docker --version")
-	if err == nil && result.ExitCode == 0 {
-		PrintSuccess("Docker: %s", strings.TrimSpace(result.Stdout))
+	if docker.ExitCode == 0 {
+		PrintSuccess("Docker: %s", strings.TrimSpace(docker.Stdout))
 	} else {
 		PrintWarning("Docker: Not installed")
 	}
 
 	// Check FrankenDeploy directory
-	result, err = client.Exec(ctx, fmt.Sprintf("test -d %s && echo 'exists'", constants.BasePath))
-	if err == nil && strings.Contains(result.Stdout, "exists") {
+	if strings.Contains(baseDir.Stdout, "exists") {
 		PrintSuccess("FrankenDeploy: Configured")
 	} else {
 		PrintWarning("FrankenDeploy: Not configured (run 'frankendeploy server setup %s')", name)
 	}
 
 	// Check Caddy container
-	result, err = client.Exec(ctx, "docker ps --filter name=caddy --format '{{.Status}}'")
-	if err == nil {
-		caddyStatus := strings.TrimSpace(result.Stdout)
-		if strings.Contains(caddyStatus, "Up") {
-			PrintSuccess("Caddy: %s (Docker)", caddyStatus)
-		} else {
-			PrintWarning("Caddy: Not running")
-		}
+	caddyStatus := strings.TrimSpace(caddyPS.Stdout)
+	if strings.Contains(caddyStatus, "Up") {
+		PrintSuccess("Caddy: %s (Docker)", caddyStatus)
 	} else {
-		PrintWarning("Could not check Caddy status: %v", err)
+		PrintWarning("Caddy: Not running")
 	}
 
 	// Check Docker network
-	result, err = client.Exec(ctx, fmt.Sprintf("docker network inspect %s --format '{{.Name}}' 2>/dev/null", constants.NetworkName))
-	if err == nil && strings.Contains(result.Stdout, constants.NetworkName) {
+	if strings.Contains(network.Stdout, constants.NetworkName) {
 		PrintSuccess("Docker network: %s", constants.NetworkName)
 	} else {
 		PrintWarning("Docker network: %s not found", constants.NetworkName)
@@ -610,92 +847,80 @@ func runServerStatus(cmd *cobra.Command, args []string) error {
 	fmt.Println()
 	fmt.Println("System Resources:")
 
-	// CPU usage
-	result, err = client.Exec(ctx, "top -bn1 | grep 'Cpu(s)' | awk '{print 100 - $8}' 2>/dev/null || echo 'N/A'")
-	if err == nil {
-		cpuUsage := strings.TrimSpace(result.Stdout)
-		if cpuUsage != "" && cpuUsage != "N/A" {
-			fmt.Printf("  CPU:    %s%% used\n", cpuUsage)
+	if cpuUsage := strings.TrimSpace(cpu.Stdout); cpuUsage != "" && cpuUsage != "N/A" {
+		fmt.Printf("  CPU:    %s%% used\n", cpuUsage)
+	}
+	if memUsage := strings.TrimSpace(memory.Stdout); memUsage != "" {
+		fmt.Printf("  Memory: %s\n", memUsage)
+	}
+	if diskUsage := strings.TrimSpace(disk.Stdout); diskUsage != "" {
+		fmt.Printf("  Disk:   %s\n", diskUsage)
+		if diskFull(diskUsage) {
+			PrintWarning("Disk almost full: run 'frankendeploy server disk %s' for a breakdown, 'frankendeploy server gc %s' to free space", name, name)
 		}
 	}
+	if loadAvg := strings.TrimSpace(load.Stdout); loadAvg != "" {
+		fmt.Printf("  Load:   %s\n", loadAvg)
+	}
 
-	// Memory usage
-	result, err = client.Exec(ctx, "free -m | awk 'NR==2{printf \"%.1f/%.1fGB (%.0f%%)\", $3/1024, $2/1024, $3*100/$2}'")
-	if err == nil {
-		memUsage := strings.TrimSpace(result.Stdout)
-		if memUsage != "" {
-			fmt.Printf("  Memory: %s\n", memUsage)
-		}
+	// Settings of server tune
+	if tune.ExitCode == 0 {
+		fmt.Println()
+		printTuneStatus(name, provision.ParseTuneStatus(tune.Stdout))
 	}
 
-	// Disk usage
-	result, err = client.Exec(ctx, "df -h / | awk 'NR==2{printf \"%s/%s (%s)\", $3, $2, $5}'")
-	if err == nil {
-		diskUsage := strings.TrimSpace(result.Stdout)
-		if diskUsage != "" {
-			fmt.Printf("  Disk:   %s\n", diskUsage)
+	// List deployed apps with container stats
+	var apps []string
+	for _, app := range strings.Split(strings.TrimSpace(appDirs.Stdout), "\n") {
+		if app != "" {
+			apps = append(apps, app)
 		}
 	}
+	if len(apps) == 0 {
+		return nil
+	}
 
-	// Load average
-	result, err = client.Exec(ctx, "uptime | awk -F'load average:' '{print $2}' | xargs")
-	if err == nil {
-		loadAvg := strings.TrimSpace(result.Stdout)
-		if loadAvg != "" {
-			fmt.Printf("  Load:   %s\n", loadAvg)
-		}
+	// docker stats samples for about two seconds: the app and worker stats
+	// are read concurrently, in separate sessions
+	statsCmds := make([]string, 0, 2*len(apps))
+	for _, app := range apps {
+		statsCmds = append(statsCmds,
+			fmt.Sprintf("docker stats --no-stream --format '{{.CPUPerc}}\t{{.MemUsage}}' %s 2>/dev/null", app),
+			fmt.Sprintf("docker stats --no-stream --format '{{.CPUPerc}}\t{{.MemUsage}}' %s-worker 2>/dev/null", app))
 	}
+	stats, _ := ssh.ExecConcurrent(ctx, client, statsCmds, 0)
 
-	// List deployed apps with container stats
-	result, err = client.Exec(ctx, fmt.Sprintf("ls -1 %s 2>/dev/null", constants.AppsDir))
-	if err == nil {
-		apps := strings.TrimSpace(result.Stdout)
-		if apps != "" {
-			fmt.Println()
-			fmt.Println("Deployed Applications:")
-			fmt.Println()
-			for _, app := range strings.Split(apps, "\n") {
-				if app == "" {
-					continue
-				}
-				fmt.Printf("  %s:\n", app)
-
-				// Get container stats for app
-				statsCmd := fmt.Sprintf("docker stats --no-stream --format '{{.CPUPerc}}\t{{.MemUsage}}' %s 2>/dev/null", app)
-				statsResult, statsErr := client.Exec(ctx, statsCmd)
-				if statsErr == nil {
-					stats := strings.TrimSpace(statsResult.Stdout)
-					if stats != "" {
-						parts := strings.Split(stats, "\t")
-						if len(parts) >= 2 {
-							fmt.Printf("    App:    CPU %s, Mem %s\n", parts[0], parts[1])
-						}
-					} else {
-						fmt.Printf("    App:    not running\n")
-					}
-				} else {
-					fmt.Printf("    App:    not running\n")
-				}
-
-				// Get worker stats if exists
-				workerStatsCmd := fmt.Sprintf("docker stats --no-stream --format '{{.CPUPerc}}\t{{.MemUsage}}' %s-worker 2>/dev/null", app)
-				workerResult, workerErr := client.Exec(ctx, workerStatsCmd)
-				if workerErr == nil {
-					workerStats := strings.TrimSpace(workerResult.Stdout)
-					if workerStats != "" {
-						parts := strings.Split(workerStats, "\t")
-						if len(parts) >= 2 {
-							fmt.Printf("    Worker: CPU %s, Mem %s\n", parts[0], parts[1])
-						}
-					}
-				}
-			}
+	fmt.Println()
+	fmt.Println("Deployed Applications:")
+	fmt.Println()
+	for i, app := range apps {
+		fmt.Printf("  %s:\n", app)
+		if cpuPerc, mem, ok := parseContainerStats(stats[2*i]); ok {
+			fmt.Printf("    App:    CPU %s, Mem %s\n", cpuPerc, mem)
+		} else {
+			fmt.Printf("    App:    not running\n")
+		}
+		if cpuPerc, mem, ok := parseContainerStats(stats[2*i+1]); ok {
+			fmt.Printf("    Worker: CPU %s, Mem %s\n", cpuPerc, mem)
 		}
 	}
 
 	return nil
 }
 
+// parseContainerStats returns the CPU and memory usage printed by
+// docker stats --format '{{.CPUPerc}}\t{{.MemUsage}}'
+func parseContainerStats(result *ssh.ExecResult) (cpu, memory string, ok bool) {
+	if result == nil {
+		return "", "", false
+	}
+	parts := strings.Split(strings.TrimSpace(result.Stdout), "\t")
+	if len(parts) < 2 {
+		return "", "", false
+	}
+	return parts[0], parts[1], true
+}
+
 func runServerRemove(cmd *cobra.Command, args []string) error {
 	name := args[0]
 
@@ -749,8 +974,22 @@ func runServerSet(cmd *cobra.Command, args []string) error {
 		}
 		serverCfg.RemoteBuild = &boolValue
 
+	case "forward_agent":
+		boolValue, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid value for forward_agent: use 'true' or 'false'")
+		}
+		serverCfg.ForwardAgent = boolValue
+
+	case "remote_builder":
+		boolValue, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid value for remote_builder: use 'true' or 'false'")
+		}
+		serverCfg.RemoteBuilder = boolValue
+
 	default:
-		return fmt.Errorf("unknown configuration key: %s\n\nAvailable keys:\n  remote_build  Enable/disable remote build (true/false)", key)
+		return fmt.Errorf("unknown configuration key: %s\n\nAvailable keys:\n  remote_build    Enable/disable remote build (true/false)\n  remote_builder  Build with the server's Docker daemon over SSH (true/false)\n  forward_agent   Forward the local ssh-agent to remote builds (true/false)", key)
 	}
 
 	globalCfg.Servers[serverName] = *serverCfg
@@ -0,0 +1,190 @@
+package cmd
+
+import (
+	"fmt"
+	"os/user"
+	"regexp"
+	"sort"
+
+	"github.com/spf13/cobra"
+	"github.com/yoanbernabeu/frankendeploy/internal/config"
+	"github.com/yoanbernabeu/frankendeploy/internal/security"
+	"github.com/yoanbernabeu/frankendeploy/internal/ssh"
+)
+
+var serverImportCmd = &cobra.Command{
+	Use:   "import [alias...]",
+	Short: "Add servers from the Host entries of ~/.ssh/config",
+	Long: `Adds a server for each Host alias of ~/.ssh/config (the Include
+directives are followed), or for the aliases given. HostName, User, Port,
+IdentityFile and ProxyJump are resolved like plain ssh does, wildcard Host
+blocks included, and stored in the server config: it keeps working where
+the ssh_config file is not available (CI/CD).
+
+Each server is named after its alias, with the characters not allowed in
+server names replaced by "-". Aliases already configured are skipped.
+Wildcard patterns ("Host *.internal") are not imported: add such hosts
+with 'server add <name> --from-ssh-config <host>'.
+
+FRANKENDEPLOY_SSH_CONFIG reads another ssh_config file.
+
+Example:
+  frankendeploy server import
+  frankendeploy server import prod staging`,
+	RunE: runServerImport,
+}
+
+var serverFromSSHConfig string
+
+// invalidServerNameChars are the characters of an ssh_config alias not
+// allowed in a server name
+var invalidServerNameChars = regexp.MustCompile(`[^a-zA-Z0-9_-]+`)
+
+func init() {
+	serverCmd.AddCommand(serverImportCmd)
+
+	serverAddCmd.Flags().StringVar(&serverFromSSHConfig, "from-ssh-config", "", "Take host, user, port, key and jump hosts from this ~/.ssh/config alias")
+}
+
+// loadSSHConfig loads the ssh_config file the SSH client resolves hosts from
+func loadSSHConfig() (*ssh.SSHConfig, string, error) {
+	path := ssh.DefaultSSHConfigPath()
+	if path == "" {
+		return nil, "", fmt.Errorf("no SSH config file (FRANKENDEPLOY_SSH_CONFIG is none)")
+	}
+	sshCfg, err := ssh.LoadSSHConfig(path)
+	if err != nil {
+		return nil, path, fmt.Errorf("failed to read SSH config: %w", err)
+	}
+	return sshCfg, path, nil
+}
+
+// serverConfigFromSSH returns the server config of an ssh_config alias. The
+// settings are resolved, jump hosts included, so the config does not depend
+// on the ssh_config file. The user defaults to default_user of the global
+// config then to the local user, the port to 22.
+func serverConfigFromSSH(sshCfg *ssh.SSHConfig, alias string, globalCfg *config.GlobalConfig) (config.ServerConfig, error) {
+	host, err := sshCfg.Lookup(alias)
+	if err != nil {
+		return config.ServerConfig{}, err
+	}
+	if host == (ssh.SSHHostConfig{}) {
+		return config.ServerConfig{}, fmt.Errorf("no Host entry matches %q", alias)
+	}
+
+	serverCfg := config.ServerConfig{
+		Host:    host.HostName,
+		User:    host.User,
+		Port:    host.Port,
+		KeyPath: host.IdentityFile,
+	}
+	if serverCfg.Host == "" {
+		serverCfg.Host = alias
+	}
+	if serverCfg.User == "" {
+		serverCfg.User = globalCfg.DefaultUser
+	}
+	if serverCfg.User == "" {
+		if u, err := user.Current(); err == nil {
+			serverCfg.User = u.Username
+		}
+	}
+	if serverCfg.Port == 0 {
+		serverCfg.Port = 22
+	}
+
+	hops, err := config.ParseProxyJump(host.ProxyJump)
+	if err != nil {
+		return config.ServerConfig{}, fmt.Errorf("invalid ProxyJump for %s: %w", alias, err)
+	}
+	for _, jump := range hops {
+		resolved, err := sshCfg.Lookup(jump.Host)
+		if err != nil {
+			return config.ServerConfig{}, err
+		}
+		jump.KeyPath = resolved.IdentityFile
+		if resolved.HostName != "" {
+			jump.Host = resolved.HostName
+		}
+		if jump.User == "" {
+			jump.User = resolved.User
+		}
+		if jump.Port == 0 {
+			jump.Port = resolved.Port
+		}
+		serverCfg.ProxyJump = append(serverCfg.ProxyJump, jump)
+	}
+	return serverCfg, nil
+}
+
+// serverNameFromAlias turns an ssh_config alias into a valid server name
+func serverNameFromAlias(alias string) string {
+	name := invalidServerNameChars.ReplaceAllString(alias, "-")
+	if len(name) > 64 {
+		name = name[:64]
+	}
+	return name
+}
+
+func runServerImport(cmd *cobra.Command, args []string) error {
+	sshCfg, path, err := loadSSHConfig()
+	if err != nil {
+		return err
+	}
+
+	aliases := args
+	if len(aliases) == 0 {
+		aliases = sshCfg.Aliases()
+		if len(aliases) == 0 {
+			PrintInfo("No Host alias found in %s", path)
+			return nil
+		}
+	}
+
+	globalCfg, err := config.LoadGlobalConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load global config: %w", err)
+	}
+
+	var imported []string
+	for _, alias := range aliases {
+		name := serverNameFromAlias(alias)
+		if err := security.ValidateServerName(name); err != nil {
+			PrintWarning("Skipping %s: %v", alias, err)
+			continue
+		}
+		if _, exists := globalCfg.Servers[name]; exists {
+			PrintInfo("Skipping %s: server '%s' already exists", alias, name)
+			continue
+		}
+
+		serverCfg, err := serverConfigFromSSH(sshCfg, alias, globalCfg)
+		if err != nil {
+			PrintWarning("Skipping %s: %v", alias, err)
+			continue
+		}
+		if errors := config.ValidateServerConfig(&serverCfg); errors.HasErrors() {
+			PrintWarning("Skipping %s: %v", alias, errors)
+			continue
+		}
+		if err := globalCfg.AddServer(name, serverCfg); err != nil {
+			return err
+		}
+		imported = append(imported, name)
+		PrintSuccess("Imported '%s' (%s@%s:%d)", name, serverCfg.User, serverCfg.Host, serverCfg.Port)
+	}
+
+	if len(imported) == 0 {
+		PrintInfo("No server imported")
+		return nil
+	}
+	if err := config.SaveGlobalConfig(globalCfg); err != nil {
+		return fmt.Errorf("failed to save config: %w", err)
+	}
+
+	sort.Strings(imported)
+	fmt.Println()
+	fmt.Println("Next step:")
+	fmt.Printf("  Run 'frankendeploy server status <name>' to test a connection, for example: frankendeploy server status %s\n", imported[0])
+	return nil
+}
@@ -0,0 +1,107 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/yoanbernabeu/frankendeploy/internal/config"
+	"github.com/yoanbernabeu/frankendeploy/internal/ssh"
+)
+
+const testSSHConfig = `Host prod
+  HostName 51.210.0.10
+  User deploy
+  Port 2222
+  IdentityFile ~/.ssh/prod
+  ProxyJump gate,admin@10.0.0.2:2200
+
+Host gate
+  HostName bastion.example.com
+  User ops
+  IdentityFile ~/.ssh/bastion
+
+Host my.vps *.internal
+  HostName 203.0.113.7
+`
+
+func TestServerConfigFromSSH(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	path := filepath.Join(home, "ssh_config")
+	if err := os.WriteFile(path, []byte(testSSHConfig), 0600); err != nil {
+		t.Fatal(err)
+	}
+	sshCfg, err := ssh.LoadSSHConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	globalCfg := &config.GlobalConfig{DefaultUser: "fallback"}
+
+	got, err := serverConfigFromSSH(sshCfg, "prod", globalCfg)
+	if err != nil {
+		t.Fatalf("serverConfigFromSSH() error: %v", err)
+	}
+	want := config.ServerConfig{
+		Host:    "51.210.0.10",
+		User:    "deploy",
+		Port:    2222,
+		KeyPath: filepath.Join(home, ".ssh", "prod"),
+		// Jump host aliases are resolved too
+		ProxyJump: []config.JumpHost{
+			{Host: "bastion.example.com", User: "ops", KeyPath: filepath.Join(home, ".ssh", "bastion")},
+			{Host: "10.0.0.2", User: "admin", Port: 2200},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("serverConfigFromSSH(prod) = %+v, want %+v", got, want)
+	}
+
+	got, err = serverConfigFromSSH(sshCfg, "my.vps", globalCfg)
+	if err != nil || got.Host != "203.0.113.7" || got.User != "fallback" || got.Port != 22 {
+		t.Errorf("serverConfigFromSSH(my.vps) = %+v, %v", got, err)
+	}
+
+	if _, err := serverConfigFromSSH(sshCfg, "unknown", globalCfg); err == nil {
+		t.Error("serverConfigFromSSH() should fail for an alias without Host entry")
+	}
+}
+
+func TestRunServerImport(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, ".config"))
+	path := filepath.Join(home, "ssh_config")
+	if err := os.WriteFile(path, []byte(testSSHConfig), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("FRANKENDEPLOY_SSH_CONFIG", path)
+
+	globalCfg := config.DefaultGlobalConfig()
+	globalCfg.Servers["gate"] = config.ServerConfig{Host: "configured.example.com", User: "root", Port: 22}
+	if err := config.SaveGlobalConfig(globalCfg); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := runServerImport(serverImportCmd, nil); err != nil {
+		t.Fatalf("runServerImport() error: %v", err)
+	}
+
+	globalCfg, err := config.LoadGlobalConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := globalCfg.ListServers(); len(got) != 3 {
+		t.Errorf("servers after import = %v, want gate, prod and my-vps", got)
+	}
+	if globalCfg.Servers["gate"].Host != "configured.example.com" {
+		t.Error("an existing server must not be overwritten")
+	}
+	if prod := globalCfg.Servers["prod"]; prod.Host != "51.210.0.10" || len(prod.ProxyJump) != 2 {
+		t.Errorf("prod imported as %+v", prod)
+	}
+	if vps := globalCfg.Servers["my-vps"]; vps.Host != "203.0.113.7" {
+		t.Errorf("my.vps should be imported as my-vps, got %+v", vps)
+	}
+}
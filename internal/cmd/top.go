@@ -0,0 +1,216 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/yoanbernabeu/frankendeploy/internal/deploy"
+	"github.com/yoanbernabeu/frankendeploy/internal/security"
+	"golang.org/x/term"
+)
+
+var serverTopCmd = &cobra.Command{
+	Use:   "top <name>...",
+	Short: "Live resource dashboard of one or more servers",
+	Long: `Shows a refreshing dashboard of the resources of one or more servers:
+- CPU, memory, disk and load average
+- Per container: CPU, memory, network I/O and restart count
+
+Containers using 90% or more of their memory limit (deploy.memory_limit)
+are highlighted: they are about to be OOM-killed. Each refresh collects
+all the metrics of a server with a single SSH command. Press Ctrl+C to
+quit.
+
+Example:
+  frankendeploy server top production
+  frankendeploy server top production staging --interval 10s
+  frankendeploy server top production --once --json`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: runServerTop,
+}
+
+var (
+	topInterval time.Duration
+	topOnce     bool
+	topJSON     bool
+)
+
+// topMinInterval keeps the refreshes from overlapping: docker stats samples
+// for about two seconds
+const topMinInterval = 2 * time.Second
+
+// ANSI sequences of the dashboard, used only on a terminal
+const (
+	ansiClearScreen = "\033[H\033[2J"
+	ansiRed         = "\033[31m"
+	ansiReset       = "\033[0m"
+)
+
+func init() {
+	serverCmd.AddCommand(serverTopCmd)
+
+	serverTopCmd.Flags().DurationVar(&topInterval, "interval", 5*time.Second, "Refresh interval (minimum 2s)")
+	serverTopCmd.Flags().BoolVar(&topOnce, "once", false, "Print a single snapshot and exit")
+	serverTopCmd.Flags().BoolVar(&topJSON, "json", false, "Output a single snapshot as JSON (implies --once)")
+}
+
+// topSnapshot is the metrics of a server for one refresh, or the reason they
+// are missing
+type topSnapshot struct {
+	Server  string                `json:"server"`
+	Metrics *deploy.ServerMetrics `json:"metrics,omitempty"`
+	Error   string                `json:"error,omitempty"`
+}
+
+func runServerTop(cmd *cobra.Command, args []string) error {
+	if topInterval < topMinInterval {
+		return fmt.Errorf("invalid --interval %s: must be at least %s", topInterval, topMinInterval)
+	}
+	for _, name := range args {
+		if err := security.ValidateServerName(name); err != nil {
+			return fmt.Errorf("invalid server name: %w", err)
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt)
+	defer stop()
+
+	conns := make([]*ServerConnection, len(args))
+	for i, name := range args {
+		conn, err := ConnectToServerNoProject(name)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		defer conn.Client.Close()
+		conns[i] = conn
+	}
+
+	probe, err := deploy.MetricsCommand()
+	if err != nil {
+		return err
+	}
+
+	if topJSON {
+		out, err := json.MarshalIndent(collectTop(ctx, args, conns, probe), "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(out))
+		return nil
+	}
+
+	interactive := term.IsTerminal(int(os.Stdout.Fd()))
+	for {
+		snapshots := collectTop(ctx, args, conns, probe)
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		var frame strings.Builder
+		if !topOnce {
+			if interactive {
+				frame.WriteString(ansiClearScreen)
+			}
+			fmt.Fprintf(&frame, "frankendeploy server top - every %s - %s (Ctrl+C to quit)\n", topInterval, time.Now().Format("15:04:05"))
+		}
+		for _, snapshot := range snapshots {
+			fmt.Fprintln(&frame)
+			renderTop(&frame, snapshot, interactive)
+		}
+		fmt.Print(frame.String())
+
+		if topOnce {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(topInterval):
+		}
+	}
+}
+
+// collectTop collects the metrics of every server concurrently, one SSH
+// command per server
+func collectTop(ctx context.Context, names []string, conns []*ServerConnection, probe string) []topSnapshot {
+	snapshots := make([]topSnapshot, len(conns))
+	var wg sync.WaitGroup
+	for i, conn := range conns {
+		wg.Add(1)
+		go func(i int, conn *ServerConnection) {
+			defer wg.Done()
+			snapshots[i].Server = names[i]
+			result, err := conn.Client.Exec(ctx, probe)
+			if err != nil {
+				snapshots[i].Error = err.Error()
+				return
+			}
+			snapshots[i].Metrics = deploy.ParseMetrics(result.Stdout)
+		}(i, conn)
+	}
+	wg.Wait()
+	return snapshots
+}
+
+// renderTop writes the dashboard of a server. Containers close to their
+// memory limit are marked, and colored when color is set.
+func renderTop(w io.Writer, snapshot topSnapshot, color bool) {
+	fmt.Fprintf(w, "%s\n", snapshot.Server)
+	if snapshot.Metrics == nil {
+		fmt.Fprintf(w, "  unavailable: %s\n", snapshot.Error)
+		return
+	}
+	metrics := snapshot.Metrics
+
+	fmt.Fprintf(w, "  CPU:    %s\n", formatPercent(metrics.CPUPercent))
+	fmt.Fprintf(w, "  Memory: %s\n", formatUsage(metrics.MemUsed, metrics.MemTotal))
+	fmt.Fprintf(w, "  Disk:   %s\n", formatUsage(metrics.DiskUsed, metrics.DiskTotal))
+	if metrics.Load != "" {
+		fmt.Fprintf(w, "  Load:   %s\n", metrics.Load)
+	}
+
+	if len(metrics.Containers) == 0 {
+		fmt.Fprintln(w, "  No running containers")
+		return
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "  %-28s %7s  %-16s %-15s %s\n", "CONTAINER", "CPU", "MEMORY", "NET RX/TX", "RESTARTS")
+	for _, c := range metrics.Containers {
+		memory := formatSize(c.MemUsed)
+		if c.MemLimit > 0 {
+			memory += "/" + formatSize(c.MemLimit)
+		}
+		line := fmt.Sprintf("  %-28s %7s  %-16s %-15s %d", c.Name, formatPercent(c.CPUPercent), memory, formatSize(c.NetRx)+"/"+formatSize(c.NetTx), c.Restarts)
+		if c.NearMemoryLimit() {
+			line += fmt.Sprintf("  ⚠️  %d%% of memory limit", c.MemUsed*100/c.MemLimit)
+			if color {
+				line = ansiRed + line + ansiReset
+			}
+		}
+		fmt.Fprintln(w, line)
+	}
+}
+
+// formatPercent prints a percentage, "?" when unknown
+func formatPercent(percent float64) string {
+	if percent < 0 {
+		return "?"
+	}
+	return fmt.Sprintf("%.1f%%", percent)
+}
+
+// formatUsage prints used/total with the used share, "?" when unknown
+func formatUsage(used, total int64) string {
+	if total <= 0 {
+		return "?"
+	}
+	return fmt.Sprintf("%s/%s (%d%%)", formatSize(used), formatSize(total), used*100/total)
+}
@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/yoanbernabeu/frankendeploy/internal/deploy"
+)
+
+func TestRenderTop(t *testing.T) {
+	snapshot := topSnapshot{
+		Server: "production",
+		Metrics: &deploy.ServerMetrics{
+			CPUPercent: 42.5,
+			MemUsed:    1 << 30,
+			MemTotal:   2 << 30,
+			DiskTotal:  -1,
+			Load:       "0.52 0.40 0.31",
+			Containers: []deploy.ContainerMetrics{
+				{Name: "caddy", CPUPercent: 0.3, MemUsed: 25 << 20},
+				{Name: "shop", CPUPercent: -1, MemUsed: 470 << 20, MemLimit: 512 << 20, Restarts: 3},
+			},
+		},
+	}
+
+	var out strings.Builder
+	renderTop(&out, snapshot, true)
+	lines := strings.Split(out.String(), "\n")
+
+	for _, want := range []string{"  CPU:    42.5%", "  Memory: 1.0G/2.0G (50%)", "  Disk:   ?", "  Load:   0.52 0.40 0.31"} {
+		if !strings.Contains(out.String(), want+"\n") {
+			t.Errorf("renderTop() missing %q:\n%s", want, out.String())
+		}
+	}
+	for _, line := range lines {
+		switch {
+		case strings.Contains(line, "caddy"):
+			if strings.Contains(line, "memory limit") || strings.Contains(line, ansiRed) {
+				t.Errorf("caddy has no memory limit, got %q", line)
+			}
+		case strings.Contains(line, "shop"):
+			if !strings.HasPrefix(line, ansiRed) || !strings.Contains(line, "470M/512M") || !strings.Contains(line, "91% of memory limit") {
+				t.Errorf("shop should be highlighted, got %q", line)
+			}
+		}
+	}
+}
+
+func TestRenderTopUnavailable(t *testing.T) {
+	var out strings.Builder
+	renderTop(&out, topSnapshot{Server: "staging", Error: "connection reset"}, false)
+	if out.String() != "staging\n  unavailable: connection reset\n" {
+		t.Errorf("renderTop() = %q", out.String())
+	}
+}
@@ -0,0 +1,174 @@
+package cmd
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/yoanbernabeu/frankendeploy/internal/caddy"
+)
+
+var trafficCmd = &cobra.Command{
+	Use:   "traffic <server>",
+	Short: "Show traffic analytics from the Caddy access logs",
+	Long: `Analyzes the Caddy access log of the application over a time window:
+requests per minute, status codes, latency percentiles, and the top
+paths, client IPs and user agents.
+
+Log lines are filtered on the server and compressed before transfer;
+the analysis runs locally.
+
+Example:
+  frankendeploy traffic production
+  frankendeploy traffic production --since 24h --top 20
+  frankendeploy traffic production --since 7d --json`,
+	Args: cobra.ExactArgs(1),
+	RunE: runTraffic,
+}
+
+var (
+	trafficSince string
+	trafficTop   int
+	trafficJSON  bool
+)
+
+func init() {
+	rootCmd.AddCommand(trafficCmd)
+	trafficCmd.Flags().StringVar(&trafficSince, "since", "1h", "Time window (e.g., 30m, 6h, 7d)")
+	trafficCmd.Flags().IntVar(&trafficTop, "top", 10, "Number of entries in top paths, IPs and user agents")
+	trafficCmd.Flags().BoolVar(&trafficJSON, "json", false, "Output the report as JSON")
+}
+
+func runTraffic(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	serverName := args[0]
+
+	window, err := parseTrafficWindow(trafficSince)
+	if err != nil {
+		return err
+	}
+	if trafficTop < 1 {
+		return fmt.Errorf("invalid --top value: must be at least 1")
+	}
+
+	conn, err := ConnectToServer(serverName)
+	if err != nil {
+		return err
+	}
+	defer conn.Client.Close()
+
+	logCmd, err := caddy.AccessLogCommand(conn.Project.Name, window)
+	if err != nil {
+		return err
+	}
+	PrintVerboseCommand(logCmd)
+	result, err := conn.Client.Exec(ctx, logCmd)
+	if err != nil {
+		return fmt.Errorf("failed to read access logs: %w", err)
+	}
+	if err := result.Err(); err != nil {
+		return fmt.Errorf("failed to read access logs (is the caddy container running?): %w", err)
+	}
+
+	gz, err := gzip.NewReader(bytes.NewReader([]byte(result.Stdout)))
+	if err != nil {
+		return fmt.Errorf("failed to decompress access logs: %w", err)
+	}
+	defer gz.Close()
+
+	report, err := caddy.AnalyzeAccessLog(gz, conn.Project.Name, window, trafficTop)
+	if err != nil {
+		return err
+	}
+
+	if trafficJSON {
+		out, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(out))
+		return nil
+	}
+
+	printTrafficReport(report, serverName, trafficSince)
+	return nil
+}
+
+// parseTrafficWindow parses a --since duration. Days ("7d") are accepted on
+// top of Go durations.
+func parseTrafficWindow(since string) (time.Duration, error) {
+	var window time.Duration
+	if days, ok := strings.CutSuffix(since, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, fmt.Errorf("invalid --since value %q: use a duration such as 30m, 6h or 7d", since)
+		}
+		window = time.Duration(n) * 24 * time.Hour
+	} else {
+		d, err := time.ParseDuration(since)
+		if err != nil {
+			return 0, fmt.Errorf("invalid --since value %q: use a duration such as 30m, 6h or 7d", since)
+		}
+		window = d
+	}
+	if window < time.Minute {
+		return 0, fmt.Errorf("invalid --since value %q: the window must be at least 1m", since)
+	}
+	return window, nil
+}
+
+func printTrafficReport(r *caddy.TrafficReport, serverName, since string) {
+	fmt.Printf("Traffic of %s on %s (last %s)\n\n", r.App, serverName, since)
+	if r.Requests == 0 {
+		PrintInfo("No requests in this window")
+		return
+	}
+
+	fmt.Printf("  Requests: %d (%.1f/min, peak %d/min at %s UTC)\n",
+		r.Requests, r.RequestsPerMinute, r.PeakPerMinute.Count, r.PeakPerMinute.Minute.Format("2006-01-02 15:04"))
+	fmt.Printf("  Latency:  p50 %.1fms  p95 %.1fms  p99 %.1fms  max %.1fms\n",
+		r.Latency.P50, r.Latency.P95, r.Latency.P99, r.Latency.Max)
+	fmt.Println()
+
+	fmt.Println("Status codes:")
+	classes := make([]string, 0, len(r.StatusClasses))
+	for class := range r.StatusClasses {
+		classes = append(classes, class)
+	}
+	sort.Strings(classes)
+	codes := make([]string, 0, len(r.StatusCodes))
+	for code := range r.StatusCodes {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	for _, class := range classes {
+		fmt.Printf("  %s  %8d  %5.1f%%\n", class, r.StatusClasses[class], 100*float64(r.StatusClasses[class])/float64(r.Requests))
+		for _, code := range codes {
+			if code[0] == class[0] {
+				fmt.Printf("    %s %8d\n", code, r.StatusCodes[code])
+			}
+		}
+	}
+
+	printTopCounts("Top paths", r.TopPaths)
+	printTopCounts("Top client IPs", r.TopClientIPs)
+	printTopCounts("Top user agents", r.TopUserAgents)
+}
+
+func printTopCounts(title string, counts []caddy.Count) {
+	fmt.Println()
+	fmt.Printf("%s:\n", title)
+	for _, c := range counts {
+		value := c.Value
+		if len(value) > 80 {
+			value = value[:77] + "..."
+		}
+		fmt.Printf("  %8d  %s\n", c.Count, value)
+	}
+}
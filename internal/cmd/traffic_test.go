@@ -0,0 +1,32 @@
+package cmd
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseTrafficWindow(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"1h", time.Hour, false},
+		{"30m", 30 * time.Minute, false},
+		{"7d", 7 * 24 * time.Hour, false},
+		{"10s", 0, true},
+		{"xd", 0, true},
+		{"yesterday", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := parseTrafficWindow(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseTrafficWindow(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseTrafficWindow(%q) = %v, want %v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
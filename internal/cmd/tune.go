@@ -0,0 +1,160 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/yoanbernabeu/frankendeploy/internal/provision"
+	"github.com/yoanbernabeu/frankendeploy/internal/ssh"
+)
+
+var serverTuneCmd = &cobra.Command{
+	Use:   "tune <name>",
+	Short: "Add swap and tune the kernel and Docker for small servers",
+	Long: `Prepares a small VPS for memory peaks and busy apps:
+- Creates a swap file (/swapfile, 2G by default, persisted in /etc/fstab)
+- Sets vm.swappiness and raises the fs.inotify and net.core.somaxconn
+  limits (/etc/sysctl.d/99-frankendeploy.conf)
+- Adds log rotation and live-restore defaults to /etc/docker/daemon.json,
+  keeping its other settings (the previous file is saved as daemon.json.bak)
+
+Every step is idempotent: running tune again only changes what differs.
+Docker is restarted only when daemon.json changes, with live-restore
+enabled first so the running containers are kept. 'server status' reports
+the current settings.
+
+Example:
+  frankendeploy server tune production
+  frankendeploy server tune production --swap 4G --swappiness 20
+  frankendeploy server tune production --swap 0`,
+	Args: cobra.ExactArgs(1),
+	RunE: runServerTune,
+}
+
+var (
+	tuneSwap       string
+	tuneSwappiness int
+)
+
+func init() {
+	serverCmd.AddCommand(serverTuneCmd)
+
+	serverTuneCmd.Flags().StringVar(&tuneSwap, "swap", provision.DefaultSwapSize, "Swap file size, like 512M or 2G (0 leaves swap untouched)")
+	serverTuneCmd.Flags().IntVar(&tuneSwappiness, "swappiness", provision.DefaultSwappiness, "vm.swappiness, from 0 to 100")
+}
+
+func runServerTune(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	name := args[0]
+
+	swapSize, err := provision.ParseSwapSize(tuneSwap)
+	if err != nil {
+		return err
+	}
+	if tuneSwappiness < 0 || tuneSwappiness > 100 {
+		return fmt.Errorf("invalid swappiness %d: must be between 0 and 100", tuneSwappiness)
+	}
+
+	conn, err := ConnectToServerNoProject(name)
+	if err != nil {
+		return err
+	}
+	defer conn.Client.Close()
+
+	provisioner, distro, err := detectProvisioner(ctx, conn.Client)
+	if err != nil {
+		return err
+	}
+	PrintInfo("Detected %s (%s)", distro.PrettyName, provisioner.Name())
+
+	if err := tuneServer(ctx, conn.Client, provisioner, swapSize, tuneSwappiness); err != nil {
+		return err
+	}
+	PrintSuccess("Server '%s' tuned", name)
+	return nil
+}
+
+// tuneServer creates the swap file (unless swapSize is 0), applies the
+// kernel settings and merges the Docker daemon defaults. Docker only
+// restarts when daemon.json changes.
+func tuneServer(ctx context.Context, client ssh.Executor, p provision.Provisioner, swapSize int64, swappiness int) error {
+	if swapSize > 0 {
+		PrintInfo("Configuring %s swap file...", formatSwapSize(swapSize))
+		if err := runCommandsStrict(ctx, client, provision.SwapCommands(p, swapSize)); err != nil {
+			return fmt.Errorf("failed to configure swap: %w", err)
+		}
+	}
+
+	PrintInfo("Applying kernel settings...")
+	if err := runCommandsStrict(ctx, client, provision.SysctlCommands(swappiness)); err != nil {
+		return fmt.Errorf("failed to apply kernel settings: %w", err)
+	}
+
+	result, err := client.Exec(ctx, provision.DaemonJSONReadCommand)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", provision.DockerDaemonFile, err)
+	}
+	merged, changed, err := provision.MergeDaemonJSON(result.Stdout)
+	if err != nil {
+		return err
+	}
+	if !changed {
+		PrintInfo("Docker daemon defaults already set")
+		return nil
+	}
+	PrintInfo("Setting Docker daemon defaults and restarting Docker...")
+	if err := runCommandsStrict(ctx, client, provision.DaemonJSONCommands(p, merged)); err != nil {
+		return fmt.Errorf("failed to configure the Docker daemon: %w", err)
+	}
+	return nil
+}
+
+// formatSwapSize prints a swap size in bytes as ParseSwapSize reads it
+func formatSwapSize(size int64) string {
+	if size%(1<<30) == 0 {
+		return fmt.Sprintf("%dG", size>>30)
+	}
+	return fmt.Sprintf("%dM", size>>20)
+}
+
+// printTuneStatus prints the settings of server tune, for server status
+func printTuneStatus(name string, status provision.TuneStatus) {
+	fmt.Println("Tuning:")
+	switch {
+	case status.SwapTotal == 0:
+		fmt.Println("  Swap:       none")
+	case status.SwapFile > 0:
+		fmt.Printf("  Swap:       %s (%s)\n", formatSize(status.SwapTotal), provision.SwapFile)
+	default:
+		fmt.Printf("  Swap:       %s\n", formatSize(status.SwapTotal))
+	}
+	fmt.Printf("  Swappiness: %d\n", status.Swappiness)
+	fmt.Printf("  inotify:    %d watches, %d instances\n", status.InotifyWatches, status.InotifyInstances)
+	fmt.Printf("  somaxconn:  %d\n", status.Somaxconn)
+
+	driver := status.LogDriver
+	if driver == "" {
+		driver = "json-file"
+	}
+	logs := driver + " logs"
+	if driver == "json-file" || driver == "local" {
+		logs += " unbounded"
+	}
+	if status.LogMaxSize != "" {
+		logs = fmt.Sprintf("%s logs %s", driver, status.LogMaxSize)
+		if status.LogMaxFile != "" {
+			logs += " x " + status.LogMaxFile
+		}
+	}
+	liveRestore := "off"
+	if status.LiveRestore {
+		liveRestore = "on"
+	}
+	fmt.Printf("  Docker:     %s, live-restore %s\n", logs, liveRestore)
+
+	if pending := status.Pending(); len(pending) > 0 {
+		PrintWarning("Not tuned: %s (run 'frankendeploy server tune %s')", strings.Join(pending, ", "), name)
+	}
+}
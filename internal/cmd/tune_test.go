@@ -0,0 +1,58 @@
+package cmd
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/yoanbernabeu/frankendeploy/internal/provision"
+	"github.com/yoanbernabeu/frankendeploy/internal/ssh"
+)
+
+// tuneExecutor answers the daemon.json read with daemonJSON
+func tuneExecutor(daemonJSON string) *ssh.MockExecutor {
+	return &ssh.MockExecutor{
+		ExecFunc: func(ctx context.Context, command string) (*ssh.ExecResult, error) {
+			if command == provision.DaemonJSONReadCommand {
+				return &ssh.ExecResult{Stdout: daemonJSON}, nil
+			}
+			return &ssh.ExecResult{}, nil
+		},
+	}
+}
+
+func TestTuneServer_FirstRun(t *testing.T) {
+	mock := tuneExecutor("")
+	if err := tuneServer(context.Background(), mock, provision.Debian{}, 1<<30, 10); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	all := strings.Join(mock.Commands, "\n")
+	for _, want := range []string{"sudo swapon /swapfile", provision.SysctlFile, "sudo tee " + provision.DockerDaemonFile, "sudo systemctl restart docker"} {
+		if !strings.Contains(all, want) {
+			t.Errorf("expected %q in:\n%s", want, all)
+		}
+	}
+}
+
+func TestTuneServer_AlreadyTuned(t *testing.T) {
+	merged, _, _ := provision.MergeDaemonJSON("")
+	mock := tuneExecutor(merged)
+	if err := tuneServer(context.Background(), mock, provision.Debian{}, 0, 10); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	all := strings.Join(mock.Commands, "\n")
+	if strings.Contains(all, provision.SwapFile) {
+		t.Errorf("--swap 0 must leave swap untouched:\n%s", all)
+	}
+	if strings.Contains(all, "restart docker") || strings.Contains(all, "sudo tee "+provision.DockerDaemonFile) {
+		t.Errorf("Docker must not restart when daemon.json is unchanged:\n%s", all)
+	}
+}
+
+func TestTuneServer_InvalidDaemonJSON(t *testing.T) {
+	mock := tuneExecutor("{broken")
+	err := tuneServer(context.Background(), mock, provision.Debian{}, 0, 10)
+	if err == nil || !strings.Contains(err.Error(), "fix it by hand") {
+		t.Fatalf("expected an invalid daemon.json error, got %v", err)
+	}
+}
@@ -0,0 +1,250 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/yoanbernabeu/frankendeploy/internal/caddy"
+	"github.com/yoanbernabeu/frankendeploy/internal/config"
+	"github.com/yoanbernabeu/frankendeploy/internal/ssh"
+)
+
+var serverUpdateCmd = &cobra.Command{
+	Use:   "update <name>",
+	Short: "Upgrade Caddy, and optionally Docker, on a server",
+	Long: `Upgrades the Caddy reverse proxy of a server:
+- Pulls the latest ` + caddy.Image + ` image
+- Validates the main config and every app config with the new binary
+- Recreates the caddy container with the new image, keeping its volumes
+  (certificates, config) and mounts
+
+The replaced image is kept as ` + caddy.PreviousImage + `. If the new
+binary rejects the config, or the new container does not start, the
+previous image is put back. --rollback switches back to the previous image
+(running it twice toggles between both).
+
+With --docker, the Docker engine packages are upgraded first. The daemon
+restarts: containers restart with it unless live-restore is enabled
+('server tune').
+
+Example:
+  frankendeploy server update production
+  frankendeploy server update production --docker
+  frankendeploy server update production --rollback`,
+	Args: cobra.ExactArgs(1),
+	RunE: runServerUpdate,
+}
+
+var (
+	updateDocker   bool
+	updateRollback bool
+)
+
+// imageID matches the ID of a local Docker image. IDs are read back from
+// the server before being interpolated in commands.
+var imageID = regexp.MustCompile(`^sha256:[0-9a-f]{64}$`)
+
+func init() {
+	serverCmd.AddCommand(serverUpdateCmd)
+
+	serverUpdateCmd.Flags().BoolVar(&updateDocker, "docker", false, "Also upgrade the Docker engine packages")
+	serverUpdateCmd.Flags().BoolVar(&updateRollback, "rollback", false, "Switch Caddy back to the image replaced by the last update")
+}
+
+// caddyChange is what an update or rollback of Caddy changed
+type caddyChange struct {
+	OldVersion string
+	NewVersion string
+	// Changed is false when the running image was already the latest
+	Changed bool
+}
+
+func runServerUpdate(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	name := args[0]
+
+	if updateRollback && updateDocker {
+		return fmt.Errorf("--rollback and --docker cannot be combined")
+	}
+
+	conn, err := ConnectToServerNoProject(name)
+	if err != nil {
+		return err
+	}
+	defer conn.Client.Close()
+	client := conn.Client
+	apiMode := conn.Server.CaddyMode == config.CaddyModeAPI
+
+	if updateRollback {
+		PrintInfo("Switching Caddy back to %s...", caddy.PreviousImage)
+		change, err := rollbackCaddy(ctx, client, apiMode)
+		if err != nil {
+			return err
+		}
+		PrintSuccess("Caddy rolled back: %s → %s", change.OldVersion, change.NewVersion)
+		return nil
+	}
+
+	var dockerBefore, dockerAfter string
+	if updateDocker {
+		provisioner, distro, err := detectProvisioner(ctx, client)
+		if err != nil {
+			return err
+		}
+		PrintInfo("Upgrading Docker on %s...", distro.PrettyName)
+		dockerBefore = remoteOutput(ctx, client, dockerVersionCommand)
+		if err := runCommandsStrict(ctx, client, provisioner.DockerUpgradeCommands()); err != nil {
+			return fmt.Errorf("failed to upgrade Docker: %w", err)
+		}
+		dockerAfter = remoteOutput(ctx, client, dockerVersionCommand)
+	}
+
+	PrintInfo("Updating Caddy...")
+	change, err := updateCaddy(ctx, client, apiMode)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println()
+	fmt.Println("Summary:")
+	if change.Changed {
+		fmt.Printf("  Caddy:  %s → %s (previous image kept as %s)\n", change.OldVersion, change.NewVersion, caddy.PreviousImage)
+	} else {
+		fmt.Printf("  Caddy:  %s (already up to date)\n", change.OldVersion)
+	}
+	if updateDocker {
+		if dockerBefore == dockerAfter {
+			fmt.Printf("  Docker: %s (already up to date)\n", dockerBefore)
+		} else {
+			fmt.Printf("  Docker: %s → %s\n", dockerBefore, dockerAfter)
+		}
+	}
+	return nil
+}
+
+// dockerVersionCommand prints the version of the Docker daemon
+const dockerVersionCommand = "docker version --format '{{.Server.Version}}'"
+
+// updateCaddy pulls the latest Caddy image and, when it differs from the
+// running one, switches the caddy container to it with replaceCaddyImage
+func updateCaddy(ctx context.Context, client ssh.Executor, apiMode bool) (*caddyChange, error) {
+	current, err := readImageID(ctx, client, "docker inspect --format '{{.Image}}' caddy")
+	if err != nil {
+		return nil, fmt.Errorf("cannot read the caddy container (run 'frankendeploy server setup'): %w", err)
+	}
+	change := &caddyChange{OldVersion: caddyVersion(ctx, client)}
+
+	if err := runCommandsStrict(ctx, client, []string{"docker pull -q " + caddy.Image}); err != nil {
+		return nil, fmt.Errorf("failed to pull %s: %w", caddy.Image, err)
+	}
+	latest, err := readImageID(ctx, client, "docker image inspect --format '{{.Id}}' "+caddy.Image)
+	if err != nil {
+		return nil, err
+	}
+	if latest == current {
+		change.NewVersion = change.OldVersion
+		return change, nil
+	}
+
+	if err := replaceCaddyImage(ctx, client, apiMode, current, latest); err != nil {
+		return nil, err
+	}
+	change.NewVersion = caddyVersion(ctx, client)
+	change.Changed = true
+	return change, nil
+}
+
+// rollbackCaddy switches the caddy container back to the image kept by the
+// last update. The image replaced becomes the previous one.
+func rollbackCaddy(ctx context.Context, client ssh.Executor, apiMode bool) (*caddyChange, error) {
+	previous, err := readImageID(ctx, client, "docker image inspect --format '{{.Id}}' "+caddy.PreviousImage)
+	if err != nil {
+		return nil, fmt.Errorf("no previous Caddy image: %s is created by 'server update'", caddy.PreviousImage)
+	}
+	current, err := readImageID(ctx, client, "docker inspect --format '{{.Image}}' caddy")
+	if err != nil {
+		return nil, fmt.Errorf("cannot read the caddy container (run 'frankendeploy server setup'): %w", err)
+	}
+	if previous == current {
+		return nil, fmt.Errorf("caddy already runs %s", caddy.PreviousImage)
+	}
+	change := &caddyChange{OldVersion: caddyVersion(ctx, client)}
+	if err := replaceCaddyImage(ctx, client, apiMode, current, previous); err != nil {
+		return nil, err
+	}
+	change.NewVersion = caddyVersion(ctx, client)
+	change.Changed = true
+	return change, nil
+}
+
+// replaceCaddyImage switches the caddy container from the image current to
+// target, never leaving Caddy down with a config it rejects:
+//  1. the live config is validated by the Caddy binary of target
+//  2. current is tagged caddy.PreviousImage, target caddy.Image
+//  3. the container is recreated from caddy.Image, with the same volumes
+//  4. if it does not stay running, current is tagged caddy.Image again and
+//     the container recreated from it
+//
+// On failure, caddy.Image points to current again.
+func replaceCaddyImage(ctx context.Context, client ssh.Executor, apiMode bool, current, target string) error {
+	restoreTag := "docker tag " + current + " " + caddy.Image
+
+	PrintInfo("Validating the Caddy config with the replacement binary...")
+	if err := runCommandsStrict(ctx, client, []string{caddy.ValidateImageCommand(target, apiMode)}); err != nil {
+		_ = runCommandsStrict(ctx, client, []string{restoreTag})
+		return fmt.Errorf("the new Caddy binary rejects the current config, caddy left unchanged: %w", err)
+	}
+
+	PrintInfo("Recreating the caddy container...")
+	err := runCommandsStrict(ctx, client, []string{
+		"docker tag " + current + " " + caddy.PreviousImage,
+		"docker tag " + target + " " + caddy.Image,
+		caddy.ContainerRunCommand(apiMode),
+		"sleep 3 && docker inspect --format '{{.State.Running}}' caddy | grep -qx true",
+	})
+	if err == nil {
+		return nil
+	}
+
+	PrintWarning("The new caddy container failed: %v", err)
+	if restoreErr := runCommandsStrict(ctx, client, []string{restoreTag, caddy.ContainerRunCommand(apiMode)}); restoreErr != nil {
+		return fmt.Errorf("caddy failed with the new image and could not be restarted with the previous one: %w", restoreErr)
+	}
+	return fmt.Errorf("caddy failed with the new image, previous image restored: %w", err)
+}
+
+// readImageID runs a command printing an image ID and checks the ID
+func readImageID(ctx context.Context, client ssh.Executor, command string) (string, error) {
+	result, err := client.Exec(ctx, command)
+	if err != nil {
+		return "", err
+	}
+	if err := result.Err(); err != nil {
+		return "", err
+	}
+	id := strings.TrimSpace(result.Stdout)
+	if !imageID.MatchString(id) {
+		return "", fmt.Errorf("unexpected image ID %q", id)
+	}
+	return id, nil
+}
+
+// caddyVersion returns the version of the running Caddy binary ("v2.8.4"),
+// "unknown" when it cannot be read
+func caddyVersion(ctx context.Context, client ssh.Executor) string {
+	version, _, _ := strings.Cut(remoteOutput(ctx, client, caddy.VersionCommand), " ")
+	return version
+}
+
+// remoteOutput returns the trimmed output of a command, "unknown" when it
+// fails
+func remoteOutput(ctx context.Context, client ssh.Executor, command string) string {
+	result, err := client.Exec(ctx, command)
+	if err != nil || result.ExitCode != 0 || strings.TrimSpace(result.Stdout) == "" {
+		return "unknown"
+	}
+	return strings.TrimSpace(result.Stdout)
+}
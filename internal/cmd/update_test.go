@@ -0,0 +1,158 @@
+package cmd
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/yoanbernabeu/frankendeploy/internal/caddy"
+	"github.com/yoanbernabeu/frankendeploy/internal/ssh"
+)
+
+var (
+	oldCaddyID = "sha256:" + strings.Repeat("a", 64)
+	newCaddyID = "sha256:" + strings.Repeat("b", 64)
+)
+
+// caddyServer simulates the Docker commands of a Caddy update
+type caddyServer struct {
+	running string
+	latest  string
+	// failOn makes the first command containing it exit 1
+	failOn string
+}
+
+func (s *caddyServer) executor() *ssh.MockExecutor {
+	return &ssh.MockExecutor{
+		ExecFunc: func(ctx context.Context, command string) (*ssh.ExecResult, error) {
+			if s.failOn != "" && strings.Contains(command, s.failOn) {
+				s.failOn = ""
+				return &ssh.ExecResult{ExitCode: 1, Stderr: "rejected"}, nil
+			}
+			switch {
+			case strings.HasPrefix(command, "docker inspect --format '{{.Image}}' caddy"):
+				return &ssh.ExecResult{Stdout: s.running + "\n"}, nil
+			case strings.HasPrefix(command, "docker image inspect --format '{{.Id}}' "+caddy.Image):
+				return &ssh.ExecResult{Stdout: s.latest + "\n"}, nil
+			case command == caddy.VersionCommand:
+				version := "v2.8.4 h1:abc"
+				if s.running == newCaddyID {
+					version = "v2.9.1 h1:def"
+				}
+				return &ssh.ExecResult{Stdout: version + "\n"}, nil
+			case strings.Contains(command, "docker run -d --name caddy"):
+				s.running = s.latest
+			case strings.HasPrefix(command, "docker tag "):
+				if fields := strings.Fields(command); fields[3] == caddy.Image {
+					s.latest = fields[2]
+				}
+			}
+			return &ssh.ExecResult{}, nil
+		},
+	}
+}
+
+func TestUpdateCaddy(t *testing.T) {
+	server := &caddyServer{running: oldCaddyID, latest: newCaddyID}
+	mock := server.executor()
+
+	change, err := updateCaddy(context.Background(), mock, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !change.Changed || change.OldVersion != "v2.8.4" || change.NewVersion != "v2.9.1" {
+		t.Errorf("change = %+v", change)
+	}
+	keep, validate, recreate := -1, -1, -1
+	for i, command := range mock.Commands {
+		switch {
+		case command == "docker tag "+oldCaddyID+" "+caddy.PreviousImage:
+			keep = i
+		case strings.Contains(command, "caddy validate") && strings.Contains(command, newCaddyID):
+			validate = i
+		case strings.Contains(command, "docker run -d --name caddy"):
+			recreate = i
+		}
+	}
+	if validate < 0 || keep < validate || recreate < keep {
+		t.Errorf("expected validate, keep previous image, recreate in order:\n%s", strings.Join(mock.Commands, "\n"))
+	}
+}
+
+func TestUpdateCaddy_UpToDate(t *testing.T) {
+	server := &caddyServer{running: oldCaddyID, latest: oldCaddyID}
+	mock := server.executor()
+
+	change, err := updateCaddy(context.Background(), mock, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if change.Changed {
+		t.Errorf("change = %+v, want unchanged", change)
+	}
+	for _, command := range mock.Commands {
+		if strings.Contains(command, "docker run") || strings.HasPrefix(command, "docker tag") {
+			t.Errorf("nothing should change when up to date, ran %q", command)
+		}
+	}
+}
+
+func TestUpdateCaddy_ConfigRejected(t *testing.T) {
+	server := &caddyServer{running: oldCaddyID, latest: newCaddyID, failOn: "caddy validate"}
+	mock := server.executor()
+
+	if _, err := updateCaddy(context.Background(), mock, true); err == nil || !strings.Contains(err.Error(), "left unchanged") {
+		t.Fatalf("expected the config to be rejected, got %v", err)
+	}
+	if server.running != oldCaddyID || server.latest != oldCaddyID {
+		t.Errorf("caddy should run and be tagged the old image, running %s, tagged %s", server.running, server.latest)
+	}
+	for _, command := range mock.Commands {
+		if strings.Contains(command, "docker run -d") {
+			t.Errorf("caddy must not be recreated, ran %q", command)
+		}
+	}
+}
+
+func TestUpdateCaddy_NewContainerFails(t *testing.T) {
+	server := &caddyServer{running: oldCaddyID, latest: newCaddyID, failOn: "{{.State.Running}}"}
+	mock := server.executor()
+
+	if _, err := updateCaddy(context.Background(), mock, false); err == nil || !strings.Contains(err.Error(), "previous image restored") {
+		t.Fatalf("expected the previous image to be restored, got %v", err)
+	}
+	if server.running != oldCaddyID {
+		t.Errorf("caddy should run the old image again, runs %s", server.running)
+	}
+}
+
+func TestRollbackCaddy(t *testing.T) {
+	server := &caddyServer{running: newCaddyID, latest: newCaddyID}
+	mock := server.executor()
+	mock.ExecFunc = func(next func(context.Context, string) (*ssh.ExecResult, error)) func(context.Context, string) (*ssh.ExecResult, error) {
+		return func(ctx context.Context, command string) (*ssh.ExecResult, error) {
+			if strings.HasPrefix(command, "docker image inspect --format '{{.Id}}' "+caddy.PreviousImage) {
+				return &ssh.ExecResult{Stdout: oldCaddyID}, nil
+			}
+			return next(ctx, command)
+		}
+	}(mock.ExecFunc)
+
+	change, err := rollbackCaddy(context.Background(), mock, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if server.running != oldCaddyID || change.OldVersion != "v2.9.1" || change.NewVersion != "v2.8.4" {
+		t.Errorf("running %s, change = %+v", server.running, change)
+	}
+	if !strings.Contains(strings.Join(mock.Commands, "\n"), "docker tag "+newCaddyID+" "+caddy.PreviousImage) {
+		t.Error("the replaced image should become the previous one")
+	}
+}
+
+func TestRollbackCaddy_NoPreviousImage(t *testing.T) {
+	server := &caddyServer{running: newCaddyID, latest: newCaddyID, failOn: caddy.PreviousImage}
+	if _, err := rollbackCaddy(context.Background(), server.executor(), false); err == nil || !strings.Contains(err.Error(), "no previous Caddy image") {
+		t.Errorf("expected a missing previous image error, got %v", err)
+	}
+}
@@ -0,0 +1,62 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// String formats a jump host like OpenSSH's ProxyJump: [user@]host[:port]
+func (j JumpHost) String() string {
+	s := j.Host
+	if strings.Contains(s, ":") {
+		s = "[" + s + "]"
+	}
+	if j.User != "" {
+		s = j.User + "@" + s
+	}
+	if j.Port != 0 {
+		s += ":" + strconv.Itoa(j.Port)
+	}
+	return s
+}
+
+// ParseProxyJump parses an OpenSSH ProxyJump value: comma-separated
+// [user@]host[:port] hops, IPv6 hosts in brackets. "none" means no hop.
+func ParseProxyJump(spec string) ([]JumpHost, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" || spec == "none" {
+		return nil, nil
+	}
+	var hops []JumpHost
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(part), "ssh://"))
+		var hop JumpHost
+		if at := strings.LastIndex(part, "@"); at >= 0 {
+			hop.User, part = part[:at], part[at+1:]
+		}
+		host, port := part, ""
+		if strings.HasPrefix(part, "[") {
+			end := strings.Index(part, "]")
+			if end < 0 {
+				return nil, fmt.Errorf("invalid jump host %q: unclosed bracket", part)
+			}
+			host, port = part[1:end], strings.TrimPrefix(part[end+1:], ":")
+		} else if i := strings.LastIndex(part, ":"); i >= 0 && strings.Count(part, ":") == 1 {
+			host, port = part[:i], part[i+1:]
+		}
+		if host == "" {
+			return nil, fmt.Errorf("invalid jump host %q: missing host", part)
+		}
+		hop.Host = host
+		if port != "" {
+			n, err := strconv.Atoi(port)
+			if err != nil || n < 1 || n > 65535 {
+				return nil, fmt.Errorf("invalid jump host port %q", port)
+			}
+			hop.Port = n
+		}
+		hops = append(hops, hop)
+	}
+	return hops, nil
+}
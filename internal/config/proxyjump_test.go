@@ -0,0 +1,52 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseProxyJump(t *testing.T) {
+	tests := []struct {
+		spec string
+		want []JumpHost
+	}{
+		{"", nil},
+		{"none", nil},
+		{"bastion.example.com", []JumpHost{{Host: "bastion.example.com"}}},
+		{"ops@bastion:2222", []JumpHost{{Host: "bastion", User: "ops", Port: 2222}}},
+		{"ops@bastion, deploy@10.0.0.2:22", []JumpHost{{Host: "bastion", User: "ops"}, {Host: "10.0.0.2", User: "deploy", Port: 22}}},
+		{"ssh://ops@[2001:db8::1]:2222", []JumpHost{{Host: "2001:db8::1", User: "ops", Port: 2222}}},
+		{"2001:db8::1", []JumpHost{{Host: "2001:db8::1"}}},
+	}
+	for _, tt := range tests {
+		got, err := ParseProxyJump(tt.spec)
+		if err != nil {
+			t.Errorf("ParseProxyJump(%q) error: %v", tt.spec, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseProxyJump(%q) = %+v, want %+v", tt.spec, got, tt.want)
+		}
+	}
+}
+
+func TestParseProxyJump_Invalid(t *testing.T) {
+	for _, spec := range []string{"ops@", "bastion:0", "bastion:ssh", "[2001:db8::1", "a,,b"} {
+		if _, err := ParseProxyJump(spec); err == nil {
+			t.Errorf("ParseProxyJump(%q) should fail", spec)
+		}
+	}
+}
+
+func TestJumpHostString(t *testing.T) {
+	tests := map[string]JumpHost{
+		"bastion":                {Host: "bastion"},
+		"ops@bastion:2222":       {Host: "bastion", User: "ops", Port: 2222},
+		"ops@[2001:db8::1]:2222": {Host: "2001:db8::1", User: "ops", Port: 2222},
+	}
+	for want, hop := range tests {
+		if got := hop.String(); got != want {
+			t.Errorf("%+v.String() = %q, want %q", hop, got, want)
+		}
+	}
+}
@@ -69,6 +69,35 @@ type MailerConfig struct {
 type DockerfileConfig struct {
 	ExtraPackages []string `yaml:"extra_packages,omitempty"`
 	ExtraCommands []string `yaml:"extra_commands,omitempty"`
+	// BuildArgs are passed to docker build with --build-arg and declared as
+	// ARG in the build stages. They end up in the image history: secrets
+	// belong in Secrets.
+	BuildArgs map[string]string `yaml:"build_args,omitempty"`
+	// Secrets are passed to docker build with --secret and mounted in the
+	// RUN steps using them only, never stored in a layer
+	Secrets []BuildSecret `yaml:"secrets,omitempty"`
+	// CacheDir is a local directory local builds import their cache from
+	// and export it to (--cache-from/--cache-to type=local). It needs a
+	// buildx builder with cache export (docker-container driver).
+	CacheDir string `yaml:"cache_dir,omitempty"`
+}
+
+// Build secrets the generated Dockerfile mounts
+const (
+	// SecretComposerAuth is the auth.json content of composer install
+	// (private Packagist, GitHub tokens), mounted as COMPOSER_AUTH
+	SecretComposerAuth = "composer_auth"
+	// SecretNpmrc is the .npmrc of npm ci (registry tokens)
+	SecretNpmrc = "npmrc"
+)
+
+// BuildSecret is a build secret read from a local file or a local
+// environment variable. Other ids than the ones of the generated
+// Dockerfile can be mounted by extra commands (RUN --mount=type=secret).
+type BuildSecret struct {
+	ID   string `yaml:"id"`
+	File string `yaml:"file,omitempty"`
+	Env  string `yaml:"env,omitempty"`
 }
 
 // DeployConfig holds deployment configuration
@@ -92,6 +121,97 @@ type DeployConfig struct {
 	// CPULimit caps the app container CPUs (e.g. "0.5", "2"). Empty means
 	// no limit.
 	CPULimit string `yaml:"cpu_limit,omitempty"`
+	// Caddy holds per-app reverse proxy directives (headers, filters, auth)
+	Caddy CaddyConfig `yaml:"caddy,omitempty"`
+	// Protect puts the whole app behind basic auth (e.g. staging)
+	Protect *ProtectConfig `yaml:"protect,omitempty"`
+	// TLS selects how the certificate of the domain is obtained
+	TLS TLSConfig `yaml:"tls,omitempty"`
+}
+
+// TLS modes of an app
+const (
+	// TLSModeACME obtains a public certificate automatically (default)
+	TLSModeACME = "acme"
+	// TLSModeCustom serves a user-supplied certificate and key
+	TLSModeCustom = "custom"
+	// TLSModeInternal issues a certificate from Caddy's internal CA, for
+	// private hosts that public CAs cannot reach
+	TLSModeInternal = "internal"
+	// TLSModeOnDemand serves any domain pointed at the server, obtaining
+	// its certificate at the first TLS handshake once the app's ask
+	// endpoint approves it (customer domains of a SaaS)
+	TLSModeOnDemand = "on_demand"
+)
+
+// TLSConfig holds the TLS options of an app. CertFile and KeyFile are local
+// PEM files (relative to the project), uploaded at deploy in custom mode.
+type TLSConfig struct {
+	Mode     string `yaml:"mode,omitempty"`
+	CertFile string `yaml:"cert_file,omitempty"`
+	KeyFile  string `yaml:"key_file,omitempty"`
+	// Ask is the path of the app endpoint approving on-demand certificates.
+	// It receives ?domain=<name> and must answer 200 to allow issuance.
+	Ask string `yaml:"ask,omitempty"`
+}
+
+// EffectiveMode returns the configured TLS mode, ACME when unset
+func (t *TLSConfig) EffectiveMode() string {
+	if t.Mode == "" {
+		return TLSModeACME
+	}
+	return t.Mode
+}
+
+// ProtectConfig puts an app behind HTTP basic authentication.
+// Passwords may be plaintext or bcrypt hashes: plaintext is hashed locally
+// before rendering, so it never reaches the server. Users added with
+// `frankendeploy access add` are stored on the server and merged in.
+type ProtectConfig struct {
+	Users map[string]string `yaml:"users,omitempty"`
+	// Exempt lists extra path matchers reachable without credentials
+	// (e.g. /webhooks/*). The healthcheck path is always exempt.
+	Exempt []string `yaml:"exempt,omitempty"`
+}
+
+// CaddyConfig holds per-app directives rendered into the app's Caddy site
+// block. Every value flows into a Caddyfile, so all fields are validated
+// before generation.
+// There is no rate limit: rate_limit is a third-party module missing from
+// the stock Caddy image.
+type CaddyConfig struct {
+	HSTS *HSTSConfig `yaml:"hsts,omitempty"`
+	// CSP is the Content-Security-Policy header value
+	CSP string `yaml:"csp,omitempty"`
+	// Headers are extra response headers. They override the default
+	// security headers of the same name.
+	Headers map[string]string `yaml:"headers,omitempty"`
+	// CacheControl maps a path matcher (e.g. /build/*) to a Cache-Control value
+	CacheControl map[string]string `yaml:"cache_control,omitempty"`
+	// MaxBodySize limits the request body size (e.g. 10MB, 1GiB)
+	MaxBodySize string `yaml:"max_body_size,omitempty"`
+	// IPAllow restricts access to these IPs/CIDR ranges (403 otherwise)
+	IPAllow []string `yaml:"ip_allow,omitempty"`
+	// IPDeny rejects requests from these IPs/CIDR ranges with a 403
+	IPDeny    []string        `yaml:"ip_deny,omitempty"`
+	BasicAuth []BasicAuthRule `yaml:"basic_auth,omitempty"`
+	// Raw is a Caddyfile snippet appended to the site block as-is. It is
+	// validated by the Caddy binary on the server before any reload.
+	Raw string `yaml:"raw,omitempty"`
+}
+
+// HSTSConfig configures the Strict-Transport-Security header
+type HSTSConfig struct {
+	MaxAge            int  `yaml:"max_age"`
+	IncludeSubdomains bool `yaml:"include_subdomains,omitempty"`
+	Preload           bool `yaml:"preload,omitempty"`
+}
+
+// BasicAuthRule protects a path with HTTP basic authentication.
+// Users map a username to a bcrypt hash (see `caddy hash-password`).
+type BasicAuthRule struct {
+	Path  string            `yaml:"path"`
+	Users map[string]string `yaml:"users"`
 }
 
 // Hooks holds deployment hook commands
@@ -146,6 +266,46 @@ type ServerConfig struct {
 	KeyPath     string            `yaml:"key_path,omitempty"`
 	Apps        map[string]string `yaml:"apps,omitempty"`
 	RemoteBuild *bool             `yaml:"remote_build,omitempty"`
+	// CaddyMode is how app routes reach Caddy: "caddyfile" (default) or
+	// "api". Set by `server setup --caddy-mode`.
+	CaddyMode string `yaml:"caddy_mode,omitempty"`
+	// ProxyJump lists the bastions SSH connections are tunnelled through,
+	// first hop first
+	ProxyJump []JumpHost `yaml:"proxy_jump,omitempty"`
+	// HostKeys pins the host keys of the server ("<key type> SHA256:<...>"),
+	// recorded by `server add` and `server rekey`. When set, they are
+	// trusted instead of known_hosts.
+	HostKeys []string `yaml:"host_keys,omitempty"`
+	// ForwardAgent forwards the local ssh-agent to remote builds, for
+	// private Git dependencies (RUN --mount=type=ssh)
+	ForwardAgent bool `yaml:"forward_agent,omitempty"`
+	// RemoteBuilder builds images with the server's Docker daemon as
+	// buildx builder, reached through the SSH connection: the build context
+	// streams from the local machine and the image stays on the server
+	RemoteBuilder bool `yaml:"remote_builder,omitempty"`
+}
+
+// JumpHost is a bastion of a server. Empty fields default to the user and
+// key of the server, and port 22.
+type JumpHost struct {
+	Host    string `yaml:"host"`
+	User    string `yaml:"user,omitempty"`
+	Port    int    `yaml:"port,omitempty"`
+	KeyPath string `yaml:"key_path,omitempty"`
+}
+
+// Caddy modes of a server
+const (
+	// CaddyModeCaddyfile writes one Caddyfile per app and reloads Caddy
+	CaddyModeCaddyfile = "caddyfile"
+	// CaddyModeAPI patches per-app JSON routes through the admin API
+	CaddyModeAPI = "api"
+)
+
+// UsesCaddyAPI reports whether app routes are managed through the Caddy
+// admin API on this server
+func (s *ServerConfig) UsesCaddyAPI() bool {
+	return s.CaddyMode == CaddyModeAPI
 }
 
 // AppConfig represents a deployed application on a server
@@ -154,6 +154,31 @@ func ValidateProjectConfig(config *ProjectConfig) ValidationErrors {
 		})
 	}
 
+	errors = append(errors, ValidateCaddyConfig(&config.Deploy.Caddy)...)
+
+	if p := config.Deploy.Protect; p != nil {
+		for user, password := range p.Users {
+			if err := security.ValidateBasicAuthUsername(user); err != nil {
+				errors = append(errors, ValidationError{Field: "deploy.protect.users", Message: err.Error()})
+			}
+			if password == "" {
+				errors = append(errors, ValidationError{
+					Field:   "deploy.protect.users",
+					Message: fmt.Sprintf("password for %q cannot be empty", user),
+				})
+			}
+		}
+		for _, path := range p.Exempt {
+			if err := security.ValidateCaddyPath(path); err != nil {
+				errors = append(errors, ValidationError{Field: "deploy.protect.exempt", Message: err.Error()})
+			}
+		}
+	}
+
+	errors = append(errors, validateTLSConfig(&config.Deploy.TLS)...)
+
+	errors = append(errors, validateDockerfileConfig(&config.Dockerfile)...)
+
 	for key := range config.Env.Dev {
 		if err := security.ValidateEnvKey(key); err != nil {
 			errors = append(errors, ValidationError{
@@ -175,6 +200,82 @@ func ValidateProjectConfig(config *ProjectConfig) ValidationErrors {
 	return errors
 }
 
+// ValidateCaddyConfig validates per-app Caddy directives. It is shared by
+// project validation and the Caddy generator, which refuses to render an
+// invalid config.
+func ValidateCaddyConfig(c *CaddyConfig) ValidationErrors {
+	var errors ValidationErrors
+	add := func(field string, err error) {
+		errors = append(errors, ValidationError{Field: "deploy.caddy." + field, Message: err.Error()})
+	}
+
+	if c.HSTS != nil && c.HSTS.MaxAge <= 0 {
+		add("hsts.max_age", fmt.Errorf("max_age must be a positive number of seconds"))
+	}
+
+	if c.CSP != "" {
+		if err := security.ValidateHeaderValue(c.CSP); err != nil {
+			add("csp", err)
+		}
+	}
+
+	for name, value := range c.Headers {
+		if err := security.ValidateHeaderName(name); err != nil {
+			add("headers", err)
+		} else if err := security.ValidateHeaderValue(value); err != nil {
+			add("headers", fmt.Errorf("%s: %w", name, err))
+		}
+	}
+
+	for path, value := range c.CacheControl {
+		if err := security.ValidateCaddyPath(path); err != nil {
+			add("cache_control", err)
+		} else if err := security.ValidateHeaderValue(value); err != nil {
+			add("cache_control", fmt.Errorf("%s: %w", path, err))
+		}
+	}
+
+	if c.MaxBodySize != "" {
+		if err := security.ValidateCaddySize(c.MaxBodySize); err != nil {
+			add("max_body_size", err)
+		}
+	}
+
+	for _, ip := range c.IPAllow {
+		if err := security.ValidateIPRange(ip); err != nil {
+			add("ip_allow", err)
+		}
+	}
+	for _, ip := range c.IPDeny {
+		if err := security.ValidateIPRange(ip); err != nil {
+			add("ip_deny", err)
+		}
+	}
+
+	for i, rule := range c.BasicAuth {
+		field := fmt.Sprintf("basic_auth[%d]", i)
+		if err := security.ValidateCaddyPath(rule.Path); err != nil {
+			add(field+".path", err)
+		}
+		if len(rule.Users) == 0 {
+			add(field+".users", fmt.Errorf("at least one user is required"))
+		}
+		for user, hash := range rule.Users {
+			if err := security.ValidateBasicAuthUser(user, hash); err != nil {
+				add(field+".users", err)
+			}
+		}
+	}
+
+	if c.Raw != "" {
+		if err := security.ValidateCaddySnippet(c.Raw); err != nil {
+			add("raw", err)
+		}
+	}
+
+	return errors
+}
+
 // ValidateServerConfig validates a server configuration
 func ValidateServerConfig(config *ServerConfig) ValidationErrors {
 	var errors ValidationErrors
@@ -200,6 +301,39 @@ func ValidateServerConfig(config *ServerConfig) ValidationErrors {
 		})
 	}
 
+	for i, hop := range config.ProxyJump {
+		if hop.Host == "" {
+			errors = append(errors, ValidationError{
+				Field:   fmt.Sprintf("proxy_jump[%d].host", i),
+				Message: "jump host is required",
+			})
+		}
+		if hop.Port < 0 || hop.Port > 65535 {
+			errors = append(errors, ValidationError{
+				Field:   fmt.Sprintf("proxy_jump[%d].port", i),
+				Message: "port must be between 1 and 65535",
+			})
+		}
+	}
+
+	for i, pin := range config.HostKeys {
+		if !hostKeyPinRegex.MatchString(pin) {
+			errors = append(errors, ValidationError{
+				Field:   fmt.Sprintf("host_keys[%d]", i),
+				Message: "host key must be a SHA256 fingerprint, optionally preceded by the key type (ssh-ed25519 SHA256:...)",
+			})
+		}
+	}
+
+	for i, pin := range config.HostKeys {
+		if !hostKeyPinRegex.MatchString(pin) {
+			errors = append(errors, ValidationError{
+				Field:   fmt.Sprintf("host_keys[%d]", i),
+				Message: "host key must be a SHA256 fingerprint, optionally preceded by the key type (ssh-ed25519 SHA256:...)",
+			})
+		}
+	}
+
 	return errors
 }
 
@@ -208,6 +342,70 @@ func isValidProjectName(name string) bool {
 	return matched
 }
 
+// buildSecretIDRegex: a docker build --secret id, part of --secret and
+// RUN --mount options
+var buildSecretIDRegex = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+// validateDockerfileConfig validates the build args, secrets and cache
+// directory
+func validateDockerfileConfig(cfg *DockerfileConfig) ValidationErrors {
+	var errors ValidationErrors
+	for name, value := range cfg.BuildArgs {
+		if err := security.ValidateEnvKey(name); err != nil {
+			errors = append(errors, ValidationError{
+				Field:   "dockerfile.build_args",
+				Message: fmt.Sprintf("invalid name %q: %s", name, err.Error()),
+			})
+		}
+		if strings.ContainsAny(value, "\n\r") {
+			errors = append(errors, ValidationError{
+				Field:   "dockerfile.build_args",
+				Message: fmt.Sprintf("value of %q must be a single line", name),
+			})
+		}
+	}
+
+	// Part of the comma-separated --cache-from/--cache-to values
+	if strings.ContainsAny(cfg.CacheDir, ",\n\r") {
+		errors = append(errors, ValidationError{
+			Field:   "dockerfile.cache_dir",
+			Message: "must not contain commas or line breaks",
+		})
+	}
+
+	seen := make(map[string]bool)
+	for _, secret := range cfg.Secrets {
+		if !buildSecretIDRegex.MatchString(secret.ID) {
+			errors = append(errors, ValidationError{
+				Field:   "dockerfile.secrets",
+				Message: fmt.Sprintf("invalid id %q: only alphanumeric, dots, underscores, and hyphens allowed", secret.ID),
+			})
+			continue
+		}
+		if seen[secret.ID] {
+			errors = append(errors, ValidationError{
+				Field:   "dockerfile.secrets",
+				Message: fmt.Sprintf("duplicate id %q", secret.ID),
+			})
+		}
+		seen[secret.ID] = true
+		if (secret.File == "") == (secret.Env == "") {
+			errors = append(errors, ValidationError{
+				Field:   "dockerfile.secrets",
+				Message: fmt.Sprintf("secret %q needs either file or env", secret.ID),
+			})
+		} else if secret.Env != "" {
+			if err := security.ValidateEnvKey(secret.Env); err != nil {
+				errors = append(errors, ValidationError{
+					Field:   "dockerfile.secrets",
+					Message: fmt.Sprintf("secret %q: invalid env %q: %s", secret.ID, secret.Env, err.Error()),
+				})
+			}
+		}
+	}
+	return errors
+}
+
 // phpVersionRegex matches PHP versions of the form "8.x" where x ≥ 2, the
 // minimum version with an official FrankenPHP image (dunglas/frankenphp
 // requires PHP >= 8.2 — there is no php8.1 tag).
@@ -222,6 +420,10 @@ var memoryLimitRegex = regexp.MustCompile(`^[0-9]+[bBkKmMgG]?$`)
 // cpuLimitRegex: decimal CPU count. Flows into docker run command lines.
 var cpuLimitRegex = regexp.MustCompile(`^[0-9]+(\.[0-9]+)?$`)
 
+// hostKeyPinRegex: a SHA256 host key fingerprint (unpadded base64 of 32
+// bytes), optionally preceded by the key type
+var hostKeyPinRegex = regexp.MustCompile(`^([a-z0-9@.-]+ )?SHA256:[A-Za-z0-9+/]{43}$`)
+
 // IsValidPHPVersion reports whether the given version is an accepted PHP version.
 // This is the single source of truth used by both the config and generator layers.
 func IsValidPHPVersion(version string) bool {
@@ -264,3 +466,51 @@ func isValidDomain(domain string) bool {
 	matched, _ := regexp.MatchString(`^([a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?\.)*[a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?$`, domain)
 	return matched
 }
+
+// validateTLSConfig checks the TLS mode and that certificate files and the
+// ask endpoint are set exactly when they are used
+func validateTLSConfig(t *TLSConfig) ValidationErrors {
+	var errors ValidationErrors
+	mode := t.EffectiveMode()
+	if mode != TLSModeCustom && (t.CertFile != "" || t.KeyFile != "") {
+		errors = append(errors, ValidationError{
+			Field:   "deploy.tls",
+			Message: fmt.Sprintf("cert_file and key_file are only used with mode %q", TLSModeCustom),
+		})
+	}
+	if mode != TLSModeOnDemand && t.Ask != "" {
+		errors = append(errors, ValidationError{
+			Field:   "deploy.tls.ask",
+			Message: fmt.Sprintf("only used with mode %q", TLSModeOnDemand),
+		})
+	}
+
+	switch mode {
+	case TLSModeACME, TLSModeInternal:
+	case TLSModeOnDemand:
+		if t.Ask == "" {
+			errors = append(errors, ValidationError{
+				Field:   "deploy.tls.ask",
+				Message: "required with mode \"on_demand\": certificates are only issued for domains the app approves",
+			})
+		} else if err := security.ValidateHealthPath(t.Ask); err != nil {
+			errors = append(errors, ValidationError{
+				Field:   "deploy.tls.ask",
+				Message: strings.Replace(err.Error(), "health path", "ask path", 1),
+			})
+		}
+	case TLSModeCustom:
+		if t.CertFile == "" {
+			errors = append(errors, ValidationError{Field: "deploy.tls.cert_file", Message: "required with mode \"custom\""})
+		}
+		if t.KeyFile == "" {
+			errors = append(errors, ValidationError{Field: "deploy.tls.key_file", Message: "required with mode \"custom\""})
+		}
+	default:
+		errors = append(errors, ValidationError{
+			Field:   "deploy.tls.mode",
+			Message: fmt.Sprintf("invalid mode %q (acme, custom, internal or on_demand)", t.Mode),
+		})
+	}
+	return errors
+}
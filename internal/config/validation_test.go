@@ -359,6 +359,101 @@ func TestValidateProjectConfig(t *testing.T) {
 			},
 			wantErrors: true,
 		},
+		{
+			name: "valid build args and secrets",
+			config: &ProjectConfig{
+				Name: "my-app",
+				PHP: PHPConfig{
+					Version: "8.3",
+				},
+				Dockerfile: DockerfileConfig{
+					BuildArgs: map[string]string{"APP_VERSION": "1.2"},
+					Secrets: []BuildSecret{
+						{ID: SecretComposerAuth, File: "~/.composer/auth.json"},
+						{ID: SecretNpmrc, Env: "NPMRC"},
+					},
+				},
+			},
+			wantErrors: false,
+		},
+		{
+			name: "invalid build arg name",
+			config: &ProjectConfig{
+				Name: "my-app",
+				PHP: PHPConfig{
+					Version: "8.3",
+				},
+				Dockerfile: DockerfileConfig{
+					BuildArgs: map[string]string{"APP-VERSION": "1.2"},
+				},
+			},
+			wantErrors: true,
+		},
+		{
+			name: "secret without source",
+			config: &ProjectConfig{
+				Name: "my-app",
+				PHP: PHPConfig{
+					Version: "8.3",
+				},
+				Dockerfile: DockerfileConfig{
+					Secrets: []BuildSecret{{ID: SecretComposerAuth}},
+				},
+			},
+			wantErrors: true,
+		},
+		{
+			name: "secret with file and env",
+			config: &ProjectConfig{
+				Name: "my-app",
+				PHP: PHPConfig{
+					Version: "8.3",
+				},
+				Dockerfile: DockerfileConfig{
+					Secrets: []BuildSecret{{ID: SecretComposerAuth, File: "auth.json", Env: "COMPOSER_AUTH"}},
+				},
+			},
+			wantErrors: true,
+		},
+		{
+			name: "duplicate secret id",
+			config: &ProjectConfig{
+				Name: "my-app",
+				PHP: PHPConfig{
+					Version: "8.3",
+				},
+				Dockerfile: DockerfileConfig{
+					Secrets: []BuildSecret{{ID: "token", Env: "A"}, {ID: "token", Env: "B"}},
+				},
+			},
+			wantErrors: true,
+		},
+		{
+			name: "cache dir with comma",
+			config: &ProjectConfig{
+				Name: "my-app",
+				PHP: PHPConfig{
+					Version: "8.3",
+				},
+				Dockerfile: DockerfileConfig{
+					CacheDir: "/tmp/cache,mode=min",
+				},
+			},
+			wantErrors: true,
+		},
+		{
+			name: "invalid secret id",
+			config: &ProjectConfig{
+				Name: "my-app",
+				PHP: PHPConfig{
+					Version: "8.3",
+				},
+				Dockerfile: DockerfileConfig{
+					Secrets: []BuildSecret{{ID: "a,src=/etc/passwd", Env: "A"}},
+				},
+			},
+			wantErrors: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -389,6 +484,26 @@ func TestValidateServerConfig(t *testing.T) {
 			},
 			wantErrors: false,
 		},
+		{
+			name: "pinned host keys",
+			config: &ServerConfig{
+				Host:     "example.com",
+				User:     "deploy",
+				Port:     22,
+				HostKeys: []string{"ssh-ed25519 SHA256:uNiVztksCsDhcc0u9e8BujQXVUpKZIDTMczCvj3tD2s", "SHA256:uNiVztksCsDhcc0u9e8BujQXVUpKZIDTMczCvj3tD2s"},
+			},
+			wantErrors: false,
+		},
+		{
+			name: "invalid host key pin",
+			config: &ServerConfig{
+				Host:     "example.com",
+				User:     "deploy",
+				Port:     22,
+				HostKeys: []string{"ssh-ed25519 AAAAC3NzaC1lZDI1NTE5"},
+			},
+			wantErrors: true,
+		},
 		{
 			name: "missing host",
 			config: &ServerConfig{
@@ -423,6 +538,26 @@ func TestValidateServerConfig(t *testing.T) {
 			},
 			wantErrors: true,
 		},
+		{
+			name: "valid jump hosts",
+			config: &ServerConfig{
+				Host:      "10.0.0.5",
+				User:      "deploy",
+				Port:      22,
+				ProxyJump: []JumpHost{{Host: "bastion.example.com"}, {Host: "10.0.0.2", User: "ops", Port: 2222}},
+			},
+			wantErrors: false,
+		},
+		{
+			name: "jump host without host",
+			config: &ServerConfig{
+				Host:      "10.0.0.5",
+				User:      "deploy",
+				Port:      22,
+				ProxyJump: []JumpHost{{User: "ops"}},
+			},
+			wantErrors: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -482,3 +617,106 @@ func TestValidateProjectConfig_ResourceLimits(t *testing.T) {
 		}
 	}
 }
+
+func TestValidateCaddyConfig(t *testing.T) {
+	hash := "$2a$14$" + "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0"
+
+	valid := CaddyConfig{
+		HSTS:         &HSTSConfig{MaxAge: 31536000, IncludeSubdomains: true},
+		CSP:          "default-src 'self'; img-src *",
+		Headers:      map[string]string{"Permissions-Policy": "camera=()"},
+		CacheControl: map[string]string{"/build/*": "public, max-age=31536000, immutable"},
+		MaxBodySize:  "20MB",
+		IPAllow:      []string{"10.0.0.0/8", "private_ranges"},
+		IPDeny:       []string{"203.0.113.7"},
+		BasicAuth:    []BasicAuthRule{{Path: "/admin/*", Users: map[string]string{"admin": hash}}},
+		Raw:          "handle /ping {\n    respond \"pong\" 200\n}",
+	}
+	if errs := ValidateCaddyConfig(&valid); errs.HasErrors() {
+		t.Fatalf("expected valid caddy config, got: %v", errs)
+	}
+
+	invalid := map[string]CaddyConfig{
+		"zero hsts max_age":      {HSTS: &HSTSConfig{}},
+		"csp with quote":         {CSP: `default-src "self"`},
+		"csp with newline":       {CSP: "default-src 'self'\n}"},
+		"header name with space": {Headers: map[string]string{"X Evil": "1"}},
+		"empty header value":     {Headers: map[string]string{"X-Test": ""}},
+		"relative cache path":    {CacheControl: map[string]string{"build/*": "no-cache"}},
+		"cache path traversal":   {CacheControl: map[string]string{"/../etc": "no-cache"}},
+		"bad body size":          {MaxBodySize: "10 MB"},
+		"bad ip":                 {IPAllow: []string{"10.0.0.0/33"}},
+		"bad deny ip":            {IPDeny: []string{"evil; rm"}},
+		"plaintext password":     {BasicAuth: []BasicAuthRule{{Path: "/admin/*", Users: map[string]string{"admin": "secret"}}}},
+		"basic auth no users":    {BasicAuth: []BasicAuthRule{{Path: "/admin/*"}}},
+		"unbalanced raw":         {Raw: "}\nevil.com {"},
+	}
+	for name, cfg := range invalid {
+		t.Run(name, func(t *testing.T) {
+			if errs := ValidateCaddyConfig(&cfg); !errs.HasErrors() {
+				t.Errorf("expected validation error for %s", name)
+			}
+		})
+	}
+}
+
+func TestValidateProjectConfig_Protect(t *testing.T) {
+	cfg := &ProjectConfig{
+		Name: "myapp",
+		PHP:  PHPConfig{Version: "8.3"},
+		Deploy: DeployConfig{Protect: &ProtectConfig{
+			Users:  map[string]string{"alice": "s3cret"},
+			Exempt: []string{"/webhooks/*"},
+		}},
+	}
+	if errs := ValidateProjectConfig(cfg); errs.HasErrors() {
+		t.Fatalf("expected valid protect config, got: %v", errs)
+	}
+
+	invalid := []*ProtectConfig{
+		{Users: map[string]string{"al ice": "s3cret"}},
+		{Users: map[string]string{"alice": ""}},
+		{Exempt: []string{"webhooks"}},
+	}
+	for _, p := range invalid {
+		cfg.Deploy.Protect = p
+		if errs := ValidateProjectConfig(cfg); !errs.HasErrors() {
+			t.Errorf("expected error for %+v", p)
+		}
+	}
+}
+
+func TestValidateProjectConfig_TLS(t *testing.T) {
+	valid := []TLSConfig{
+		{},
+		{Mode: TLSModeACME},
+		{Mode: TLSModeInternal},
+		{Mode: TLSModeCustom, CertFile: "certs/app.pem", KeyFile: "certs/app.key"},
+		{Mode: TLSModeOnDemand, Ask: "/tls/allowed"},
+	}
+	invalid := []TLSConfig{
+		{Mode: "letsencrypt"},
+		{Mode: TLSModeCustom, CertFile: "certs/app.pem"},
+		{Mode: TLSModeCustom, KeyFile: "certs/app.key"},
+		{Mode: TLSModeInternal, CertFile: "certs/app.pem"},
+		{KeyFile: "certs/app.key"},
+		{Mode: TLSModeOnDemand},
+		{Mode: TLSModeOnDemand, Ask: "tls/allowed"},
+		{Mode: TLSModeOnDemand, Ask: "/tls/allowed?x=1"},
+		{Ask: "/tls/allowed"},
+	}
+
+	cfg := &ProjectConfig{Name: "myapp", PHP: PHPConfig{Version: "8.3"}}
+	for _, tlsCfg := range valid {
+		cfg.Deploy.TLS = tlsCfg
+		if errs := ValidateProjectConfig(cfg); errs.HasErrors() {
+			t.Errorf("expected %+v to be valid, got: %v", tlsCfg, errs)
+		}
+	}
+	for _, tlsCfg := range invalid {
+		cfg.Deploy.TLS = tlsCfg
+		if errs := ValidateProjectConfig(cfg); !errs.HasErrors() {
+			t.Errorf("expected error for %+v", tlsCfg)
+		}
+	}
+}
@@ -12,6 +12,12 @@ const (
 	CaddyDir     = BasePath + "/caddy"
 	CaddyAppsDir = CaddyDir + "/apps"
 	CaddyLogsDir = CaddyDir + "/logs"
+	// CaddyAdminDir holds the admin API socket in API mode. It is owned by
+	// the SSH user with mode 0700: only that user reaches the socket.
+	CaddyAdminDir    = CaddyDir + "/admin"
+	CaddyAdminSocket = CaddyAdminDir + "/admin.sock"
+	// DockerSocket is the Docker daemon API, used as remote builder
+	DockerSocket = "/var/run/docker.sock"
 )
 
 // Container configuration
@@ -74,7 +80,24 @@ func CaddyAppConfig(name string) string {
 	return filepath.Join(CaddyAppsDir, name+".caddy")
 }
 
+// CaddyAppRoute returns the last applied JSON route of an app (API mode).
+func CaddyAppRoute(name string) string {
+	return filepath.Join(CaddyAppsDir, name+".json")
+}
+
+// CaddyAppTLS returns the TLS settings applied with the route of an app
+// (API mode).
+func CaddyAppTLS(name string) string {
+	return filepath.Join(CaddyAppsDir, name+".tls")
+}
+
 // AppEnvFilePath returns the .env.local file path for an app.
 func AppEnvFilePath(name string) string {
 	return filepath.Join(AppsDir, name, "shared", ".env.local")
 }
+
+// AppAccessFilePath returns the basic auth users file for an app. It lives
+// outside the shared dir: it is read by FrankenDeploy, never by the app.
+func AppAccessFilePath(name string) string {
+	return filepath.Join(AppsDir, name, "access")
+}
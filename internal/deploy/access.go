@@ -0,0 +1,120 @@
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/yoanbernabeu/frankendeploy/internal/constants"
+	"github.com/yoanbernabeu/frankendeploy/internal/security"
+	"github.com/yoanbernabeu/frankendeploy/internal/ssh"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// HashAccessPassword returns the bcrypt hash of a basic auth password.
+// Hashing happens locally so plaintext passwords never reach the server.
+// A value that already is a bcrypt hash is returned unchanged.
+func HashAccessPassword(password string) (string, error) {
+	if security.IsBcryptHash(password) {
+		return password, nil
+	}
+	if password == "" {
+		return "", fmt.Errorf("password cannot be empty")
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash password: %w", err)
+	}
+	return string(hash), nil
+}
+
+// HashAccessUsers hashes every password of a username → password map
+func HashAccessUsers(users map[string]string) (map[string]string, error) {
+	hashed := make(map[string]string, len(users))
+	for user, password := range users {
+		hash, err := HashAccessPassword(password)
+		if err != nil {
+			return nil, fmt.Errorf("user %s: %w", user, err)
+		}
+		hashed[user] = hash
+	}
+	return hashed, nil
+}
+
+// ParseAccessContent parses the server-side access file (user:hash lines)
+func ParseAccessContent(content string) map[string]string {
+	users := make(map[string]string)
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		users[parts[0]] = parts[1]
+	}
+	return users
+}
+
+// BuildAccessContent builds the access file content, sorted by username
+func BuildAccessContent(users map[string]string) string {
+	names := make([]string, 0, len(users))
+	for name := range users {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var sb strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&sb, "%s:%s\n", name, users[name])
+	}
+	return sb.String()
+}
+
+// ReadAccessUsers reads the basic auth users stored on the server for an
+// app. A missing file yields an empty map.
+func ReadAccessUsers(ctx context.Context, client ssh.Executor, appName string) (map[string]string, error) {
+	accessFile := constants.AppAccessFilePath(appName)
+	result, err := client.Exec(ctx, fmt.Sprintf("cat %s 2>/dev/null || true", accessFile))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read access file: %w", err)
+	}
+	return ParseAccessContent(result.Stdout), nil
+}
+
+// WriteAccessUsers writes the app's access file (bcrypt hashes only) with
+// 0600 permissions. An empty map removes the file.
+func WriteAccessUsers(ctx context.Context, client ssh.Executor, appName string, users map[string]string) error {
+	accessFile := constants.AppAccessFilePath(appName)
+
+	if len(users) == 0 {
+		if _, err := client.Exec(ctx, fmt.Sprintf("rm -f %s", accessFile)); err != nil {
+			return fmt.Errorf("failed to remove access file: %w", err)
+		}
+		return nil
+	}
+
+	for user, hash := range users {
+		if err := security.ValidateBasicAuthUser(user, hash); err != nil {
+			return err
+		}
+	}
+
+	delim, err := security.GenerateHeredocDelimiter("ACCESSEOF")
+	if err != nil {
+		return fmt.Errorf("failed to generate delimiter: %w", err)
+	}
+	writeCmd := fmt.Sprintf("mkdir -p $(dirname %s) && (umask 077 && cat > %s << '%s'\n%s%s\n) && chmod 600 %s",
+		accessFile, accessFile, delim, BuildAccessContent(users), delim, accessFile)
+	result, err := client.Exec(ctx, writeCmd)
+	if err != nil {
+		return fmt.Errorf("failed to write access file: %w", err)
+	}
+	if err := result.Err(); err != nil {
+		return fmt.Errorf("failed to write access file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package deploy
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/yoanbernabeu/frankendeploy/internal/security"
+	"github.com/yoanbernabeu/frankendeploy/internal/ssh"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestHashAccessPassword(t *testing.T) {
+	hash, err := HashAccessPassword("s3cret")
+	if err != nil {
+		t.Fatalf("HashAccessPassword() error = %v", err)
+	}
+	if !security.IsBcryptHash(hash) {
+		t.Fatalf("expected a bcrypt hash, got %q", hash)
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte("s3cret")); err != nil {
+		t.Errorf("hash does not match the password: %v", err)
+	}
+
+	// An existing hash is passed through unchanged
+	again, err := HashAccessPassword(hash)
+	if err != nil {
+		t.Fatalf("HashAccessPassword(hash) error = %v", err)
+	}
+	if again != hash {
+		t.Error("an existing bcrypt hash must not be re-hashed")
+	}
+
+	if _, err := HashAccessPassword(""); err == nil {
+		t.Error("expected error for an empty password")
+	}
+}
+
+func TestAccessContent_RoundTrip(t *testing.T) {
+	users := map[string]string{
+		"zoe":   "$2a$10$" + strings.Repeat("a", 53),
+		"alice": "$2a$10$" + strings.Repeat("b", 53),
+	}
+	content := BuildAccessContent(users)
+	if !strings.HasPrefix(content, "alice:") {
+		t.Errorf("users must be sorted, got: %q", content)
+	}
+	parsed := ParseAccessContent(content)
+	if len(parsed) != 2 || parsed["zoe"] != users["zoe"] || parsed["alice"] != users["alice"] {
+		t.Errorf("round trip mismatch: %v", parsed)
+	}
+}
+
+func TestWriteAccessUsers_Permissions(t *testing.T) {
+	mock := &ssh.MockExecutor{}
+	users := map[string]string{"alice": "$2a$10$" + strings.Repeat("a", 53)}
+
+	if err := WriteAccessUsers(context.Background(), mock, "myapp", users); err != nil {
+		t.Fatalf("WriteAccessUsers() error = %v", err)
+	}
+	all := strings.Join(mock.Commands, "\n")
+	if !strings.Contains(all, "/opt/frankendeploy/apps/myapp/access") {
+		t.Errorf("should write the app access file, got: %s", all)
+	}
+	if !strings.Contains(all, "umask 077") || !strings.Contains(all, "chmod 600") {
+		t.Error("access file must never be readable by other users")
+	}
+}
+
+func TestWriteAccessUsers_RejectsPlaintext(t *testing.T) {
+	mock := &ssh.MockExecutor{}
+	err := WriteAccessUsers(context.Background(), mock, "myapp", map[string]string{"alice": "plaintext"})
+	if err == nil {
+		t.Fatal("expected error: only hashes may be written to the server")
+	}
+	if len(mock.Commands) != 0 {
+		t.Errorf("no command should run, got: %v", mock.Commands)
+	}
+}
+
+func TestWriteAccessUsers_EmptyRemovesFile(t *testing.T) {
+	mock := &ssh.MockExecutor{}
+	if err := WriteAccessUsers(context.Background(), mock, "myapp", nil); err != nil {
+		t.Fatalf("WriteAccessUsers() error = %v", err)
+	}
+	if len(mock.Commands) != 1 || !strings.HasPrefix(mock.Commands[0], "rm -f ") {
+		t.Errorf("expected a single rm command, got: %v", mock.Commands)
+	}
+}
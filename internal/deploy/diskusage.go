@@ -0,0 +1,179 @@
+package deploy
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/yoanbernabeu/frankendeploy/internal/constants"
+	"github.com/yoanbernabeu/frankendeploy/internal/security"
+)
+
+// DiskUsage is where the disk space of a server goes. Sizes are in bytes;
+// -1 when the server could not measure it (no passwordless sudo).
+type DiskUsage struct {
+	DiskUsed  int64         `json:"disk_used"`
+	DiskTotal int64         `json:"disk_total"`
+	Docker    []DockerUsage `json:"docker"`
+	Apps      []AppUsage    `json:"apps"`
+}
+
+// DockerUsage is a line of docker system df. Image sizes count shared
+// layers once.
+type DockerUsage struct {
+	Type        string `json:"type"`
+	Size        int64  `json:"size"`
+	Reclaimable int64  `json:"reclaimable"`
+}
+
+// AppUsage is the disk usage of one app. Each image size counts the layers
+// it shares with the app's other images.
+type AppUsage struct {
+	Name      string     `json:"name"`
+	Images    []TagUsage `json:"images"`
+	Releases  []TagUsage `json:"releases"`
+	Backups   int64      `json:"backups"`
+	DBVolume  int64      `json:"db_volume"`
+	CaddyLogs int64      `json:"caddy_logs"`
+}
+
+// TagUsage is the size of an image or release directory of an app
+type TagUsage struct {
+	Tag  string `json:"tag"`
+	Size int64  `json:"size"`
+}
+
+// app returns the usage of an app, adding it on first use
+func (u *DiskUsage) app(name string) *AppUsage {
+	for i := range u.Apps {
+		if u.Apps[i].Name == name {
+			return &u.Apps[i]
+		}
+	}
+	u.Apps = append(u.Apps, AppUsage{Name: name})
+	return &u.Apps[len(u.Apps)-1]
+}
+
+// DiskUsageCommand returns the script measuring the disk usage with a
+// single SSH command, one tab-separated record per line. du sizes are in
+// KiB, Docker sizes as Docker prints them. Files the SSH user cannot read
+// (backups, volumes) are measured through sudo -n, never prompting.
+func DiskUsageCommand() (string, error) {
+	delimiter, err := security.GenerateHeredocDelimiter("DISK")
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf(`sh -s << '%[1]s'
+df -Pk / | awk 'NR == 2 {print "disk\t/\t" $3 "\t" $2}'
+docker system df --format '{{.Type}}\t{{.Size}}\t{{.Reclaimable}}' 2>/dev/null | awk '{print "docker\t" $0}'
+rdu() { sudo -n du -sk "$1" 2>/dev/null || du -sk "$1" 2>/dev/null || echo "-"; }
+for dir in %[2]s/*/; do
+  [ -d "$dir" ] || continue
+  app=$(basename "$dir")
+  docker images "$app" --format '{{.Tag}}\t{{.Size}}' 2>/dev/null | awk -v app="$app" '{print "image\t" app "\t" $0}'
+  for release in "$dir"releases/*/; do
+    [ -d "$release" ] && du -sk "$release" 2>/dev/null | awk -v app="$app" -v tag="$(basename "$release")" '{print "release\t" app "\t" tag "\t" $1}'
+  done
+  [ -d "${dir}shared/backups" ] && rdu "${dir}shared/backups" | awk -v app="$app" '{print "backups\t" app "\t\t" $1}'
+  mountpoint=$(docker volume inspect -f '{{.Mountpoint}}' "$app-db-data" 2>/dev/null) && rdu "$mountpoint" | awk -v app="$app" '{print "volume\t" app "\t\t" $1}'
+  du -ck %[3]s/"$app".log %[3]s/"$app"-*.log* 2>/dev/null | tail -n 1 | awk -v app="$app" '{print "logs\t" app "\t\t" $1}'
+done
+%[1]s`, delimiter, constants.AppsDir, constants.CaddyLogsDir), nil
+}
+
+// ParseDiskUsage parses the output of DiskUsageCommand
+func ParseDiskUsage(out string) *DiskUsage {
+	usage := &DiskUsage{}
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Split(strings.TrimRight(line, "\r"), "\t")
+		if len(fields) < 3 {
+			continue
+		}
+		switch fields[0] {
+		case "disk":
+			if len(fields) == 4 {
+				usage.DiskUsed = parseKiB(fields[2])
+				usage.DiskTotal = parseKiB(fields[3])
+			}
+		case "docker":
+			if len(fields) == 4 {
+				reclaimable, _, _ := strings.Cut(fields[3], " ")
+				usage.Docker = append(usage.Docker, DockerUsage{
+					Type:        fields[1],
+					Size:        ParseDockerSize(fields[2]),
+					Reclaimable: ParseDockerSize(reclaimable),
+				})
+			}
+		case "image":
+			if len(fields) == 4 {
+				app := usage.app(fields[1])
+				app.Images = append(app.Images, TagUsage{Tag: fields[2], Size: ParseDockerSize(fields[3])})
+			}
+		case "release":
+			if len(fields) == 4 {
+				app := usage.app(fields[1])
+				app.Releases = append(app.Releases, TagUsage{Tag: fields[2], Size: parseKiB(fields[3])})
+			}
+		case "backups", "volume", "logs":
+			if len(fields) == 4 {
+				app := usage.app(fields[1])
+				size := parseKiB(fields[3])
+				switch fields[0] {
+				case "backups":
+					app.Backups = size
+				case "volume":
+					app.DBVolume = size
+				default:
+					app.CaddyLogs = size
+				}
+			}
+		}
+	}
+	return usage
+}
+
+// parseKiB parses a du size in KiB into bytes, -1 when unknown
+func parseKiB(s string) int64 {
+	kib, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+	if err != nil {
+		return -1
+	}
+	return kib << 10
+}
+
+// dockerSizeUnits are the units of Docker's human sizes: binary in the
+// memory usage of docker stats, decimal everywhere else
+var dockerSizeUnits = []struct {
+	suffix string
+	factor float64
+}{
+	{"TiB", 1 << 40}, {"GiB", 1 << 30}, {"MiB", 1 << 20}, {"KiB", 1 << 10},
+	{"TB", 1e12}, {"GB", 1e9}, {"MB", 1e6}, {"kB", 1e3}, {"B", 1},
+}
+
+// ParseDockerSize parses a size printed by the Docker CLI ("1.23GB",
+// "512MB", "128MiB", "0B") into bytes, -1 when it cannot be read
+func ParseDockerSize(s string) int64 {
+	s = strings.TrimSpace(s)
+	for _, unit := range dockerSizeUnits {
+		if number, ok := strings.CutSuffix(s, unit.suffix); ok {
+			value, err := strconv.ParseFloat(number, 64)
+			if err != nil {
+				return -1
+			}
+			return int64(value * unit.factor)
+		}
+	}
+	return -1
+}
+
+// Total is the disk space of the app's files: release directories,
+// backups, database volume and Caddy logs. Images are left out, their
+// layers are shared.
+func (a AppUsage) Total() int64 {
+	var total int64
+	for _, release := range a.Releases {
+		total += max(release.Size, 0)
+	}
+	return total + max(a.Backups, 0) + max(a.DBVolume, 0) + max(a.CaddyLogs, 0)
+}
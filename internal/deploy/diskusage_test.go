@@ -0,0 +1,99 @@
+package deploy
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestParseDockerSize(t *testing.T) {
+	tests := map[string]int64{
+		"0B":      0,
+		"512B":    512,
+		"85.3kB":  85300,
+		"512MB":   512e6,
+		"1.23GB":  1.23e9,
+		" 2TB ":   2e12,
+		"128MiB":  128 << 20,
+		"1.5GiB":  1.5 * (1 << 30),
+		"":        -1,
+		"1.2 GiB": -1,
+		"N/A":     -1,
+	}
+	for in, want := range tests {
+		if got := ParseDockerSize(in); got != want {
+			t.Errorf("ParseDockerSize(%q) = %d, want %d", in, got, want)
+		}
+	}
+}
+
+func TestParseDiskUsage(t *testing.T) {
+	out := strings.Join([]string{
+		"disk\t/\t12582912\t26214400",
+		"docker\tImages\t4.2GB\t1.1GB (26%)",
+		"docker\tBuild Cache\t2.3GB\t2.3GB",
+		"image\tshop\tv2\t812MB",
+		"image\tshop\tv1\t790MB",
+		"release\tshop\tv1\t120",
+		"release\tshop\tv2\t128",
+		"backups\tshop\t\t2048",
+		"volume\tshop\t\t-",
+		"logs\tshop\t\t512",
+		"image\tblog\tv1\t300MB",
+		"logs\tblog\t\t0",
+		"garbage line",
+	}, "\n")
+
+	usage := ParseDiskUsage(out)
+	if usage.DiskUsed != 12582912<<10 || usage.DiskTotal != 26214400<<10 {
+		t.Errorf("disk = %d/%d", usage.DiskUsed, usage.DiskTotal)
+	}
+	if len(usage.Docker) != 2 || usage.Docker[0].Reclaimable != 1.1e9 || usage.Docker[1].Type != "Build Cache" {
+		t.Errorf("docker = %+v", usage.Docker)
+	}
+	if len(usage.Apps) != 2 {
+		t.Fatalf("apps = %+v", usage.Apps)
+	}
+
+	shop := usage.Apps[0]
+	if shop.Name != "shop" || len(shop.Images) != 2 || shop.Images[0].Size != 812e6 {
+		t.Errorf("shop images = %+v", shop.Images)
+	}
+	if len(shop.Releases) != 2 || shop.Releases[1].Size != 128<<10 {
+		t.Errorf("shop releases = %+v", shop.Releases)
+	}
+	if shop.Backups != 2048<<10 || shop.CaddyLogs != 512<<10 {
+		t.Errorf("shop backups = %d, logs = %d", shop.Backups, shop.CaddyLogs)
+	}
+	if shop.DBVolume != -1 {
+		t.Errorf("an unreadable volume must be unknown (-1), got %d", shop.DBVolume)
+	}
+	if got, want := shop.Total(), int64((120+128+2048+512)<<10); got != want {
+		t.Errorf("Total() = %d, want %d (unknown sizes count as 0)", got, want)
+	}
+}
+
+func TestDiskUsageCommand_ValidShell(t *testing.T) {
+	script, err := DiskUsageCommand()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(script, "sh -s << '") {
+		t.Fatalf("expected a single sh heredoc, got:\n%s", script)
+	}
+	_, body, _ := strings.Cut(script, "\n")
+	body = body[:strings.LastIndex(body, "\n")]
+	if strings.Contains(body, "sudo du") {
+		t.Error("sudo must never prompt: use sudo -n")
+	}
+
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("no sh")
+	}
+	check := exec.Command(sh, "-n")
+	check.Stdin = strings.NewReader(body)
+	if out, err := check.CombinedOutput(); err != nil {
+		t.Errorf("invalid shell script: %v\n%s", err, out)
+	}
+}
@@ -0,0 +1,219 @@
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/yoanbernabeu/frankendeploy/internal/constants"
+	"github.com/yoanbernabeu/frankendeploy/internal/security"
+	"github.com/yoanbernabeu/frankendeploy/internal/ssh"
+)
+
+// tempContainerSuffixes name the temporary containers of deploy (-new, and
+// -old during the swap), env reload (-new) and rollback (-rollback). An
+// interrupted run leaves them behind.
+var tempContainerSuffixes = []string{"-new", "-rollback", "-old"}
+
+// staleTarMinutes is the age after which an image tar left in /tmp by an
+// interrupted transfer is removed: a younger one may be a transfer in
+// progress
+const staleTarMinutes = 60
+
+// buildCacheMaxAge keeps the build cache of recent remote builds
+const buildCacheMaxAge = "24h"
+
+// GCReport lists what CollectGarbage removed, or would remove on a dry run
+type GCReport struct {
+	// Containers are the stopped temporary containers
+	Containers []string `json:"containers"`
+	// RunningContainers are temporary containers left alone: a deploy may
+	// be in progress
+	RunningContainers []string `json:"running_containers,omitempty"`
+	// Images are the image tags of releases no longer kept, per app
+	Images map[string][]string `json:"images"`
+	// DanglingImages and BuildCache are the space Docker reports reclaimed
+	DanglingImages string   `json:"dangling_images"`
+	BuildCache     string   `json:"build_cache"`
+	Tars           []string `json:"tars"`
+	// Warnings are the steps skipped after an error
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// CollectGarbage frees the disk space deploys leave behind, with the
+// safety rules of PruneOldImages:
+//   - nothing is removed when the apps cannot be listed, and an app's
+//     images are kept when its releases cannot be listed
+//   - nothing is forced: docker rm and rmi never remove a running
+//     container or an image in use, and running temporary containers are
+//     only reported
+//   - dangling images only, and build cache unused for 24 hours, are pruned
+//   - image tars in /tmp are removed once older than an hour
+//
+// On a dry run, nothing is removed.
+func CollectGarbage(ctx context.Context, client ssh.Executor, dryRun bool) (*GCReport, error) {
+	apps, err := listApps(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &GCReport{Images: make(map[string][]string)}
+	if err := collectTempContainers(ctx, client, apps, dryRun, report); err != nil {
+		report.Warnings = append(report.Warnings, err.Error())
+	}
+
+	for _, app := range apps {
+		var tags []string
+		var err error
+		if dryRun {
+			tags, err = OldImageTags(ctx, client, app, constants.AppBasePath(app))
+		} else {
+			tags, err = PruneOldImages(ctx, client, app, constants.AppBasePath(app))
+		}
+		if err != nil {
+			report.Warnings = append(report.Warnings, fmt.Sprintf("%s images kept: %v", app, err))
+			continue
+		}
+		if len(tags) > 0 {
+			report.Images[app] = tags
+		}
+	}
+
+	if dryRun {
+		result, err := client.Exec(ctx, "docker images -f dangling=true -q | wc -l")
+		if err == nil && result.ExitCode == 0 {
+			report.DanglingImages = strings.TrimSpace(result.Stdout) + " images"
+		}
+		report.BuildCache = "unused for " + buildCacheMaxAge
+	} else {
+		report.DanglingImages = pruneReclaimed(ctx, client, "docker image prune -f", report)
+		report.BuildCache = pruneReclaimed(ctx, client, "docker builder prune -f --filter until="+buildCacheMaxAge, report)
+	}
+
+	if err := collectTars(ctx, client, apps, dryRun, report); err != nil {
+		report.Warnings = append(report.Warnings, err.Error())
+	}
+	return report, nil
+}
+
+// listApps lists the apps deployed on the server
+func listApps(ctx context.Context, client ssh.Executor) ([]string, error) {
+	result, err := client.Exec(ctx, fmt.Sprintf("[ ! -d %[1]s ] || ls -1 %[1]s", constants.AppsDir))
+	if err == nil {
+		err = result.Err()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot list apps, nothing removed: %w", err)
+	}
+	var apps []string
+	for _, line := range strings.Split(result.Stdout, "\n") {
+		if app := strings.TrimSpace(line); app != "" && security.ValidateAppName(app) == nil {
+			apps = append(apps, app)
+		}
+	}
+	return apps, nil
+}
+
+// collectTempContainers removes the stopped temporary containers of the
+// apps
+func collectTempContainers(ctx context.Context, client ssh.Executor, apps []string, dryRun bool, report *GCReport) error {
+	result, err := client.Exec(ctx, "docker ps -a --format '{{.Names}}\t{{.State}}'")
+	if err == nil {
+		err = result.Err()
+	}
+	if err != nil {
+		return fmt.Errorf("containers kept: cannot list containers: %w", err)
+	}
+
+	temp := make(map[string]bool)
+	for _, app := range apps {
+		for _, suffix := range tempContainerSuffixes {
+			temp[app+suffix] = true
+		}
+	}
+	for _, line := range strings.Split(result.Stdout, "\n") {
+		name, state, ok := strings.Cut(strings.TrimSpace(line), "\t")
+		if !ok || !temp[name] {
+			continue
+		}
+		if state != "exited" && state != "created" && state != "dead" {
+			report.RunningContainers = append(report.RunningContainers, name)
+			continue
+		}
+		if !dryRun {
+			rm, err := client.Exec(ctx, "docker rm "+name)
+			if err != nil || rm.ExitCode != 0 {
+				continue
+			}
+		}
+		report.Containers = append(report.Containers, name)
+	}
+	return nil
+}
+
+// pruneReclaimed runs a docker prune command and returns the space it
+// reports reclaimed
+func pruneReclaimed(ctx context.Context, client ssh.Executor, command string, report *GCReport) string {
+	result, err := client.Exec(ctx, command)
+	if err == nil {
+		err = result.Err()
+	}
+	if err != nil {
+		report.Warnings = append(report.Warnings, fmt.Sprintf("%s: %v", command, err))
+		return ""
+	}
+	// "Total reclaimed space: 1.2GB" (image prune), "Total:\t1.2GB" (builder prune)
+	for _, line := range strings.Split(result.Stdout, "\n") {
+		if strings.HasPrefix(line, "Total") {
+			if _, size, ok := strings.Cut(line, ":"); ok {
+				return strings.TrimSpace(size)
+			}
+		}
+	}
+	return "0B"
+}
+
+// collectTars removes the image tars of the apps left in /tmp by
+// interrupted transfers: complete tars not loaded (/tmp/<app>-<tag>.tar)
+// and partial uploads (/tmp/.<app>-<tag>.tar.<random>.tmp)
+func collectTars(ctx context.Context, client ssh.Executor, apps []string, dryRun bool, report *GCReport) error {
+	if len(apps) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(apps))
+	for _, app := range apps {
+		names = append(names, fmt.Sprintf("-name '%s-*.tar' -o -name '.%s-*.tar.*.tmp'", app, app))
+	}
+	result, err := client.Exec(ctx, fmt.Sprintf("find /tmp -maxdepth 1 -type f \\( %s \\) -mmin +%d",
+		strings.Join(names, " -o "), staleTarMinutes))
+	if err == nil {
+		err = result.Err()
+	}
+	if err != nil {
+		return fmt.Errorf("tars kept: cannot list /tmp: %w", err)
+	}
+
+	for _, line := range strings.Split(result.Stdout, "\n") {
+		tar := strings.TrimSpace(line)
+		if path.Dir(tar) != "/tmp" || !isImageTar(path.Base(tar)) {
+			continue
+		}
+		if !dryRun {
+			rm, err := client.Exec(ctx, "rm -f "+security.ShellEscape(tar))
+			if err != nil || rm.ExitCode != 0 {
+				continue
+			}
+		}
+		report.Tars = append(report.Tars, tar)
+	}
+	return nil
+}
+
+// isImageTar reports whether name is an image tar or a partial upload of one
+func isImageTar(name string) bool {
+	if strings.HasSuffix(name, ".tar") {
+		return true
+	}
+	return strings.HasPrefix(name, ".") && strings.HasSuffix(name, ".tmp") && strings.Contains(name, ".tar.")
+}
@@ -0,0 +1,132 @@
+package deploy
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/yoanbernabeu/frankendeploy/internal/ssh"
+)
+
+// gcMock simulates a server with the apps shop and blog
+func gcMock() *ssh.MockExecutor {
+	return &ssh.MockExecutor{
+		ExecFunc: func(ctx context.Context, command string) (*ssh.ExecResult, error) {
+			switch {
+			case strings.Contains(command, "ls -1 /opt/frankendeploy/apps/shop/releases"):
+				return &ssh.ExecResult{Stdout: "v3\nv4\n"}, nil
+			case strings.Contains(command, "ls -1 /opt/frankendeploy/apps/blog/releases"):
+				return &ssh.ExecResult{Stdout: "v1\n"}, nil
+			case strings.Contains(command, "ls -1 /opt/frankendeploy/apps"):
+				return &ssh.ExecResult{Stdout: "shop\nblog\n"}, nil
+			case strings.HasPrefix(command, "docker ps -a"):
+				return &ssh.ExecResult{Stdout: "shop\trunning\nshop-new\texited\nshop-old\trunning\n" +
+					"blog-rollback\tcreated\nblog-db\texited\nother-new\texited\n"}, nil
+			case strings.HasPrefix(command, "docker images shop"):
+				return &ssh.ExecResult{Stdout: "v1\nv2\nv3\nv4\n"}, nil
+			case strings.HasPrefix(command, "docker images blog"):
+				return &ssh.ExecResult{Stdout: "v1\n"}, nil
+			case strings.HasPrefix(command, "docker image prune"):
+				return &ssh.ExecResult{Stdout: "Deleted Images:\nsha256:abc\n\nTotal reclaimed space: 1.2GB\n"}, nil
+			case strings.HasPrefix(command, "docker builder prune"):
+				return &ssh.ExecResult{Stdout: "ID\tRECLAIMABLE\tSIZE\nabc\ttrue\t300MB\nTotal:\t300MB\n"}, nil
+			case strings.HasPrefix(command, "find /tmp"):
+				return &ssh.ExecResult{Stdout: "/tmp/shop-v2.tar\n/etc/passwd\n"}, nil
+			}
+			return &ssh.ExecResult{}, nil
+		},
+	}
+}
+
+func TestCollectGarbage(t *testing.T) {
+	mock := gcMock()
+	report, err := CollectGarbage(context.Background(), mock, false)
+	if err != nil {
+		t.Fatalf("CollectGarbage() error = %v", err)
+	}
+
+	if strings.Join(report.Containers, ",") != "shop-new,blog-rollback" {
+		t.Errorf("Containers = %v, want the stopped temporary containers only", report.Containers)
+	}
+	if strings.Join(report.RunningContainers, ",") != "shop-old" {
+		t.Errorf("RunningContainers = %v", report.RunningContainers)
+	}
+	if strings.Join(report.Images["shop"], ",") != "v1,v2" || len(report.Images["blog"]) != 0 {
+		t.Errorf("Images = %v", report.Images)
+	}
+	if report.DanglingImages != "1.2GB" || report.BuildCache != "300MB" {
+		t.Errorf("reclaimed = %q, %q", report.DanglingImages, report.BuildCache)
+	}
+	if strings.Join(report.Tars, ",") != "/tmp/shop-v2.tar" {
+		t.Errorf("Tars = %v", report.Tars)
+	}
+
+	all := strings.Join(mock.Commands, "\n")
+	for _, cmd := range mock.Commands {
+		if strings.Contains(cmd, " -f ") && strings.HasPrefix(cmd, "docker r") {
+			t.Errorf("nothing may be forced: %s", cmd)
+		}
+	}
+	for _, unwanted := range []string{"docker rm shop-old", "docker rm other-new", "docker rm blog-db", "/etc/passwd", "docker image prune -a"} {
+		if strings.Contains(all, unwanted) {
+			t.Errorf("unexpected %q in:\n%s", unwanted, all)
+		}
+	}
+	for _, want := range []string{"until=24h", "-mmin +60", "-name 'shop-*.tar' -o -name '.shop-*.tar.*.tmp' -o -name 'blog-*.tar'", "rm -f '/tmp/shop-v2.tar'"} {
+		if !strings.Contains(all, want) {
+			t.Errorf("expected %q in:\n%s", want, all)
+		}
+	}
+}
+
+func TestCollectGarbage_PartialUploads(t *testing.T) {
+	mock := &ssh.MockExecutor{
+		ExecFunc: func(ctx context.Context, command string) (*ssh.ExecResult, error) {
+			if strings.HasPrefix(command, "find /tmp") {
+				return &ssh.ExecResult{Stdout: "/tmp/.shop-v3.tar.1a2b3c4d.tmp\n/tmp/.bashrc.tmp\n"}, nil
+			}
+			return &ssh.ExecResult{}, nil
+		},
+	}
+	report := &GCReport{}
+	if err := collectTars(context.Background(), mock, []string{"shop"}, false, report); err != nil {
+		t.Fatalf("collectTars() error = %v", err)
+	}
+	if strings.Join(report.Tars, ",") != "/tmp/.shop-v3.tar.1a2b3c4d.tmp" {
+		t.Errorf("Tars = %v, want the partial upload only", report.Tars)
+	}
+	if !strings.Contains(strings.Join(mock.Commands, "\n"), "rm -f '/tmp/.shop-v3.tar.1a2b3c4d.tmp'") {
+		t.Errorf("the partial upload should be removed: %v", mock.Commands)
+	}
+}
+
+func TestCollectGarbage_DryRunRemovesNothing(t *testing.T) {
+	mock := gcMock()
+	report, err := CollectGarbage(context.Background(), mock, true)
+	if err != nil {
+		t.Fatalf("CollectGarbage() error = %v", err)
+	}
+	for _, cmd := range mock.Commands {
+		if strings.Contains(cmd, "docker rm") || strings.Contains(cmd, "prune") || strings.HasPrefix(cmd, "rm ") {
+			t.Errorf("a dry run must not remove anything: %s", cmd)
+		}
+	}
+	if len(report.Containers) != 2 || len(report.Images["shop"]) != 2 || len(report.Tars) != 1 {
+		t.Errorf("a dry run must list what would be removed: %+v", report)
+	}
+}
+
+func TestCollectGarbage_UnknownAppsRemovesNothing(t *testing.T) {
+	mock := &ssh.MockExecutor{
+		ExecFunc: func(ctx context.Context, command string) (*ssh.ExecResult, error) {
+			return nil, errors.New("connection lost")
+		},
+	}
+	if _, err := CollectGarbage(context.Background(), mock, false); err == nil || !strings.Contains(err.Error(), "nothing removed") {
+		t.Fatalf("expected a nothing removed error, got %v", err)
+	}
+	if len(mock.Commands) != 1 {
+		t.Errorf("nothing may run once the apps cannot be listed: %v", mock.Commands)
+	}
+}
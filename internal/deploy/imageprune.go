@@ -22,6 +22,27 @@ import (
 //
 // Returns the list of removed tags.
 func PruneOldImages(ctx context.Context, client ssh.Executor, appName, appPath string) ([]string, error) {
+	tags, err := OldImageTags(ctx, client, appName, appPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var removed []string
+	for _, tag := range tags {
+		result, err := client.Exec(ctx, fmt.Sprintf("docker rmi %s:%s", appName, tag))
+		if err != nil || result == nil || result.ExitCode != 0 {
+			// In use or transient error: skip, the next deploy retries
+			continue
+		}
+		removed = append(removed, tag)
+	}
+
+	return removed, nil
+}
+
+// OldImageTags returns the app's image tags PruneOldImages would remove,
+// following the same rules: none when the kept releases are unknown.
+func OldImageTags(ctx context.Context, client ssh.Executor, appName, appPath string) ([]string, error) {
 	keptResult, err := client.Exec(ctx, fmt.Sprintf("ls -1 %s/releases 2>/dev/null", appPath))
 	if err != nil || keptResult == nil {
 		return nil, fmt.Errorf("cannot list kept releases: %w", err)
@@ -41,19 +62,13 @@ func PruneOldImages(ctx context.Context, client ssh.Executor, appName, appPath s
 		return nil, fmt.Errorf("cannot list images: %w", err)
 	}
 
-	var removed []string
+	var tags []string
 	for _, line := range strings.Split(imagesResult.Stdout, "\n") {
 		tag := strings.TrimSpace(line)
 		if tag == "" || tag == "<none>" || tag == "latest" || kept[tag] {
 			continue
 		}
-		result, err := client.Exec(ctx, fmt.Sprintf("docker rmi %s:%s", appName, tag))
-		if err != nil || result == nil || result.ExitCode != 0 {
-			// In use or transient error: skip, the next deploy retries
-			continue
-		}
-		removed = append(removed, tag)
+		tags = append(tags, tag)
 	}
-
-	return removed, nil
+	return tags, nil
 }
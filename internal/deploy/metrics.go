@@ -0,0 +1,176 @@
+package deploy
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/yoanbernabeu/frankendeploy/internal/security"
+)
+
+// MemoryWarnPercent is the share of its memory limit from which a container
+// is reported close to being OOM-killed
+const MemoryWarnPercent = 90
+
+// ServerMetrics is a snapshot of the resources of a server. Percentages are
+// -1 and sizes 0 when the server could not report them.
+type ServerMetrics struct {
+	CPUPercent float64            `json:"cpu_percent"`
+	MemUsed    int64              `json:"mem_used"`
+	MemTotal   int64              `json:"mem_total"`
+	DiskUsed   int64              `json:"disk_used"`
+	DiskTotal  int64              `json:"disk_total"`
+	Load       string             `json:"load"`
+	Containers []ContainerMetrics `json:"containers"`
+}
+
+// ContainerMetrics is the resource usage of a running container. MemLimit
+// is the --memory limit (deploy.memory_limit), 0 when unlimited.
+type ContainerMetrics struct {
+	Name       string  `json:"name"`
+	CPUPercent float64 `json:"cpu_percent"`
+	MemUsed    int64   `json:"mem_used"`
+	MemLimit   int64   `json:"mem_limit"`
+	NetRx      int64   `json:"net_rx"`
+	NetTx      int64   `json:"net_tx"`
+	Restarts   int     `json:"restarts"`
+}
+
+// NearMemoryLimit reports whether the container uses MemoryWarnPercent of
+// its memory limit or more
+func (c ContainerMetrics) NearMemoryLimit() bool {
+	return c.MemLimit > 0 && c.MemUsed*100 >= c.MemLimit*MemoryWarnPercent
+}
+
+// MetricsCommand returns the script collecting the metrics of a server with
+// a single SSH command, one tab-separated record per line. The CPU counters
+// of /proc/stat are read before and after docker stats, which samples for
+// about two seconds: the CPU usage is the difference between both reads.
+func MetricsCommand() (string, error) {
+	delimiter, err := security.GenerateHeredocDelimiter("TOP")
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf(`sh -s << '%[1]s'
+cpu() { head -n 1 /proc/stat | awk '{$1 = ""; print "cpu\t" substr($0, 2)}'; }
+cpu
+docker stats --no-stream --format '{{.Name}}\t{{.CPUPerc}}\t{{.MemUsage}}\t{{.NetIO}}' 2>/dev/null | awk '{print "stats\t" $0}'
+cpu
+awk '/^MemTotal:/ {total = $2} /^MemAvailable:/ {available = $2} END {print "mem\t" total - available "\t" total}' /proc/meminfo
+df -Pk / | awk 'NR == 2 {print "disk\t" $3 "\t" $2}'
+awk '{print "load\t" $1 " " $2 " " $3}' /proc/loadavg
+ids=$(docker ps -q 2>/dev/null)
+[ -n "$ids" ] && docker inspect --format '{{.Name}} {{.RestartCount}} {{.HostConfig.Memory}}' $ids 2>/dev/null | awk '{sub("^/", "", $1); print "container\t" $1 "\t" $2 "\t" $3}'
+true
+%[1]s`, delimiter), nil
+}
+
+// ParseMetrics parses the output of MetricsCommand. Containers are sorted
+// by name.
+func ParseMetrics(out string) *ServerMetrics {
+	metrics := &ServerMetrics{CPUPercent: -1}
+	var cpuSamples [][]int64
+	containers := make(map[string]*ContainerMetrics)
+	container := func(name string) *ContainerMetrics {
+		if containers[name] == nil {
+			containers[name] = &ContainerMetrics{Name: name, CPUPercent: -1}
+		}
+		return containers[name]
+	}
+
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Split(strings.TrimRight(line, "\r"), "\t")
+		switch {
+		case fields[0] == "cpu" && len(fields) == 2:
+			if sample := parseCPUCounters(fields[1]); sample != nil {
+				cpuSamples = append(cpuSamples, sample)
+			}
+		case fields[0] == "mem" && len(fields) == 3:
+			metrics.MemUsed = max(parseKiB(fields[1]), 0)
+			metrics.MemTotal = max(parseKiB(fields[2]), 0)
+		case fields[0] == "disk" && len(fields) == 3:
+			metrics.DiskUsed = max(parseKiB(fields[1]), 0)
+			metrics.DiskTotal = max(parseKiB(fields[2]), 0)
+		case fields[0] == "load" && len(fields) == 2:
+			metrics.Load = fields[1]
+		case fields[0] == "stats" && len(fields) == 5:
+			c := container(fields[1])
+			c.CPUPercent = parsePercent(fields[2])
+			used, _, _ := strings.Cut(fields[3], "/")
+			c.MemUsed = max(ParseDockerSize(used), 0)
+			rx, tx, _ := strings.Cut(fields[4], "/")
+			c.NetRx = max(ParseDockerSize(rx), 0)
+			c.NetTx = max(ParseDockerSize(tx), 0)
+		case fields[0] == "container" && len(fields) == 4:
+			c := container(fields[1])
+			c.Restarts, _ = strconv.Atoi(fields[2])
+			c.MemLimit, _ = strconv.ParseInt(fields[3], 10, 64)
+		}
+	}
+
+	if len(cpuSamples) == 2 {
+		metrics.CPUPercent = cpuPercent(cpuSamples[0], cpuSamples[1])
+	}
+	for _, c := range containers {
+		metrics.Containers = append(metrics.Containers, *c)
+	}
+	sort.Slice(metrics.Containers, func(i, j int) bool {
+		return metrics.Containers[i].Name < metrics.Containers[j].Name
+	})
+	return metrics
+}
+
+// parseCPUCounters parses the counters of the cpu line of /proc/stat: user,
+// nice, system, idle, iowait, irq, softirq, steal...
+func parseCPUCounters(s string) []int64 {
+	fields := strings.Fields(s)
+	if len(fields) < 4 {
+		return nil
+	}
+	counters := make([]int64, len(fields))
+	for i, field := range fields {
+		value, err := strconv.ParseInt(field, 10, 64)
+		if err != nil {
+			return nil
+		}
+		counters[i] = value
+	}
+	return counters
+}
+
+// cpuPercent is the CPU usage between two reads of /proc/stat: the share of
+// time spent neither idle nor waiting for I/O. -1 when no time elapsed.
+func cpuPercent(before, after []int64) float64 {
+	idle := func(counters []int64) int64 {
+		if len(counters) > 4 {
+			return counters[3] + counters[4]
+		}
+		return counters[3]
+	}
+	// guest and guest_nice are already counted in user and nice
+	total := func(counters []int64) int64 {
+		var sum int64
+		for i, value := range counters {
+			if i < 8 {
+				sum += value
+			}
+		}
+		return sum
+	}
+	elapsed := total(after) - total(before)
+	if elapsed <= 0 {
+		return -1
+	}
+	return float64(elapsed-(idle(after)-idle(before))) * 100 / float64(elapsed)
+}
+
+// parsePercent parses a percentage printed by docker stats ("12.34%"), -1
+// when it cannot be read
+func parsePercent(s string) float64 {
+	value, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(s), "%"), 64)
+	if err != nil {
+		return -1
+	}
+	return value
+}
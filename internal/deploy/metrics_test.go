@@ -0,0 +1,79 @@
+package deploy
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestParseMetrics(t *testing.T) {
+	out := strings.Join([]string{
+		"cpu\t1000 0 500 8000 500 0 0 0 0 0",
+		"stats\tshop\t12.50%\t470MiB / 512MiB\t1.2MB / 3.4kB",
+		"stats\tcaddy\t0.30%\t25.5MiB / 1.9GiB\t12MB / 15MB",
+		"cpu\t1600 0 700 8150 550 0 0 0 0 0",
+		"mem\t1048576\t2097152",
+		"disk\t12582912\t26214400",
+		"load\t0.52 0.40 0.31",
+		"container\tshop\t3\t536870912",
+		"container\tcaddy\t0\t0",
+		"container\tshop-worker\t1\t536870912",
+		"garbage line",
+	}, "\n")
+
+	metrics := ParseMetrics(out)
+	// 1000 elapsed, 200 idle or waiting for I/O
+	if metrics.CPUPercent != 80 {
+		t.Errorf("CPUPercent = %v, want 80", metrics.CPUPercent)
+	}
+	if metrics.MemUsed != 1<<30 || metrics.MemTotal != 2<<30 {
+		t.Errorf("mem = %d/%d", metrics.MemUsed, metrics.MemTotal)
+	}
+	if metrics.DiskUsed != 12582912<<10 || metrics.DiskTotal != 26214400<<10 {
+		t.Errorf("disk = %d/%d", metrics.DiskUsed, metrics.DiskTotal)
+	}
+	if metrics.Load != "0.52 0.40 0.31" {
+		t.Errorf("Load = %q", metrics.Load)
+	}
+
+	if len(metrics.Containers) != 3 {
+		t.Fatalf("containers = %+v", metrics.Containers)
+	}
+	caddy, shop, worker := metrics.Containers[0], metrics.Containers[1], metrics.Containers[2]
+	if caddy.Name != "caddy" || caddy.MemLimit != 0 || caddy.NearMemoryLimit() {
+		t.Errorf("caddy = %+v", caddy)
+	}
+	if shop.CPUPercent != 12.5 || shop.MemUsed != 470<<20 || shop.NetRx != 1.2e6 || shop.NetTx != 3400 || shop.Restarts != 3 {
+		t.Errorf("shop = %+v", shop)
+	}
+	if !shop.NearMemoryLimit() {
+		t.Error("shop uses 92% of its memory limit, NearMemoryLimit() = false")
+	}
+	// Started after docker stats sampled the containers
+	if worker.Name != "shop-worker" || worker.CPUPercent != -1 || worker.Restarts != 1 {
+		t.Errorf("worker = %+v", worker)
+	}
+}
+
+func TestParseMetricsUnknownCPU(t *testing.T) {
+	metrics := ParseMetrics("cpu\t1000 0 500 8000\nmem\t\t\n")
+	if metrics.CPUPercent != -1 {
+		t.Errorf("CPUPercent = %v with a single sample, want -1", metrics.CPUPercent)
+	}
+	if metrics.MemUsed != 0 || metrics.MemTotal != 0 {
+		t.Errorf("mem = %d/%d, want 0/0", metrics.MemUsed, metrics.MemTotal)
+	}
+}
+
+func TestMetricsCommandSyntax(t *testing.T) {
+	script, err := MetricsCommand()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Count(script, "\ncpu\n") != 2 {
+		t.Error("MetricsCommand() should read /proc/stat before and after docker stats")
+	}
+	if out, err := exec.Command("sh", "-n", "-c", script).CombinedOutput(); err != nil {
+		t.Errorf("MetricsCommand() is not a valid shell script: %v\n%s", err, out)
+	}
+}
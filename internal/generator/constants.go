@@ -32,4 +32,14 @@ const (
 	// Database ports
 	PostgresPort = "5432"
 	MySQLPort    = "3306"
+
+	// GitSSHCommand is the ssh used by composer through the forwarded
+	// ssh-agent: the build container has no known_hosts, Git host keys are
+	// accepted for the build only
+	GitSSHCommand = "ssh -o StrictHostKeyChecking=accept-new -o UserKnownHostsFile=/dev/null"
+
+	// Download caches kept in BuildKit cache mounts between builds, never
+	// in an image layer
+	ComposerCacheDir = "/root/.cache/composer"
+	NpmCacheDir      = "/root/.npm"
 )
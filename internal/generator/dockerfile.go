@@ -11,6 +11,12 @@ import (
 type DockerfileGenerator struct {
 	loader *TemplateLoader
 	config *config.ProjectConfig
+	// ForwardAgent mounts the ssh-agent forwarded by the build in the
+	// composer steps, for private Git dependencies
+	ForwardAgent bool
+	// NoCache leaves out the BuildKit cache mounts of the apt, npm and
+	// composer steps
+	NoCache bool
 }
 
 // NewDockerfileGenerator creates a new Dockerfile generator
@@ -34,6 +40,51 @@ type DockerfileData struct {
 	// HasPreload enables opcache.preload when the project ships a
 	// config/preload.php
 	HasPreload bool
+	// ForwardAgent runs composer with RUN --mount=type=ssh
+	ForwardAgent bool
+	// CacheMounts keeps the apt, npm and composer download caches in
+	// BuildKit cache mounts between builds
+	CacheMounts bool
+}
+
+// HasSecret reports whether the build secret id is configured
+func (d DockerfileData) HasSecret(id string) bool {
+	for _, secret := range d.Dockerfile.Secrets {
+		if secret.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// ComposerMounts returns the RUN --mount options of composer install: the
+// forwarded ssh-agent, the composer_auth secret and the download cache,
+// when enabled
+func (d DockerfileData) ComposerMounts() string {
+	var mounts string
+	if d.ForwardAgent {
+		mounts += "--mount=type=ssh "
+	}
+	if d.HasSecret(config.SecretComposerAuth) {
+		mounts += "--mount=type=secret,id=" + config.SecretComposerAuth + ",env=COMPOSER_AUTH "
+	}
+	if d.CacheMounts {
+		mounts += "--mount=type=cache,target=" + ComposerCacheDir + " "
+	}
+	return mounts
+}
+
+// NpmMounts returns the RUN --mount options of npm ci: the npmrc secret
+// and the download cache, when enabled
+func (d DockerfileData) NpmMounts() string {
+	var mounts string
+	if d.HasSecret(config.SecretNpmrc) {
+		mounts += "--mount=type=secret,id=" + config.SecretNpmrc + ",target=/root/.npmrc "
+	}
+	if d.CacheMounts {
+		mounts += "--mount=type=cache,target=" + NpmCacheDir + " "
+	}
+	return mounts
 }
 
 // Generate generates the Dockerfile content
@@ -45,6 +96,8 @@ func (g *DockerfileGenerator) Generate() (string, error) {
 		FrankenPHPVersion: g.config.FrankenPHPVersion,
 		HealthcheckPath:   g.config.Deploy.HealthcheckPath,
 		HasPreload:        hasPreloadFile(),
+		ForwardAgent:      g.ForwardAgent,
+		CacheMounts:       !g.NoCache,
 	}
 
 	if g.config.Assets.BuildTool != "" {
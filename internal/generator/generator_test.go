@@ -364,6 +364,118 @@ func TestDockerfileGenerator_Generate_Minimal(t *testing.T) {
 	}
 }
 
+func TestDockerfileGenerator_Generate_ForwardAgent(t *testing.T) {
+	cfg := &config.ProjectConfig{
+		Name: "test-app",
+		PHP:  config.PHPConfig{Version: "8.3"},
+	}
+	gen := NewDockerfileGenerator(cfg)
+	dockerfile, err := gen.Generate()
+	if err != nil {
+		t.Fatalf("failed to generate: %v", err)
+	}
+	if strings.Contains(dockerfile, "--mount=type=ssh") || strings.Contains(dockerfile, "openssh-client") {
+		t.Error("the ssh mount should only be generated with ForwardAgent")
+	}
+
+	gen.ForwardAgent = true
+	dockerfile, err = gen.Generate()
+	if err != nil {
+		t.Fatalf("failed to generate: %v", err)
+	}
+	if n := strings.Count(dockerfile, "RUN --mount=type=ssh "); n != 2 {
+		t.Errorf("both composer install steps should mount the agent, got %d", n)
+	}
+	for _, want := range []string{"openssh-client", `GIT_SSH_COMMAND="` + GitSSHCommand + `"`} {
+		if !strings.Contains(dockerfile, want) {
+			t.Errorf("Dockerfile should contain %q", want)
+		}
+	}
+}
+
+func TestDockerfileGenerator_Generate_BuildArgsAndSecrets(t *testing.T) {
+	cfg := &config.ProjectConfig{
+		Name:   "test-app",
+		PHP:    config.PHPConfig{Version: "8.3"},
+		Assets: config.AssetsConfig{BuildTool: "vite", BuildCommand: "npm run build"},
+		Dockerfile: config.DockerfileConfig{
+			BuildArgs: map[string]string{"APP_VERSION": "1.2", "SENTRY_RELEASE": "abc"},
+			Secrets: []config.BuildSecret{
+				{ID: config.SecretComposerAuth, File: "auth.json"},
+				{ID: config.SecretNpmrc, Env: "NPMRC"},
+			},
+		},
+	}
+	dockerfile, err := NewDockerfileGenerator(cfg).Generate()
+	if err != nil {
+		t.Fatalf("failed to generate: %v", err)
+	}
+
+	// Declared in the node, base and prod stages
+	if n := strings.Count(dockerfile, "ARG APP_VERSION\n"); n != 3 {
+		t.Errorf("ARG APP_VERSION declared %d times, want 3", n)
+	}
+	for _, want := range []string{
+		"RUN --mount=type=secret,id=npmrc,target=/root/.npmrc ",
+		"RUN --mount=type=secret,id=composer_auth,env=COMPOSER_AUTH ",
+	} {
+		if !strings.Contains(dockerfile, want) {
+			t.Errorf("Dockerfile should contain %q", want)
+		}
+	}
+	// Build arg values are given to docker build, never written in the file
+	if strings.Contains(dockerfile, "1.2") {
+		t.Error("build arg values must not be written in the Dockerfile")
+	}
+
+	cfg.Dockerfile.Secrets = []config.BuildSecret{{ID: "bad id", Env: "X"}}
+	if _, err := NewDockerfileGenerator(cfg).Generate(); err == nil {
+		t.Error("an invalid secret id should be rejected")
+	}
+}
+
+func TestDockerfileGenerator_Generate_CacheMounts(t *testing.T) {
+	cfg := &config.ProjectConfig{
+		Name:   "test-app",
+		PHP:    config.PHPConfig{Version: "8.3"},
+		Assets: config.AssetsConfig{BuildTool: "vite", BuildCommand: "npm run build"},
+	}
+	gen := NewDockerfileGenerator(cfg)
+	dockerfile, err := gen.Generate()
+	if err != nil {
+		t.Fatalf("failed to generate: %v", err)
+	}
+	for _, want := range []string{
+		"--mount=type=cache,target=/var/cache/apt,sharing=locked",
+		"RUN --mount=type=cache,target=" + NpmCacheDir + " npm ci",
+		"COMPOSER_CACHE_DIR=" + ComposerCacheDir,
+	} {
+		if !strings.Contains(dockerfile, want) {
+			t.Errorf("Dockerfile should contain %q", want)
+		}
+	}
+	if n := strings.Count(dockerfile, "--mount=type=cache,target="+ComposerCacheDir); n != 2 {
+		t.Errorf("both composer install steps should mount the cache, got %d", n)
+	}
+	if strings.Contains(dockerfile, "--no-cache") || strings.Contains(dockerfile, "rm -rf /var/lib/apt/lists") {
+		t.Error("downloads should be kept in the cache mounts")
+	}
+
+	gen.NoCache = true
+	dockerfile, err = gen.Generate()
+	if err != nil {
+		t.Fatalf("failed to generate: %v", err)
+	}
+	if strings.Contains(dockerfile, "--mount=type=cache") || strings.Contains(dockerfile, "COMPOSER_CACHE_DIR") {
+		t.Error("NoCache should leave out the cache mounts")
+	}
+	for _, want := range []string{"composer install --no-cache", "rm -rf /var/lib/apt/lists/*"} {
+		if !strings.Contains(dockerfile, want) {
+			t.Errorf("Dockerfile should contain %q", want)
+		}
+	}
+}
+
 func TestDockerfileGenerator_Generate_WithExtensions(t *testing.T) {
 	cfg := &config.ProjectConfig{
 		Name: "test-app",
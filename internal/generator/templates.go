@@ -87,12 +87,14 @@ func templateFuncs() template.FuncMap {
 			replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`, "\t", `\t`)
 			return replacer.Replace(s)
 		},
-		"appPort":     func() string { return AppPort },
-		"devPort":     func() string { return DevExternalPort },
-		"logMaxSize":  func() string { return constants.LogMaxSize },
-		"logMaxFile":  func() string { return constants.LogMaxFile },
-		"defaultUID":  func() string { return DefaultUID },
-		"defaultGID":  func() string { return DefaultGID },
-		"networkName": func() string { return NetworkName },
+		"appPort":          func() string { return AppPort },
+		"devPort":          func() string { return DevExternalPort },
+		"logMaxSize":       func() string { return constants.LogMaxSize },
+		"logMaxFile":       func() string { return constants.LogMaxFile },
+		"defaultUID":       func() string { return DefaultUID },
+		"defaultGID":       func() string { return DefaultGID },
+		"networkName":      func() string { return NetworkName },
+		"gitSSHCommand":    func() string { return GitSSHCommand },
+		"composerCacheDir": func() string { return ComposerCacheDir },
 	}
 }
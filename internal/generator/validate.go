@@ -23,6 +23,8 @@ var (
 	// healthPathRegex: absolute URL path, safe chars only. Flows into the
 	// Dockerfile HEALTHCHECK shell command and compose healthcheck test.
 	healthPathRegex = regexp.MustCompile(`^/[a-zA-Z0-9._/-]*$`)
+	// buildSecretIDRegex: flows into RUN --mount options
+	buildSecretIDRegex = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
 )
 
 // dockerfileInstructions are the valid Dockerfile instruction keywords
@@ -79,6 +81,18 @@ func ValidateDockerfileData(data DockerfileData) error {
 		}
 	}
 
+	for name := range data.Dockerfile.BuildArgs {
+		if err := security.ValidateEnvKey(name); err != nil {
+			return fmt.Errorf("invalid build arg name %q: %w", name, err)
+		}
+	}
+
+	for _, secret := range data.Dockerfile.Secrets {
+		if !buildSecretIDRegex.MatchString(secret.ID) {
+			return fmt.Errorf("invalid build secret id %q: only alphanumeric, dots, underscores, and hyphens allowed", secret.ID)
+		}
+	}
+
 	for _, ini := range data.PHP.IniValues {
 		if err := validateIniValue(ini); err != nil {
 			return fmt.Errorf("invalid PHP ini value: %w", err)
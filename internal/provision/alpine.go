@@ -0,0 +1,179 @@
+package provision
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Alpine provisions Alpine servers: apk, OpenRC and iptables. sudo must be
+// installed for the SSH user (Alpine defaults to doas).
+type Alpine struct{}
+
+// Name implements Provisioner
+func (Alpine) Name() string { return "alpine" }
+
+// InstallCommand implements Provisioner
+func (Alpine) InstallCommand(packages ...string) string {
+	return "sudo apk add -q " + strings.Join(packages, " ")
+}
+
+// PrereqCommands implements Provisioner
+func (a Alpine) PrereqCommands() []string {
+	return []string{
+		"sudo apk update -q",
+		a.InstallCommand("curl", "ca-certificates"),
+	}
+}
+
+// Fail2banCommands implements Provisioner
+func (a Alpine) Fail2banCommands() []string {
+	return []string{
+		a.InstallCommand("fail2ban"),
+		"sudo rc-update add fail2ban default",
+		"sudo rc-service fail2ban start",
+	}
+}
+
+// Fail2banJailCommand implements Provisioner. sshd logs through syslog to
+// /var/log/messages.
+func (Alpine) Fail2banJailCommand() string {
+	return fail2banJailCommand(fail2banJail("logpath = /var/log/messages"))
+}
+
+// RestartCommand implements Provisioner
+func (Alpine) RestartCommand(service string) string {
+	return "sudo rc-service " + service + " restart"
+}
+
+// DockerCommands implements Provisioner
+func (a Alpine) DockerCommands() []string {
+	return []string{
+		"which docker || " + a.InstallCommand("docker", "docker-cli-buildx"),
+		"sudo addgroup $USER docker || true",
+		"sudo rc-update add docker default",
+		"sudo rc-service docker start",
+	}
+}
+
+// DockerUpgradeCommands implements Provisioner. apk never restarts
+// services: the daemon is restarted.
+func (a Alpine) DockerUpgradeCommands() []string {
+	return []string{
+		"sudo apk upgrade -U -q docker docker-cli-buildx",
+		a.RestartCommand("docker"),
+	}
+}
+
+// FirewallCommands implements Provisioner. Alpine has no firewall manager
+// by default: plain iptables rules (IPv4 and IPv6) are added idempotently,
+// the INPUT policy is switched to DROP last, then the rules are saved and
+// restored at boot.
+func (a Alpine) FirewallCommands(sshPorts []int) []string {
+	ports := uniquePorts(append(append([]int{}, sshPorts...), 80, 443))
+	cmds := []string{"which iptables ip6tables || " + a.InstallCommand("iptables", "ip6tables")}
+	for _, tool := range []string{"iptables", "ip6tables"} {
+		icmp := "icmp"
+		if tool == "ip6tables" {
+			// IPv6 neighbor discovery relies on ICMPv6
+			icmp = "ipv6-icmp"
+		}
+		rules := []string{
+			"-i lo -j ACCEPT",
+			"-m conntrack --ctstate ESTABLISHED,RELATED -j ACCEPT",
+			"-p " + icmp + " -j ACCEPT",
+		}
+		for _, port := range ports {
+			rules = append(rules, fmt.Sprintf("-p tcp -m tcp --dport %d -j ACCEPT", port))
+		}
+		for _, rule := range rules {
+			cmds = append(cmds, fmt.Sprintf("sudo %[1]s -C INPUT %[2]s 2>/dev/null || sudo %[1]s -A INPUT %[2]s", tool, rule))
+		}
+	}
+	cmds = append(cmds,
+		"sudo iptables -P INPUT DROP || true",
+		"sudo ip6tables -P INPUT DROP || true",
+		"sudo rc-service iptables save || true",
+		"sudo rc-service ip6tables save || true",
+		"sudo rc-update add iptables default || true",
+		"sudo rc-update add ip6tables default || true",
+	)
+	return cmds
+}
+
+// FirewallStatusCommand implements Provisioner
+func (Alpine) FirewallStatusCommand() string {
+	return "command -v iptables >/dev/null || { echo 'iptables: not installed'; exit 127; }; sudo -n iptables -S INPUT"
+}
+
+// ParseFirewallStatus implements Provisioner: 'iptables -S INPUT' rules,
+// with a single --dport or a multiport --dports list
+func (Alpine) ParseFirewallStatus(out string) (bool, map[int]bool) {
+	allowed := make(map[int]bool)
+	active := false
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 3 && fields[0] == "-P" && fields[1] == "INPUT" {
+			active = fields[2] == "DROP" || fields[2] == "REJECT"
+			continue
+		}
+		if !strings.HasSuffix(line, "-j ACCEPT") || !strings.Contains(line, "-p tcp") {
+			continue
+		}
+		for i, field := range fields[:len(fields)-1] {
+			switch field {
+			case "--dport":
+				allowPortSpec(allowed, fields[i+1], ":")
+			case "--dports":
+				for _, spec := range strings.Split(fields[i+1], ",") {
+					allowPortSpec(allowed, spec, ":")
+				}
+			}
+		}
+	}
+	return active, allowed
+}
+
+// SecurityUpdatesCommand implements Provisioner: apk publishes no security
+// advisories
+func (Alpine) SecurityUpdatesCommand() string {
+	return "echo " + SecurityUnsupported
+}
+
+// SecurityUpgradeCommands implements Provisioner
+func (Alpine) SecurityUpgradeCommands([]string) []string {
+	return []string{"sudo apk update -q", "sudo apk upgrade -q"}
+}
+
+// AutoUpdatesCommands implements Provisioner. Stable Alpine branches only
+// receive security and bug fixes: a daily apk upgrade run by crond stands
+// for unattended security upgrades.
+func (a Alpine) AutoUpdatesCommands() []string {
+	const script = "/etc/periodic/daily/frankendeploy-upgrade"
+	return []string{
+		writeFileCommand(script, "#!/bin/sh\napk upgrade -U -q\n", "APKEOF"),
+		"sudo chmod 755 " + script,
+		"sudo rc-update add crond default",
+		"sudo rc-service crond start",
+	}
+}
+
+// CreateUserCommands implements Provisioner. adduser -D locks the
+// password, which Alpine's sshd also refuses key logins for: the password
+// is set to '*' instead, which matches no password.
+func (Alpine) CreateUserCommands(user string) []string {
+	return []string{
+		fmt.Sprintf("id -u %[1]s >/dev/null 2>&1 || (sudo adduser -D -s /bin/sh %[1]s && echo '%[1]s:*' | sudo chpasswd -e)", user),
+		fmt.Sprintf("sudo addgroup %s docker", user),
+	}
+}
+
+// ReloadSSHCommand implements Provisioner
+func (Alpine) ReloadSSHCommand() string {
+	return "sudo rc-service sshd reload"
+}
+
+// SwapBootCommands implements Provisioner: the OpenRC swap service reads
+// /etc/fstab, when it is in the boot runlevel
+func (Alpine) SwapBootCommands() []string {
+	return []string{"sudo rc-update add swap boot"}
+}
@@ -0,0 +1,182 @@
+package provision
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Debian provisions Debian and Ubuntu servers: apt, systemd and UFW
+type Debian struct{}
+
+// Name implements Provisioner
+func (Debian) Name() string { return "debian" }
+
+// InstallCommand implements Provisioner
+func (Debian) InstallCommand(packages ...string) string {
+	return "sudo DEBIAN_FRONTEND=noninteractive apt-get install -y -qq " + strings.Join(packages, " ")
+}
+
+// PrereqCommands implements Provisioner
+func (d Debian) PrereqCommands() []string {
+	return []string{
+		"sudo apt-get update -qq",
+		d.InstallCommand("curl", "ca-certificates"),
+	}
+}
+
+// Fail2banCommands implements Provisioner
+func (d Debian) Fail2banCommands() []string {
+	return []string{
+		d.InstallCommand("fail2ban"),
+		"sudo systemctl enable fail2ban",
+		"sudo systemctl start fail2ban",
+	}
+}
+
+// Fail2banJailCommand implements Provisioner
+func (Debian) Fail2banJailCommand() string {
+	return fail2banJailCommand(fail2banJail("logpath = /var/log/auth.log"))
+}
+
+// RestartCommand implements Provisioner
+func (Debian) RestartCommand(service string) string {
+	return "sudo systemctl restart " + service
+}
+
+// DockerCommands implements Provisioner
+func (Debian) DockerCommands() []string {
+	return []string{
+		// Install Docker if not present
+		"which docker || (curl -fsSL https://get.docker.com | sudo sh)",
+		// Add user to docker group
+		"sudo usermod -aG docker $USER || true",
+		// Enable and start Docker
+		"sudo systemctl enable docker",
+		"sudo systemctl start docker",
+	}
+}
+
+// DockerUpgradeCommands implements Provisioner. get.docker.com installs
+// from the Docker apt repository; the packages restart the daemon.
+func (Debian) DockerUpgradeCommands() []string {
+	return []string{
+		"sudo apt-get update -qq",
+		"sudo DEBIAN_FRONTEND=noninteractive apt-get install -y -qq --only-upgrade docker-ce docker-ce-cli containerd.io docker-buildx-plugin docker-compose-plugin",
+	}
+}
+
+// FirewallCommands implements Provisioner. Every allow runs before UFW is
+// enabled: the SSH ports (the configured one and, behind a gateway/NAT,
+// the server-side one) must be open or the user gets locked out.
+func (d Debian) FirewallCommands(sshPorts []int) []string {
+	ports := uniquePorts(sshPorts)
+	cmds := make([]string, 0, len(ports)+4)
+	cmds = append(cmds, "which ufw || "+d.InstallCommand("ufw"))
+	for _, port := range ports {
+		cmds = append(cmds, fmt.Sprintf("sudo ufw allow %d/tcp || true", port))
+	}
+	cmds = append(cmds,
+		"sudo ufw allow 80/tcp || true",
+		"sudo ufw allow 443/tcp || true",
+		"sudo ufw --force enable || true",
+	)
+	return cmds
+}
+
+// FirewallStatusCommand implements Provisioner
+func (Debian) FirewallStatusCommand() string {
+	return "command -v ufw >/dev/null || { echo 'ufw: not installed'; exit 127; }; sudo -n ufw status"
+}
+
+// ParseFirewallStatus implements Provisioner. Rules may list a single
+// port, a comma-separated list or a range, with or without the /tcp
+// protocol; the OpenSSH application profile stands for port 22.
+func (Debian) ParseFirewallStatus(status string) (bool, map[int]bool) {
+	allowed := make(map[int]bool)
+	for _, line := range strings.Split(status, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || fields[1] != "ALLOW" {
+			continue
+		}
+		target := fields[0]
+		if target == "OpenSSH" {
+			allowed[22] = true
+			continue
+		}
+		ports, proto, _ := strings.Cut(target, "/")
+		if proto != "" && proto != "tcp" {
+			continue
+		}
+		for _, spec := range strings.Split(ports, ",") {
+			allowPortSpec(allowed, spec, ":")
+		}
+	}
+	return strings.Contains(status, "Status: active"), allowed
+}
+
+// allowPortSpec marks the ports of a single port or a range ("from<sep>to")
+// as allowed. Ranges only matter for the standard ports: a non-standard
+// SSH port is always a single-port rule.
+func allowPortSpec(allowed map[int]bool, spec, sep string) {
+	low, high, isRange := strings.Cut(spec, sep)
+	from, err := strconv.Atoi(low)
+	if err != nil {
+		return
+	}
+	if !isRange {
+		allowed[from] = true
+		return
+	}
+	to, err := strconv.Atoi(high)
+	if err != nil {
+		return
+	}
+	for _, port := range []int{22, 80, 443} {
+		if port >= from && port <= to {
+			allowed[port] = true
+		}
+	}
+}
+
+// SecurityUpdatesCommand implements Provisioner. The list is as fresh as
+// the last apt-get update.
+func (Debian) SecurityUpdatesCommand() string {
+	return "apt-get -s -o Debug::NoLocking=1 upgrade 2>/dev/null | awk '/^Inst/ && /-security/ {print $2}'"
+}
+
+// SecurityUpgradeCommands implements Provisioner
+func (Debian) SecurityUpgradeCommands(packages []string) []string {
+	return []string{
+		"sudo apt-get update -qq",
+		"sudo DEBIAN_FRONTEND=noninteractive apt-get install -y -qq --only-upgrade " + strings.Join(packages, " "),
+	}
+}
+
+// AutoUpdatesCommands implements Provisioner. The default
+// unattended-upgrades origins are the security ones.
+func (d Debian) AutoUpdatesCommands() []string {
+	return []string{
+		d.InstallCommand("unattended-upgrades"),
+		writeFileCommand("/etc/apt/apt.conf.d/20auto-upgrades", `APT::Periodic::Update-Package-Lists "1";
+APT::Periodic::Unattended-Upgrade "1";
+`, "APTEOF"),
+	}
+}
+
+// CreateUserCommands implements Provisioner
+func (Debian) CreateUserCommands(user string) []string {
+	return []string{
+		fmt.Sprintf("id -u %[1]s >/dev/null 2>&1 || sudo useradd -m -s /bin/bash %[1]s", user),
+		fmt.Sprintf("sudo usermod -aG docker %s", user),
+	}
+}
+
+// ReloadSSHCommand implements Provisioner. The unit is ssh on Debian and
+// Ubuntu, sshd on older releases.
+func (Debian) ReloadSSHCommand() string {
+	return "sudo systemctl reload ssh 2>/dev/null || sudo systemctl reload sshd"
+}
+
+// SwapBootCommands implements Provisioner: systemd reads /etc/fstab
+func (Debian) SwapBootCommands() []string { return nil }
@@ -0,0 +1,99 @@
+package provision
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDebianFirewallCommands_CustomSSHPort(t *testing.T) {
+	cmds := Debian{}.FirewallCommands([]int{3022})
+
+	joined := strings.Join(cmds, "\n")
+	if !strings.Contains(joined, "sudo ufw allow 3022/tcp") {
+		t.Errorf("expected the configured SSH port 3022 to be allowed, got:\n%s", joined)
+	}
+	if strings.Contains(joined, "allow 22/tcp") {
+		t.Errorf("port 22 must not be hardcoded when SSH uses another port, got:\n%s", joined)
+	}
+}
+
+func TestDebianFirewallCommands_MultiplePortsDeduplicated(t *testing.T) {
+	// Configured port + server-side detected port (gateway/NAT case), with a duplicate
+	cmds := Debian{}.FirewallCommands([]int{3022, 22, 3022})
+
+	joined := strings.Join(cmds, "\n")
+	if !strings.Contains(joined, "allow 3022/tcp") || !strings.Contains(joined, "allow 22/tcp") {
+		t.Errorf("expected both SSH ports to be allowed, got:\n%s", joined)
+	}
+	count := strings.Count(joined, "allow 3022/tcp")
+	if count != 1 {
+		t.Errorf("expected port 3022 to be allowed exactly once, got %d times", count)
+	}
+}
+
+func TestDebianFirewallCommands_HTTPPortsAndEnableLast(t *testing.T) {
+	cmds := Debian{}.FirewallCommands([]int{22})
+
+	joined := strings.Join(cmds, "\n")
+	for _, want := range []string{"allow 80/tcp", "allow 443/tcp"} {
+		if !strings.Contains(joined, want) {
+			t.Errorf("expected %q in firewall commands, got:\n%s", want, joined)
+		}
+	}
+	// The enable must come last: every allow runs before the firewall goes up.
+	last := cmds[len(cmds)-1]
+	if !strings.Contains(last, "ufw --force enable") {
+		t.Errorf("expected 'ufw --force enable' to be the last command, got %q", last)
+	}
+	for _, cmd := range cmds[:len(cmds)-1] {
+		if strings.Contains(cmd, "enable") {
+			t.Errorf("enable found before the last position: %q", cmd)
+		}
+	}
+}
+
+func TestDebianFirewallCommands_InvalidPortsFiltered(t *testing.T) {
+	// A failed detection (0) must not produce an 'allow 0/tcp' rule, and at
+	// least the valid port must still be allowed before enabling.
+	cmds := Debian{}.FirewallCommands([]int{0, -1, 2222})
+
+	joined := strings.Join(cmds, "\n")
+	if strings.Contains(joined, "allow 0/tcp") || strings.Contains(joined, "allow -1/tcp") {
+		t.Errorf("invalid ports must be filtered, got:\n%s", joined)
+	}
+	if !strings.Contains(joined, "allow 2222/tcp") {
+		t.Errorf("expected valid port 2222 to be allowed, got:\n%s", joined)
+	}
+}
+
+func TestDebianFirewallCommands_InstallsUFWFirst(t *testing.T) {
+	cmds := Debian{}.FirewallCommands([]int{22})
+	if !strings.HasPrefix(cmds[0], "which ufw || ") || !strings.Contains(cmds[0], "apt-get install -y -qq ufw") {
+		t.Errorf("expected ufw to be installed first when missing, got %q", cmds[0])
+	}
+}
+
+func TestDebianParseFirewallStatus(t *testing.T) {
+	active, allowed := Debian{}.ParseFirewallStatus(`Status: active
+
+To                         Action      From
+--                         ------      ----
+22                         ALLOW IN    Anywhere
+8000:9000/tcp              ALLOW IN    Anywhere
+3022/udp                   ALLOW IN    Anywhere
+443/tcp                    DENY IN     Anywhere
+80/tcp (v6)                ALLOW IN    Anywhere (v6)`)
+
+	if !active {
+		t.Error("expected ufw to be reported active")
+	}
+	for port, want := range map[int]bool{22: true, 3022: false, 443: false, 80: false} {
+		if allowed[port] != want {
+			t.Errorf("port %d: expected allowed=%v", port, want)
+		}
+	}
+
+	if active, _ := (Debian{}).ParseFirewallStatus("Status: inactive"); active {
+		t.Error("inactive ufw reported active")
+	}
+}
@@ -0,0 +1,77 @@
+package provision
+
+import (
+	"fmt"
+	"strings"
+)
+
+// OSReleaseCommand prints the distro identification of the server
+const OSReleaseCommand = "cat /etc/os-release"
+
+// Distro is the identification read from /etc/os-release
+type Distro struct {
+	ID         string
+	IDLike     []string
+	VersionID  string
+	PrettyName string
+}
+
+// ParseOSRelease parses the content of /etc/os-release
+func ParseOSRelease(content string) Distro {
+	var d Distro
+	for _, line := range strings.Split(content, "\n") {
+		key, value, ok := strings.Cut(strings.TrimSpace(line), "=")
+		if !ok {
+			continue
+		}
+		value = strings.Trim(value, `"'`)
+		switch key {
+		case "ID":
+			d.ID = strings.ToLower(value)
+		case "ID_LIKE":
+			d.IDLike = strings.Fields(strings.ToLower(value))
+		case "VERSION_ID":
+			d.VersionID = value
+		case "PRETTY_NAME":
+			d.PrettyName = value
+		}
+	}
+	if d.PrettyName == "" {
+		d.PrettyName = strings.TrimSpace(d.ID + " " + d.VersionID)
+	}
+	return d
+}
+
+// is reports whether the distro is, or derives from, one of ids
+func (d Distro) is(ids ...string) bool {
+	for _, id := range ids {
+		if d.ID == id {
+			return true
+		}
+		for _, like := range d.IDLike {
+			if like == id {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ForDistro returns the provisioner of a distro family
+func ForDistro(d Distro) (Provisioner, error) {
+	switch {
+	case d.is("debian", "ubuntu"):
+		return Debian{}, nil
+	case d.ID == "fedora":
+		return RHEL{DockerRepo: "fedora"}, nil
+	case d.is("rhel", "centos", "fedora", "rocky", "almalinux"):
+		return RHEL{DockerRepo: "centos"}, nil
+	case d.is("alpine"):
+		return Alpine{}, nil
+	}
+	name := d.PrettyName
+	if name == "" {
+		name = "unknown distribution"
+	}
+	return nil, fmt.Errorf("unsupported distribution %s: FrankenDeploy supports Debian/Ubuntu, RHEL/Rocky/Alma/Fedora and Alpine", name)
+}
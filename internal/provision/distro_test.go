@@ -0,0 +1,61 @@
+package provision
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseOSRelease(t *testing.T) {
+	d := ParseOSRelease(`PRETTY_NAME="Rocky Linux 9.3 (Blue Onyx)"
+NAME="Rocky Linux"
+ID="rocky"
+ID_LIKE="rhel centos fedora"
+VERSION_ID="9.3"
+# comment
+`)
+	want := Distro{
+		ID:         "rocky",
+		IDLike:     []string{"rhel", "centos", "fedora"},
+		VersionID:  "9.3",
+		PrettyName: "Rocky Linux 9.3 (Blue Onyx)",
+	}
+	if !reflect.DeepEqual(d, want) {
+		t.Errorf("ParseOSRelease() = %+v, want %+v", d, want)
+	}
+
+	if d := ParseOSRelease("ID=alpine\nVERSION_ID=3.20.3"); d.PrettyName != "alpine 3.20.3" {
+		t.Errorf("expected a pretty name built from ID and version, got %q", d.PrettyName)
+	}
+}
+
+func TestForDistro(t *testing.T) {
+	tests := []struct {
+		osRelease string
+		want      Provisioner
+	}{
+		{"ID=ubuntu\nID_LIKE=debian", Debian{}},
+		{"ID=debian", Debian{}},
+		{"ID=linuxmint\nID_LIKE=\"ubuntu debian\"", Debian{}},
+		{"ID=\"rhel\"", RHEL{DockerRepo: "centos"}},
+		{"ID=\"almalinux\"\nID_LIKE=\"rhel centos fedora\"", RHEL{DockerRepo: "centos"}},
+		{"ID=\"centos\"\nID_LIKE=\"rhel fedora\"", RHEL{DockerRepo: "centos"}},
+		{"ID=fedora", RHEL{DockerRepo: "fedora"}},
+		{"ID=alpine", Alpine{}},
+	}
+	for _, tt := range tests {
+		got, err := ForDistro(ParseOSRelease(tt.osRelease))
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", tt.osRelease, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%q: got %#v, want %#v", tt.osRelease, got, tt.want)
+		}
+	}
+
+	_, err := ForDistro(ParseOSRelease("ID=arch\nPRETTY_NAME=\"Arch Linux\""))
+	if err == nil || !strings.Contains(err.Error(), "unsupported distribution Arch Linux") {
+		t.Errorf("expected an unsupported distribution error, got %v", err)
+	}
+}
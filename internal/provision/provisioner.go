@@ -0,0 +1,109 @@
+// Package provision generates the distro-specific commands server setup and
+// audit run: package installation, services, firewall, Fail2ban and kernel
+// tuning.
+package provision
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// Provisioner generates the commands preparing a server of one distro
+// family. Commands run over SSH as the deploy user, through sudo.
+type Provisioner interface {
+	// Name identifies the backend: debian, rhel or alpine
+	Name() string
+	// InstallCommand installs packages non-interactively
+	InstallCommand(packages ...string) string
+	// PrereqCommands installs what setup needs before anything else
+	PrereqCommands() []string
+	// Fail2banCommands installs, enables and starts Fail2ban
+	Fail2banCommands() []string
+	// Fail2banJailCommand writes the SSH jail
+	Fail2banJailCommand() string
+	// RestartCommand restarts a service
+	RestartCommand(service string) string
+	// DockerCommands installs Docker, lets the SSH user run it and starts it
+	DockerCommands() []string
+	// DockerUpgradeCommands upgrades the installed Docker engine packages
+	// and leaves the daemon running the new version
+	DockerUpgradeCommands() []string
+	// FirewallCommands installs and enables the firewall, allowing only
+	// the SSH ports, 80 and 443. The SSH ports are allowed before the
+	// firewall can drop anything, so the setup never locks itself out.
+	FirewallCommands(sshPorts []int) []string
+	// FirewallStatusCommand prints the firewall state for
+	// ParseFirewallStatus. It exits 127 when the firewall is not installed
+	// and never waits for a sudo password.
+	FirewallStatusCommand() string
+	// ParseFirewallStatus reports whether the firewall filters incoming
+	// traffic, and which TCP ports it allows
+	ParseFirewallStatus(out string) (active bool, allowed map[int]bool)
+	// SecurityUpdatesCommand prints the packages with a pending security
+	// update, one per line, or "unsupported" when the distro publishes no
+	// security metadata
+	SecurityUpdatesCommand() string
+	// SecurityUpgradeCommands applies the pending security updates
+	SecurityUpgradeCommands(packages []string) []string
+	// AutoUpdatesCommands enables unattended security upgrades
+	AutoUpdatesCommands() []string
+	// CreateUserCommands creates a user, if missing, with a home directory
+	// and key-only login, and adds it to the docker group
+	CreateUserCommands(user string) []string
+	// ReloadSSHCommand reloads sshd, keeping the open sessions
+	ReloadSSHCommand() string
+	// SwapBootCommands make the swap entries of /etc/fstab enabled at boot
+	SwapBootCommands() []string
+}
+
+// SecurityUnsupported is printed by SecurityUpdatesCommand when pending
+// security updates cannot be told apart from the other ones
+const SecurityUnsupported = "unsupported"
+
+// packageName matches a package name or NEVRA as printed by apt and dnf
+var packageName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9+._:~-]*$`)
+
+// ValidPackageName reports whether a package name printed by the server is
+// safe to pass back on a command line
+func ValidPackageName(name string) bool {
+	return packageName.MatchString(name)
+}
+
+// fail2banJail is the SSH jail installed by server setup. logSettings tells
+// Fail2ban where sshd logs on the distro.
+func fail2banJail(logSettings string) string {
+	return fmt.Sprintf(`[sshd]
+enabled = true
+port = ssh
+filter = sshd
+%s
+maxretry = 5
+bantime = 3600
+findtime = 600
+`, logSettings)
+}
+
+// fail2banJailCommand returns the command writing a jail to jail.local
+func fail2banJailCommand(jail string) string {
+	return writeFileCommand("/etc/fail2ban/jail.local", jail, "FAIL2BANEOF")
+}
+
+// writeFileCommand returns the command writing a root-owned file. content
+// is generated by this package and never holds the delimiter.
+func writeFileCommand(path, content, delimiter string) string {
+	return fmt.Sprintf("sudo tee %s > /dev/null << '%s'\n%s%s", path, delimiter, content, delimiter)
+}
+
+// uniquePorts returns the valid ports (> 0) in order, without duplicates: a
+// failed detection (0) must never produce a rule
+func uniquePorts(ports []int) []int {
+	unique := make([]int, 0, len(ports))
+	seen := make(map[int]bool)
+	for _, port := range ports {
+		if port > 0 && !seen[port] {
+			seen[port] = true
+			unique = append(unique, port)
+		}
+	}
+	return unique
+}
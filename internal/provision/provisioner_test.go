@@ -0,0 +1,273 @@
+package provision
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// backendCase describes what every backend must generate
+type backendCase struct {
+	p       Provisioner
+	name    string
+	prereqs []string
+	// fail2ban are the install, enable and start commands
+	fail2ban []string
+	// jailLog is how the jail finds the sshd logs
+	jailLog string
+	restart string
+	docker  []string
+	// activate is the firewall command after which traffic gets filtered
+	activate string
+	// status is a firewall status allowing 2222, 80 and 443
+	status string
+	// createUser are the commands creating the deploy user
+	createUser []string
+	reloadSSH  string
+	// autoUpdates is a fragment of the unattended upgrades setup
+	autoUpdates string
+	// dockerUpgrade is the last Docker upgrade command, after which the
+	// daemon runs the new version
+	dockerUpgrade string
+}
+
+var backendCases = []backendCase{
+	{
+		p:    Debian{},
+		name: "debian",
+		prereqs: []string{
+			"sudo apt-get update -qq",
+			"sudo DEBIAN_FRONTEND=noninteractive apt-get install -y -qq curl ca-certificates",
+		},
+		fail2ban: []string{
+			"sudo DEBIAN_FRONTEND=noninteractive apt-get install -y -qq fail2ban",
+			"sudo systemctl enable fail2ban",
+			"sudo systemctl start fail2ban",
+		},
+		jailLog: "logpath = /var/log/auth.log",
+		restart: "sudo systemctl restart fail2ban",
+		docker: []string{
+			"which docker || (curl -fsSL https://get.docker.com | sudo sh)",
+			"sudo usermod -aG docker $USER || true",
+			"sudo systemctl enable docker",
+			"sudo systemctl start docker",
+		},
+		activate: "sudo ufw --force enable",
+		status:   "Status: active\n\nTo Action From\n2222/tcp ALLOW Anywhere\n80,443/tcp ALLOW Anywhere",
+		createUser: []string{
+			"id -u deploy >/dev/null 2>&1 || sudo useradd -m -s /bin/bash deploy",
+			"sudo usermod -aG docker deploy",
+		},
+		reloadSSH:     "sudo systemctl reload ssh 2>/dev/null || sudo systemctl reload sshd",
+		autoUpdates:   `APT::Periodic::Unattended-Upgrade "1";`,
+		dockerUpgrade: "sudo DEBIAN_FRONTEND=noninteractive apt-get install -y -qq --only-upgrade docker-ce docker-ce-cli containerd.io docker-buildx-plugin docker-compose-plugin",
+	},
+	{
+		p:    RHEL{DockerRepo: "centos"},
+		name: "rhel",
+		prereqs: []string{
+			"sudo dnf install -y -q curl ca-certificates",
+		},
+		fail2ban: []string{
+			"sudo dnf install -y -q epel-release || true",
+			"sudo dnf install -y -q fail2ban",
+			"sudo systemctl enable fail2ban",
+			"sudo systemctl start fail2ban",
+		},
+		jailLog: "backend = systemd",
+		restart: "sudo systemctl restart fail2ban",
+		docker: []string{
+			"which docker || (sudo curl -fsSL -o /etc/yum.repos.d/docker-ce.repo https://download.docker.com/linux/centos/docker-ce.repo && sudo dnf install -y -q docker-ce docker-ce-cli containerd.io docker-buildx-plugin)",
+			"sudo usermod -aG docker $USER || true",
+			"sudo systemctl enable docker",
+			"sudo systemctl start docker",
+		},
+		activate: "sudo firewall-cmd --reload",
+		status:   "running\n2222/tcp\ndhcpv6-client http https ssh",
+		createUser: []string{
+			"id -u deploy >/dev/null 2>&1 || sudo useradd -m -s /bin/bash deploy",
+			"sudo usermod -aG docker deploy",
+		},
+		reloadSSH:     "sudo systemctl reload sshd",
+		autoUpdates:   "upgrade_type = security",
+		dockerUpgrade: "sudo systemctl restart docker",
+	},
+	{
+		p:    Alpine{},
+		name: "alpine",
+		prereqs: []string{
+			"sudo apk update -q",
+			"sudo apk add -q curl ca-certificates",
+		},
+		fail2ban: []string{
+			"sudo apk add -q fail2ban",
+			"sudo rc-update add fail2ban default",
+			"sudo rc-service fail2ban start",
+		},
+		jailLog: "logpath = /var/log/messages",
+		restart: "sudo rc-service fail2ban restart",
+		docker: []string{
+			"which docker || sudo apk add -q docker docker-cli-buildx",
+			"sudo addgroup $USER docker || true",
+			"sudo rc-update add docker default",
+			"sudo rc-service docker start",
+		},
+		activate: "sudo iptables -P INPUT DROP",
+		status: "-P INPUT DROP\n-A INPUT -i lo -j ACCEPT\n-A INPUT -p tcp -m tcp --dport 2222 -j ACCEPT\n" +
+			"-A INPUT -p tcp -m multiport --dports 80,443 -j ACCEPT",
+		createUser: []string{
+			"id -u deploy >/dev/null 2>&1 || (sudo adduser -D -s /bin/sh deploy && echo 'deploy:*' | sudo chpasswd -e)",
+			"sudo addgroup deploy docker",
+		},
+		reloadSSH:     "sudo rc-service sshd reload",
+		autoUpdates:   "apk upgrade -U -q",
+		dockerUpgrade: "sudo rc-service docker restart",
+	},
+}
+
+func TestBackends_CommandLists(t *testing.T) {
+	for _, tc := range backendCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.p.Name() != tc.name {
+				t.Errorf("Name() = %q, want %q", tc.p.Name(), tc.name)
+			}
+			if got := tc.p.PrereqCommands(); !reflect.DeepEqual(got, tc.prereqs) {
+				t.Errorf("PrereqCommands() =\n%q\nwant\n%q", got, tc.prereqs)
+			}
+			if got := tc.p.Fail2banCommands(); !reflect.DeepEqual(got, tc.fail2ban) {
+				t.Errorf("Fail2banCommands() =\n%q\nwant\n%q", got, tc.fail2ban)
+			}
+			if got := tc.p.RestartCommand("fail2ban"); got != tc.restart {
+				t.Errorf("RestartCommand() = %q, want %q", got, tc.restart)
+			}
+			if got := tc.p.DockerCommands(); !reflect.DeepEqual(got, tc.docker) {
+				t.Errorf("DockerCommands() =\n%q\nwant\n%q", got, tc.docker)
+			}
+			if got := tc.p.CreateUserCommands("deploy"); !reflect.DeepEqual(got, tc.createUser) {
+				t.Errorf("CreateUserCommands() =\n%q\nwant\n%q", got, tc.createUser)
+			}
+			if got := tc.p.ReloadSSHCommand(); got != tc.reloadSSH {
+				t.Errorf("ReloadSSHCommand() = %q, want %q", got, tc.reloadSSH)
+			}
+			if got := strings.Join(tc.p.AutoUpdatesCommands(), "\n"); !strings.Contains(got, tc.autoUpdates) {
+				t.Errorf("AutoUpdatesCommands() should contain %q:\n%s", tc.autoUpdates, got)
+			}
+			if got := tc.p.DockerUpgradeCommands(); len(got) == 0 || got[len(got)-1] != tc.dockerUpgrade {
+				t.Errorf("DockerUpgradeCommands() =\n%q\nshould end with %q", got, tc.dockerUpgrade)
+			}
+		})
+	}
+}
+
+func TestBackends_Fail2banJail(t *testing.T) {
+	for _, tc := range backendCases {
+		t.Run(tc.name, func(t *testing.T) {
+			jail := tc.p.Fail2banJailCommand()
+			for _, want := range []string{"sudo tee /etc/fail2ban/jail.local", "[sshd]", "enabled = true", "maxretry = 5", tc.jailLog} {
+				if !strings.Contains(jail, want) {
+					t.Errorf("expected %q in jail command:\n%s", want, jail)
+				}
+			}
+			if tc.jailLog != "logpath = /var/log/auth.log" && strings.Contains(jail, "auth.log") {
+				t.Errorf("%s has no auth.log:\n%s", tc.name, jail)
+			}
+		})
+	}
+}
+
+func TestBackends_FirewallAllowsBeforeFiltering(t *testing.T) {
+	for _, tc := range backendCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cmds := tc.p.FirewallCommands([]int{2222, 0, -1, 2222})
+			activate := -1
+			for i, cmd := range cmds {
+				if strings.HasPrefix(cmd, tc.activate) {
+					activate = i
+				}
+			}
+			if activate < 0 {
+				t.Fatalf("no %q command in:\n%s", tc.activate, strings.Join(cmds, "\n"))
+			}
+
+			allows := map[string]int{}
+			for i, cmd := range cmds {
+				for _, port := range []string{"2222", "80", "443", "http", "https"} {
+					if strings.Contains(cmd, port+"/tcp") || strings.Contains(cmd, "--dport "+port+" ") || strings.HasSuffix(cmd, "service="+port+" || true") {
+						allows[port]++
+						if i > activate {
+							t.Errorf("%q runs after the firewall starts filtering", cmd)
+						}
+					}
+				}
+				if strings.Contains(cmd, " 0/tcp") || strings.Contains(cmd, "--dport 0 ") || strings.Contains(cmd, "-1") {
+					t.Errorf("invalid port in %q", cmd)
+				}
+			}
+			if allows["2222"] == 0 {
+				t.Errorf("SSH port 2222 is never allowed:\n%s", strings.Join(cmds, "\n"))
+			}
+			if allows["80"]+allows["http"] == 0 || allows["443"]+allows["https"] == 0 {
+				t.Errorf("80 and 443 must be allowed:\n%s", strings.Join(cmds, "\n"))
+			}
+		})
+	}
+}
+
+func TestBackends_FirewallStatus(t *testing.T) {
+	for _, tc := range backendCases {
+		t.Run(tc.name, func(t *testing.T) {
+			status := tc.p.FirewallStatusCommand()
+			if !strings.Contains(status, "exit 127") {
+				t.Errorf("status command must exit 127 when the firewall is missing: %s", status)
+			}
+			if strings.Contains(strings.ReplaceAll(status, "sudo -n", ""), "sudo") {
+				t.Errorf("status command must never wait for a sudo password: %s", status)
+			}
+
+			active, allowed := tc.p.ParseFirewallStatus(tc.status)
+			if !active {
+				t.Error("expected the firewall to be reported active")
+			}
+			for _, port := range []int{2222, 80, 443} {
+				if !allowed[port] {
+					t.Errorf("port %d should be allowed", port)
+				}
+			}
+			if allowed[8080] {
+				t.Error("port 8080 is not allowed")
+			}
+		})
+	}
+}
+
+func TestBackends_SecurityUpdates(t *testing.T) {
+	for _, tc := range backendCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.p.SecurityUpdatesCommand() == "" {
+				t.Error("empty security updates command")
+			}
+			upgrade := tc.p.SecurityUpgradeCommands([]string{"openssl"})
+			if len(upgrade) == 0 {
+				t.Fatal("no security upgrade command")
+			}
+			for _, cmd := range upgrade {
+				if !strings.HasPrefix(cmd, "sudo ") {
+					t.Errorf("upgrade command must run as root: %q", cmd)
+				}
+			}
+		})
+	}
+}
+
+func TestValidPackageName(t *testing.T) {
+	for _, name := range []string{"openssl", "libssl3:amd64", "openssl-1:3.0.7-25.el9_3.x86_64", "g++", "libc6~rc1"} {
+		if !ValidPackageName(name) {
+			t.Errorf("%q should be valid", name)
+		}
+	}
+	for _, name := range []string{"", "-rf", "a;b", "a b", "$(id)"} {
+		if ValidPackageName(name) {
+			t.Errorf("%q should be rejected", name)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package provision
+
+import (
+	"fmt"
+	"strings"
+)
+
+// RHEL provisions RHEL-family servers (RHEL, Rocky, Alma, CentOS Stream,
+// Fedora): dnf, systemd and firewalld
+type RHEL struct {
+	// DockerRepo is the download.docker.com repository: centos for the
+	// RHEL rebuilds, fedora for Fedora
+	DockerRepo string
+}
+
+// Name implements Provisioner
+func (RHEL) Name() string { return "rhel" }
+
+// InstallCommand implements Provisioner
+func (RHEL) InstallCommand(packages ...string) string {
+	return "sudo dnf install -y -q " + strings.Join(packages, " ")
+}
+
+// PrereqCommands implements Provisioner
+func (r RHEL) PrereqCommands() []string {
+	return []string{
+		r.InstallCommand("curl", "ca-certificates"),
+	}
+}
+
+// Fail2banCommands implements Provisioner. Fail2ban comes from EPEL on the
+// RHEL rebuilds (Fedora ships it, hence the tolerated failure).
+func (r RHEL) Fail2banCommands() []string {
+	return []string{
+		r.InstallCommand("epel-release") + " || true",
+		r.InstallCommand("fail2ban"),
+		"sudo systemctl enable fail2ban",
+		"sudo systemctl start fail2ban",
+	}
+}
+
+// Fail2banJailCommand implements Provisioner. There is no auth.log: sshd
+// logs to the journal.
+func (RHEL) Fail2banJailCommand() string {
+	return fail2banJailCommand(fail2banJail("backend = systemd"))
+}
+
+// RestartCommand implements Provisioner
+func (RHEL) RestartCommand(service string) string {
+	return "sudo systemctl restart " + service
+}
+
+// DockerCommands implements Provisioner. get.docker.com rejects the RHEL
+// rebuilds: Docker CE is installed from its repository instead.
+func (r RHEL) DockerCommands() []string {
+	repo := r.DockerRepo
+	if repo == "" {
+		repo = "centos"
+	}
+	return []string{
+		fmt.Sprintf("which docker || (sudo curl -fsSL -o /etc/yum.repos.d/docker-ce.repo https://download.docker.com/linux/%s/docker-ce.repo && %s)",
+			repo, r.InstallCommand("docker-ce", "docker-ce-cli", "containerd.io", "docker-buildx-plugin")),
+		"sudo usermod -aG docker $USER || true",
+		"sudo systemctl enable docker",
+		"sudo systemctl start docker",
+	}
+}
+
+// DockerUpgradeCommands implements Provisioner. dnf leaves the daemon
+// running the old binary: it is restarted.
+func (r RHEL) DockerUpgradeCommands() []string {
+	return []string{
+		"sudo dnf upgrade -y -q docker-ce docker-ce-cli containerd.io docker-buildx-plugin",
+		r.RestartCommand("docker"),
+	}
+}
+
+// FirewallCommands implements Provisioner. firewall-cmd needs the daemon
+// running: firewalld starts first, with its default zone allowing SSH on
+// port 22, and the SSH session survives since established connections are
+// always accepted. Rules are added permanently, then loaded.
+func (r RHEL) FirewallCommands(sshPorts []int) []string {
+	ports := uniquePorts(sshPorts)
+	cmds := make([]string, 0, len(ports)+6)
+	cmds = append(cmds,
+		"which firewall-cmd || "+r.InstallCommand("firewalld"),
+		"sudo systemctl enable --now firewalld",
+	)
+	for _, port := range ports {
+		cmds = append(cmds, fmt.Sprintf("sudo firewall-cmd --permanent --add-port=%d/tcp || true", port))
+	}
+	cmds = append(cmds,
+		"sudo firewall-cmd --permanent --add-service=http || true",
+		"sudo firewall-cmd --permanent --add-service=https || true",
+		"sudo firewall-cmd --reload || true",
+	)
+	return cmds
+}
+
+// FirewallStatusCommand implements Provisioner
+func (RHEL) FirewallStatusCommand() string {
+	return "command -v firewall-cmd >/dev/null || { echo 'firewalld: not installed'; exit 127; }; " +
+		"sudo -n firewall-cmd --state && sudo -n firewall-cmd --list-ports && sudo -n firewall-cmd --list-services"
+}
+
+// firewalldServicePorts maps the firewalld services setup relies on to
+// their port
+var firewalldServicePorts = map[string]int{"ssh": 22, "http": 80, "https": 443}
+
+// ParseFirewallStatus implements Provisioner: the state, then the ports
+// ("2222/tcp 8000-8100/tcp") and the services of the default zone
+func (RHEL) ParseFirewallStatus(out string) (bool, map[int]bool) {
+	allowed := make(map[int]bool)
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	for _, line := range lines[1:] {
+		for _, field := range strings.Fields(line) {
+			if port, ok := firewalldServicePorts[field]; ok {
+				allowed[port] = true
+				continue
+			}
+			ports, proto, ok := strings.Cut(field, "/")
+			if ok && proto == "tcp" {
+				allowPortSpec(allowed, ports, "-")
+			}
+		}
+	}
+	return strings.TrimSpace(lines[0]) == "running", allowed
+}
+
+// SecurityUpdatesCommand implements Provisioner
+func (RHEL) SecurityUpdatesCommand() string {
+	return "dnf -q updateinfo list --security 2>/dev/null | awk 'NF >= 3 {print $3}'"
+}
+
+// SecurityUpgradeCommands implements Provisioner: dnf selects the security
+// updates itself
+func (RHEL) SecurityUpgradeCommands([]string) []string {
+	return []string{"sudo dnf upgrade -y -q --security"}
+}
+
+// AutoUpdatesCommands implements Provisioner: dnf-automatic, restricted to
+// security updates
+func (r RHEL) AutoUpdatesCommands() []string {
+	return []string{
+		r.InstallCommand("dnf-automatic"),
+		"sudo sed -i -e 's/^upgrade_type *=.*/upgrade_type = security/' -e 's/^apply_updates *=.*/apply_updates = yes/' /etc/dnf/automatic.conf",
+		"sudo systemctl enable --now dnf-automatic.timer",
+	}
+}
+
+// CreateUserCommands implements Provisioner
+func (RHEL) CreateUserCommands(user string) []string {
+	return []string{
+		fmt.Sprintf("id -u %[1]s >/dev/null 2>&1 || sudo useradd -m -s /bin/bash %[1]s", user),
+		fmt.Sprintf("sudo usermod -aG docker %s", user),
+	}
+}
+
+// ReloadSSHCommand implements Provisioner
+func (RHEL) ReloadSSHCommand() string {
+	return "sudo systemctl reload sshd"
+}
+
+// SwapBootCommands implements Provisioner: systemd reads /etc/fstab
+func (RHEL) SwapBootCommands() []string { return nil }
@@ -0,0 +1,66 @@
+package provision
+
+import (
+	"fmt"
+
+	"github.com/yoanbernabeu/frankendeploy/internal/security"
+)
+
+// SSHDDropIn holds the sshd settings of the hardening step. sshd keeps the
+// first value it reads for each setting: the 00- prefix puts it before the
+// drop-ins of cloud images (50-cloud-init.conf enables passwords).
+const SSHDDropIn = "/etc/ssh/sshd_config.d/00-frankendeploy.conf"
+
+// sshdHardening disables every login but public keys, and root logins.
+// ChallengeResponseAuthentication is understood by old and new OpenSSH
+// releases alike (KbdInteractiveAuthentication only exists since 8.7).
+const sshdHardening = `# Managed by FrankenDeploy (server setup --harden)
+PermitRootLogin no
+PasswordAuthentication no
+ChallengeResponseAuthentication no
+PermitEmptyPasswords no
+PubkeyAuthentication yes
+`
+
+// SSHDHardeningCommands write the hardening drop-in, make sure sshd_config
+// includes the drop-in directory first, then validate the whole config
+// with sshd -t: an invalid config is removed before sshd ever reloads it.
+func SSHDHardeningCommands() []string {
+	return []string{
+		"sudo mkdir -p /etc/ssh/sshd_config.d",
+		writeFileCommand(SSHDDropIn, sshdHardening, "SSHDEOF"),
+		`grep -qiE '^\s*Include\s+/etc/ssh/sshd_config\.d/\*\.conf' /etc/ssh/sshd_config || sudo sed -i '1i Include /etc/ssh/sshd_config.d/*.conf' /etc/ssh/sshd_config`,
+		fmt.Sprintf("sudo sshd -t || { sudo rm -f %s; exit 1; }", SSHDDropIn),
+	}
+}
+
+// SSHDRevertCommand removes the hardening drop-in. sshd must be reloaded
+// afterwards.
+func SSHDRevertCommand() string {
+	return "sudo rm -f " + SSHDDropIn
+}
+
+// AuthorizedKeysCommand appends the SSH user's authorized keys to the ones
+// of user, without duplicates, owned by user and private
+func AuthorizedKeysCommand(user string) (string, error) {
+	if err := security.ValidateUnixUser(user); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf(`home=$(getent passwd %[1]s | cut -d: -f6) && [ -n "$home" ] && `+
+		`sudo install -d -m 700 -o %[1]s -g %[1]s "$home/.ssh" && `+
+		`cat ~/.ssh/authorized_keys | sudo sh -c 'cat >> "$1" && sort -u -o "$1" "$1"' _ "$home/.ssh/authorized_keys" && `+
+		`sudo chown %[1]s:%[1]s "$home/.ssh/authorized_keys" && sudo chmod 600 "$home/.ssh/authorized_keys"`, user), nil
+}
+
+// SudoersCommand lets user run sudo without a password, as FrankenDeploy
+// does for the SSH user. The file is checked with visudo before it is
+// installed: a broken sudoers file would lock sudo for everyone.
+func SudoersCommand(user string) (string, error) {
+	if err := security.ValidateUnixUser(user); err != nil {
+		return "", err
+	}
+	file := "/etc/sudoers.d/frankendeploy-" + user
+	return fmt.Sprintf(`tmp=$(mktemp) && echo '%[1]s ALL=(ALL) NOPASSWD:ALL' > "$tmp" && `+
+		`sudo visudo -cf "$tmp" >/dev/null && sudo install -m 440 -o root -g root "$tmp" %[2]s; status=$?; rm -f "$tmp"; exit $status`,
+		user, file), nil
+}
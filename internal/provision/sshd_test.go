@@ -0,0 +1,56 @@
+package provision
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSSHDHardeningCommands(t *testing.T) {
+	cmds := SSHDHardeningCommands()
+	joined := strings.Join(cmds, "\n")
+	for _, want := range []string{"PermitRootLogin no", "PasswordAuthentication no", "ChallengeResponseAuthentication no", "PubkeyAuthentication yes"} {
+		if !strings.Contains(joined, want) {
+			t.Errorf("expected %q in the sshd drop-in:\n%s", want, joined)
+		}
+	}
+	// The config is validated last, and an invalid one is removed
+	last := cmds[len(cmds)-1]
+	if !strings.HasPrefix(last, "sudo sshd -t || ") || !strings.Contains(last, "rm -f "+SSHDDropIn) {
+		t.Errorf("expected sshd -t to validate the config last, got %q", last)
+	}
+	if !strings.Contains(SSHDRevertCommand(), SSHDDropIn) {
+		t.Errorf("revert should remove %s", SSHDDropIn)
+	}
+}
+
+func TestAuthorizedKeysAndSudoersCommands(t *testing.T) {
+	keys, err := AuthorizedKeysCommand("deploy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"getent passwd deploy", "-m 700 -o deploy", "sort -u", "chmod 600"} {
+		if !strings.Contains(keys, want) {
+			t.Errorf("expected %q in %s", want, keys)
+		}
+	}
+
+	sudoers, err := SudoersCommand("deploy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(sudoers, "visudo -cf") || !strings.Contains(sudoers, "/etc/sudoers.d/frankendeploy-deploy") {
+		t.Errorf("sudoers must be checked by visudo before install: %s", sudoers)
+	}
+	if strings.Index(sudoers, "visudo") > strings.Index(sudoers, "install -m 440") {
+		t.Errorf("visudo must run before the file is installed: %s", sudoers)
+	}
+
+	for _, user := range []string{"root; rm -rf /", "$(id)", ""} {
+		if _, err := AuthorizedKeysCommand(user); err == nil {
+			t.Errorf("AuthorizedKeysCommand(%q) should fail", user)
+		}
+		if _, err := SudoersCommand(user); err == nil {
+			t.Errorf("SudoersCommand(%q) should fail", user)
+		}
+	}
+}
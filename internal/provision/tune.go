@@ -0,0 +1,247 @@
+package provision
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/yoanbernabeu/frankendeploy/internal/constants"
+)
+
+// Files managed by server tune
+const (
+	SwapFile         = "/swapfile"
+	SysctlFile       = "/etc/sysctl.d/99-frankendeploy.conf"
+	DockerDaemonFile = "/etc/docker/daemon.json"
+)
+
+// Kernel settings of server tune. The inotify limits are the ones file
+// watchers (Symfony, Webpack Encore) ask for; somaxconn is the listen
+// backlog of FrankenPHP and Caddy under bursts.
+const (
+	DefaultSwappiness       = 10
+	InotifyMaxUserWatches   = 524288
+	InotifyMaxUserInstances = 512
+	Somaxconn               = 4096
+)
+
+// DefaultSwapSize is the swap file size of server tune: enough for a
+// Composer install or MySQL to survive a memory peak on a 1GB VPS
+const DefaultSwapSize = "2G"
+
+// ParseSwapSize parses a swap file size in mebibytes (512M) or gibibytes
+// (2G) into bytes. "0" disables the swap file.
+func ParseSwapSize(size string) (int64, error) {
+	size = strings.TrimSpace(size)
+	if size == "0" {
+		return 0, nil
+	}
+	if len(size) < 2 {
+		return 0, fmt.Errorf("invalid swap size %q: use a size like 512M or 2G", size)
+	}
+	var unit int64
+	switch size[len(size)-1] {
+	case 'M', 'm':
+		unit = 1 << 20
+	case 'G', 'g':
+		unit = 1 << 30
+	default:
+		return 0, fmt.Errorf("invalid swap size %q: use a size like 512M or 2G", size)
+	}
+	n, err := strconv.ParseInt(size[:len(size)-1], 10, 64)
+	if err != nil || n <= 0 || n > 1<<14 {
+		return 0, fmt.Errorf("invalid swap size %q: use a size like 512M or 2G", size)
+	}
+	bytes := n * unit
+	if bytes < 64<<20 {
+		return 0, fmt.Errorf("invalid swap size %q: the minimum is 64M", size)
+	}
+	return bytes, nil
+}
+
+// SwapCommands create, enable and persist a swap file of size bytes. A
+// swap file of another size is recreated, which needs it to be swapped
+// off first: that fails rather than kill processes when memory is short.
+func SwapCommands(p Provisioner, size int64) []string {
+	return append([]string{
+		fmt.Sprintf(`if [ -f %[1]s ] && [ "$(stat -c %%s %[1]s)" != "%[2]d" ]; then `+
+			`if grep -q '^%[1]s ' /proc/swaps; then sudo swapoff %[1]s || exit 1; fi; sudo rm -f %[1]s; fi`, SwapFile, size),
+		fmt.Sprintf(`[ -f %[1]s ] || { (sudo fallocate -l %[2]d %[1]s || sudo dd if=/dev/zero of=%[1]s bs=1M count=%[3]d) && `+
+			`sudo chmod 600 %[1]s && sudo mkswap %[1]s > /dev/null || { sudo rm -f %[1]s; exit 1; }; }`, SwapFile, size, size>>20),
+		fmt.Sprintf("grep -q '^%[1]s ' /proc/swaps || sudo swapon %[1]s", SwapFile),
+		fmt.Sprintf("grep -q '^%[1]s ' /etc/fstab || echo '%[1]s none swap sw 0 0' | sudo tee -a /etc/fstab > /dev/null", SwapFile),
+	}, p.SwapBootCommands()...)
+}
+
+// sysctlSettings is the content of SysctlFile
+func sysctlSettings(swappiness int) string {
+	return fmt.Sprintf(`# Managed by FrankenDeploy (server tune)
+vm.swappiness = %d
+fs.inotify.max_user_watches = %d
+fs.inotify.max_user_instances = %d
+net.core.somaxconn = %d
+`, swappiness, InotifyMaxUserWatches, InotifyMaxUserInstances, Somaxconn)
+}
+
+// SysctlCommands write the kernel settings to sysctl.d, loaded at boot, and
+// apply them right away
+func SysctlCommands(swappiness int) []string {
+	return []string{
+		writeFileCommand(SysctlFile, sysctlSettings(swappiness), "SYSCTLEOF"),
+		"sudo sysctl -p " + SysctlFile + " > /dev/null",
+	}
+}
+
+// DaemonJSONReadCommand prints the current daemon.json, if any
+const DaemonJSONReadCommand = "cat " + DockerDaemonFile + " 2>/dev/null || true"
+
+// MergeDaemonJSON adds the FrankenDeploy defaults to a daemon.json: log
+// rotation for the json-file and local drivers, and live-restore so that
+// restarting or upgrading Docker keeps the containers running. Settings
+// already present are kept: the result is unchanged when nothing is
+// missing.
+func MergeDaemonJSON(current string) (string, bool, error) {
+	daemon := make(map[string]any)
+	if strings.TrimSpace(current) != "" {
+		if err := json.Unmarshal([]byte(current), &daemon); err != nil {
+			return "", false, fmt.Errorf("%s is not valid JSON, fix it by hand: %w", DockerDaemonFile, err)
+		}
+	}
+
+	changed := false
+	setDefault := func(m map[string]any, key string, value any) {
+		if _, ok := m[key]; !ok {
+			m[key] = value
+			changed = true
+		}
+	}
+
+	setDefault(daemon, "log-driver", "json-file")
+	if driver, _ := daemon["log-driver"].(string); driver == "json-file" || driver == "local" {
+		opts, ok := daemon["log-opts"].(map[string]any)
+		if !ok {
+			opts = make(map[string]any)
+			daemon["log-opts"] = opts
+		}
+		setDefault(opts, "max-size", constants.LogMaxSize)
+		setDefault(opts, "max-file", constants.LogMaxFile)
+	}
+	setDefault(daemon, "live-restore", true)
+
+	if !changed {
+		return current, false, nil
+	}
+	out, err := json.MarshalIndent(daemon, "", "  ")
+	if err != nil {
+		return "", false, err
+	}
+	return string(out) + "\n", true, nil
+}
+
+// DaemonJSONCommands install a daemon.json merged by MergeDaemonJSON, the
+// previous one kept as daemon.json.bak. live-restore can be reloaded: the
+// daemon gets SIGHUP first, so the restart applying the log defaults keeps
+// the containers running.
+func DaemonJSONCommands(p Provisioner, content string) []string {
+	return []string{
+		"sudo mkdir -p /etc/docker",
+		fmt.Sprintf("[ ! -f %[1]s ] || sudo cp -p %[1]s %[1]s.bak", DockerDaemonFile),
+		writeFileCommand(DockerDaemonFile, content, "DAEMONEOF"),
+		"sudo pkill -HUP -x dockerd && sleep 1 || true",
+		p.RestartCommand("docker"),
+	}
+}
+
+// TuneStatusCommand prints the settings of server tune for
+// ParseTuneStatus. It needs no sudo.
+func TuneStatusCommand() string {
+	return strings.Join([]string{
+		`echo "swap_total=$(awk 'NR > 1 {s += $3} END {print s + 0}' /proc/swaps)"`,
+		fmt.Sprintf(`echo "swap_file=$(awk '$1 == "%s" {print $3}' /proc/swaps)"`, SwapFile),
+		`echo "swappiness=$(cat /proc/sys/vm/swappiness)"`,
+		`echo "inotify_watches=$(cat /proc/sys/fs/inotify/max_user_watches)"`,
+		`echo "inotify_instances=$(cat /proc/sys/fs/inotify/max_user_instances)"`,
+		`echo "somaxconn=$(cat /proc/sys/net/core/somaxconn)"`,
+		fmt.Sprintf(`echo "daemon_json=$(cat %s 2>/dev/null | tr -d '\n')"`, DockerDaemonFile),
+	}, "; ")
+}
+
+// TuneStatus is the state of the settings of server tune
+type TuneStatus struct {
+	// SwapTotal and SwapFile are in bytes; SwapFile is the size of
+	// SwapFile when it is swapped on
+	SwapTotal        int64
+	SwapFile         int64
+	Swappiness       int
+	InotifyWatches   int
+	InotifyInstances int
+	Somaxconn        int
+	// Docker daemon defaults from daemon.json
+	LogDriver   string
+	LogMaxSize  string
+	LogMaxFile  string
+	LiveRestore bool
+}
+
+// ParseTuneStatus parses the output of TuneStatusCommand. Missing or
+// unreadable values are left at zero.
+func ParseTuneStatus(out string) TuneStatus {
+	var status TuneStatus
+	for _, line := range strings.Split(out, "\n") {
+		key, value, ok := strings.Cut(strings.TrimSpace(line), "=")
+		if !ok {
+			continue
+		}
+		number, _ := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+		switch key {
+		case "swap_total":
+			status.SwapTotal = number << 10
+		case "swap_file":
+			status.SwapFile = number << 10
+		case "swappiness":
+			status.Swappiness = int(number)
+		case "inotify_watches":
+			status.InotifyWatches = int(number)
+		case "inotify_instances":
+			status.InotifyInstances = int(number)
+		case "somaxconn":
+			status.Somaxconn = int(number)
+		case "daemon_json":
+			var daemon struct {
+				LogDriver   string            `json:"log-driver"`
+				LogOpts     map[string]string `json:"log-opts"`
+				LiveRestore bool              `json:"live-restore"`
+			}
+			if json.Unmarshal([]byte(value), &daemon) == nil {
+				status.LogDriver = daemon.LogDriver
+				status.LogMaxSize = daemon.LogOpts["max-size"]
+				status.LogMaxFile = daemon.LogOpts["max-file"]
+				status.LiveRestore = daemon.LiveRestore
+			}
+		}
+	}
+	return status
+}
+
+// Pending lists the settings server tune would still change. Swappiness
+// is left out: it is a choice, not a limit.
+func (s TuneStatus) Pending() []string {
+	var pending []string
+	if s.SwapTotal == 0 {
+		pending = append(pending, "no swap")
+	}
+	if s.InotifyWatches < InotifyMaxUserWatches || s.InotifyInstances < InotifyMaxUserInstances {
+		pending = append(pending, "low inotify limits")
+	}
+	if s.Somaxconn < Somaxconn {
+		pending = append(pending, "low somaxconn")
+	}
+	if (s.LogDriver == "" || s.LogDriver == "json-file" || s.LogDriver == "local") && s.LogMaxSize == "" {
+		pending = append(pending, "unbounded Docker logs")
+	}
+	if !s.LiveRestore {
+		pending = append(pending, "Docker live-restore off")
+	}
+	return pending
+}
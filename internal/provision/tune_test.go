@@ -0,0 +1,169 @@
+package provision
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestParseSwapSize(t *testing.T) {
+	tests := []struct {
+		size    string
+		want    int64
+		wantErr bool
+	}{
+		{"2G", 2 << 30, false},
+		{"512M", 512 << 20, false},
+		{"1g", 1 << 30, false},
+		{"0", 0, false},
+		{"32M", 0, true},
+		{"2", 0, true},
+		{"2GB", 0, true},
+		{"-1G", 0, true},
+		{"1.5G", 0, true},
+		{"", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseSwapSize(tt.size)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseSwapSize(%q) = %d, %v; want %d, error %v", tt.size, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestSwapCommands(t *testing.T) {
+	cmds := SwapCommands(Debian{}, 1<<30)
+	all := strings.Join(cmds, "\n")
+	for _, want := range []string{
+		`"$(stat -c %s /swapfile)" != "1073741824"`,
+		"sudo swapoff /swapfile || exit 1",
+		"sudo fallocate -l 1073741824 /swapfile",
+		"count=1024",
+		"sudo mkswap /swapfile",
+		"grep -q '^/swapfile ' /proc/swaps || sudo swapon /swapfile",
+		"/swapfile none swap sw 0 0",
+	} {
+		if !strings.Contains(all, want) {
+			t.Errorf("expected %q in:\n%s", want, all)
+		}
+	}
+	if strings.Contains(all, "rc-update") {
+		t.Error("systemd reads fstab, no swap service needed")
+	}
+	if got := SwapCommands(Alpine{}, 1<<30); got[len(got)-1] != "sudo rc-update add swap boot" {
+		t.Errorf("Alpine must enable the swap service, got %q", got[len(got)-1])
+	}
+}
+
+func TestSysctlCommands(t *testing.T) {
+	cmds := SysctlCommands(20)
+	for _, want := range []string{"sudo tee " + SysctlFile, "vm.swappiness = 20", "fs.inotify.max_user_watches = 524288", "net.core.somaxconn = 4096"} {
+		if !strings.Contains(cmds[0], want) {
+			t.Errorf("expected %q in:\n%s", want, cmds[0])
+		}
+	}
+	if cmds[1] != "sudo sysctl -p "+SysctlFile+" > /dev/null" {
+		t.Errorf("settings must be applied right away, got %q", cmds[1])
+	}
+}
+
+func TestMergeDaemonJSON(t *testing.T) {
+	t.Run("missing file", func(t *testing.T) {
+		merged, changed, err := MergeDaemonJSON("")
+		if err != nil || !changed {
+			t.Fatalf("expected a change, got %v, %v", changed, err)
+		}
+		var daemon map[string]any
+		if err := json.Unmarshal([]byte(merged), &daemon); err != nil {
+			t.Fatalf("invalid JSON: %v\n%s", err, merged)
+		}
+		opts := daemon["log-opts"].(map[string]any)
+		if daemon["log-driver"] != "json-file" || opts["max-size"] != "10m" || opts["max-file"] != "3" || daemon["live-restore"] != true {
+			t.Errorf("unexpected defaults:\n%s", merged)
+		}
+	})
+
+	t.Run("keeps existing settings", func(t *testing.T) {
+		current := `{"registry-mirrors": ["https://mirror.example.com"], "log-opts": {"max-size": "50m"}}`
+		merged, changed, err := MergeDaemonJSON(current)
+		if err != nil || !changed {
+			t.Fatalf("expected a change, got %v, %v", changed, err)
+		}
+		for _, want := range []string{`"https://mirror.example.com"`, `"max-size": "50m"`, `"max-file": "3"`, `"live-restore": true`} {
+			if !strings.Contains(merged, want) {
+				t.Errorf("expected %s in:\n%s", want, merged)
+			}
+		}
+	})
+
+	t.Run("idempotent", func(t *testing.T) {
+		first, _, _ := MergeDaemonJSON("{}")
+		second, changed, err := MergeDaemonJSON(first)
+		if err != nil || changed || second != first {
+			t.Errorf("a merged daemon.json must be left unchanged, got changed=%v err=%v", changed, err)
+		}
+	})
+
+	t.Run("other log driver", func(t *testing.T) {
+		merged, _, err := MergeDaemonJSON(`{"log-driver": "journald"}`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(merged, "max-size") {
+			t.Errorf("journald rotates its own logs, no log-opts expected:\n%s", merged)
+		}
+	})
+
+	t.Run("invalid JSON", func(t *testing.T) {
+		if _, _, err := MergeDaemonJSON("{broken"); err == nil {
+			t.Error("an invalid daemon.json must never be overwritten")
+		}
+	})
+}
+
+func TestDaemonJSONCommands_ReloadBeforeRestart(t *testing.T) {
+	cmds := DaemonJSONCommands(RHEL{}, "{}\n")
+	hup, restart := -1, -1
+	for i, cmd := range cmds {
+		if strings.Contains(cmd, "pkill -HUP -x dockerd") {
+			hup = i
+		}
+		if cmd == "sudo systemctl restart docker" {
+			restart = i
+		}
+	}
+	if hup < 0 || restart < 0 || hup > restart {
+		t.Errorf("live-restore must be reloaded before the restart:\n%s", strings.Join(cmds, "\n"))
+	}
+}
+
+func TestParseTuneStatus(t *testing.T) {
+	out := `swap_total=2097148
+swap_file=2097148
+swappiness=10
+inotify_watches=524288
+inotify_instances=512
+somaxconn=4096
+daemon_json={  "live-restore": true,  "log-driver": "json-file",  "log-opts": {    "max-file": "3",    "max-size": "10m"  }}`
+	status := ParseTuneStatus(out)
+	want := TuneStatus{
+		SwapTotal: 2097148 << 10, SwapFile: 2097148 << 10, Swappiness: 10,
+		InotifyWatches: 524288, InotifyInstances: 512, Somaxconn: 4096,
+		LogDriver: "json-file", LogMaxSize: "10m", LogMaxFile: "3", LiveRestore: true,
+	}
+	if status != want {
+		t.Errorf("ParseTuneStatus() =\n%+v\nwant\n%+v", status, want)
+	}
+	if pending := status.Pending(); len(pending) != 0 {
+		t.Errorf("a tuned server has nothing pending, got %v", pending)
+	}
+}
+
+func TestTuneStatus_Pending(t *testing.T) {
+	status := ParseTuneStatus("swap_total=0\nswap_file=\nswappiness=60\ninotify_watches=8192\ninotify_instances=128\nsomaxconn=4096\ndaemon_json=")
+	got := strings.Join(status.Pending(), ", ")
+	want := "no swap, low inotify limits, unbounded Docker logs, Docker live-restore off"
+	if got != want {
+		t.Errorf("Pending() = %q, want %q", got, want)
+	}
+}
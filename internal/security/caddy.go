@@ -0,0 +1,152 @@
+package security
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+)
+
+var (
+	// headerNameRegex validates HTTP header field names (RFC 7230 token
+	// subset: letters, digits, hyphens)
+	headerNameRegex = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9-]{0,127}$`)
+
+	// caddyPathRegex validates Caddy path matchers
+	// Allows: absolute URL paths with alphanumeric, slashes, dots,
+	// underscores, hyphens and * wildcards
+	caddyPathRegex = regexp.MustCompile(`^/[a-zA-Z0-9_.*/-]*$`)
+
+	// caddySizeRegex validates Caddy byte sizes (e.g. 10MB, 512KiB, 1GB)
+	caddySizeRegex = regexp.MustCompile(`^[0-9]+([kKmMgGtT][iI]?[bB])?$`)
+
+	// basicAuthUserRegex validates basic auth usernames
+	basicAuthUserRegex = regexp.MustCompile(`^[A-Za-z0-9._@-]{1,64}$`)
+
+	// bcryptHashRegex matches a bcrypt hash as produced by `caddy hash-password`
+	bcryptHashRegex = regexp.MustCompile(`^\$2[aby]\$[0-9]{2}\$[./A-Za-z0-9]{53}$`)
+)
+
+// ValidateHeaderName validates an HTTP header name used in a Caddyfile
+func ValidateHeaderName(name string) error {
+	if !headerNameRegex.MatchString(name) {
+		return fmt.Errorf("header name %q must contain only letters, numbers, and hyphens", name)
+	}
+	return nil
+}
+
+// ValidateHeaderValue validates a header value rendered as a quoted
+// Caddyfile token. Quotes, backslashes and control characters would break
+// out of the token.
+func ValidateHeaderValue(value string) error {
+	if value == "" {
+		return fmt.Errorf("header value cannot be empty")
+	}
+	if len(value) > 4096 {
+		return fmt.Errorf("header value too long (max 4096 characters)")
+	}
+	for _, r := range value {
+		if r < 0x20 || r == 0x7f || r == '"' || r == '\\' {
+			return fmt.Errorf("header value contains invalid character %q", r)
+		}
+	}
+	return nil
+}
+
+// ValidateCaddyPath validates a Caddy path matcher (e.g. /build/*)
+func ValidateCaddyPath(path string) error {
+	if !strings.HasPrefix(path, "/") {
+		return fmt.Errorf("path %q must start with /", path)
+	}
+	if strings.Contains(path, "..") {
+		return fmt.Errorf("path %q cannot contain path traversal (..) sequences", path)
+	}
+	if !caddyPathRegex.MatchString(path) {
+		return fmt.Errorf("path %q contains invalid characters", path)
+	}
+	return nil
+}
+
+// ValidateCaddySize validates a byte size such as 10MB or 512KiB
+func ValidateCaddySize(size string) error {
+	if !caddySizeRegex.MatchString(size) {
+		return fmt.Errorf("invalid size %q (expected a number with optional KB/MB/GB suffix, e.g. 10MB)", size)
+	}
+	return nil
+}
+
+// ValidateIPRange validates an IP address or CIDR range. The Caddy
+// shorthand "private_ranges" is accepted as well.
+func ValidateIPRange(value string) error {
+	if value == "private_ranges" {
+		return nil
+	}
+	if _, _, err := net.ParseCIDR(value); err == nil {
+		return nil
+	}
+	if net.ParseIP(value) != nil {
+		return nil
+	}
+	return fmt.Errorf("invalid IP address or CIDR range %q", value)
+}
+
+// ValidateBasicAuthUsername validates a basic auth username
+func ValidateBasicAuthUsername(user string) error {
+	if !basicAuthUserRegex.MatchString(user) {
+		return fmt.Errorf("username %q must contain only letters, numbers, dots, underscores, @, and hyphens", user)
+	}
+	return nil
+}
+
+// ValidateBasicAuthUser validates a basic auth username and its bcrypt hash
+func ValidateBasicAuthUser(user, hash string) error {
+	if err := ValidateBasicAuthUsername(user); err != nil {
+		return err
+	}
+	if !IsBcryptHash(hash) {
+		return fmt.Errorf("password for %q must be a bcrypt hash (generate one with 'caddy hash-password')", user)
+	}
+	return nil
+}
+
+// IsBcryptHash reports whether s looks like a bcrypt hash
+func IsBcryptHash(s string) bool {
+	return bcryptHashRegex.MatchString(s)
+}
+
+// ValidateCaddySnippet performs a local sanity check of a raw Caddyfile
+// snippet: braces must balance so the snippet cannot close the enclosing
+// site block. Full validation is left to the Caddy binary on the server.
+func ValidateCaddySnippet(snippet string) error {
+	depth := 0
+	inQuote := false
+	for i := 0; i < len(snippet); i++ {
+		c := snippet[i]
+		switch {
+		case c == '\\' && inQuote:
+			i++
+		case c == '"':
+			inQuote = !inQuote
+		case inQuote:
+		case c == '#' && (i == 0 || snippet[i-1] == ' ' || snippet[i-1] == '\t' || snippet[i-1] == '\n'):
+			// Comment: skip to end of line
+			for i < len(snippet) && snippet[i] != '\n' {
+				i++
+			}
+		case c == '{':
+			depth++
+		case c == '}':
+			depth--
+			if depth < 0 {
+				return fmt.Errorf("snippet closes a block it did not open")
+			}
+		}
+	}
+	if inQuote {
+		return fmt.Errorf("snippet has an unterminated quoted string")
+	}
+	if depth != 0 {
+		return fmt.Errorf("snippet has unbalanced braces")
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package security
+
+import "testing"
+
+func TestValidateHeaderValue(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		wantErr bool
+	}{
+		{"simple", "nosniff", false},
+		{"csp with quotes", "default-src 'self'", false},
+		{"placeholder", "{http.request.host}", false},
+		{"empty", "", true},
+		{"double quote", `a"b`, true},
+		{"backslash", `a\b`, true},
+		{"newline", "a\nb", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateHeaderValue(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateHeaderValue(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateIPRange(t *testing.T) {
+	tests := []struct {
+		input   string
+		wantErr bool
+	}{
+		{"192.168.1.1", false},
+		{"10.0.0.0/8", false},
+		{"2001:db8::/32", false},
+		{"private_ranges", false},
+		{"", true},
+		{"10.0.0.0/33", true},
+		{"example.com", true},
+		{"1.2.3.4; rm -rf /", true},
+	}
+
+	for _, tt := range tests {
+		if err := ValidateIPRange(tt.input); (err != nil) != tt.wantErr {
+			t.Errorf("ValidateIPRange(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+		}
+	}
+}
+
+func TestValidateCaddySnippet(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		wantErr bool
+	}{
+		{"single directive", "encode gzip", false},
+		{"nested block", "handle /api/* {\n    respond 204\n}", false},
+		{"placeholder", "header X-Host {host}", false},
+		{"brace in quotes", `respond "}" 200`, false},
+		{"brace in comment", "# } closing\nencode gzip", false},
+		{"closes site block", "}\nevil.com {\n    respond 200", true},
+		{"unclosed block", "handle {", true},
+		{"unterminated quote", `respond "oops`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateCaddySnippet(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateCaddySnippet(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateBasicAuthUser(t *testing.T) {
+	hash := "$2a$14$" + "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0"
+	if err := ValidateBasicAuthUser("admin", hash); err != nil {
+		t.Errorf("expected valid user, got %v", err)
+	}
+	if err := ValidateBasicAuthUser("admin", "plaintext"); err == nil {
+		t.Error("expected error for plaintext password")
+	}
+	if err := ValidateBasicAuthUser("ad min", hash); err == nil {
+		t.Error("expected error for username with space")
+	}
+}
@@ -25,6 +25,11 @@ var (
 	// Length: 1-128 characters
 	releaseRegex = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9._-]{0,126}[a-zA-Z0-9])?$`)
 
+	// imageRefRegex validates Docker image references
+	// Allows: [registry[:port]/]path[:tag][@sha256:<64 hex>], with
+	// lowercase path components as Docker requires
+	imageRefRegex = regexp.MustCompile(`^([a-zA-Z0-9][a-zA-Z0-9.-]*(:[0-9]+)?/)?[a-z0-9]+([._-]+[a-z0-9]+)*(/[a-z0-9]+([._-]+[a-z0-9]+)*)*(:[a-zA-Z0-9_][a-zA-Z0-9._-]{0,127})?(@sha256:[a-f0-9]{64})?$`)
+
 	// unixUserRegex validates Unix usernames
 	// Standard POSIX username rules
 	// Length: 1-32 characters
@@ -120,6 +125,20 @@ func ValidateRelease(release string) error {
 	return nil
 }
 
+// ValidateImageRef validates a Docker image reference
+func ValidateImageRef(ref string) error {
+	if ref == "" {
+		return fmt.Errorf("image reference cannot be empty")
+	}
+	if len(ref) > 512 {
+		return fmt.Errorf("image reference too long (max 512 characters)")
+	}
+	if !imageRefRegex.MatchString(ref) {
+		return fmt.Errorf("image reference must be [registry/]name[:tag][@sha256:digest] with a lowercase name")
+	}
+	return nil
+}
+
 // ValidateUnixUser validates a Unix username
 func ValidateUnixUser(user string) error {
 	if user == "" {
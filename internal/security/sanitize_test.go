@@ -101,6 +101,35 @@ func TestValidateRelease(t *testing.T) {
 	}
 }
 
+func TestValidateImageRef(t *testing.T) {
+	digest := "sha256:" + strings.Repeat("ab", 32)
+	tests := []struct {
+		name    string
+		input   string
+		wantErr bool
+	}{
+		{"docker hub name", "nginx", false},
+		{"name and tag", "acme/app:1.2.3", false},
+		{"registry and digest", "ghcr.io/acme/app@" + digest, false},
+		{"registry port, tag and digest", "registry.local:5000/acme/my_app:v1@" + digest, false},
+		{"empty", "", true},
+		{"uppercase name", "ghcr.io/Acme/app", true},
+		{"short digest", "ghcr.io/acme/app@sha256:abc", true},
+		{"injection attempt", "app:1;rm -rf /", true},
+		{"space", "app 1", true},
+		{"option", "--privileged", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateImageRef(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateImageRef(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+		})
+	}
+}
+
 func TestValidateUnixUser(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -0,0 +1,57 @@
+package ssh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// ErrNoAgent is returned when the ssh-agent to forward is not running
+var ErrNoAgent = errors.New("no ssh-agent to forward: SSH_AUTH_SOCK is not set (start ssh-agent and add your key with ssh-add)")
+
+// AgentForwarder is an Executor able to forward the local ssh-agent to a
+// command, so the command authenticates with the local keys without them
+// ever leaving the machine.
+type AgentForwarder interface {
+	Executor
+	ExecForwardAgent(ctx context.Context, command string) (*ExecResult, error)
+}
+
+// ExecForwardAgent runs a command with the local ssh-agent (SSH_AUTH_SOCK)
+// forwarded to its session only: other sessions of the connection never see
+// the agent. The remote side reaches it through the socket in its own
+// SSH_AUTH_SOCK.
+func (c *Client) ExecForwardAgent(ctx context.Context, command string) (*ExecResult, error) {
+	sock := os.Getenv("SSH_AUTH_SOCK")
+	if sock == "" {
+		return nil, ErrNoAgent
+	}
+	return c.execSession(ctx, command, nil, func(session *ssh.Session) error {
+		if err := c.forwardAgentTo(sock); err != nil {
+			return err
+		}
+		if err := agent.RequestAgentForwarding(session); err != nil {
+			return fmt.Errorf("server refused agent forwarding (AllowAgentForwarding in sshd_config): %w", err)
+		}
+		return nil
+	})
+}
+
+// forwardAgentTo serves the agent channels the server opens with the agent
+// at sock, once per connection
+func (c *Client) forwardAgentTo(sock string) error {
+	c.agentMu.Lock()
+	defer c.agentMu.Unlock()
+	if c.agentForwarded == c.client {
+		return nil
+	}
+	if err := agent.ForwardToRemote(c.client, sock); err != nil {
+		return fmt.Errorf("failed to forward ssh-agent: %w", err)
+	}
+	c.agentForwarded = c.client
+	return nil
+}
@@ -0,0 +1,46 @@
+package ssh
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"testing"
+
+	"golang.org/x/crypto/ssh/agent"
+)
+
+func TestExecForwardAgent(t *testing.T) {
+	client, server := connectTestClient(t, echoHandler)
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("SSH_AUTH_SOCK", startFakeAgent(t, agent.AddedKey{PrivateKey: priv, Comment: "git@forge"}))
+
+	for i := 0; i < 2; i++ {
+		result, err := client.ExecForwardAgent(context.Background(), "docker build --ssh default .")
+		if err != nil || result.ExitCode != 0 {
+			t.Fatalf("ExecForwardAgent() = %+v, %v", result, err)
+		}
+	}
+	if keys := server.AgentKeys(); len(keys) != 2 || keys[0] != "git@forge" {
+		t.Errorf("the command should reach the local agent each time, got %v", keys)
+	}
+
+	// Other sessions never see the agent
+	if _, err := client.Exec(context.Background(), "ssh-add -l"); err != nil {
+		t.Fatal(err)
+	}
+	if keys := server.AgentKeys(); len(keys) != 2 {
+		t.Errorf("the agent was forwarded to a plain Exec: %v", keys)
+	}
+}
+
+func TestExecForwardAgent_NoAgent(t *testing.T) {
+	client, _ := connectTestClient(t, echoHandler)
+	t.Setenv("SSH_AUTH_SOCK", "")
+	if _, err := client.ExecForwardAgent(context.Background(), "true"); !errors.Is(err, ErrNoAgent) {
+		t.Errorf("ExecForwardAgent() without an agent = %v, want ErrNoAgent", err)
+	}
+}
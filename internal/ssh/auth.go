@@ -108,8 +108,10 @@ func (c *Client) resolveKeyPath() (string, error) {
 }
 
 // authMethods builds the authentication methods:
-//  1. FRANKENDEPLOY_SSH_KEY (CI/CD): the provided key only
-//  2. a single publickey method combining ssh-agent signers and the key file
+//  1. FRANKENDEPLOY_SSH_KEY (CI/CD): the provided key only, with the
+//     certificate in FRANKENDEPLOY_SSH_CERT if any
+//  2. a single publickey method combining ssh-agent signers and the key
+//     file, with the user certificate next to the key file
 //
 // Agent and key file MUST share one publickey method: the x/crypto client
 // tries at most one AuthMethod per method name, so a second publickey entry
@@ -120,7 +122,17 @@ func (c *Client) authMethods() ([]ssh.AuthMethod, error) {
 		if err != nil {
 			return nil, fmt.Errorf("failed to parse FRANKENDEPLOY_SSH_KEY: %w", err)
 		}
-		return []ssh.AuthMethod{ssh.PublicKeys(signer)}, nil
+		var cert *ssh.Certificate
+		if envCert := os.Getenv("FRANKENDEPLOY_SSH_CERT"); envCert != "" {
+			if cert, err = parseUserCertificate([]byte(envCert), "FRANKENDEPLOY_SSH_CERT"); err != nil {
+				return nil, err
+			}
+		}
+		signers, err := c.withCertificates([]ssh.Signer{signer}, "FRANKENDEPLOY_SSH_KEY", cert)
+		if err != nil {
+			return nil, err
+		}
+		return []ssh.AuthMethod{ssh.PublicKeys(signers...)}, nil
 	}
 
 	agentFn := agentSignersFunc()
@@ -139,7 +151,8 @@ func (c *Client) authMethods() ([]ssh.AuthMethod, error) {
 	})}, nil
 }
 
-// collectSigners gathers the agent signers followed by the key file signer.
+// collectSigners gathers the agent signers followed by the key file signer,
+// led by the certificate of the key file (<key>-cert.pub) when there is one.
 // The key file passphrase is only prompted when the agent does not already
 // hold that key; when the prompt fails but the agent offers other keys,
 // authentication proceeds with those instead of aborting.
@@ -151,6 +164,7 @@ func (c *Client) collectSigners(agentFn func() ([]ssh.Signer, error), keyPath st
 		}
 	}
 
+	var cert *ssh.Certificate
 	if keyPath != "" {
 		fileSigner, err := c.keyFileSigner(keyPath, signers)
 		if err != nil {
@@ -160,9 +174,19 @@ func (c *Client) collectSigners(agentFn func() ([]ssh.Signer, error), keyPath st
 		} else if fileSigner != nil {
 			signers = append(signers, fileSigner)
 		}
+		if cert, err = loadUserCertificate(keyPath); err != nil {
+			return nil, err
+		}
 	}
 
+	signers, err := c.withCertificates(signers, keyPath, cert)
+	if err != nil {
+		return nil, err
+	}
 	if len(signers) == 0 {
+		if c.certErr != nil {
+			return nil, c.certErr
+		}
 		return nil, fmt.Errorf("no usable SSH credentials for %s", keyPath)
 	}
 	return signers, nil
@@ -112,9 +112,9 @@ func TestParsePrivateKeyWithPrompt_InvalidKey(t *testing.T) {
 }
 
 // startFakeAgent starts an in-process ssh-agent on a unix socket and returns
-// the socket path. A short temp dir is used directly: t.TempDir() paths embed
+// the socket path, holding keys. A short temp dir is used directly: t.TempDir() paths embed
 // the test name and can exceed the macOS 104-char unix socket path limit.
-func startFakeAgent(t *testing.T) string {
+func startFakeAgent(t *testing.T, keys ...agent.AddedKey) string {
 	t.Helper()
 	dir, err := os.MkdirTemp("", "agent")
 	if err != nil {
@@ -130,6 +130,11 @@ func startFakeAgent(t *testing.T) string {
 	t.Cleanup(func() { listener.Close() })
 
 	keyring := agent.NewKeyring()
+	for _, key := range keys {
+		if err := keyring.Add(key); err != nil {
+			t.Fatalf("failed to add key to agent: %v", err)
+		}
+	}
 	go func() {
 		for {
 			conn, err := listener.Accept()
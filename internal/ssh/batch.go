@@ -0,0 +1,153 @@
+package ssh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultMaxSessions bounds the sessions a client opens at once, below the
+// MaxSessions of sshd (10 by default): over it, sshd refuses new sessions
+const DefaultMaxSessions = 8
+
+// batchMarker starts the header of each command output of a batch
+const batchMarker = "__FRANKENDEPLOY_BATCH__"
+
+// BatchExecutor is an Executor able to run several commands in one session.
+// Use ExecBatch, which falls back to one Exec per command for the other
+// executors.
+type BatchExecutor interface {
+	Executor
+	ExecBatch(ctx context.Context, commands []string) ([]*ExecResult, error)
+}
+
+// WithMaxSessions sets the number of sessions the client opens at once.
+// Exec calls over it wait for a session to close.
+func WithMaxSessions(n int) ClientOption {
+	return func(o *clientOptions) {
+		o.maxSessions = n
+	}
+}
+
+// ExecBatch runs commands in order and returns the result of each: in one
+// session when client is a BatchExecutor, one Exec per command otherwise.
+// A command failing does not stop the next ones; the error is only set
+// when the results could not be collected.
+func ExecBatch(ctx context.Context, client Executor, commands []string) ([]*ExecResult, error) {
+	if batcher, ok := client.(BatchExecutor); ok {
+		return batcher.ExecBatch(ctx, commands)
+	}
+	results := make([]*ExecResult, len(commands))
+	for i, command := range commands {
+		result, err := client.Exec(ctx, command)
+		if err != nil {
+			return nil, err
+		}
+		results[i] = result
+	}
+	return results, nil
+}
+
+// ExecConcurrent runs commands in separate sessions, at most limit at once
+// (DefaultMaxSessions when limit is 0). Suits slow commands, like
+// docker stats, that would add up in a batch. A command that could not run
+// has a nil result, and its error is part of the joined error returned.
+func ExecConcurrent(ctx context.Context, client Executor, commands []string, limit int) ([]*ExecResult, error) {
+	if limit <= 0 {
+		limit = DefaultMaxSessions
+	}
+	results := make([]*ExecResult, len(commands))
+	errs := make([]error, len(commands))
+	slots := make(chan struct{}, limit)
+	var wg sync.WaitGroup
+	for i, command := range commands {
+		wg.Add(1)
+		go func(i int, command string) {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+			results[i], errs[i] = client.Exec(ctx, command)
+			if errs[i] != nil {
+				results[i] = nil
+			}
+		}(i, command)
+	}
+	wg.Wait()
+	return results, errors.Join(errs...)
+}
+
+// ExecBatch runs commands in order in a single session. Each command runs
+// in a subshell with stdin closed, its stdout and stderr captured apart and
+// sent back length-prefixed: the output of a command never bleeds into the
+// next one, whatever it prints.
+func (c *Client) ExecBatch(ctx context.Context, commands []string) ([]*ExecResult, error) {
+	if len(commands) == 0 {
+		return nil, nil
+	}
+	result, err := c.ExecInput(ctx, "sh -s", strings.NewReader(batchScript(commands)))
+	if err != nil {
+		return nil, err
+	}
+	results, err := parseBatchOutput(result.Stdout, len(commands))
+	if err != nil {
+		if stderr := strings.TrimSpace(result.Stderr); stderr != "" {
+			return nil, fmt.Errorf("%w: %s", err, stderr)
+		}
+		return nil, err
+	}
+	return results, nil
+}
+
+// batchScript returns the shell script running commands for ExecBatch. It
+// is read by sh -s from stdin, hence the commands' stdin from /dev/null.
+func batchScript(commands []string) string {
+	var b strings.Builder
+	b.WriteString(`d=$(mktemp -d) || exit 1
+trap 'rm -rf "$d"' EXIT
+frame() {
+  printf '%s %d %d %d\n' ` + batchMarker + ` "$1" $(($(wc -c < "$d/o"))) $(($(wc -c < "$d/e")))
+  cat "$d/o" "$d/e"
+}
+`)
+	for _, command := range commands {
+		b.WriteString("(\n")
+		b.WriteString(command)
+		b.WriteString("\n) < /dev/null > \"$d/o\" 2> \"$d/e\"; frame $?\n")
+	}
+	return b.String()
+}
+
+// parseBatchOutput splits the output of batchScript into the results of its
+// n commands
+func parseBatchOutput(output string, n int) ([]*ExecResult, error) {
+	results := make([]*ExecResult, 0, n)
+	for len(results) < n {
+		header, rest, ok := strings.Cut(output, "\n")
+		if !ok {
+			return nil, fmt.Errorf("batch output truncated after %d of %d commands", len(results), n)
+		}
+		fields := strings.Fields(header)
+		if len(fields) != 4 || fields[0] != batchMarker {
+			return nil, fmt.Errorf("invalid batch output header %q", header)
+		}
+		code, codeErr := strconv.Atoi(fields[1])
+		outLen, outErr := strconv.Atoi(fields[2])
+		errLen, errErr := strconv.Atoi(fields[3])
+		if codeErr != nil || outErr != nil || errErr != nil || outLen < 0 || errLen < 0 {
+			return nil, fmt.Errorf("invalid batch output header %q", header)
+		}
+		if len(rest) < outLen+errLen {
+			return nil, fmt.Errorf("batch output truncated after %d of %d commands", len(results), n)
+		}
+		results = append(results, &ExecResult{
+			Stdout:   rest[:outLen],
+			Stderr:   rest[outLen : outLen+errLen],
+			ExitCode: code,
+		})
+		output = rest[outLen+errLen:]
+	}
+	return results, nil
+}
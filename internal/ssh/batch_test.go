@@ -0,0 +1,186 @@
+package ssh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// connectTestClient connects a client to a new test server running handler
+func connectTestClient(t *testing.T, handler execHandler, opts ...ClientOption) (*Client, *testServer) {
+	t.Helper()
+	keyPath, signer := writeKeyPair(t, t.TempDir(), "")
+	server := startTestServer(t, signer.PublicKey(), handler)
+	jumpTestEnv(t, server.KnownHostsLine())
+
+	client := NewClient("127.0.0.1", "deploy", server.Port(), keyPath, append([]ClientOption{WithRetries(1)}, opts...)...)
+	if err := client.Connect(); err != nil {
+		t.Fatalf("Connect() error: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client, server
+}
+
+func TestClientExecBatch(t *testing.T) {
+	client, server := connectTestClient(t, shellHandler)
+
+	commands := []string{
+		"echo one",
+		"printf 'no newline'; echo oops >&2; exit 3",
+		// Output mimicking a frame header cannot be taken for one
+		"printf '" + batchMarker + " 0 1 1\\nxy'",
+		// stdin is closed: the rest of the batch is not read as input
+		"cat",
+		"exit 5",
+		"cat << 'EOF'\nheredoc $HOME\nEOF",
+		"echo last",
+	}
+	results, err := client.ExecBatch(context.Background(), commands)
+	if err != nil {
+		t.Fatalf("ExecBatch() error: %v", err)
+	}
+
+	want := []ExecResult{
+		{Stdout: "one\n"},
+		{Stdout: "no newline", Stderr: "oops\n", ExitCode: 3},
+		{Stdout: batchMarker + " 0 1 1\nxy"},
+		{},
+		{ExitCode: 5},
+		{Stdout: "heredoc $HOME\n"},
+		{Stdout: "last\n"},
+	}
+	if len(results) != len(want) {
+		t.Fatalf("ExecBatch() returned %d results, want %d", len(results), len(want))
+	}
+	for i, result := range results {
+		if *result != want[i] {
+			t.Errorf("result %d (%q) = %+v, want %+v", i, commands[i], *result, want[i])
+		}
+	}
+	if got := server.Commands(); len(got) != 1 {
+		t.Errorf("the batch should run in one session, got %d", len(got))
+	}
+}
+
+func TestClientExecBatch_ScriptFails(t *testing.T) {
+	client, _ := connectTestClient(t, func(command string, stdin io.Reader, stdout, stderr io.Writer) int {
+		io.Copy(io.Discard, stdin)
+		fmt.Fprint(stderr, "sh: not found")
+		return 127
+	})
+
+	_, err := client.ExecBatch(context.Background(), []string{"true"})
+	if err == nil || !strings.Contains(err.Error(), "sh: not found") {
+		t.Errorf("ExecBatch() should fail with the shell error, got %v", err)
+	}
+}
+
+func TestParseBatchOutput_Truncated(t *testing.T) {
+	for _, output := range []string{
+		"",
+		batchMarker + " 0 10 0\nshort",
+		batchMarker + " 0 1 0\nx",
+		"garbage\n",
+	} {
+		if _, err := parseBatchOutput(output, 2); err == nil {
+			t.Errorf("parseBatchOutput(%q) should fail", output)
+		}
+	}
+}
+
+func TestExecBatch_FallsBackToExec(t *testing.T) {
+	var commands []string
+	executor := &execOnly{exec: func(command string) (*ExecResult, error) {
+		commands = append(commands, command)
+		return &ExecResult{Stdout: command}, nil
+	}}
+
+	results, err := ExecBatch(context.Background(), executor, []string{"a", "b"})
+	if err != nil || len(results) != 2 || results[1].Stdout != "b" {
+		t.Fatalf("ExecBatch() = %v, %v", results, err)
+	}
+	if strings.Join(commands, ",") != "a,b" {
+		t.Errorf("commands run: %v", commands)
+	}
+}
+
+func TestExecConcurrent_BoundsSessions(t *testing.T) {
+	var active, peak atomic.Int32
+	handler := func(command string, stdin io.Reader, stdout, stderr io.Writer) int {
+		n := active.Add(1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(50 * time.Millisecond)
+		active.Add(-1)
+		fmt.Fprint(stdout, command)
+		return 0
+	}
+	client, _ := connectTestClient(t, handler, WithMaxSessions(2))
+
+	commands := []string{"a", "b", "c", "d", "e", "f"}
+	results, err := ExecConcurrent(context.Background(), client, commands, 0)
+	if err != nil {
+		t.Fatalf("ExecConcurrent() error: %v", err)
+	}
+	for i, result := range results {
+		if result == nil || result.Stdout != commands[i] {
+			t.Errorf("result %d = %+v, want %q", i, result, commands[i])
+		}
+	}
+	if got := peak.Load(); got != 2 {
+		t.Errorf("peak concurrent sessions = %d, want 2 (WithMaxSessions)", got)
+	}
+}
+
+func TestExecConcurrent_ReportsFailures(t *testing.T) {
+	failure := errors.New("connection lost")
+	var mu sync.Mutex
+	executor := &execOnly{exec: func(command string) (*ExecResult, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if command == "bad" {
+			return nil, failure
+		}
+		return &ExecResult{Stdout: command}, nil
+	}}
+
+	results, err := ExecConcurrent(context.Background(), executor, []string{"ok", "bad"}, 1)
+	if !errors.Is(err, failure) {
+		t.Errorf("ExecConcurrent() error = %v, want %v", err, failure)
+	}
+	if results[0] == nil || results[0].Stdout != "ok" || results[1] != nil {
+		t.Errorf("ExecConcurrent() results = %v", results)
+	}
+}
+
+// execOnly is an Executor without ExecBatch
+type execOnly struct {
+	exec func(command string) (*ExecResult, error)
+}
+
+func (e *execOnly) Exec(ctx context.Context, command string) (*ExecResult, error) {
+	return e.exec(command)
+}
+
+func (e *execOnly) ExecInput(ctx context.Context, command string, stdin io.Reader) (*ExecResult, error) {
+	return e.exec(command)
+}
+
+func (e *execOnly) ExecStream(ctx context.Context, command string) error {
+	_, err := e.exec(command)
+	return err
+}
+
+func (e *execOnly) Close() error {
+	return nil
+}
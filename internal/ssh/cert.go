@@ -0,0 +1,289 @@
+package ssh
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// CertificateExpiredError is returned for an SSH certificate used outside
+// of its validity period: a user certificate (next to the key file or in
+// the agent) or the host certificate of a server.
+type CertificateExpiredError struct {
+	// Subject describes the certificate, e.g. "user certificate ~/.ssh/id_ed25519-cert.pub"
+	Subject     string
+	KeyID       string
+	ValidAfter  time.Time
+	ValidBefore time.Time
+	// NotYetValid is set when the certificate is not valid yet
+	NotYetValid bool
+}
+
+func (e *CertificateExpiredError) Error() string {
+	if e.NotYetValid {
+		return fmt.Sprintf("%s (key ID %q) is not valid before %s: check the local clock",
+			e.Subject, e.KeyID, e.ValidAfter.Format(time.RFC3339))
+	}
+	return fmt.Sprintf("%s (key ID %q) expired on %s: request a new certificate from your SSH certificate authority",
+		e.Subject, e.KeyID, e.ValidBefore.Format(time.RFC3339))
+}
+
+// HostCertificateError is returned when the host certificate of a server
+// signed by a known @cert-authority is rejected: expired, not issued for
+// the host, revoked authority... Never retried, never subject to TOFU.
+type HostCertificateError struct {
+	Host string
+	Err  error
+}
+
+func (e *HostCertificateError) Error() string {
+	return fmt.Sprintf("host certificate of %s rejected: %v", e.Host, e.Err)
+}
+
+func (e *HostCertificateError) Unwrap() error {
+	return e.Err
+}
+
+// checkCertValidity returns a CertificateExpiredError when now is outside
+// the validity period of the certificate
+func checkCertValidity(cert *ssh.Certificate, subject string, now time.Time) error {
+	validAfter := certTime(cert.ValidAfter)
+	validBefore := certTime(cert.ValidBefore)
+	notYetValid := now.Before(validAfter)
+	if !notYetValid && (cert.ValidBefore == ssh.CertTimeInfinity || now.Before(validBefore)) {
+		return nil
+	}
+	return &CertificateExpiredError{
+		Subject:     subject,
+		KeyID:       cert.KeyId,
+		ValidAfter:  validAfter,
+		ValidBefore: validBefore,
+		NotYetValid: notYetValid,
+	}
+}
+
+// certTime converts a certificate timestamp, capping "forever"
+func certTime(t uint64) time.Time {
+	if t > math.MaxInt64 {
+		return time.Unix(math.MaxInt64, 0)
+	}
+	return time.Unix(int64(t), 0)
+}
+
+// hostPublicKey returns the key a host key stands for: the signed key of a
+// host certificate, which keeps its fingerprint across certificate renewals
+func hostPublicKey(key ssh.PublicKey) ssh.PublicKey {
+	if cert, ok := key.(*ssh.Certificate); ok {
+		return cert.Key
+	}
+	return key
+}
+
+// loadUserCertificate reads the OpenSSH user certificate next to a key
+// file (<key>-cert.pub, as written by ssh-keygen -s). Returns nil when
+// there is none.
+func loadUserCertificate(keyPath string) (*ssh.Certificate, error) {
+	data, err := os.ReadFile(keyPath + "-cert.pub")
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read certificate: %w", err)
+	}
+	return parseUserCertificate(data, keyPath+"-cert.pub")
+}
+
+// parseUserCertificate parses an authorized_keys formatted user certificate
+func parseUserCertificate(data []byte, name string) (*ssh.Certificate, error) {
+	pub, _, _, _, err := ssh.ParseAuthorizedKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse certificate %s: %w", name, err)
+	}
+	cert, ok := pub.(*ssh.Certificate)
+	if !ok || cert.CertType != ssh.UserCert {
+		return nil, fmt.Errorf("%s is not an SSH user certificate", name)
+	}
+	return cert, nil
+}
+
+// certSigner wraps the signer of the certified key with its certificate.
+// Returns nil when no signer holds the key.
+func certSigner(cert *ssh.Certificate, signers []ssh.Signer) (ssh.Signer, error) {
+	certified := cert.Key.Marshal()
+	for _, s := range signers {
+		if s != nil && bytes.Equal(s.PublicKey().Marshal(), certified) {
+			return ssh.NewCertSigner(cert, s)
+		}
+	}
+	return nil, nil
+}
+
+// withCertificates returns the signers with their certificates: the
+// certificate of the key file is offered first, wrapping the key file
+// signer or the agent signer of that key. Certificates out of their
+// validity period are left out, the first one recorded in c.certErr to
+// explain an authentication failure.
+func (c *Client) withCertificates(signers []ssh.Signer, keyPath string, cert *ssh.Certificate) ([]ssh.Signer, error) {
+	now := time.Now()
+	valid := make([]ssh.Signer, 0, len(signers)+1)
+	for _, s := range signers {
+		if agentCert, ok := s.PublicKey().(*ssh.Certificate); ok {
+			if err := checkCertValidity(agentCert, "ssh-agent certificate", now); err != nil {
+				c.recordCertErr(err)
+				continue
+			}
+		}
+		valid = append(valid, s)
+	}
+	if cert == nil {
+		return valid, nil
+	}
+
+	if err := checkCertValidity(cert, "user certificate "+keyPath+"-cert.pub", now); err != nil {
+		c.recordCertErr(err)
+		return valid, nil
+	}
+	signer, err := certSigner(cert, valid)
+	if err != nil {
+		return nil, fmt.Errorf("failed to use certificate %s-cert.pub: %w", keyPath, err)
+	}
+	if signer == nil {
+		return valid, nil
+	}
+	return append([]ssh.Signer{signer}, valid...), nil
+}
+
+// recordCertErr keeps the first certificate error
+func (c *Client) recordCertErr(err error) {
+	if c.certErr == nil {
+		c.certErr = err
+	}
+}
+
+// certAuthority is a @cert-authority line of known_hosts
+type certAuthority struct {
+	patterns []string
+	key      ssh.PublicKey
+}
+
+// certAuthorities are the host certificate authorities of a known_hosts file
+type certAuthorities []certAuthority
+
+// parseCertAuthorities returns the @cert-authority lines of known_hosts
+// content. Other lines are checked by knownhosts. Each line is parsed on
+// its own: a malformed or unsupported one is skipped, never the lines
+// after it.
+func parseCertAuthorities(data []byte) certAuthorities {
+	var cas certAuthorities
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		marker, hosts, key, _, _, err := ssh.ParseKnownHosts(line)
+		if err != nil {
+			continue
+		}
+		if marker == "cert-authority" {
+			cas = append(cas, certAuthority{patterns: hosts, key: key})
+		}
+	}
+	return cas
+}
+
+// covers reports whether an authority is trusted for the host
+func (cas certAuthorities) covers(hostname string) bool {
+	host := knownhosts.Normalize(hostname)
+	for _, ca := range cas {
+		if matchHostPatterns(host, ca.patterns) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchHostPatterns reports whether host matches a known_hosts pattern list:
+// at least one pattern matches and no negated pattern does
+func matchHostPatterns(host string, patterns []string) bool {
+	host = strings.ToLower(host)
+	matched := false
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(pattern)
+		if negated, ok := strings.CutPrefix(pattern, "!"); ok {
+			if matchWildcard(negated, host) {
+				return false
+			}
+			continue
+		}
+		if matchWildcard(pattern, host) {
+			matched = true
+		}
+	}
+	return matched
+}
+
+// matchWildcard matches s against a pattern where * matches any sequence
+// and ? any single character
+func matchWildcard(pattern, s string) bool {
+	for pattern != "" {
+		switch pattern[0] {
+		case '*':
+			for i := 0; i <= len(s); i++ {
+				if matchWildcard(pattern[1:], s[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if s == "" {
+				return false
+			}
+		default:
+			if s == "" || s[0] != pattern[0] {
+				return false
+			}
+		}
+		pattern, s = pattern[1:], s[1:]
+	}
+	return s == ""
+}
+
+// hostKey returns the key to verify for the host: host certificates not
+// covered by an authority stand for their signed key, verified like a
+// plain host key, as OpenSSH does
+func (cas certAuthorities) hostKey(hostname string, key ssh.PublicKey) ssh.PublicKey {
+	if cert, ok := key.(*ssh.Certificate); ok && !cas.covers(hostname) {
+		return cert.Key
+	}
+	return key
+}
+
+// verifyHostCertificate checks a host certificate covered by an authority:
+// its validity period first, for a clear error, then the authority,
+// principals and revocations with the knownhosts callback
+func verifyHostCertificate(base ssh.HostKeyCallback, hostname string, remote net.Addr, cert *ssh.Certificate) error {
+	host := knownhosts.Normalize(hostname)
+	if err := checkCertValidity(cert, "host certificate of "+host, time.Now()); err != nil {
+		return &HostCertificateError{Host: host, Err: err}
+	}
+	if err := base(hostname, remote, cert); err != nil {
+		return &HostCertificateError{Host: host, Err: err}
+	}
+	return nil
+}
+
+// certHostKeyCallback adds host certificates to a knownhosts callback
+// built from the same content
+func certHostKeyCallback(base ssh.HostKeyCallback, cas certAuthorities) ssh.HostKeyCallback {
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		key = cas.hostKey(hostname, key)
+		if cert, ok := key.(*ssh.Certificate); ok {
+			return verifyHostCertificate(base, hostname, remote, cert)
+		}
+		return base(hostname, remote, key)
+	}
+}
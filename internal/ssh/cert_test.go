@@ -0,0 +1,263 @@
+package ssh
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// testSigner returns a new ed25519 signer
+func testSigner(t *testing.T) ssh.Signer {
+	t.Helper()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	signer, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatalf("failed to create signer: %v", err)
+	}
+	return signer
+}
+
+// signCert signs a certificate of key with ca, valid until validBefore
+func signCert(t *testing.T, ca ssh.Signer, key ssh.PublicKey, certType uint32, principals []string, validBefore time.Time) *ssh.Certificate {
+	t.Helper()
+	cert := &ssh.Certificate{
+		Key:             key,
+		CertType:        certType,
+		KeyId:           "test-cert",
+		ValidPrincipals: principals,
+		ValidAfter:      uint64(time.Now().Add(-time.Hour).Unix()),
+		ValidBefore:     uint64(validBefore.Unix()),
+	}
+	if err := cert.SignCert(rand.Reader, ca); err != nil {
+		t.Fatalf("failed to sign certificate: %v", err)
+	}
+	return cert
+}
+
+// writeUserCert writes the certificate next to the key file, like ssh-keygen -s
+func writeUserCert(t *testing.T, keyPath string, cert *ssh.Certificate) {
+	t.Helper()
+	if err := os.WriteFile(keyPath+"-cert.pub", ssh.MarshalAuthorizedKey(cert), 0644); err != nil {
+		t.Fatalf("failed to write certificate: %v", err)
+	}
+}
+
+func TestCheckCertValidity(t *testing.T) {
+	now := time.Now()
+	cert := &ssh.Certificate{KeyId: "alice", ValidAfter: uint64(now.Add(-time.Hour).Unix())}
+
+	cert.ValidBefore = ssh.CertTimeInfinity
+	if err := checkCertValidity(cert, "user certificate", now); err != nil {
+		t.Errorf("a certificate valid forever was rejected: %v", err)
+	}
+
+	cert.ValidBefore = uint64(now.Add(-time.Minute).Unix())
+	err := checkCertValidity(cert, "user certificate", now)
+	var expiredErr *CertificateExpiredError
+	if !errors.As(err, &expiredErr) || expiredErr.NotYetValid || !strings.Contains(err.Error(), "expired") {
+		t.Errorf("expected an expired certificate error, got %v", err)
+	}
+
+	cert.ValidAfter = uint64(now.Add(time.Hour).Unix())
+	cert.ValidBefore = uint64(now.Add(2 * time.Hour).Unix())
+	if err := checkCertValidity(cert, "user certificate", now); !errors.As(err, &expiredErr) || !expiredErr.NotYetValid {
+		t.Errorf("expected a not yet valid certificate error, got %v", err)
+	}
+}
+
+func TestCollectSigners_UserCertificate(t *testing.T) {
+	keyPath, signer := writeKeyPair(t, t.TempDir(), "")
+	ca := testSigner(t)
+	writeUserCert(t, keyPath, signCert(t, ca, signer.PublicKey(), ssh.UserCert, []string{"deploy"}, time.Now().Add(time.Hour)))
+
+	client := NewClient("example.com", "deploy", 22, keyPath)
+	signers, err := client.collectSigners(nil, keyPath)
+	if err != nil {
+		t.Fatalf("collectSigners() error = %v", err)
+	}
+	if len(signers) != 2 {
+		t.Fatalf("expected the certificate and the key, got %d signers", len(signers))
+	}
+	if _, ok := signers[0].PublicKey().(*ssh.Certificate); !ok {
+		t.Errorf("the certificate should be offered first, got %s", signers[0].PublicKey().Type())
+	}
+}
+
+func TestCollectSigners_AgentKeyCertificate(t *testing.T) {
+	// The certificate file wraps the agent signer of an encrypted key
+	keyPath, signer := writeKeyPair(t, t.TempDir(), "secret")
+	writeUserCert(t, keyPath, signCert(t, testSigner(t), signer.PublicKey(), ssh.UserCert, []string{"deploy"}, time.Now().Add(time.Hour)))
+
+	client := NewClient("example.com", "deploy", 22, keyPath, WithPassphraseReader(func(string) ([]byte, error) {
+		t.Fatal("the agent key should not be prompted for")
+		return nil, nil
+	}))
+	signers, err := client.collectSigners(func() ([]ssh.Signer, error) { return []ssh.Signer{signer}, nil }, keyPath)
+	if err != nil {
+		t.Fatalf("collectSigners() error = %v", err)
+	}
+	if len(signers) != 2 || signers[0].PublicKey().Type() != ssh.CertAlgoED25519v01 {
+		t.Errorf("expected the certificate then the agent key, got %d signers", len(signers))
+	}
+}
+
+func TestCollectSigners_ExpiredCertificate(t *testing.T) {
+	keyPath, signer := writeKeyPair(t, t.TempDir(), "")
+	writeUserCert(t, keyPath, signCert(t, testSigner(t), signer.PublicKey(), ssh.UserCert, []string{"deploy"}, time.Now().Add(-time.Minute)))
+
+	client := NewClient("example.com", "deploy", 22, keyPath)
+	signers, err := client.collectSigners(nil, keyPath)
+	if err != nil {
+		t.Fatalf("collectSigners() error = %v", err)
+	}
+	// The key is still offered alone, the expiry kept to explain a failure
+	if len(signers) != 1 || signers[0].PublicKey().Type() != ssh.KeyAlgoED25519 {
+		t.Errorf("expected the plain key only, got %d signers", len(signers))
+	}
+	var expiredErr *CertificateExpiredError
+	if !errors.As(client.certErr, &expiredErr) {
+		t.Errorf("certErr = %v, want a CertificateExpiredError", client.certErr)
+	}
+}
+
+func TestConnect_UserCertificate(t *testing.T) {
+	keyPath, signer := writeKeyPair(t, t.TempDir(), "")
+	ca := testSigner(t)
+	// The server trusts the CA only, not the key itself
+	server := startTestServer(t, ca.PublicKey(), echoHandler)
+	jumpTestEnv(t, server.KnownHostsLine())
+
+	writeUserCert(t, keyPath, signCert(t, ca, signer.PublicKey(), ssh.UserCert, []string{"deploy"}, time.Now().Add(time.Hour)))
+	client := NewClient("127.0.0.1", "deploy", server.Port(), keyPath, WithRetries(1))
+	if err := client.Connect(); err != nil {
+		t.Fatalf("Connect() with a certificate error: %v", err)
+	}
+	client.Close()
+
+	writeUserCert(t, keyPath, signCert(t, ca, signer.PublicKey(), ssh.UserCert, []string{"deploy"}, time.Now().Add(-time.Minute)))
+	client = NewClient("127.0.0.1", "deploy", server.Port(), keyPath, WithRetries(3))
+	err := client.Connect()
+	var expiredErr *CertificateExpiredError
+	if !errors.As(err, &expiredErr) {
+		client.Close()
+		t.Fatalf("expected a CertificateExpiredError, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "-cert.pub") || !strings.Contains(err.Error(), "expired") {
+		t.Errorf("the error should name the expired certificate: %s", err)
+	}
+}
+
+func TestResolveHostKeyCallback_CertAuthority(t *testing.T) {
+	ca := testSigner(t)
+	hostKey := testSigner(t)
+	jumpTestEnv(t, "@cert-authority *.example.com "+strings.TrimSpace(string(ssh.MarshalAuthorizedKey(ca.PublicKey()))))
+	callback, err := ResolveHostKeyCallback(nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	remote := fakeAddr{"192.0.2.1:22"}
+
+	valid := signCert(t, ca, hostKey.PublicKey(), ssh.HostCert, []string{"prod.example.com"}, time.Now().Add(time.Hour))
+	if err := callback("prod.example.com:22", remote, valid); err != nil {
+		t.Errorf("a certificate signed by the authority was rejected: %v", err)
+	}
+
+	expired := signCert(t, ca, hostKey.PublicKey(), ssh.HostCert, []string{"prod.example.com"}, time.Now().Add(-time.Minute))
+	err = callback("prod.example.com:22", remote, expired)
+	var certErr *HostCertificateError
+	var expiredErr *CertificateExpiredError
+	if !errors.As(err, &certErr) || !errors.As(err, &expiredErr) {
+		t.Fatalf("expected an expired HostCertificateError, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "prod.example.com") || !strings.Contains(err.Error(), "expired") {
+		t.Errorf("unclear error: %s", err)
+	}
+
+	// Issued for another host, or by another authority
+	other := signCert(t, ca, hostKey.PublicKey(), ssh.HostCert, []string{"staging.example.com"}, time.Now().Add(time.Hour))
+	if err := callback("prod.example.com:22", remote, other); !errors.As(err, &certErr) {
+		t.Errorf("a certificate for another host should be rejected, got %v", err)
+	}
+	forged := signCert(t, testSigner(t), hostKey.PublicKey(), ssh.HostCert, []string{"prod.example.com"}, time.Now().Add(time.Hour))
+	if err := callback("prod.example.com:22", remote, forged); !errors.As(err, &certErr) {
+		t.Errorf("a certificate from another authority should be rejected, got %v", err)
+	}
+}
+
+func TestParseCertAuthorities_SkipsBadLines(t *testing.T) {
+	ca := testSigner(t)
+	caLine := "@cert-authority *.example.com " + strings.TrimSpace(string(ssh.MarshalAuthorizedKey(ca.PublicKey())))
+	data := strings.Join([]string{
+		"# comment",
+		"broken.example.com ssh-unknown AAAAnotakey",
+		"",
+		"@cert-authority *.example.com garbage",
+		caLine,
+	}, "\n")
+
+	cas := parseCertAuthorities([]byte(data))
+	if len(cas) != 1 || !cas.covers("prod.example.com:22") {
+		t.Errorf("the authority after malformed lines should be kept, got %+v", cas)
+	}
+}
+
+func TestHostKeyCallback_CertificateWithoutAuthority(t *testing.T) {
+	// Without an authority for the host, the certificate stands for its
+	// signed key, verified and recorded like a plain host key
+	hostKey := testSigner(t)
+	cert := signCert(t, testSigner(t), hostKey.PublicKey(), ssh.HostCert, []string{"prod.example.com"}, time.Now().Add(time.Hour))
+	path := t.TempDir() + "/known_hosts"
+
+	var prompted string
+	callback, err := knownHostsCallbackWithTOFU(path, func(host, keyType, fingerprint string) bool {
+		prompted = fingerprint
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := callback("prod.example.com:22", fakeAddr{"192.0.2.1:22"}, cert); err != nil {
+		t.Fatalf("callback() error = %v", err)
+	}
+	if prompted != ssh.FingerprintSHA256(hostKey.PublicKey()) {
+		t.Errorf("prompted for %q, want the fingerprint of the signed key", prompted)
+	}
+	data, _ := os.ReadFile(path)
+	if want := knownhosts.Line([]string{"prod.example.com:22"}, hostKey.PublicKey()); strings.TrimSpace(string(data)) != want {
+		t.Errorf("known_hosts = %q, want %q", data, want)
+	}
+	if HostKeyPin(cert) != HostKeyPin(hostKey.PublicKey()) {
+		t.Error("a host certificate should be pinned by its signed key")
+	}
+}
+
+func TestMatchHostPatterns(t *testing.T) {
+	tests := []struct {
+		host     string
+		patterns []string
+		want     bool
+	}{
+		{"prod", []string{"prod"}, true},
+		{"prod", []string{"*"}, true},
+		{"web1.example.com", []string{"web?.example.com"}, true},
+		{"web10.example.com", []string{"web?.example.com"}, false},
+		{"db.internal", []string{"*.internal", "!db.internal"}, false},
+		{"app.internal", []string{"*.internal", "!db.internal"}, true},
+		{"prod", []string{"!staging"}, false},
+	}
+	for _, tt := range tests {
+		if got := matchHostPatterns(tt.host, tt.patterns); got != tt.want {
+			t.Errorf("matchHostPatterns(%q, %v) = %v, want %v", tt.host, tt.patterns, got, tt.want)
+		}
+	}
+}
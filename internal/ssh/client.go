@@ -1,10 +1,13 @@
 package ssh
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"math"
+	"net"
 	"strings"
+	"sync"
 	"time"
 
 	"golang.org/x/crypto/ssh"
@@ -29,6 +32,11 @@ type clientOptions struct {
 	maxDelay         time.Duration
 	passphrasePrompt PassphraseReader
 	hostKeyPrompt    HostKeyPrompt
+	proxyJump        []JumpHost
+	sshConfigPath    string
+	maxSessions      int
+	hostKeyPins      []string
+	hostKeyCheck     HostKeyCheck
 }
 
 func defaultOptions() clientOptions {
@@ -39,6 +47,8 @@ func defaultOptions() clientOptions {
 		maxDelay:         DefaultMaxDelay,
 		passphrasePrompt: DefaultPassphraseReader,
 		hostKeyPrompt:    DefaultHostKeyPrompt,
+		sshConfigPath:    DefaultSSHConfigPath(),
+		maxSessions:      DefaultMaxSessions,
 	}
 }
 
@@ -84,6 +94,14 @@ func WithHostKeyPrompt(p HostKeyPrompt) ClientOption {
 	}
 }
 
+// WithSSHConfig sets the ssh_config file empty settings are resolved from,
+// "" for none. Defaults to DefaultSSHConfigPath.
+func WithSSHConfig(path string) ClientOption {
+	return func(o *clientOptions) {
+		o.sshConfigPath = path
+	}
+}
+
 // Client represents an SSH client connection
 type Client struct {
 	Host    string
@@ -97,12 +115,29 @@ type Client struct {
 	// cachedSigner memoizes the (possibly passphrase-decrypted) key file
 	// signer so the passphrase is prompted at most once per process
 	cachedSigner ssh.Signer
+	// jumps are the connected jump hosts, first hop first
+	jumps []*Client
+	// defaultPort is set when no port was given: ssh_config may set it
+	defaultPort bool
+	// sshConfigApplied is set once the ssh_config entry of Host is applied
+	sshConfigApplied bool
+	// sessions holds a slot per open session, up to opts.maxSessions
+	sessions chan struct{}
+	// hostKey is the server host key verified at the last connection
+	hostKey ssh.PublicKey
+	// certErr is the first user certificate left out for its validity
+	// period, reported when the authentication fails
+	certErr error
+	// agentForwarded is the connection agent channels are served on
+	agentForwarded *ssh.Client
+	agentMu        sync.Mutex
 }
 
 // NewClient creates a new SSH client.
 // Accepts optional ClientOption arguments for configuration (backward compatible).
 func NewClient(host, user string, port int, keyPath string, opts ...ClientOption) *Client {
-	if port == 0 {
+	defaultPort := port == 0
+	if defaultPort {
 		port = 22
 	}
 	o := defaultOptions()
@@ -110,31 +145,49 @@ func NewClient(host, user string, port int, keyPath string, opts ...ClientOption
 		opt(&o)
 	}
 	return &Client{
-		Host:    host,
-		User:    user,
-		Port:    port,
-		KeyPath: keyPath,
-		opts:    o,
+		Host:        host,
+		User:        user,
+		Port:        port,
+		KeyPath:     keyPath,
+		opts:        o,
+		defaultPort: defaultPort,
+		sessions:    make(chan struct{}, max(o.maxSessions, 1)),
 	}
 }
 
 // Connect establishes an SSH connection with retry and exponential backoff.
 func (c *Client) Connect() error {
+	if err := c.applySSHConfig(); err != nil {
+		return err
+	}
+	if c.User == "" {
+		return fmt.Errorf("no SSH user for %s: set it in the server config or as User in ~/.ssh/config", c.Host)
+	}
+
 	auths, err := c.authMethods()
 	if err != nil {
 		return fmt.Errorf("failed to load SSH credentials: %w", err)
 	}
 
-	hostKeyCallback, err := ResolveHostKeyCallback(c.opts.hostKeyPrompt)
+	hostKeyCallback, hostKeyAlgorithms, err := c.serverHostKeyConfig()
+	if err != nil {
+		return fmt.Errorf("host key verification failed: %w", err)
+	}
+	// Jump hosts are not pinned: they are verified with known_hosts
+	jumpHostKeyCallback, err := ResolveHostKeyCallback(c.opts.hostKeyPrompt, nil)
 	if err != nil {
 		return fmt.Errorf("host key verification failed: %w", err)
 	}
 
 	c.sshConfig = &ssh.ClientConfig{
-		User:            c.User,
-		Auth:            auths,
-		HostKeyCallback: hostKeyCallback,
-		Timeout:         c.opts.timeout,
+		User:              c.User,
+		Auth:              auths,
+		HostKeyCallback:   hostKeyCallback,
+		HostKeyAlgorithms: hostKeyAlgorithms,
+		Timeout:           c.opts.timeout,
+	}
+	if err := c.prepareJumps(jumpHostKeyCallback); err != nil {
+		return err
 	}
 
 	return c.connectWithRetry()
@@ -144,7 +197,7 @@ func (c *Client) Connect() error {
 // network-level errors are retried: authentication and host key failures
 // are permanent and surfaced immediately.
 func (c *Client) connectWithRetry() error {
-	addr := fmt.Sprintf("%s:%d", c.Host, c.Port)
+	addr := c.addr()
 	var lastErr error
 
 	for attempt := 0; attempt < c.opts.maxRetries; attempt++ {
@@ -153,12 +206,15 @@ func (c *Client) connectWithRetry() error {
 			time.Sleep(delay)
 		}
 
-		client, err := ssh.Dial("tcp", addr, c.sshConfig)
+		client, err := c.dial()
 		if err == nil {
 			c.client = client
 			return nil
 		}
 		if !isRetryableConnError(err) {
+			if c.certErr != nil && isAuthError(err) {
+				return fmt.Errorf("failed to connect to %s: %w (%v)", addr, c.certErr, err)
+			}
 			return classifyConnError(addr, err)
 		}
 		lastErr = err
@@ -174,14 +230,15 @@ func isRetryableConnError(err error) bool {
 	var changedErr *HostKeyChangedError
 	var unknownErr *HostKeyUnknownError
 	var keyErr *knownhosts.KeyError
-	if errors.As(err, &changedErr) || errors.As(err, &unknownErr) || errors.As(err, &keyErr) {
+	var certErr *HostCertificateError
+	var expiredErr *CertificateExpiredError
+	if errors.As(err, &changedErr) || errors.As(err, &unknownErr) || errors.As(err, &keyErr) ||
+		errors.As(err, &certErr) || errors.As(err, &expiredErr) {
 		return false
 	}
 
 	msg := err.Error()
-	if strings.Contains(msg, "unable to authenticate") ||
-		strings.Contains(msg, "permission denied") ||
-		strings.Contains(msg, "no supported methods remain") ||
+	if isAuthError(err) ||
 		// Local credential errors (unpromptable or wrong passphrase) are
 		// deterministic: retrying cannot fix them.
 		strings.Contains(msg, "passphrase-protected") ||
@@ -191,6 +248,14 @@ func isRetryableConnError(err error) bool {
 	return true
 }
 
+// isAuthError reports whether the server refused every credential offered
+func isAuthError(err error) bool {
+	msg := err.Error()
+	return strings.Contains(msg, "unable to authenticate") ||
+		strings.Contains(msg, "permission denied") ||
+		strings.Contains(msg, "no supported methods remain")
+}
+
 // classifyConnError unwraps host key errors so the user sees the dedicated
 // message instead of the generic handshake wrapper.
 func classifyConnError(addr string, err error) error {
@@ -202,6 +267,10 @@ func classifyConnError(addr string, err error) error {
 	if errors.As(err, &unknownErr) {
 		return unknownErr
 	}
+	var certErr *HostCertificateError
+	if errors.As(err, &certErr) {
+		return certErr
+	}
 	return fmt.Errorf("failed to connect to %s: %w", addr, err)
 }
 
@@ -214,12 +283,14 @@ func (c *Client) backoffDelay(attempt int) time.Duration {
 	return delay
 }
 
-// Close closes the SSH connection
+// Close closes the SSH connection, then the jump host connections
 func (c *Client) Close() error {
+	var err error
 	if c.client != nil {
-		return c.client.Close()
+		err = c.client.Close()
 	}
-	return nil
+	c.closeJumps()
+	return err
 }
 
 // Reconnect closes the existing connection and establishes a new one.
@@ -233,9 +304,34 @@ func (c *Client) Reconnect() error {
 		c.client.Close()
 		c.client = nil
 	}
+	c.closeJumps()
 	return c.connectWithRetry()
 }
 
+// DialContext opens a connection to addr from the server side, tunnelled
+// through the SSH connection. network is "tcp" or "unix".
+func (c *Client) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	if c.client == nil {
+		return nil, fmt.Errorf("not connected")
+	}
+	conn, err := c.client.DialContext(ctx, network, addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial %s through SSH: %w", addr, err)
+	}
+	return conn, nil
+}
+
+// acquireSession waits for a free session slot. The returned function frees
+// it once the session is closed.
+func (c *Client) acquireSession(ctx context.Context) (func(), error) {
+	select {
+	case c.sessions <- struct{}{}:
+		return func() { <-c.sessions }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
 // NewSession creates a new SSH session.
 // If the session creation fails, it attempts to reconnect once and retry.
 func (c *Client) NewSession() (*ssh.Session, error) {
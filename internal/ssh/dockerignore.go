@@ -0,0 +1,62 @@
+package ssh
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/moby/patternmatcher"
+	"github.com/moby/patternmatcher/ignorefile"
+)
+
+// Dockerignore holds the patterns of a .dockerignore file, matched with the
+// Docker CLI's own matcher
+type Dockerignore struct {
+	matcher *patternmatcher.PatternMatcher
+}
+
+// LoadDockerignore reads the .dockerignore file of dir. A missing file
+// excludes nothing.
+func LoadDockerignore(dir string) (*Dockerignore, error) {
+	file, err := os.Open(filepath.Join(dir, ".dockerignore"))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return ParseDockerignore(nil)
+		}
+		return nil, err
+	}
+	defer file.Close()
+	return ParseDockerignore(file)
+}
+
+// ParseDockerignore parses .dockerignore patterns: one per line, # for
+// comments, ! for exceptions, ** for any number of directories. The last
+// pattern matching a path or one of its parents decides.
+func ParseDockerignore(r io.Reader) (*Dockerignore, error) {
+	patterns, err := ignorefile.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read .dockerignore: %w", err)
+	}
+	matcher, err := patternmatcher.New(patterns)
+	if err != nil {
+		return nil, fmt.Errorf("invalid .dockerignore pattern: %w", err)
+	}
+	return &Dockerignore{matcher: matcher}, nil
+}
+
+// Excluded reports whether the build context leaves out rel, a slash
+// separated path relative to the context root. Dockerfile and
+// .dockerignore are always sent, like Docker does. With exception patterns,
+// directories are never excluded as a whole: a file inside may be kept.
+// Not safe for concurrent use.
+func (d *Dockerignore) Excluded(rel string, isDir bool) bool {
+	if rel == "Dockerfile" || rel == ".dockerignore" || (isDir && d.matcher.Exclusions()) {
+		return false
+	}
+	// Patterns were checked by ParseDockerignore: matching does not fail
+	excluded, err := d.matcher.MatchesOrParentMatches(rel)
+	return err == nil && excluded
+}
@@ -0,0 +1,86 @@
+package ssh
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDockerignore_Excluded(t *testing.T) {
+	d, err := ParseDockerignore(strings.NewReader(`
+# comment
+.git
+/vendor
+*.md
+var/cache
+**/*.log
+Dockerfile*
+docs/**
+!docs/keep.md
+tests/[a-c]*.php
+`))
+	if err != nil {
+		t.Fatalf("ParseDockerignore() error: %v", err)
+	}
+
+	tests := []struct {
+		rel      string
+		isDir    bool
+		excluded bool
+	}{
+		{".git", true, false}, // exceptions exist: directories are walked
+		{".git/HEAD", false, true},
+		{"vendor/autoload.php", false, true},
+		{"src/vendor/lib.php", false, false},
+		{"README.md", false, true},
+		{"src/README.md", false, false},
+		{"var/cache/prod/x.php", false, true},
+		{"var/log/dev.log", false, true},
+		{"dev.log", false, true},
+		{"Dockerfile", false, false}, // always sent
+		{"Dockerfile.dev", false, true},
+		{".dockerignore", false, false},
+		{"docs/guide.txt", false, true},
+		{"docs/keep.md", false, false},
+		{"tests/bTest.php", false, true},
+		{"tests/dTest.php", false, false},
+		{"src/Kernel.php", false, false},
+	}
+	for _, tt := range tests {
+		if got := d.Excluded(tt.rel, tt.isDir); got != tt.excluded {
+			t.Errorf("Excluded(%q) = %v, want %v", tt.rel, got, tt.excluded)
+		}
+	}
+}
+
+func TestDockerignore_DirectoriesWithoutExceptions(t *testing.T) {
+	d, err := ParseDockerignore(strings.NewReader("node_modules\nvar/cache\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !d.Excluded("node_modules", true) || !d.Excluded("var/cache", true) {
+		t.Error("excluded directories should be skipped as a whole")
+	}
+	if d.Excluded("var", true) {
+		t.Error("the parent of an excluded directory is not excluded")
+	}
+}
+
+func TestLoadDockerignore_Missing(t *testing.T) {
+	d, err := LoadDockerignore(t.TempDir())
+	if err != nil {
+		t.Fatalf("LoadDockerignore() error: %v", err)
+	}
+	if d.Excluded("anything", false) {
+		t.Error("a missing .dockerignore should exclude nothing")
+	}
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, ".dockerignore"), []byte("[\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadDockerignore(dir); err == nil {
+		t.Error("LoadDockerignore() should reject an invalid pattern")
+	}
+}
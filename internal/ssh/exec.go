@@ -5,6 +5,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"strings"
 
@@ -42,19 +43,43 @@ func (r *ExecResult) Err() error {
 
 // Exec executes a command on the remote server
 func (c *Client) Exec(ctx context.Context, command string) (*ExecResult, error) {
+	return c.ExecInput(ctx, command, nil)
+}
+
+// ExecInput executes a command on the remote server with stdin as its
+// standard input. Unlike a heredoc, the input never appears in the command
+// line of a remote process, so it suits secrets such as private keys.
+func (c *Client) ExecInput(ctx context.Context, command string, stdin io.Reader) (*ExecResult, error) {
+	return c.execSession(ctx, command, stdin, nil)
+}
+
+// execSession runs a command in a new session, set up by setup when not nil
+func (c *Client) execSession(ctx context.Context, command string, stdin io.Reader, setup func(*ssh.Session) error) (*ExecResult, error) {
 	if err := ctx.Err(); err != nil {
 		return nil, err
 	}
 
+	release, err := c.acquireSession(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
 	session, err := c.NewSession()
 	if err != nil {
 		return nil, fmt.Errorf("failed to create session: %w", err)
 	}
 	defer session.Close()
+	if setup != nil {
+		if err := setup(session); err != nil {
+			return nil, err
+		}
+	}
 
 	var stdout, stderr bytes.Buffer
 	session.Stdout = &stdout
 	session.Stderr = &stderr
+	session.Stdin = stdin
 
 	err = session.Run(command)
 
@@ -82,6 +107,12 @@ func (c *Client) ExecStream(ctx context.Context, command string) error {
 		return err
 	}
 
+	release, err := c.acquireSession(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
 	session, err := c.NewSession()
 	if err != nil {
 		return fmt.Errorf("failed to create session: %w", err)
@@ -1,10 +1,14 @@
 package ssh
 
-import "context"
+import (
+	"context"
+	"io"
+)
 
 // Executor abstracts remote command execution for testability.
 type Executor interface {
 	Exec(ctx context.Context, command string) (*ExecResult, error)
+	ExecInput(ctx context.Context, command string, stdin io.Reader) (*ExecResult, error)
 	ExecStream(ctx context.Context, command string) error
 	Close() error
 }
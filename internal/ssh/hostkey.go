@@ -21,14 +21,22 @@ import (
 type HostKeyPrompt func(host, keyType, fingerprint string) bool
 
 // HostKeyChangedError is returned when the server's host key does not match
-// the one recorded in known_hosts. This is never retried and never subject
-// to TOFU: it either means the server was reinstalled or a MITM attack.
+// the one recorded in known_hosts, or pinned in the server config (Pinned).
+// This is never retried and never subject to TOFU: it either means the
+// server was reinstalled or a MITM attack.
 type HostKeyChangedError struct {
 	Host        string
 	Fingerprint string
+	Pinned      bool
 }
 
 func (e *HostKeyChangedError) Error() string {
+	if e.Pinned {
+		return fmt.Sprintf("host key for %s does not match the key pinned in the server config (fingerprint: %s)\n"+
+			"This happens when the server was reinstalled or its keys rotated, but could also indicate a man-in-the-middle attack.\n"+
+			"If the key changed on purpose, check the new fingerprint on the server and pin it with:\n"+
+			"  frankendeploy server rekey <server>", e.Host, e.Fingerprint)
+	}
 	return fmt.Sprintf("host key for %s has changed (fingerprint: %s)\n"+
 		"This happens when the server was reinstalled or recreated, but could also indicate a man-in-the-middle attack.\n"+
 		"If you recently recreated this server, remove the old key with:\n"+
@@ -74,10 +82,15 @@ func DefaultHostKeyPrompt(host, keyType, fingerprint string) bool {
 // every SSH connection (deploy, server add, TryConnect...).
 //
 // Resolution order:
-//  1. FRANKENDEPLOY_KNOWN_HOSTS: known_hosts content for CI/CD (strict, no TOFU)
-//  2. FRANKENDEPLOY_SKIP_HOST_KEY_CHECK=true: skip verification (not recommended)
-//  3. ~/.ssh/known_hosts with trust-on-first-use via prompt
-func ResolveHostKeyCallback(prompt HostKeyPrompt) (ssh.HostKeyCallback, error) {
+//  1. pins: the host keys pinned in the server config (strict, no TOFU)
+//  2. FRANKENDEPLOY_KNOWN_HOSTS: known_hosts content for CI/CD (strict, no TOFU)
+//  3. FRANKENDEPLOY_SKIP_HOST_KEY_CHECK=true: skip verification (not recommended)
+//  4. ~/.ssh/known_hosts with trust-on-first-use via prompt
+func ResolveHostKeyCallback(prompt HostKeyPrompt, pins []string) (ssh.HostKeyCallback, error) {
+	if len(pins) > 0 {
+		return pinnedHostKeyCallback(pins), nil
+	}
+
 	if content := os.Getenv("FRANKENDEPLOY_KNOWN_HOSTS"); content != "" {
 		tmpFile, err := os.CreateTemp("", "known_hosts")
 		if err != nil {
@@ -95,10 +108,10 @@ func ResolveHostKeyCallback(prompt HostKeyPrompt) (ssh.HostKeyCallback, error) {
 		if err != nil {
 			return nil, fmt.Errorf("failed to parse FRANKENDEPLOY_KNOWN_HOSTS: %w", err)
 		}
-		return callback, nil
+		return certHostKeyCallback(callback, parseCertAuthorities([]byte(content))), nil
 	}
 
-	if os.Getenv("FRANKENDEPLOY_SKIP_HOST_KEY_CHECK") == "true" {
+	if hostKeyCheckSkipped(pins) {
 		return ssh.InsecureIgnoreHostKey(), nil
 	}
 
@@ -110,9 +123,18 @@ func ResolveHostKeyCallback(prompt HostKeyPrompt) (ssh.HostKeyCallback, error) {
 	return knownHostsCallbackWithTOFU(filepath.Join(homeDir, ".ssh", "known_hosts"), prompt)
 }
 
+// hostKeyCheckSkipped reports whether ResolveHostKeyCallback accepts any
+// host key for these pins (FRANKENDEPLOY_SKIP_HOST_KEY_CHECK)
+func hostKeyCheckSkipped(pins []string) bool {
+	return len(pins) == 0 && os.Getenv("FRANKENDEPLOY_KNOWN_HOSTS") == "" &&
+		os.Getenv("FRANKENDEPLOY_SKIP_HOST_KEY_CHECK") == "true"
+}
+
 // knownHostsCallbackWithTOFU wraps a knownhosts callback with
 // trust-on-first-use: unknown hosts are confirmed via prompt and appended to
 // the known_hosts file; key mismatches are surfaced as HostKeyChangedError.
+// Host certificates signed by a @cert-authority of the file are never
+// subject to TOFU: a rejected one is a HostCertificateError.
 func knownHostsCallbackWithTOFU(path string, prompt HostKeyPrompt) (ssh.HostKeyCallback, error) {
 	if _, err := os.Stat(path); os.IsNotExist(err) {
 		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
@@ -127,6 +149,11 @@ func knownHostsCallbackWithTOFU(path string, prompt HostKeyPrompt) (ssh.HostKeyC
 	if err != nil {
 		return nil, fmt.Errorf("failed to read known_hosts: %w", err)
 	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read known_hosts: %w", err)
+	}
+	cas := parseCertAuthorities(data)
 
 	// Keys accepted during this process: the base callback is parsed once,
 	// so reconnections must not prompt again for a key already accepted.
@@ -134,6 +161,13 @@ func knownHostsCallbackWithTOFU(path string, prompt HostKeyPrompt) (ssh.HostKeyC
 	accepted := make(map[string]bool)
 
 	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		// Host certificates of a known authority are verified strictly,
+		// other ones as their signed key
+		key = cas.hostKey(hostname, key)
+		if cert, ok := key.(*ssh.Certificate); ok {
+			return verifyHostCertificate(base, hostname, remote, cert)
+		}
+
 		err := base(hostname, remote, key)
 		if err == nil {
 			return nil
@@ -212,7 +212,7 @@ func TestResolveHostKeyCallback_EnvKnownHosts(t *testing.T) {
 	line := knownhosts.Line([]string{"example.com:22"}, key)
 	t.Setenv("FRANKENDEPLOY_KNOWN_HOSTS", line+"\n")
 
-	callback, err := ResolveHostKeyCallback(nil)
+	callback, err := ResolveHostKeyCallback(nil, nil)
 	if err != nil {
 		t.Fatalf("ResolveHostKeyCallback() error = %v", err)
 	}
@@ -231,7 +231,7 @@ func TestResolveHostKeyCallback_EnvKnownHosts(t *testing.T) {
 func TestResolveHostKeyCallback_SkipCheck(t *testing.T) {
 	t.Setenv("FRANKENDEPLOY_SKIP_HOST_KEY_CHECK", "true")
 
-	callback, err := ResolveHostKeyCallback(nil)
+	callback, err := ResolveHostKeyCallback(nil, nil)
 	if err != nil {
 		t.Fatalf("ResolveHostKeyCallback() error = %v", err)
 	}
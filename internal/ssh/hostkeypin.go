@@ -0,0 +1,128 @@
+package ssh
+
+import (
+	"net"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// HostKeyCheck verifies the host key of the server in place of pins and
+// known_hosts, returning an error to refuse it. Jump hosts are verified as
+// usual.
+type HostKeyCheck func(host, keyType, fingerprint string) error
+
+// WithHostKeyPins verifies the server against pinned host keys instead of
+// known_hosts: a key not pinned fails with a HostKeyChangedError. A pin is
+// "<key type> SHA256:<fingerprint>", as returned by HostKeyPin, or a bare
+// fingerprint. Jump hosts are still verified with known_hosts.
+func WithHostKeyPins(pins ...string) ClientOption {
+	return func(o *clientOptions) {
+		o.hostKeyPins = pins
+	}
+}
+
+// WithHostKeyCheck sets the verification of the server host key, used to
+// pin a new key after a planned rotation
+func WithHostKeyCheck(check HostKeyCheck) ClientOption {
+	return func(o *clientOptions) {
+		o.hostKeyCheck = check
+	}
+}
+
+// HostKeyPin returns the pin of a host key: its type and SHA256 fingerprint.
+// A host certificate is pinned by its signed key.
+func HostKeyPin(key ssh.PublicKey) string {
+	key = hostPublicKey(key)
+	return key.Type() + " " + ssh.FingerprintSHA256(key)
+}
+
+// HostKeyPin returns the pin of the server host key verified at the last
+// connection, "" before or when verification was skipped: an unverified key
+// must never become the trusted pin. Set as soon as the key is verified: it
+// is known even when the authentication failed afterwards.
+func (c *Client) HostKeyPin() string {
+	if c.hostKey == nil {
+		return ""
+	}
+	return HostKeyPin(c.hostKey)
+}
+
+// pinFingerprint returns the fingerprint of a pin
+func pinFingerprint(pin string) string {
+	fields := strings.Fields(pin)
+	if len(fields) == 0 {
+		return ""
+	}
+	return fields[len(fields)-1]
+}
+
+// pinnedHostKeyCallback accepts the host keys pinned only
+func pinnedHostKeyCallback(pins []string) ssh.HostKeyCallback {
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		key = hostPublicKey(key)
+		fingerprint := ssh.FingerprintSHA256(key)
+		for _, pin := range pins {
+			if pinFingerprint(pin) == fingerprint {
+				return nil
+			}
+		}
+		return &HostKeyChangedError{Host: knownhosts.Normalize(hostname), Fingerprint: fingerprint, Pinned: true}
+	}
+}
+
+// pinnedHostKeyAlgorithms returns the host key algorithms of the pinned key
+// types: the server then presents a pinned key, not another key it also
+// has. nil (any algorithm) when a pin has no key type.
+func pinnedHostKeyAlgorithms(pins []string) []string {
+	var algorithms []string
+	for _, pin := range pins {
+		fields := strings.Fields(pin)
+		if len(fields) != 2 {
+			return nil
+		}
+		if fields[0] == ssh.KeyAlgoRSA {
+			// RSA keys sign with SHA-2 since OpenSSH 8.8
+			algorithms = append(algorithms, ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256)
+		}
+		algorithms = append(algorithms, fields[0])
+	}
+	return algorithms
+}
+
+// checkHostKeyCallback adapts a HostKeyCheck
+func checkHostKeyCallback(check HostKeyCheck) ssh.HostKeyCallback {
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		key = hostPublicKey(key)
+		return check(knownhosts.Normalize(hostname), key.Type(), ssh.FingerprintSHA256(key))
+	}
+}
+
+// serverHostKeyConfig returns the host key callback and algorithms of the
+// server: the check, the pins or known_hosts, in that order. The callback
+// records the key it accepts for HostKeyPin, unless verification is skipped.
+func (c *Client) serverHostKeyConfig() (ssh.HostKeyCallback, []string, error) {
+	var callback ssh.HostKeyCallback
+	var algorithms []string
+	verified := true
+	if c.opts.hostKeyCheck != nil {
+		callback = checkHostKeyCallback(c.opts.hostKeyCheck)
+	} else {
+		var err error
+		if callback, err = ResolveHostKeyCallback(c.opts.hostKeyPrompt, c.opts.hostKeyPins); err != nil {
+			return nil, nil, err
+		}
+		algorithms = pinnedHostKeyAlgorithms(c.opts.hostKeyPins)
+		verified = !hostKeyCheckSkipped(c.opts.hostKeyPins)
+	}
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		if err := callback(hostname, remote, key); err != nil {
+			return err
+		}
+		if verified {
+			c.hostKey = key
+		}
+		return nil
+	}, algorithms, nil
+}
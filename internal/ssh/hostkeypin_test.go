@@ -0,0 +1,140 @@
+package ssh
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestResolveHostKeyCallback_Pins(t *testing.T) {
+	key := testHostKey(t)
+	// Pins take precedence over FRANKENDEPLOY_SKIP_HOST_KEY_CHECK
+	t.Setenv("FRANKENDEPLOY_SKIP_HOST_KEY_CHECK", "true")
+
+	for _, pin := range []string{HostKeyPin(key), ssh.FingerprintSHA256(key)} {
+		callback, err := ResolveHostKeyCallback(nil, []string{"ssh-ed25519 SHA256:other", pin})
+		if err != nil {
+			t.Fatalf("ResolveHostKeyCallback() error = %v", err)
+		}
+		if err := callback("example.com:22", fakeAddr{"192.0.2.1:22"}, key); err != nil {
+			t.Errorf("pinned key %q rejected: %v", pin, err)
+		}
+	}
+
+	callback, err := ResolveHostKeyCallback(nil, []string{HostKeyPin(key)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = callback("example.com:22", fakeAddr{"192.0.2.1:22"}, testHostKey(t))
+	var changedErr *HostKeyChangedError
+	if !errors.As(err, &changedErr) || !changedErr.Pinned || changedErr.Host != "example.com" {
+		t.Fatalf("expected a pinned HostKeyChangedError, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "server rekey") {
+		t.Errorf("the error should tell how to pin a new key: %s", err)
+	}
+}
+
+func TestPinnedHostKeyAlgorithms(t *testing.T) {
+	tests := []struct {
+		pins []string
+		want []string
+	}{
+		{[]string{"ssh-ed25519 SHA256:a"}, []string{"ssh-ed25519"}},
+		{[]string{"ssh-rsa SHA256:a"}, []string{"rsa-sha2-512", "rsa-sha2-256", "ssh-rsa"}},
+		{[]string{"ssh-ed25519 SHA256:a", "SHA256:b"}, nil},
+		{nil, nil},
+	}
+	for _, tt := range tests {
+		if got := pinnedHostKeyAlgorithms(tt.pins); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("pinnedHostKeyAlgorithms(%v) = %v, want %v", tt.pins, got, tt.want)
+		}
+	}
+}
+
+func TestConnect_PinnedHostKey(t *testing.T) {
+	keyPath, signer := writeKeyPair(t, t.TempDir(), "")
+	server := startTestServer(t, signer.PublicKey(), echoHandler)
+	// The server is not in known_hosts: the pin alone is trusted
+	jumpTestEnv(t)
+	pin := HostKeyPin(server.HostKey.PublicKey())
+
+	client := NewClient("127.0.0.1", "deploy", server.Port(), keyPath, WithRetries(1), WithHostKeyPins(pin))
+	if err := client.Connect(); err != nil {
+		t.Fatalf("Connect() with the pinned key error: %v", err)
+	}
+	client.Close()
+	if client.HostKeyPin() != pin {
+		t.Errorf("HostKeyPin() = %q, want %q", client.HostKeyPin(), pin)
+	}
+
+	other := HostKeyPin(testHostKey(t))
+	client = NewClient("127.0.0.1", "deploy", server.Port(), keyPath, WithRetries(3), WithHostKeyPins(other))
+	err := client.Connect()
+	var changedErr *HostKeyChangedError
+	if !errors.As(err, &changedErr) || !changedErr.Pinned {
+		t.Fatalf("expected a pinned HostKeyChangedError, got %v", err)
+	}
+	if changedErr.Fingerprint != ssh.FingerprintSHA256(server.HostKey.PublicKey()) {
+		t.Errorf("the error should show the key presented, got %s", changedErr.Fingerprint)
+	}
+}
+
+func TestConnect_HostKeyCheck(t *testing.T) {
+	keyPath, signer := writeKeyPair(t, t.TempDir(), "")
+	server := startTestServer(t, signer.PublicKey(), echoHandler)
+	jumpTestEnv(t)
+
+	var seen string
+	client := NewClient("127.0.0.1", "deploy", server.Port(), keyPath,
+		WithRetries(1),
+		WithHostKeyPins("ssh-ed25519 SHA256:old"),
+		WithHostKeyCheck(func(host, keyType, fingerprint string) error {
+			seen = keyType + " " + fingerprint
+			return nil
+		}),
+	)
+	if err := client.Connect(); err != nil {
+		t.Fatalf("Connect() error: %v", err)
+	}
+	client.Close()
+	if want := HostKeyPin(server.HostKey.PublicKey()); seen != want || client.HostKeyPin() != want {
+		t.Errorf("check saw %q, HostKeyPin() = %q, want %q", seen, client.HostKeyPin(), want)
+	}
+}
+
+func TestHostKeyPin_KnownAfterAuthFailure(t *testing.T) {
+	_, signer := writeKeyPair(t, t.TempDir(), "")
+	otherKey, _ := writeKeyPair(t, t.TempDir(), "")
+	server := startTestServer(t, signer.PublicKey(), echoHandler)
+	jumpTestEnv(t, server.KnownHostsLine())
+
+	client := NewClient("127.0.0.1", "deploy", server.Port(), otherKey, WithRetries(1))
+	if err := client.Connect(); err == nil {
+		client.Close()
+		t.Fatal("Connect() should fail with a key the server rejects")
+	}
+	if client.HostKeyPin() != HostKeyPin(server.HostKey.PublicKey()) {
+		t.Errorf("HostKeyPin() = %q after an authentication failure", client.HostKeyPin())
+	}
+}
+
+func TestHostKeyPin_NotSetWhenCheckSkipped(t *testing.T) {
+	_, signer := writeKeyPair(t, t.TempDir(), "")
+	server := startTestServer(t, signer.PublicKey(), echoHandler)
+	jumpTestEnv(t)
+	t.Setenv("FRANKENDEPLOY_KNOWN_HOSTS", "")
+	t.Setenv("FRANKENDEPLOY_SKIP_HOST_KEY_CHECK", "true")
+
+	keyPath, _ := writeKeyPair(t, t.TempDir(), "")
+	client := NewClient("127.0.0.1", "deploy", server.Port(), keyPath, WithRetries(1))
+	if err := client.Connect(); err == nil {
+		client.Close()
+	}
+	if pin := client.HostKeyPin(); pin != "" {
+		t.Errorf("an unverified host key must not be pinned, HostKeyPin() = %q", pin)
+	}
+}
@@ -0,0 +1,156 @@
+package ssh
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// JumpHost is a bastion the SSH connection is tunnelled through, like
+// OpenSSH's ProxyJump. Empty fields default to the values of the target
+// client: its user, port 22 and its key.
+type JumpHost struct {
+	Host    string
+	User    string
+	Port    int
+	KeyPath string
+}
+
+// WithProxyJump tunnels the connection through jump hosts, in order: the
+// first one is dialed directly, each next hop (and finally the server)
+// through the previous one. Every hop authenticates with its own key and
+// its host key is verified like the server's.
+func WithProxyJump(hops ...JumpHost) ClientOption {
+	return func(o *clientOptions) {
+		o.proxyJump = hops
+	}
+}
+
+// addr returns the host:port of a client, bracketing IPv6 addresses
+func (c *Client) addr() string {
+	return net.JoinHostPort(c.Host, strconv.Itoa(c.Port))
+}
+
+// jumpClients returns a client per jump host. A hop named by an
+// ssh_config alias is resolved like the server; the settings still empty
+// default to the user and key of c. The hops share the options of c, minus
+// the jump hosts themselves: the ProxyJump of a hop is not followed.
+func (c *Client) jumpClients() ([]*Client, error) {
+	if len(c.opts.proxyJump) == 0 {
+		return nil, nil
+	}
+	hopOpts := c.opts
+	hopOpts.proxyJump = nil
+
+	clients := make([]*Client, len(c.opts.proxyJump))
+	for i, hop := range c.opts.proxyJump {
+		client := NewClient(hop.Host, hop.User, hop.Port, hop.KeyPath)
+		client.opts = hopOpts
+		if err := client.applySSHConfig(); err != nil {
+			return nil, err
+		}
+		client.opts.proxyJump = nil
+		if client.User == "" {
+			client.User = c.User
+		}
+		if client.KeyPath == "" {
+			client.KeyPath = c.KeyPath
+		}
+		clients[i] = client
+	}
+	return clients, nil
+}
+
+// prepareJumps builds the SSH config of every jump host. Called once per
+// Connect: key passphrases are prompted at most once per process.
+func (c *Client) prepareJumps(hostKeyCallback ssh.HostKeyCallback) error {
+	jumps, err := c.jumpClients()
+	if err != nil {
+		return err
+	}
+	c.jumps = jumps
+	for _, hop := range c.jumps {
+		auths, err := hop.authMethods()
+		if err != nil {
+			return fmt.Errorf("failed to load SSH credentials for jump host %s: %w", hop.Host, err)
+		}
+		hop.sshConfig = &ssh.ClientConfig{
+			User:            hop.User,
+			Auth:            auths,
+			HostKeyCallback: hostKeyCallback,
+			Timeout:         c.opts.timeout,
+		}
+	}
+	return nil
+}
+
+// dial opens the SSH connection to the server, through the jump hosts when
+// set. On failure, the hops already connected are closed.
+func (c *Client) dial() (*ssh.Client, error) {
+	if len(c.jumps) == 0 {
+		return ssh.Dial("tcp", c.addr(), c.sshConfig)
+	}
+
+	var previous *ssh.Client
+	for _, hop := range c.jumps {
+		client, err := dialVia(previous, hop.addr(), hop.sshConfig)
+		if err != nil {
+			c.closeJumps()
+			return nil, &JumpHostError{Host: hop.addr(), Err: err}
+		}
+		hop.client = client
+		previous = client
+	}
+
+	client, err := dialVia(previous, c.addr(), c.sshConfig)
+	if err != nil {
+		c.closeJumps()
+		return nil, err
+	}
+	return client, nil
+}
+
+// dialVia opens an SSH connection to addr, tunnelled through via when set
+func dialVia(via *ssh.Client, addr string, config *ssh.ClientConfig) (*ssh.Client, error) {
+	if via == nil {
+		return ssh.Dial("tcp", addr, config)
+	}
+	conn, err := via.Dial("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open a tunnel to %s: %w", addr, err)
+	}
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, addr, config)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return ssh.NewClient(sshConn, chans, reqs), nil
+}
+
+// closeJumps closes the jump host connections, last hop first
+func (c *Client) closeJumps() {
+	for i := len(c.jumps) - 1; i >= 0; i-- {
+		if c.jumps[i].client != nil {
+			c.jumps[i].client.Close()
+			c.jumps[i].client = nil
+		}
+	}
+}
+
+// JumpHostError is returned when a jump host cannot be reached or rejects
+// the connection. Err keeps the cause: host key errors are still matched
+// by errors.As.
+type JumpHostError struct {
+	Host string
+	Err  error
+}
+
+func (e *JumpHostError) Error() string {
+	return fmt.Sprintf("jump host %s: %v", e.Host, e.Err)
+}
+
+func (e *JumpHostError) Unwrap() error {
+	return e.Err
+}
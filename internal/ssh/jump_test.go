@@ -0,0 +1,153 @@
+package ssh
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// jumpTestEnv isolates a test from the user's SSH setup: no agent, no
+// FRANKENDEPLOY_SSH_KEY, and host keys trusted from knownHosts only
+func jumpTestEnv(t *testing.T, knownHosts ...string) {
+	t.Helper()
+	t.Setenv("SSH_AUTH_SOCK", "")
+	t.Setenv("FRANKENDEPLOY_SSH_KEY", "")
+	t.Setenv("FRANKENDEPLOY_SKIP_HOST_KEY_CHECK", "")
+	t.Setenv("FRANKENDEPLOY_SSH_CONFIG", "")
+	t.Setenv("FRANKENDEPLOY_KNOWN_HOSTS", strings.Join(knownHosts, "\n")+"\n")
+	t.Setenv("HOME", t.TempDir())
+}
+
+func TestConnect_ThroughJumpHost(t *testing.T) {
+	bastionKey, bastionSigner := writeKeyPair(t, t.TempDir(), "")
+	targetKey, targetSigner := writeKeyPair(t, t.TempDir(), "")
+	bastion := startTestServer(t, bastionSigner.PublicKey(), echoHandler)
+	target := startTestServer(t, targetSigner.PublicKey(), echoHandler)
+	jumpTestEnv(t, bastion.KnownHostsLine(), target.KnownHostsLine())
+
+	client := NewClient("127.0.0.1", "deploy", target.Port(), targetKey,
+		WithRetries(1),
+		WithProxyJump(JumpHost{Host: "127.0.0.1", User: "ops", Port: bastion.Port(), KeyPath: bastionKey}),
+	)
+	if err := client.Connect(); err != nil {
+		t.Fatalf("Connect() error: %v", err)
+	}
+	defer client.Close()
+
+	result, err := client.Exec(context.Background(), "uptime")
+	if err != nil || result.Stdout != "ran: uptime" {
+		t.Fatalf("Exec() = %+v, %v", result, err)
+	}
+	if got := bastion.Forwarded(); !reflect.DeepEqual(got, []string{target.Addr}) {
+		t.Errorf("bastion forwarded %v, want [%s]", got, target.Addr)
+	}
+	if len(bastion.Commands()) != 0 {
+		t.Errorf("commands must run on the target only, bastion ran %v", bastion.Commands())
+	}
+}
+
+func TestConnect_ThroughTwoJumpHosts(t *testing.T) {
+	keyPath, signer := writeKeyPair(t, t.TempDir(), "")
+	first := startTestServer(t, signer.PublicKey(), echoHandler)
+	second := startTestServer(t, signer.PublicKey(), echoHandler)
+	target := startTestServer(t, signer.PublicKey(), echoHandler)
+	jumpTestEnv(t, first.KnownHostsLine(), second.KnownHostsLine(), target.KnownHostsLine())
+
+	// The hops default to the user and key of the server
+	client := NewClient("127.0.0.1", "deploy", target.Port(), keyPath,
+		WithRetries(1),
+		WithProxyJump(JumpHost{Host: "127.0.0.1", Port: first.Port()}, JumpHost{Host: "127.0.0.1", Port: second.Port()}),
+	)
+	if err := client.Connect(); err != nil {
+		t.Fatalf("Connect() error: %v", err)
+	}
+
+	if got := first.Forwarded(); !reflect.DeepEqual(got, []string{second.Addr}) {
+		t.Errorf("first hop forwarded %v, want [%s]", got, second.Addr)
+	}
+	if got := second.Forwarded(); !reflect.DeepEqual(got, []string{target.Addr}) {
+		t.Errorf("second hop forwarded %v, want [%s]", got, target.Addr)
+	}
+
+	// Reconnecting goes through the hops again
+	if err := client.Reconnect(); err != nil {
+		t.Fatalf("Reconnect() error: %v", err)
+	}
+	if len(first.Forwarded()) != 2 {
+		t.Errorf("Reconnect() should tunnel through the first hop again, forwarded %v", first.Forwarded())
+	}
+	if err := client.Close(); err != nil {
+		t.Errorf("Close() error: %v", err)
+	}
+	for _, hop := range client.jumps {
+		if hop.client != nil {
+			t.Error("Close() should close the jump host connections")
+		}
+	}
+}
+
+func TestConnect_JumpHostKeyUnknown(t *testing.T) {
+	keyPath, signer := writeKeyPair(t, t.TempDir(), "")
+	bastion := startTestServer(t, signer.PublicKey(), echoHandler)
+	target := startTestServer(t, signer.PublicKey(), echoHandler)
+	// Only the target is known: the bastion's key must be verified too
+	jumpTestEnv(t, target.KnownHostsLine())
+
+	client := NewClient("127.0.0.1", "deploy", target.Port(), keyPath,
+		WithRetries(1),
+		WithProxyJump(JumpHost{Host: "127.0.0.1", Port: bastion.Port()}),
+	)
+	err := client.Connect()
+	if err == nil {
+		client.Close()
+		t.Fatal("Connect() should fail when the jump host key is unknown")
+	}
+	var jumpErr *JumpHostError
+	if !errors.As(err, &jumpErr) || jumpErr.Host != bastion.Addr {
+		t.Errorf("expected a JumpHostError for %s, got %v", bastion.Addr, err)
+	}
+	if isRetryableConnError(err) {
+		t.Error("a jump host key error must not be retried")
+	}
+	if len(bastion.Forwarded()) != 0 {
+		t.Error("nothing should be tunnelled through an unverified jump host")
+	}
+}
+
+func TestConnect_JumpHostRejectsKey(t *testing.T) {
+	keyPath, signer := writeKeyPair(t, t.TempDir(), "")
+	_, otherSigner := writeKeyPair(t, t.TempDir(), "")
+	bastion := startTestServer(t, otherSigner.PublicKey(), echoHandler)
+	target := startTestServer(t, signer.PublicKey(), echoHandler)
+	jumpTestEnv(t, bastion.KnownHostsLine(), target.KnownHostsLine())
+
+	client := NewClient("127.0.0.1", "deploy", target.Port(), keyPath,
+		WithRetries(3),
+		WithInitialDelay(time.Hour),
+		WithProxyJump(JumpHost{Host: "127.0.0.1", Port: bastion.Port()}),
+	)
+	err := client.Connect()
+	if err == nil || !strings.Contains(err.Error(), "jump host "+bastion.Addr) {
+		t.Fatalf("expected an authentication error on the jump host, got %v", err)
+	}
+}
+
+func TestTryConnect_ThroughJumpHost(t *testing.T) {
+	bastionKey, bastionSigner := writeKeyPair(t, t.TempDir(), "")
+	targetKey, targetSigner := writeKeyPair(t, t.TempDir(), "")
+	bastion := startTestServer(t, bastionSigner.PublicKey(), echoHandler)
+	target := startTestServer(t, targetSigner.PublicKey(), echoHandler)
+	jumpTestEnv(t, bastion.KnownHostsLine(), target.KnownHostsLine())
+
+	hop := WithProxyJump(JumpHost{Host: "127.0.0.1", Port: bastion.Port(), KeyPath: bastionKey})
+	if err := TryConnect("127.0.0.1", "deploy", target.Port(), targetKey, hop); err != nil {
+		t.Fatalf("TryConnect() error: %v", err)
+	}
+	if err := TryConnect("127.0.0.1", "deploy", target.Port(), filepath.Join(filepath.Dir(bastionKey), "id_ed25519"), hop); err == nil {
+		t.Error("TryConnect() should fail with a key the target rejects")
+	}
+}
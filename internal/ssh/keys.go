@@ -169,13 +169,10 @@ func detectKeyType(data []byte) string {
 
 // TryConnect attempts to connect to a server with a specific key file
 // (encrypted keys prompt for their passphrase). The ssh-agent is deliberately
-// not used here: this function validates one specific key.
+// not used here: this function validates one specific key. Jump hosts given
+// with WithProxyJump authenticate as usual and default to that key.
 // Returns nil on success, error on failure.
-func TryConnect(host, user string, port int, keyPath string) error {
-	if port == 0 {
-		port = 22
-	}
-
+func TryConnect(host, user string, port int, keyPath string, opts ...ClientOption) error {
 	keyData, err := os.ReadFile(keyPath)
 	if err != nil {
 		return fmt.Errorf("failed to read key: %w", err)
@@ -186,26 +183,37 @@ func TryConnect(host, user string, port int, keyPath string) error {
 		return err
 	}
 
-	hostKeyCallback, err := ResolveHostKeyCallback(DefaultHostKeyPrompt)
+	c := NewClient(host, user, port, keyPath, append([]ClientOption{WithTimeout(10 * time.Second)}, opts...)...)
+	if err := c.applySSHConfig(); err != nil {
+		return err
+	}
+	hostKeyCallback, hostKeyAlgorithms, err := c.serverHostKeyConfig()
 	if err != nil {
 		return err
 	}
-
-	config := &ssh.ClientConfig{
-		User: user,
+	jumpHostKeyCallback, err := ResolveHostKeyCallback(c.opts.hostKeyPrompt, nil)
+	if err != nil {
+		return err
+	}
+	c.sshConfig = &ssh.ClientConfig{
+		User: c.User,
 		Auth: []ssh.AuthMethod{
 			ssh.PublicKeys(signer),
 		},
-		HostKeyCallback: hostKeyCallback,
-		Timeout:         10 * time.Second,
+		HostKeyCallback:   hostKeyCallback,
+		HostKeyAlgorithms: hostKeyAlgorithms,
+		Timeout:           c.opts.timeout,
+	}
+	if err := c.prepareJumps(jumpHostKeyCallback); err != nil {
+		return err
 	}
 
-	addr := fmt.Sprintf("%s:%d", host, port)
-	client, err := ssh.Dial("tcp", addr, config)
+	client, err := c.dial()
 	if err != nil {
-		return classifyConnError(addr, err)
+		return classifyConnError(c.addr(), err)
 	}
 	client.Close()
+	c.closeJumps()
 
 	return nil
 }
@@ -1,32 +1,135 @@
 package ssh
 
-import "context"
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+)
 
 // MockExecutor is a test double that records commands and returns configured results.
 type MockExecutor struct {
 	ExecFunc       func(ctx context.Context, command string) (*ExecResult, error)
 	ExecStreamFunc func(ctx context.Context, command string) error
+	UploadFunc     func(ctx context.Context, localPath, remotePath string) error
+	SyncDirFunc    func(ctx context.Context, localDir, remoteDir string, opts SyncOptions) (*SyncStats, error)
 	Commands       []string
+	// Inputs holds the stdin of ExecInput calls, in order
+	Inputs []string
+	// Batches holds the commands of each ExecBatch call, also recorded one
+	// by one in Commands
+	Batches [][]string
+	// Uploads holds the remote path of each Upload and SyncDir call, in order
+	Uploads []string
+	// AgentCommands holds the commands run with ExecForwardAgent, also
+	// recorded in Commands
+	AgentCommands []string
+	// Forwards holds the server side address of each Forward call
+	Forwards []string
+
+	mu sync.Mutex
 }
 
 // Exec records the command and delegates to ExecFunc.
 func (m *MockExecutor) Exec(ctx context.Context, command string) (*ExecResult, error) {
-	m.Commands = append(m.Commands, command)
+	m.record(command)
 	if m.ExecFunc != nil {
 		return m.ExecFunc(ctx, command)
 	}
 	return &ExecResult{Stdout: "", Stderr: "", ExitCode: 0}, nil
 }
 
+// ExecInput records the command and its input, then delegates to ExecFunc.
+func (m *MockExecutor) ExecInput(ctx context.Context, command string, stdin io.Reader) (*ExecResult, error) {
+	if stdin != nil {
+		data, err := io.ReadAll(stdin)
+		if err != nil {
+			return nil, err
+		}
+		m.mu.Lock()
+		m.Inputs = append(m.Inputs, string(data))
+		m.mu.Unlock()
+	}
+	return m.Exec(ctx, command)
+}
+
+// ExecForwardAgent records the command, then delegates to ExecFunc.
+func (m *MockExecutor) ExecForwardAgent(ctx context.Context, command string) (*ExecResult, error) {
+	m.mu.Lock()
+	m.AgentCommands = append(m.AgentCommands, command)
+	m.mu.Unlock()
+	return m.Exec(ctx, command)
+}
+
+// Forward records the address and returns a tunnel whose connections
+// fail: the mock has no server side.
+func (m *MockExecutor) Forward(ctx context.Context, network, addr string) (*Tunnel, error) {
+	m.mu.Lock()
+	m.Forwards = append(m.Forwards, addr)
+	m.mu.Unlock()
+	return newTunnel(ctx, func(context.Context) (net.Conn, error) {
+		return nil, fmt.Errorf("mock: no server side for %s", addr)
+	})
+}
+
 // ExecStream records the command and delegates to ExecStreamFunc.
 func (m *MockExecutor) ExecStream(ctx context.Context, command string) error {
-	m.Commands = append(m.Commands, command)
+	m.record(command)
 	if m.ExecStreamFunc != nil {
 		return m.ExecStreamFunc(ctx, command)
 	}
 	return nil
 }
 
+// ExecBatch records the batch, then runs each command with Exec.
+func (m *MockExecutor) ExecBatch(ctx context.Context, commands []string) ([]*ExecResult, error) {
+	m.mu.Lock()
+	m.Batches = append(m.Batches, commands)
+	m.mu.Unlock()
+
+	results := make([]*ExecResult, len(commands))
+	for i, command := range commands {
+		result, err := m.Exec(ctx, command)
+		if err != nil {
+			return nil, err
+		}
+		results[i] = result
+	}
+	return results, nil
+}
+
+// Upload records the remote path and delegates to UploadFunc.
+func (m *MockExecutor) Upload(ctx context.Context, localPath, remotePath string, progress ProgressFunc) error {
+	m.recordUpload(remotePath)
+	if m.UploadFunc != nil {
+		return m.UploadFunc(ctx, localPath, remotePath)
+	}
+	return nil
+}
+
+// SyncDir records the remote directory and delegates to SyncDirFunc.
+func (m *MockExecutor) SyncDir(ctx context.Context, localDir, remoteDir string, opts SyncOptions) (*SyncStats, error) {
+	m.recordUpload(remoteDir)
+	if m.SyncDirFunc != nil {
+		return m.SyncDirFunc(ctx, localDir, remoteDir, opts)
+	}
+	return &SyncStats{}, nil
+}
+
+func (m *MockExecutor) recordUpload(remotePath string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.Uploads = append(m.Uploads, remotePath)
+}
+
+// record appends a command to Commands. Safe for concurrent use.
+func (m *MockExecutor) record(command string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.Commands = append(m.Commands, command)
+}
+
 // Close is a no-op for the mock.
 func (m *MockExecutor) Close() error {
 	return nil
@@ -0,0 +1,173 @@
+package ssh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+// posixRenameExtension renames over an existing file, which a plain SFTP v3
+// rename refuses
+const posixRenameExtension = "posix-rename@openssh.com"
+
+// SFTPClient is an SFTP client running in a session of Client, over the
+// same connection (jump hosts and credentials included) as every command.
+// It adds to sftp.Client the operations a transfer needs. Safe for
+// concurrent use.
+type SFTPClient struct {
+	*sftp.Client
+	session   *ssh.Session
+	release   func()
+	closeOnce sync.Once
+}
+
+// NewSFTP starts the sftp subsystem in a new session, which takes one of
+// the session slots of c until Close
+func (c *Client) NewSFTP(ctx context.Context) (*SFTPClient, error) {
+	release, err := c.acquireSession(ctx)
+	if err != nil {
+		return nil, err
+	}
+	session, err := c.NewSession()
+	if err != nil {
+		release()
+		return nil, fmt.Errorf("failed to create session: %w", err)
+	}
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		session.Close()
+		release()
+		return nil, err
+	}
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		session.Close()
+		release()
+		return nil, err
+	}
+	if err := session.RequestSubsystem("sftp"); err != nil {
+		session.Close()
+		release()
+		return nil, fmt.Errorf("failed to start sftp subsystem: %w", err)
+	}
+
+	// Writes are pipelined: an upload does not wait a round trip per chunk
+	client, err := sftp.NewClientPipe(stdout, stdin, sftp.UseConcurrentWrites(true))
+	if err != nil {
+		session.Close()
+		release()
+		return nil, fmt.Errorf("failed to start sftp subsystem: %w", err)
+	}
+	return &SFTPClient{Client: client, session: session, release: release}, nil
+}
+
+// Close ends the sftp session
+func (s *SFTPClient) Close() error {
+	var err error
+	s.closeOnce.Do(func() {
+		s.Client.Close()
+		err = s.session.Close()
+		s.release()
+	})
+	if errors.Is(err, io.EOF) {
+		return nil
+	}
+	return err
+}
+
+// RemoveAll removes a file or a directory and what it contains. A missing
+// path is not an error. Unlike sftp.Client.RemoveAll, symlinks to
+// directories are removed, not followed.
+func (s *SFTPClient) RemoveAll(name string) error {
+	info, err := s.Lstat(name)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	if !info.IsDir() {
+		return s.Remove(name)
+	}
+	entries, err := s.ReadDir(name)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if err := s.RemoveAll(path.Join(name, entry.Name())); err != nil {
+			return err
+		}
+	}
+	return s.RemoveDirectory(name)
+}
+
+// Rename renames oldPath to newPath, replacing newPath when it exists
+// (atomically when the server supports posix-rename@openssh.com)
+func (s *SFTPClient) Rename(oldPath, newPath string) error {
+	if _, ok := s.HasExtension(posixRenameExtension); ok {
+		return s.PosixRename(oldPath, newPath)
+	}
+	// SFTP v3 rename refuses an existing target
+	if err := s.Remove(newPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return s.Client.Rename(oldPath, newPath)
+}
+
+// SetAttrs sets the permissions and the modification time (to the second)
+// of name. A zero mode or time is left unchanged.
+func (s *SFTPClient) SetAttrs(name string, mode fs.FileMode, mtime time.Time) error {
+	if mode != 0 {
+		if err := s.Chmod(name, mode.Perm()); err != nil {
+			return err
+		}
+	}
+	if !mtime.IsZero() {
+		return s.Chtimes(name, mtime, mtime)
+	}
+	return nil
+}
+
+// WriteFile creates or truncates path and writes r to it with mode,
+// calling progress with the bytes written so far. The mode is set before
+// any data is written.
+func (s *SFTPClient) WriteFile(path string, r io.Reader, mode fs.FileMode, progress func(written int64)) error {
+	file, err := s.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+	if err != nil {
+		return err
+	}
+	if err := file.Chmod(mode.Perm()); err != nil {
+		file.Close()
+		return err
+	}
+	if _, err := file.ReadFromWithConcurrency(&progressReader{r: r, fn: progress}, 0); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// progressReader reports the bytes read from r
+type progressReader struct {
+	r    io.Reader
+	fn   func(read int64)
+	read int64
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	if n > 0 && p.fn != nil {
+		p.read += int64(n)
+		p.fn(p.read)
+	}
+	return n, err
+}
@@ -0,0 +1,268 @@
+package ssh
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	sshconfig "github.com/kevinburke/ssh_config"
+	"github.com/yoanbernabeu/frankendeploy/internal/config"
+)
+
+// SSHConfig is a parsed OpenSSH client config file (~/.ssh/config). Parsing
+// and host matching are github.com/kevinburke/ssh_config's; only the
+// settings frankendeploy uses are looked up: HostName, User, Port,
+// IdentityFile and ProxyJump.
+type SSHConfig struct {
+	cfg *sshconfig.Config
+}
+
+// SSHHostConfig is what ssh_config sets for a host alias. Empty fields are
+// not set by the file.
+type SSHHostConfig struct {
+	HostName     string
+	User         string
+	Port         int
+	IdentityFile string
+	ProxyJump    string
+}
+
+// DefaultSSHConfigPath returns the ssh_config file read by the client:
+// FRANKENDEPLOY_SSH_CONFIG when set ("none" disables it), ~/.ssh/config
+// otherwise
+func DefaultSSHConfigPath() string {
+	if path := os.Getenv("FRANKENDEPLOY_SSH_CONFIG"); path != "" {
+		if path == "none" {
+			return ""
+		}
+		return expandHome(path)
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(homeDir, ".ssh", "config")
+}
+
+// LoadSSHConfig parses an ssh_config file and the files it includes. A
+// missing file is an empty config. Relative Include paths are resolved
+// from ~/.ssh, like OpenSSH. Match blocks other than "Match host" and
+// "Match all" are refused by the parser.
+func LoadSSHConfig(path string) (*SSHConfig, error) {
+	if path == "" {
+		return &SSHConfig{}, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return &SSHConfig{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := sshconfig.DecodeBytes(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &SSHConfig{cfg: cfg}, nil
+}
+
+// Lookup returns the settings of a host alias: every block matching alias
+// applies, in file order, and the first value of each setting wins.
+// IdentityFile has ~ and the %d, %h, %r, %u and %% tokens expanded.
+func (c *SSHConfig) Lookup(alias string) (SSHHostConfig, error) {
+	if c.cfg == nil {
+		return SSHHostConfig{}, nil
+	}
+	params := map[string]string{}
+	for _, keyword := range []string{"HostName", "User", "Port", "IdentityFile", "ProxyJump"} {
+		value, err := c.cfg.Get(alias, keyword)
+		if err != nil {
+			return SSHHostConfig{}, err
+		}
+		params[keyword] = value
+	}
+
+	host := SSHHostConfig{
+		User:      params["User"],
+		ProxyJump: params["ProxyJump"],
+	}
+	if hostName := params["HostName"]; hostName != "" {
+		host.HostName = strings.ReplaceAll(hostName, "%h", alias)
+	}
+	if port := params["Port"]; port != "" {
+		n, err := strconv.Atoi(port)
+		if err != nil || n < 1 || n > 65535 {
+			return SSHHostConfig{}, fmt.Errorf("invalid port %q for %s", port, alias)
+		}
+		host.Port = n
+	}
+	if identityFile := params["IdentityFile"]; identityFile != "" && !strings.EqualFold(identityFile, "none") {
+		hostName := host.HostName
+		if hostName == "" {
+			hostName = alias
+		}
+		host.IdentityFile = expandTokens(identityFile, hostName, host.User)
+	}
+	return host, nil
+}
+
+// Aliases returns the hosts named by Host blocks, in file order, included
+// files at their Include: patterns without wildcard or negation
+func (c *SSHConfig) Aliases() []string {
+	if c.cfg == nil {
+		return nil
+	}
+	seen := map[string]bool{}
+	var aliases []string
+	collectAliases(c.cfg, seen, &aliases)
+	return aliases
+}
+
+// collectAliases appends the aliases of cfg not seen yet
+func collectAliases(cfg *sshconfig.Config, seen map[string]bool, aliases *[]string) {
+	for _, block := range cfg.Hosts {
+		for _, pattern := range block.Patterns {
+			alias := pattern.String()
+			if strings.ContainsAny(alias, "*?!") || seen[alias] {
+				continue
+			}
+			seen[alias] = true
+			*aliases = append(*aliases, alias)
+		}
+		for _, node := range block.Nodes {
+			if include, ok := node.(*sshconfig.Include); ok {
+				for _, included := range includedConfigs(include) {
+					collectAliases(included, seen, aliases)
+				}
+			}
+		}
+	}
+}
+
+// includedConfigs parses the files of an Include directive again: the
+// parser keeps them private. They were parsed once already, so they are
+// valid and the nesting is bounded.
+func includedConfigs(include *sshconfig.Include) []*sshconfig.Config {
+	line, _, _ := strings.Cut(include.String(), "#")
+	fields := strings.Fields(line)
+	if len(fields) < 2 {
+		return nil
+	}
+	homeDir, _ := os.UserHomeDir()
+	var configs []*sshconfig.Config
+	for _, directive := range fields[1:] {
+		pattern := expandHome(directive)
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(homeDir, ".ssh", pattern)
+		}
+		matches, _ := filepath.Glob(pattern)
+		for _, match := range matches {
+			data, err := os.ReadFile(match)
+			if err != nil {
+				continue
+			}
+			if cfg, err := sshconfig.DecodeBytes(data); err == nil {
+				configs = append(configs, cfg)
+			}
+		}
+	}
+	return configs
+}
+
+// expandTokens expands ~ and the ssh_config tokens of a path: %d (home
+// directory), %h (host name), %r (remote user, the local user when unset),
+// %u (local user) and %%
+func expandTokens(path, hostName, remoteUser string) string {
+	homeDir, _ := os.UserHomeDir()
+	localUser := ""
+	if u, err := user.Current(); err == nil {
+		localUser = u.Username
+	}
+	if remoteUser == "" {
+		remoteUser = localUser
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(path); i++ {
+		if path[i] != '%' || i+1 == len(path) {
+			b.WriteByte(path[i])
+			continue
+		}
+		i++
+		switch path[i] {
+		case 'd':
+			b.WriteString(homeDir)
+		case 'h':
+			b.WriteString(hostName)
+		case 'r':
+			b.WriteString(remoteUser)
+		case 'u':
+			b.WriteString(localUser)
+		case '%':
+			b.WriteByte('%')
+		default:
+			b.WriteByte('%')
+			b.WriteByte(path[i])
+		}
+	}
+	return expandHome(b.String())
+}
+
+// expandHome replaces a leading ~/ with the home directory
+func expandHome(path string) string {
+	if rest, ok := strings.CutPrefix(path, "~/"); ok {
+		if homeDir, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(homeDir, rest)
+		}
+	}
+	return path
+}
+
+// applySSHConfig resolves the settings of c from the ssh_config entry of
+// its host, like plain ssh: an alias is replaced by its HostName, and User,
+// Port, IdentityFile and ProxyJump fill the settings left empty. Applied
+// once: the host is then the resolved name.
+func (c *Client) applySSHConfig() error {
+	if c.sshConfigApplied || c.opts.sshConfigPath == "" {
+		return nil
+	}
+	cfg, err := LoadSSHConfig(c.opts.sshConfigPath)
+	if err != nil {
+		return fmt.Errorf("failed to read SSH config: %w", err)
+	}
+
+	alias := c.Host
+	host, err := cfg.Lookup(alias)
+	if err != nil {
+		return fmt.Errorf("invalid SSH config for %s in %s: %w", alias, c.opts.sshConfigPath, err)
+	}
+	if host.HostName != "" {
+		c.Host = host.HostName
+	}
+	if c.User == "" {
+		c.User = host.User
+	}
+	if c.defaultPort && host.Port != 0 {
+		c.Port = host.Port
+	}
+	if c.KeyPath == "" {
+		c.KeyPath = host.IdentityFile
+	}
+	if len(c.opts.proxyJump) == 0 && host.ProxyJump != "" {
+		hops, err := config.ParseProxyJump(host.ProxyJump)
+		if err != nil {
+			return fmt.Errorf("invalid ProxyJump for %s in %s: %w", alias, c.opts.sshConfigPath, err)
+		}
+		c.opts.proxyJump = make([]JumpHost, len(hops))
+		for i, hop := range hops {
+			c.opts.proxyJump[i] = JumpHost{Host: hop.Host, User: hop.User, Port: hop.Port, KeyPath: hop.KeyPath}
+		}
+	}
+	c.sshConfigApplied = true
+	return nil
+}
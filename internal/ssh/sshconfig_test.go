@@ -0,0 +1,225 @@
+package ssh
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+// writeSSHConfig writes files under a temporary ~/.ssh and returns the path
+// of the main config
+func writeSSHConfig(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return filepath.Join(dir, "config")
+}
+
+func TestLoadSSHConfig_Lookup(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	included := writeSSHConfig(t, map[string]string{
+		"10-bastion.conf": `Host bastion
+  HostName bastion.example.com
+  User ops
+`,
+		"20-prod.conf": `Host prod
+  Port 2022
+  HostName ignored.example.com
+`,
+	})
+	path := writeSSHConfig(t, map[string]string{
+		"config": `# Team servers
+Include ` + filepath.Join(filepath.Dir(included), "*.conf") + `
+
+Host prod
+    HostName 51.210.0.10
+    User deploy
+    IdentityFile ~/.ssh/prod_ed25519
+
+Host staging !staging-old
+  HostName=%h.example.com
+  Port = 2222
+
+Host Web1
+  HostName web1.example.com
+
+Match host prod
+  User ignored
+
+Host *.internal
+  ProxyJump bastion
+  IdentityFile "%d/.ssh/internal key"
+
+Host *
+  User fallback
+  Port 2200
+`,
+	})
+
+	cfg, err := LoadSSHConfig(path)
+	if err != nil {
+		t.Fatalf("LoadSSHConfig() error: %v", err)
+	}
+
+	tests := map[string]SSHHostConfig{
+		// The included file comes first: its values win
+		"prod":    {HostName: "ignored.example.com", User: "deploy", Port: 2022, IdentityFile: filepath.Join(home, ".ssh", "prod_ed25519")},
+		"staging": {HostName: "staging.example.com", User: "fallback", Port: 2222},
+		// Negated pattern: the staging block does not apply
+		"staging-old": {User: "fallback", Port: 2200},
+		"db.internal": {User: "fallback", Port: 2200, ProxyJump: "bastion", IdentityFile: filepath.Join(home, ".ssh", "internal key")},
+		"bastion":     {HostName: "bastion.example.com", User: "ops", Port: 2200},
+		// Aliases are matched as written
+		"Web1": {HostName: "web1.example.com", User: "fallback", Port: 2200},
+	}
+	for alias, want := range tests {
+		if got, err := cfg.Lookup(alias); err != nil || got != want {
+			t.Errorf("Lookup(%q) = %+v, %v, want %+v", alias, got, err, want)
+		}
+	}
+
+	wantAliases := []string{"bastion", "prod", "staging", "Web1"}
+	if got := cfg.Aliases(); !reflect.DeepEqual(got, wantAliases) {
+		t.Errorf("Aliases() = %v, want %v", got, wantAliases)
+	}
+}
+
+func TestLoadSSHConfig_IncludeInsideHostBlock(t *testing.T) {
+	dir := filepath.Dir(writeSSHConfig(t, map[string]string{
+		// Lines before the first Host belong to the including block
+		"prod.conf": `HostName 10.0.0.5
+Host other
+  User other
+`,
+		"match.conf": `Host staging
+  User staging
+`,
+	}))
+	path := writeSSHConfig(t, map[string]string{
+		"config": `Host prod other
+  Include ` + filepath.Join(dir, "prod.conf") + `
+  User deploy
+
+Match host staging
+  Include ` + filepath.Join(dir, "match.conf") + `
+`,
+	})
+
+	cfg, err := LoadSSHConfig(path)
+	if err != nil {
+		t.Fatalf("LoadSSHConfig() error: %v", err)
+	}
+	if got, _ := cfg.Lookup("prod"); got.HostName != "10.0.0.5" || got.User != "deploy" {
+		t.Errorf("Lookup(prod) = %+v", got)
+	}
+	// An included file only applies when the including block matches
+	if got, _ := cfg.Lookup("other"); got.User != "other" || got.HostName != "10.0.0.5" {
+		t.Errorf("Lookup(other) = %+v", got)
+	}
+	if got, _ := cfg.Lookup("staging"); got.User != "staging" {
+		t.Errorf("Lookup(staging) = %+v", got)
+	}
+	if got, _ := cfg.Lookup("unrelated"); got != (SSHHostConfig{}) {
+		t.Errorf("Lookup(unrelated) = %+v", got)
+	}
+}
+
+func TestLoadSSHConfig_Errors(t *testing.T) {
+	cfg, err := LoadSSHConfig(filepath.Join(t.TempDir(), "missing"))
+	if err != nil || len(cfg.Aliases()) != 0 {
+		t.Errorf("a missing file should be an empty config, got %v, %v", cfg, err)
+	}
+
+	// Match exec would run a command: the parser refuses it
+	matchExec := writeSSHConfig(t, map[string]string{"config": "Match exec \"true\"\n  User root\n"})
+	loop := writeSSHConfig(t, map[string]string{"config": ""})
+	if err := os.WriteFile(loop, []byte("Include "+loop+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	for name, path := range map[string]string{"match exec": matchExec, "include loop": loop} {
+		if _, err := LoadSSHConfig(path); err == nil {
+			t.Errorf("%s: LoadSSHConfig() should fail", name)
+		}
+	}
+
+	cfg, err = LoadSSHConfig(writeSSHConfig(t, map[string]string{"config": "Host prod\n  Port ssh\n"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cfg.Lookup("prod"); err == nil {
+		t.Error("Lookup() should fail on an invalid port")
+	}
+}
+
+func TestConnect_ResolvesFromSSHConfig(t *testing.T) {
+	bastionKey, bastionSigner := writeKeyPair(t, t.TempDir(), "")
+	targetKey, targetSigner := writeKeyPair(t, t.TempDir(), "")
+	bastion := startTestServer(t, bastionSigner.PublicKey(), echoHandler)
+	target := startTestServer(t, targetSigner.PublicKey(), echoHandler)
+	jumpTestEnv(t, bastion.KnownHostsLine(), target.KnownHostsLine())
+
+	path := writeSSHConfig(t, map[string]string{"config": `
+Host myapp
+  HostName 127.0.0.1
+  User deploy
+  Port ` + strconv.Itoa(target.Port()) + `
+  IdentityFile ` + targetKey + `
+  ProxyJump ops@gate
+
+Host gate
+  HostName 127.0.0.1
+  Port ` + strconv.Itoa(bastion.Port()) + `
+  IdentityFile ` + bastionKey + `
+`})
+
+	// Only the alias is given: everything else comes from the file
+	client := NewClient("myapp", "", 0, "", WithRetries(1), WithSSHConfig(path))
+	if err := client.Connect(); err != nil {
+		t.Fatalf("Connect() error: %v", err)
+	}
+	defer client.Close()
+
+	if client.Host != "127.0.0.1" || client.User != "deploy" || client.Port != target.Port() || client.KeyPath != targetKey {
+		t.Errorf("client not resolved from ssh_config: %s@%s:%d key %s", client.User, client.Host, client.Port, client.KeyPath)
+	}
+	if result, err := client.Exec(context.Background(), "id"); err != nil || result.Stdout != "ran: id" {
+		t.Fatalf("Exec() = %+v, %v", result, err)
+	}
+	if got := bastion.Forwarded(); !reflect.DeepEqual(got, []string{target.Addr}) {
+		t.Errorf("bastion forwarded %v, want [%s]", got, target.Addr)
+	}
+}
+
+func TestConnect_ExplicitSettingsWinOverSSHConfig(t *testing.T) {
+	keyPath, signer := writeKeyPair(t, t.TempDir(), "")
+	target := startTestServer(t, signer.PublicKey(), echoHandler)
+	jumpTestEnv(t, target.KnownHostsLine())
+
+	path := writeSSHConfig(t, map[string]string{"config": `
+Host 127.0.0.1
+  User wrong
+  Port 1
+  IdentityFile /nonexistent
+`})
+
+	client := NewClient("127.0.0.1", "deploy", target.Port(), keyPath, WithRetries(1), WithSSHConfig(path))
+	if err := client.Connect(); err != nil {
+		t.Fatalf("Connect() error: %v", err)
+	}
+	client.Close()
+	if client.User != "deploy" || client.Port != target.Port() || client.KeyPath != keyPath {
+		t.Errorf("explicit settings overridden by ssh_config: %s:%d %s", client.User, client.Port, client.KeyPath)
+	}
+}
@@ -0,0 +1,268 @@
+package ssh
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"net"
+	"os/exec"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// execHandler runs a command of the test server and returns its exit code
+type execHandler func(command string, stdin io.Reader, stdout, stderr io.Writer) int
+
+// echoHandler prints the command it runs
+func echoHandler(command string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fmt.Fprintf(stdout, "ran: %s", command)
+	return 0
+}
+
+// shellHandler runs the command with the local sh, like sshd would
+func shellHandler(command string, stdin io.Reader, stdout, stderr io.Writer) int {
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = stdin, stdout, stderr
+	if err := cmd.Run(); err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			return exitErr.ExitCode()
+		}
+		return 255
+	}
+	return 0
+}
+
+// testServer is an in-process SSH server accepting one user key, and the
+// user certificates signed by that key. It runs
+// exec requests with its handler, serves the sftp subsystem on the local
+// filesystem and, like a jump host, forwards direct-tcpip channels.
+type testServer struct {
+	Addr    string
+	HostKey ssh.Signer
+
+	mu        sync.Mutex
+	forwarded []string
+	commands  []string
+	agentKeys []string
+}
+
+// startTestServer starts a test server on a random local port, stopped at
+// the end of the test
+func startTestServer(t *testing.T, authorized ssh.PublicKey, handler execHandler) *testServer {
+	t.Helper()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate host key: %v", err)
+	}
+	hostKey, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatalf("failed to create host signer: %v", err)
+	}
+
+	// authorized is also trusted as a user certificate authority
+	checker := &ssh.CertChecker{
+		IsUserAuthority: func(auth ssh.PublicKey) bool {
+			return bytes.Equal(auth.Marshal(), authorized.Marshal())
+		},
+	}
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if _, ok := key.(*ssh.Certificate); ok {
+				return checker.Authenticate(conn, key)
+			}
+			if bytes.Equal(key.Marshal(), authorized.Marshal()) {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("unknown key for %s", conn.User())
+		},
+	}
+	config.AddHostKey(hostKey)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	s := &testServer{Addr: listener.Addr().String(), HostKey: hostKey}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn, config, handler)
+		}
+	}()
+	return s
+}
+
+// Port returns the port the server listens on
+func (s *testServer) Port() int {
+	_, port, _ := net.SplitHostPort(s.Addr)
+	n, _ := strconv.Atoi(port)
+	return n
+}
+
+// KnownHostsLine returns the known_hosts line of the server
+func (s *testServer) KnownHostsLine() string {
+	return knownhosts.Line([]string{knownhosts.Normalize(s.Addr)}, s.HostKey.PublicKey())
+}
+
+// Forwarded returns the addresses the server tunnelled connections to
+func (s *testServer) Forwarded() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.forwarded...)
+}
+
+// Commands returns the commands the server ran
+func (s *testServer) Commands() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.commands...)
+}
+
+func (s *testServer) serve(conn net.Conn, config *ssh.ServerConfig, handler execHandler) {
+	sshConn, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	defer sshConn.Close()
+	go ssh.DiscardRequests(reqs)
+
+	for newChannel := range chans {
+		switch newChannel.ChannelType() {
+		case "session":
+			go s.serveSession(sshConn, newChannel, handler)
+		case "direct-tcpip":
+			go s.forward(newChannel)
+		default:
+			newChannel.Reject(ssh.UnknownChannelType, "unsupported channel type")
+		}
+	}
+}
+
+func (s *testServer) serveSession(conn ssh.Conn, newChannel ssh.NewChannel, handler execHandler) {
+	channel, requests, err := newChannel.Accept()
+	if err != nil {
+		return
+	}
+	defer channel.Close()
+
+	agentForwarded := false
+	for req := range requests {
+		if req.Type == "auth-agent-req@openssh.com" {
+			agentForwarded = true
+			req.Reply(true, nil)
+			continue
+		}
+		if req.Type == "subsystem" {
+			var payload struct{ Name string }
+			if err := ssh.Unmarshal(req.Payload, &payload); err != nil || payload.Name != "sftp" {
+				req.Reply(false, nil)
+				continue
+			}
+			req.Reply(true, nil)
+			go ssh.DiscardRequests(requests)
+			if server, err := sftp.NewServer(channel); err == nil {
+				server.Serve()
+			}
+			return
+		}
+		if req.Type != "exec" {
+			req.Reply(false, nil)
+			continue
+		}
+		var payload struct{ Command string }
+		if err := ssh.Unmarshal(req.Payload, &payload); err != nil {
+			req.Reply(false, nil)
+			continue
+		}
+		req.Reply(true, nil)
+
+		s.mu.Lock()
+		s.commands = append(s.commands, payload.Command)
+		s.mu.Unlock()
+		if agentForwarded {
+			s.listAgentKeys(conn)
+		}
+
+		code := handler(payload.Command, channel, channel, channel.Stderr())
+		channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{uint32(code)}))
+		return
+	}
+}
+
+// AgentKeys returns the keys of the agents forwarded to the commands run
+func (s *testServer) AgentKeys() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.agentKeys...)
+}
+
+// listAgentKeys lists the keys of the forwarded agent, like ssh-add -l
+func (s *testServer) listAgentKeys(conn ssh.Conn) {
+	channel, requests, err := conn.OpenChannel("auth-agent@openssh.com", nil)
+	if err != nil {
+		return
+	}
+	defer channel.Close()
+	go ssh.DiscardRequests(requests)
+
+	keys, err := agent.NewClient(channel).List()
+	if err != nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, key := range keys {
+		s.agentKeys = append(s.agentKeys, key.Comment)
+	}
+}
+
+func (s *testServer) forward(newChannel ssh.NewChannel) {
+	var payload struct {
+		Host       string
+		Port       uint32
+		OriginHost string
+		OriginPort uint32
+	}
+	if err := ssh.Unmarshal(newChannel.ExtraData(), &payload); err != nil {
+		newChannel.Reject(ssh.Prohibited, "invalid payload")
+		return
+	}
+	addr := net.JoinHostPort(payload.Host, strconv.Itoa(int(payload.Port)))
+	target, err := net.Dial("tcp", addr)
+	if err != nil {
+		newChannel.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+	channel, requests, err := newChannel.Accept()
+	if err != nil {
+		target.Close()
+		return
+	}
+	go ssh.DiscardRequests(requests)
+
+	s.mu.Lock()
+	s.forwarded = append(s.forwarded, addr)
+	s.mu.Unlock()
+
+	go func() {
+		io.Copy(target, channel)
+		target.(*net.TCPConn).CloseWrite()
+	}()
+	io.Copy(channel, target)
+	channel.Close()
+	target.Close()
+}
@@ -0,0 +1,454 @@
+package ssh
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// transferWorkers bounds the files a sync handles at once over its SFTP
+// session: small files cost round trips rather than bandwidth
+const transferWorkers = 16
+
+// TransferProgress is the state of an upload
+type TransferProgress struct {
+	// File is the file being uploaded, relative to the directory for a sync
+	File string
+	// Done is the number of bytes uploaded so far, out of Total
+	Done  int64
+	Total int64
+}
+
+// ProgressFunc receives the progress of an upload. It may be called from
+// several goroutines, never at once.
+type ProgressFunc func(TransferProgress)
+
+// SyncOptions configures SyncDir
+type SyncOptions struct {
+	// Exclude leaves out a path (slash separated, relative to the local
+	// directory); an excluded directory is left out with its content. Its
+	// remote copy is deleted like any path not sent.
+	Exclude func(rel string, isDir bool) bool
+	// Progress receives the progress of the uploads
+	Progress ProgressFunc
+}
+
+// SyncStats sums up what SyncDir did
+type SyncStats struct {
+	Uploaded  int
+	Unchanged int
+	Deleted   int
+	Bytes     int64
+}
+
+// Transferer is an Executor able to upload files through its connection
+type Transferer interface {
+	Executor
+	Upload(ctx context.Context, localPath, remotePath string, progress ProgressFunc) error
+	SyncDir(ctx context.Context, localDir, remoteDir string, opts SyncOptions) (*SyncStats, error)
+}
+
+// Upload copies a local file to remotePath over SFTP. The file is written
+// under a temporary name in the same directory then renamed: remotePath is
+// never seen half-written, and a failed upload leaves it untouched.
+func (c *Client) Upload(ctx context.Context, localPath, remotePath string, progress ProgressFunc) error {
+	file, err := os.Open(localPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	sftp, err := c.openSFTP(ctx)
+	if err != nil {
+		return err
+	}
+	defer sftp.Close()
+	stop := context.AfterFunc(ctx, func() { sftp.Close() })
+	defer stop()
+
+	if err := sftp.MkdirAll(path.Dir(remotePath)); err != nil {
+		return ctxErr(ctx, err)
+	}
+	report := newProgressReporter(progress, info.Size())
+	var last int64
+	err = uploadAtomic(sftp, localPath, remotePath, info, func(written int64) {
+		report.add(path.Base(remotePath), written-last)
+		last = written
+	})
+	return ctxErr(ctx, err)
+}
+
+// SyncDir makes remoteDir a copy of localDir over SFTP, uploading only what
+// changed: a file is sent again when its size or modification time differs
+// (the remote copy gets the local time). Remote paths not in localDir, or
+// excluded, are deleted. Each file is uploaded atomically, see Upload.
+func (c *Client) SyncDir(ctx context.Context, localDir, remoteDir string, opts SyncOptions) (*SyncStats, error) {
+	local, err := scanLocalDir(localDir, opts.Exclude)
+	if err != nil {
+		return nil, err
+	}
+
+	sftp, err := c.openSFTP(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer sftp.Close()
+	stop := context.AfterFunc(ctx, func() { sftp.Close() })
+	defer stop()
+
+	stats, err := syncDir(ctx, sftp, local, remoteDir, opts.Progress)
+	return stats, ctxErr(ctx, err)
+}
+
+// openSFTP starts an SFTP session, connecting first when needed
+func (c *Client) openSFTP(ctx context.Context) (*SFTPClient, error) {
+	if c.client == nil {
+		if err := c.Connect(); err != nil {
+			return nil, err
+		}
+	}
+	return c.NewSFTP(ctx)
+}
+
+// ctxErr returns the error of a cancelled ctx over err: closing the
+// session on cancellation fails the pending requests with a less telling
+// error
+func ctxErr(ctx context.Context, err error) error {
+	if err != nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+// localEntry is a path of the directory to sync
+type localEntry struct {
+	rel  string
+	path string
+	info fs.FileInfo
+	link string
+}
+
+// scanLocalDir lists the directories, regular files and symlinks under
+// root, minus the excluded paths
+func scanLocalDir(root string, exclude func(string, bool) bool) ([]localEntry, error) {
+	var entries []localEntry
+	err := filepath.WalkDir(root, func(p string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p == root {
+			return nil
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if exclude != nil && exclude(rel, entry.IsDir()) {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		e := localEntry{rel: rel, path: p, info: info}
+		switch {
+		case info.Mode()&fs.ModeSymlink != 0:
+			if e.link, err = os.Readlink(p); err != nil {
+				return err
+			}
+		case !info.IsDir() && !info.Mode().IsRegular():
+			// Sockets, devices and pipes are not sent
+			return nil
+		}
+		entries = append(entries, e)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan %s: %w", root, err)
+	}
+	return entries, nil
+}
+
+// syncDir applies the local entries to remoteDir
+func syncDir(ctx context.Context, sftp *SFTPClient, local []localEntry, remoteDir string, progress ProgressFunc) (*SyncStats, error) {
+	if err := sftp.MkdirAll(remoteDir); err != nil {
+		return nil, err
+	}
+	remote, err := scanRemoteDir(ctx, sftp, remoteDir)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &SyncStats{}
+	wanted := make(map[string]localEntry, len(local))
+	for _, e := range local {
+		wanted[e.rel] = e
+	}
+
+	// Delete what is not sent or changed kind, parents before children:
+	// removing a directory removes its content
+	var stale []string
+	for rel, info := range remote {
+		if e, ok := wanted[rel]; !ok || fileKind(e.info.Mode()) != fileKind(info.Mode()) {
+			stale = append(stale, rel)
+		}
+	}
+	sort.Strings(stale)
+	var removed []string
+	for _, rel := range stale {
+		if underAny(rel, removed) {
+			continue
+		}
+		if err := sftp.RemoveAll(path.Join(remoteDir, rel)); err != nil {
+			return stats, err
+		}
+		removed = append(removed, rel)
+		stats.Deleted++
+	}
+	for rel := range remote {
+		if underAny(rel, removed) {
+			delete(remote, rel)
+		}
+	}
+
+	// Directories, one depth at a time so parents exist first
+	byDepth := map[int][]localEntry{}
+	var files, links []localEntry
+	for _, e := range local {
+		_, exists := remote[e.rel]
+		switch {
+		case e.info.IsDir() && !exists:
+			depth := strings.Count(e.rel, "/")
+			byDepth[depth] = append(byDepth[depth], e)
+		case e.info.IsDir():
+		case e.link != "":
+			links = append(links, e)
+		default:
+			files = append(files, e)
+		}
+	}
+	depths := make([]int, 0, len(byDepth))
+	for depth := range byDepth {
+		depths = append(depths, depth)
+	}
+	sort.Ints(depths)
+	for _, depth := range depths {
+		err := forEach(ctx, byDepth[depth], func(e localEntry) error {
+			return sftp.Mkdir(path.Join(remoteDir, e.rel))
+		})
+		if err != nil {
+			return stats, err
+		}
+	}
+
+	err = forEach(ctx, links, func(e localEntry) error {
+		target := path.Join(remoteDir, e.rel)
+		if _, exists := remote[e.rel]; exists {
+			if current, err := sftp.ReadLink(target); err == nil && current == e.link {
+				return nil
+			}
+			if err := sftp.Remove(target); err != nil {
+				return err
+			}
+		}
+		return sftp.Symlink(e.link, target)
+	})
+	if err != nil {
+		return stats, err
+	}
+
+	// Files: upload what changed, fix the permissions of the others
+	var changed []localEntry
+	var total int64
+	for _, e := range files {
+		info, exists := remote[e.rel]
+		switch {
+		case !exists || info.Size() != e.info.Size() || info.ModTime().Unix() != e.info.ModTime().Unix():
+			changed = append(changed, e)
+			total += e.info.Size()
+		case info.Mode().Perm() != e.info.Mode().Perm():
+			if err := sftp.SetAttrs(path.Join(remoteDir, e.rel), e.info.Mode().Perm(), time.Time{}); err != nil {
+				return stats, err
+			}
+			stats.Unchanged++
+		default:
+			stats.Unchanged++
+		}
+	}
+
+	report := newProgressReporter(progress, total)
+	var mu sync.Mutex
+	err = forEach(ctx, changed, func(e localEntry) error {
+		var last int64
+		err := uploadAtomic(sftp, e.path, path.Join(remoteDir, e.rel), e.info, func(written int64) {
+			report.add(e.rel, written-last)
+			last = written
+		})
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		stats.Uploaded++
+		stats.Bytes += e.info.Size()
+		mu.Unlock()
+		return nil
+	})
+	return stats, err
+}
+
+// uploadAtomic writes a local file under a temporary name next to
+// remotePath, sets its permissions and modification time, then renames it
+func uploadAtomic(sftp *SFTPClient, localPath, remotePath string, info fs.FileInfo, progress func(written int64)) error {
+	file, err := os.Open(localPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	tmpPath := tempPath(remotePath)
+	if err := sftp.WriteFile(tmpPath, file, info.Mode().Perm(), progress); err != nil {
+		sftp.Remove(tmpPath)
+		return err
+	}
+	// The modification time last: writing the data sets it
+	if err := sftp.SetAttrs(tmpPath, 0, info.ModTime()); err != nil {
+		sftp.Remove(tmpPath)
+		return err
+	}
+	if err := sftp.Rename(tmpPath, remotePath); err != nil {
+		sftp.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
+
+// tempPath returns a hidden, unique name next to remotePath
+func tempPath(remotePath string) string {
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	return path.Join(path.Dir(remotePath), fmt.Sprintf(".%s.%s.tmp", path.Base(remotePath), hex.EncodeToString(suffix)))
+}
+
+// scanRemoteDir lists the paths under root, one directory level at a time
+func scanRemoteDir(ctx context.Context, sftp *SFTPClient, root string) (map[string]fs.FileInfo, error) {
+	entries := map[string]fs.FileInfo{}
+	var mu sync.Mutex
+	level := []string{""}
+	for len(level) > 0 {
+		var next []string
+		err := forEach(ctx, level, func(rel string) error {
+			children, err := sftp.ReadDir(path.Join(root, rel))
+			if err != nil {
+				return err
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			for _, child := range children {
+				childRel := path.Join(rel, child.Name())
+				entries[childRel] = child
+				if child.IsDir() {
+					next = append(next, childRel)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		level = next
+	}
+	return entries, nil
+}
+
+// forEach runs fn on the items, transferWorkers at once, and returns the
+// first error. No item starts once an item failed or ctx is done.
+func forEach[T any](ctx context.Context, items []T, fn func(T) error) error {
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+	)
+	slots := make(chan struct{}, transferWorkers)
+	for _, item := range items {
+		slots <- struct{}{}
+		mu.Lock()
+		failed := firstErr != nil
+		mu.Unlock()
+		if failed || ctx.Err() != nil {
+			<-slots
+			break
+		}
+		wg.Add(1)
+		go func(item T) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			if err := fn(item); err != nil {
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				mu.Unlock()
+			}
+		}(item)
+	}
+	wg.Wait()
+	if firstErr == nil {
+		return ctx.Err()
+	}
+	return firstErr
+}
+
+// fileKind is the type bits of a mode: directory, symlink or regular file
+func fileKind(mode fs.FileMode) fs.FileMode {
+	return mode & (fs.ModeDir | fs.ModeSymlink | fs.ModeIrregular)
+}
+
+// underAny reports whether rel is one of dirs or inside one of them
+func underAny(rel string, dirs []string) bool {
+	for _, dir := range dirs {
+		if rel == dir || strings.HasPrefix(rel, dir+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// progressReporter sums the bytes uploaded by concurrent writes
+type progressReporter struct {
+	fn    ProgressFunc
+	total int64
+	mu    sync.Mutex
+	done  int64
+}
+
+func newProgressReporter(fn ProgressFunc, total int64) *progressReporter {
+	return &progressReporter{fn: fn, total: total}
+}
+
+// add counts n more bytes of file
+func (r *progressReporter) add(file string, n int64) {
+	if r.fn == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.done += n
+	r.fn(TransferProgress{File: file, Done: r.done, Total: r.total})
+}
@@ -0,0 +1,231 @@
+package ssh
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeTree writes files (slash separated names) under root
+func writeTree(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// readTree returns the regular files under root with their content
+func readTree(t *testing.T, root string) map[string]string {
+	t.Helper()
+	files := map[string]string{}
+	err := filepath.WalkDir(root, func(p string, entry os.DirEntry, err error) error {
+		if err != nil || !entry.Type().IsRegular() {
+			return err
+		}
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(root, p)
+		files[filepath.ToSlash(rel)] = string(data)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func TestClientUpload(t *testing.T) {
+	client, _ := connectTestClient(t, echoHandler)
+	local := filepath.Join(t.TempDir(), "image.tar")
+	data := bytes.Repeat([]byte("layer"), 50000) // several chunks
+	if err := os.WriteFile(local, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	remoteDir := t.TempDir()
+	remote := filepath.Join(remoteDir, "nested", "image.tar")
+
+	var last TransferProgress
+	calls := 0
+	err := client.Upload(context.Background(), local, remote, func(p TransferProgress) {
+		calls++
+		last = p
+	})
+	if err != nil {
+		t.Fatalf("Upload() error: %v", err)
+	}
+	got, err := os.ReadFile(remote)
+	if err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("uploaded file differs (%d bytes, %v)", len(got), err)
+	}
+	if calls < 2 || last.Done != int64(len(data)) || last.Total != int64(len(data)) || last.File != "image.tar" {
+		t.Errorf("progress = %d calls, last %+v", calls, last)
+	}
+	// Only the final file is left: the temporary name was renamed
+	entries, _ := os.ReadDir(filepath.Join(remoteDir, "nested"))
+	if len(entries) != 1 {
+		t.Errorf("expected only image.tar in the remote directory, got %v", entries)
+	}
+
+	// Uploading again replaces the file
+	if err := os.WriteFile(local, []byte("v2"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Upload(context.Background(), local, remote, nil); err != nil {
+		t.Fatalf("second Upload() error: %v", err)
+	}
+	if got, _ := os.ReadFile(remote); string(got) != "v2" {
+		t.Errorf("Upload() should replace the file, got %q", got)
+	}
+}
+
+func TestClientUpload_FailureKeepsTarget(t *testing.T) {
+	client, _ := connectTestClient(t, echoHandler)
+	remote := filepath.Join(t.TempDir(), "app.tar")
+	if err := os.WriteFile(remote, []byte("previous"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	local := filepath.Join(t.TempDir(), "app.tar")
+	if err := os.WriteFile(local, []byte("next"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Upload(ctx, local, remote, nil); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Upload() with a cancelled context = %v, want context.Canceled", err)
+	}
+	if got, _ := os.ReadFile(remote); string(got) != "previous" {
+		t.Errorf("a failed upload must leave the target untouched, got %q", got)
+	}
+}
+
+func TestClientSyncDir(t *testing.T) {
+	client, _ := connectTestClient(t, echoHandler)
+	local := t.TempDir()
+	writeTree(t, local, map[string]string{
+		"composer.json":        "{}",
+		"src/Kernel.php":       "<?php",
+		"src/Controller/A.php": "<?php // A",
+		"bin/console":          "#!/usr/bin/env php",
+		"vendor/autoload.php":  "excluded",
+	})
+	if err := os.Chmod(filepath.Join(local, "bin", "console"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("Kernel.php", filepath.Join(local, "src", "link.php")); err != nil {
+		t.Fatal(err)
+	}
+	remote := filepath.Join(t.TempDir(), "build")
+	writeTree(t, remote, map[string]string{"stale/file.txt": "from a previous build"})
+
+	opts := SyncOptions{Exclude: func(rel string, isDir bool) bool { return rel == "vendor" }}
+	stats, err := client.SyncDir(context.Background(), local, remote, opts)
+	if err != nil {
+		t.Fatalf("SyncDir() error: %v", err)
+	}
+	want := map[string]string{
+		"composer.json":        "{}",
+		"src/Kernel.php":       "<?php",
+		"src/Controller/A.php": "<?php // A",
+		"bin/console":          "#!/usr/bin/env php",
+	}
+	if got := readTree(t, remote); !reflect.DeepEqual(got, want) {
+		t.Errorf("remote tree = %v, want %v", got, want)
+	}
+	if stats.Uploaded != 4 || stats.Deleted != 1 {
+		t.Errorf("first sync stats = %+v, want 4 uploaded, 1 deleted", stats)
+	}
+	if info, err := os.Stat(filepath.Join(remote, "bin", "console")); err != nil || info.Mode().Perm() != 0755 {
+		t.Errorf("bin/console should keep its mode, got %v (%v)", info.Mode(), err)
+	}
+	if target, err := os.Readlink(filepath.Join(remote, "src", "link.php")); err != nil || target != "Kernel.php" {
+		t.Errorf("symlink = %q, %v", target, err)
+	}
+
+	// Nothing changed: nothing is uploaded
+	stats, err = client.SyncDir(context.Background(), local, remote, opts)
+	if err != nil {
+		t.Fatalf("second SyncDir() error: %v", err)
+	}
+	if stats.Uploaded != 0 || stats.Deleted != 0 || stats.Unchanged != 4 {
+		t.Errorf("unchanged sync stats = %+v, want 4 unchanged only", stats)
+	}
+
+	// Only the changed file is uploaded, the removed one is deleted
+	later := time.Now().Add(time.Hour)
+	writeTree(t, local, map[string]string{"src/Kernel.php": "<?php // v2"})
+	os.Chtimes(filepath.Join(local, "src", "Kernel.php"), later, later)
+	os.Remove(filepath.Join(local, "src", "Controller", "A.php"))
+	var files []string
+	opts.Progress = func(p TransferProgress) { files = append(files, p.File) }
+	stats, err = client.SyncDir(context.Background(), local, remote, opts)
+	if err != nil {
+		t.Fatalf("third SyncDir() error: %v", err)
+	}
+	if stats.Uploaded != 1 || stats.Deleted != 1 {
+		t.Errorf("incremental sync stats = %+v, want 1 uploaded, 1 deleted", stats)
+	}
+	if got, _ := os.ReadFile(filepath.Join(remote, "src", "Kernel.php")); string(got) != "<?php // v2" {
+		t.Errorf("Kernel.php = %q", got)
+	}
+	if _, err := os.Stat(filepath.Join(remote, "src", "Controller", "A.php")); !os.IsNotExist(err) {
+		t.Error("a file removed locally should be deleted on the server")
+	}
+	if len(files) == 0 || files[len(files)-1] != "src/Kernel.php" {
+		t.Errorf("progress files = %v", files)
+	}
+}
+
+func TestClientSyncDir_ReplacesChangedKind(t *testing.T) {
+	client, _ := connectTestClient(t, echoHandler)
+	local := t.TempDir()
+	writeTree(t, local, map[string]string{"config": "now a file"})
+	remote := t.TempDir()
+	writeTree(t, remote, map[string]string{"config/packages/app.yaml": "was a directory"})
+
+	if _, err := client.SyncDir(context.Background(), local, remote, SyncOptions{}); err != nil {
+		t.Fatalf("SyncDir() error: %v", err)
+	}
+	if got := readTree(t, remote); !reflect.DeepEqual(got, map[string]string{"config": "now a file"}) {
+		t.Errorf("remote tree = %v", got)
+	}
+}
+
+func TestScanLocalDir_Exclude(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, map[string]string{
+		"a.txt":          "",
+		"node_modules/x": "",
+		"src/b.txt":      "",
+		"src/c.log":      "",
+	})
+	entries, err := scanLocalDir(root, func(rel string, isDir bool) bool {
+		return rel == "node_modules" || strings.HasSuffix(rel, ".log")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rels []string
+	for _, e := range entries {
+		rels = append(rels, e.rel)
+	}
+	sort.Strings(rels)
+	if want := []string{"a.txt", "src", "src/b.txt"}; !reflect.DeepEqual(rels, want) {
+		t.Errorf("scanLocalDir() = %v, want %v", rels, want)
+	}
+}
@@ -0,0 +1,137 @@
+package ssh
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Tunneler is an Executor able to expose an address of the server side
+// locally, through the SSH connection
+type Tunneler interface {
+	Executor
+	Forward(ctx context.Context, network, addr string) (*Tunnel, error)
+}
+
+// Tunnel forwards the connections accepted on a local unix socket to an
+// address of the server side. The socket lives in a directory private to
+// the local user: other users cannot reach the server through it.
+type Tunnel struct {
+	dir      string
+	listener net.Listener
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+}
+
+// Forward exposes addr of the server side ("tcp" or "unix" network) on a
+// local unix socket until the tunnel is closed or ctx is done
+func (c *Client) Forward(ctx context.Context, network, addr string) (*Tunnel, error) {
+	return newTunnel(ctx, func(ctx context.Context) (net.Conn, error) {
+		return c.DialContext(ctx, network, addr)
+	})
+}
+
+// newTunnel listens on a private unix socket and pipes each connection to
+// a connection opened with dial
+func newTunnel(ctx context.Context, dial func(context.Context) (net.Conn, error)) (*Tunnel, error) {
+	// MkdirTemp creates the directory with mode 0700
+	dir, err := os.MkdirTemp("", "frankendeploy-tunnel-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create tunnel directory: %w", err)
+	}
+	listener, err := net.Listen("unix", filepath.Join(dir, "tunnel.sock"))
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("failed to listen on tunnel socket: %w", err)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	t := &Tunnel{dir: dir, listener: listener, cancel: cancel}
+	t.wg.Add(1)
+	go t.serve(ctx, dial)
+	return t, nil
+}
+
+// Path returns the local socket of the tunnel
+func (t *Tunnel) Path() string {
+	return t.listener.Addr().String()
+}
+
+// URL returns the local socket as a unix:// URL (DOCKER_HOST format)
+func (t *Tunnel) URL() string {
+	return "unix://" + t.Path()
+}
+
+// Close stops the tunnel, closes the connections in progress and removes
+// the socket
+func (t *Tunnel) Close() error {
+	t.cancel()
+	err := t.listener.Close()
+	t.wg.Wait()
+	os.RemoveAll(t.dir)
+	return err
+}
+
+func (t *Tunnel) serve(ctx context.Context, dial func(context.Context) (net.Conn, error)) {
+	defer t.wg.Done()
+	go func() {
+		<-ctx.Done()
+		t.listener.Close()
+	}()
+	for {
+		local, err := t.listener.Accept()
+		if err != nil {
+			return
+		}
+		t.wg.Add(1)
+		go func() {
+			defer t.wg.Done()
+			t.pipe(ctx, local, dial)
+		}()
+	}
+}
+
+// pipe copies both ways between local and a new server side connection,
+// passing half-closes on: a client may stop writing and still read the
+// response
+func (t *Tunnel) pipe(ctx context.Context, local net.Conn, dial func(context.Context) (net.Conn, error)) {
+	defer local.Close()
+	remote, err := dial(ctx)
+	if err != nil {
+		return
+	}
+	defer remote.Close()
+
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			local.Close()
+			remote.Close()
+		case <-done:
+		}
+	}()
+	defer close(done)
+
+	var copies sync.WaitGroup
+	copies.Add(1)
+	go func() {
+		defer copies.Done()
+		io.Copy(remote, local)
+		closeWrite(remote)
+	}()
+	io.Copy(local, remote)
+	closeWrite(local)
+	copies.Wait()
+}
+
+// closeWrite half-closes conn when it supports it
+func closeWrite(conn net.Conn) {
+	if cw, ok := conn.(interface{ CloseWrite() error }); ok {
+		cw.CloseWrite()
+	}
+}
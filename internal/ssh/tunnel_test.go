@@ -0,0 +1,73 @@
+package ssh
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestClientForward(t *testing.T) {
+	client, server := connectTestClient(t, echoHandler)
+
+	// A server side service echoing what it read, once the client is done
+	service, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer service.Close()
+	go func() {
+		for {
+			conn, err := service.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				data, _ := io.ReadAll(conn)
+				conn.Write([]byte("got " + string(data)))
+			}()
+		}
+	}()
+
+	tunnel, err := client.Forward(context.Background(), "tcp", service.Addr().String())
+	if err != nil {
+		t.Fatalf("Forward() error = %v", err)
+	}
+	if tunnel.URL() != "unix://"+tunnel.Path() {
+		t.Errorf("URL() = %s", tunnel.URL())
+	}
+	info, err := os.Stat(filepath.Dir(tunnel.Path()))
+	if err != nil || info.Mode().Perm() != 0700 {
+		t.Errorf("the socket directory should be private, got %v, %v", info, err)
+	}
+
+	for i := 0; i < 2; i++ {
+		conn, err := net.Dial("unix", tunnel.Path())
+		if err != nil {
+			t.Fatalf("dial tunnel: %v", err)
+		}
+		conn.Write([]byte("ping"))
+		// The half-close reaches the service, which then answers
+		conn.(*net.UnixConn).CloseWrite()
+		reply, err := bufio.NewReader(conn).ReadString('\n')
+		if err != io.EOF || reply != "got ping" {
+			t.Errorf("reply = %q, %v", reply, err)
+		}
+		conn.Close()
+	}
+	if got := server.Forwarded(); !reflect.DeepEqual(got, []string{service.Addr().String(), service.Addr().String()}) {
+		t.Errorf("each connection should be forwarded, got %v", got)
+	}
+
+	if err := tunnel.Close(); err != nil {
+		t.Errorf("Close() error = %v", err)
+	}
+	if _, err := os.Stat(tunnel.Path()); !os.IsNotExist(err) {
+		t.Errorf("Close() should remove the socket, stat = %v", err)
+	}
+}